@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/persistence"
+	"io"
+	"sort"
+)
+
+type command func(do *state.DeviceOrganiser, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+
+var commands = map[string]command{
+	"organisation export": exportOrganisationCommand,
+	"organisation import": importOrganisationCommand,
+	"organiser fsck":      fsckOrganiserCommand,
+	"zigbee2mqtt import":  importZigbee2MQTTCommand,
+}
+
+// runCommand runs a command against the persisted data of the controller, the controller must not be running at the
+// same time. The exit code of the command is returned.
+func runCommand(args []string, section persistence.Section, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var cmd command
+
+	if len(args) >= 2 {
+		cmd = commands[args[0]+" "+args[1]]
+	}
+
+	if cmd == nil {
+		var names []string
+
+		for name := range commands {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		fmt.Fprintln(stderr, "usage: controller [options] <command> [command options]")
+		fmt.Fprintln(stderr, "commands:")
+
+		for _, name := range names {
+			fmt.Fprintf(stderr, "  %s\n", name)
+		}
+
+		return 2
+	}
+
+	deviceOrganiser := state.NewDeviceOrganiser(section.Section("Organiser"), state.NullEventPublisher)
+
+	err := cmd(deviceOrganiser.WithActor("cli"), args[2:], stdin, stdout, stderr)
+
+	if syncer, ok := section.(persistence.Syncer); ok {
+		syncer.Sync()
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
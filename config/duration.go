@@ -0,0 +1,45 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration which may be provided in configuration either as a string parsable by
+// time.ParseDuration (e.g. "1m30s"), or as a number of milliseconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw any
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch value := raw.(type) {
+	case float64:
+		*d = Duration(time.Duration(value) * time.Millisecond)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse duration: %w", err)
+		}
+
+		*d = Duration(parsed)
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("unable to parse duration from: %s", string(data))
+	}
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	t.Run("parses a duration string", func(t *testing.T) {
+		var d Duration
+
+		err := json.Unmarshal([]byte(`"1m30s"`), &d)
+		assert.NoError(t, err)
+		assert.Equal(t, 90*time.Second, d.Duration())
+	})
+
+	t.Run("parses a number as milliseconds", func(t *testing.T) {
+		var d Duration
+
+		err := json.Unmarshal([]byte(`1500`), &d)
+		assert.NoError(t, err)
+		assert.Equal(t, 1500*time.Millisecond, d.Duration())
+	})
+
+	t.Run("errors on an invalid duration string", func(t *testing.T) {
+		var d Duration
+
+		err := json.Unmarshal([]byte(`"soon"`), &d)
+		assert.Error(t, err)
+	})
+
+	t.Run("errors on an unsupported type", func(t *testing.T) {
+		var d Duration
+
+		err := json.Unmarshal([]byte(`true`), &d)
+		assert.Error(t, err)
+	})
+
+	t.Run("marshals to a duration string", func(t *testing.T) {
+		data, err := json.Marshal(Duration(90 * time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, `"1m30s"`, string(data))
+	})
+}
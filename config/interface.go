@@ -24,6 +24,8 @@ func (g *InterfaceConfig) UnmarshalJSON(data []byte) error {
 		g.Config = &HTTPInterfaceConfig{}
 	case "mqtt":
 		g.Config = &MQTTInterfaceConfig{}
+	case "mqtt-broker":
+		g.Config = &MQTTBrokerInterfaceConfig{}
 	default:
 		return fmt.Errorf("unknown interface configuration type: %s", g.Type)
 	}
@@ -38,6 +40,22 @@ func (g *InterfaceConfig) UnmarshalJSON(data []byte) error {
 type HTTPInterfaceConfig struct {
 	Port        int
 	EnabledAPIs []string
+
+	InvokerConfig
+}
+
+// InvokerConfig holds the options for invoking device actions, common to all interfaces.
+type InvokerConfig struct {
+	ActionTimeouts    map[string]Duration
+	IdempotencyWindow Duration
+	Retry             InvokerRetry
+}
+
+type InvokerRetry struct {
+	Attempts          int
+	Backoff           Duration
+	MaximumBackoff    Duration
+	OnlyRetryTimeouts bool
 }
 
 type MQTTInterfaceConfig struct {
@@ -46,6 +64,13 @@ type MQTTInterfaceConfig struct {
 	TLS         *MQTTTLS
 	Credentials *MQTTCredentials
 
+	MQTTPublishing
+	InvokerConfig
+}
+
+// MQTTPublishing holds the options for publishing controller state, common to both the mqtt and mqtt-broker
+// interfaces.
+type MQTTPublishing struct {
 	Retained    bool
 	QOS         byte
 	TopicPrefix string
@@ -53,6 +78,39 @@ type MQTTInterfaceConfig struct {
 	PublishStateOnConnect  bool
 	PublishAggregatedState bool
 	PublishIndividualState bool
+
+	PublishOnlyOnChange    bool
+	PublishRefreshInterval Duration
+	PublishCapabilities    map[string]MQTTCapabilityPublishing
+
+	PublishQueueSize       int
+	PublishWorkers         int
+	PublishQueueStatistics bool
+
+	PayloadFormat       MQTTPayloadFormat
+	CapabilityTemplates map[string]MQTTCapabilityTemplate
+
+	AvailabilityTimeout            Duration
+	CapabilityAvailabilityTimeouts map[string]Duration
+	DeviceAvailabilityTimeouts     map[string]Duration
+}
+
+type MQTTCapabilityPublishing struct {
+	MinimumInterval Duration
+	Deadband        float64
+}
+
+type MQTTPayloadFormat struct {
+	FloatPrecision *int
+	TrueValue      string
+	FalseValue     string
+	NullValue      string
+	Units          map[string]string
+}
+
+type MQTTCapabilityTemplate struct {
+	Topic   string
+	Payload string
 }
 
 type MQTTTLS struct {
@@ -67,3 +125,22 @@ type MQTTCredentials struct {
 	Username string
 	Password string
 }
+
+type MQTTBrokerInterfaceConfig struct {
+	Listeners []MQTTBrokerListener
+	Users     []MQTTCredentials
+
+	MQTTPublishing
+	InvokerConfig
+}
+
+type MQTTBrokerListener struct {
+	Type    string
+	Address string
+	TLS     *MQTTBrokerTLS
+}
+
+type MQTTBrokerTLS struct {
+	Key  string
+	Cert string
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestParseInterface(t *testing.T) {
@@ -31,7 +32,17 @@ func TestParseInterface(t *testing.T) {
     "Port": 3000,
     "EnabledAPIs": [
       "v1"
-    ]
+    ],
+    "ActionTimeouts": {
+      "EnumerateDevice": "1m"
+    },
+    "IdempotencyWindow": "1h",
+    "Retry": {
+      "Attempts": 3,
+      "Backoff": "250ms",
+      "MaximumBackoff": "2s",
+      "OnlyRetryTimeouts": true
+    }
   }
 }`)
 			gw := InterfaceConfig{}
@@ -44,6 +55,12 @@ func TestParseInterface(t *testing.T) {
 
 			assert.Equal(t, 3000, httpInt.Port)
 			assert.Contains(t, httpInt.EnabledAPIs, "v1")
+			assert.Equal(t, time.Minute, httpInt.ActionTimeouts["EnumerateDevice"].Duration())
+			assert.Equal(t, time.Hour, httpInt.IdempotencyWindow.Duration())
+			assert.Equal(t, 3, httpInt.Retry.Attempts)
+			assert.Equal(t, 250*time.Millisecond, httpInt.Retry.Backoff.Duration())
+			assert.Equal(t, 2*time.Second, httpInt.Retry.MaximumBackoff.Duration())
+			assert.True(t, httpInt.Retry.OnlyRetryTimeouts)
 		})
 	})
 
@@ -70,7 +87,41 @@ func TestParseInterface(t *testing.T) {
 
 	"PublishStateOnConnect": true,
     "PublishAggregatedState": true,
-    "PublishIndividualState": true
+    "PublishIndividualState": true,
+
+    "PublishOnlyOnChange": true,
+    "PublishRefreshInterval": "15m",
+    "PublishCapabilities": {
+      "TemperatureSensor": {
+        "MinimumInterval": "30s",
+        "Deadband": 0.5
+      }
+    },
+    "PublishQueueSize": 500,
+    "PublishWorkers": 8,
+    "PublishQueueStatistics": true,
+    "PayloadFormat": {
+      "FloatPrecision": 1,
+      "TrueValue": "ON",
+      "FalseValue": "OFF",
+      "NullValue": "",
+      "Units": {
+        "TemperatureSensor": "K"
+      }
+    },
+    "CapabilityTemplates": {
+      "OnOff": {
+        "Topic": "stat/{{.Device}}/POWER",
+        "Payload": "{{.Payload}}"
+      }
+    },
+    "AvailabilityTimeout": "10m",
+    "CapabilityAvailabilityTimeouts": {
+      "TemperatureSensor": "1h"
+    },
+    "DeviceAvailabilityTimeouts": {
+      "00158d0000000001-01": "2h"
+    }
   }
 }`)
 			gw := InterfaceConfig{}
@@ -101,6 +152,85 @@ func TestParseInterface(t *testing.T) {
 			assert.True(t, mqttInt.PublishStateOnConnect)
 			assert.True(t, mqttInt.PublishAggregatedState)
 			assert.True(t, mqttInt.PublishIndividualState)
+
+			assert.True(t, mqttInt.PublishOnlyOnChange)
+			assert.Equal(t, 15*time.Minute, mqttInt.PublishRefreshInterval.Duration())
+			assert.Equal(t, 30*time.Second, mqttInt.PublishCapabilities["TemperatureSensor"].MinimumInterval.Duration())
+			assert.Equal(t, 0.5, mqttInt.PublishCapabilities["TemperatureSensor"].Deadband)
+
+			assert.Equal(t, 500, mqttInt.PublishQueueSize)
+			assert.Equal(t, 8, mqttInt.PublishWorkers)
+			assert.True(t, mqttInt.PublishQueueStatistics)
+
+			assert.Equal(t, 1, *mqttInt.PayloadFormat.FloatPrecision)
+			assert.Equal(t, "ON", mqttInt.PayloadFormat.TrueValue)
+			assert.Equal(t, "OFF", mqttInt.PayloadFormat.FalseValue)
+			assert.Equal(t, "", mqttInt.PayloadFormat.NullValue)
+			assert.Equal(t, "K", mqttInt.PayloadFormat.Units["TemperatureSensor"])
+			assert.Equal(t, "stat/{{.Device}}/POWER", mqttInt.CapabilityTemplates["OnOff"].Topic)
+			assert.Equal(t, "{{.Payload}}", mqttInt.CapabilityTemplates["OnOff"].Payload)
+
+			assert.Equal(t, 10*time.Minute, mqttInt.AvailabilityTimeout.Duration())
+			assert.Equal(t, time.Hour, mqttInt.CapabilityAvailabilityTimeouts["TemperatureSensor"].Duration())
+			assert.Equal(t, 2*time.Hour, mqttInt.DeviceAvailabilityTimeouts["00158d0000000001-01"].Duration())
+		})
+	})
+
+	t.Run("mqtt-broker gateway", func(t *testing.T) {
+		t.Run("parses successfully", func(t *testing.T) {
+			data := []byte(`{
+  "Type": "mqtt-broker",
+  "Config": {
+    "Listeners": [
+      {
+        "Type": "tcp",
+        "Address": ":1883"
+      },
+      {
+        "Type": "websocket",
+        "Address": ":8883",
+        "TLS": {
+          "Key": "key.pem",
+          "Cert": "cert.pem"
+        }
+      }
+    ],
+    "Users": [
+      {
+        "Username": "user",
+        "Password": "pass"
+      }
+    ],
+    "Retained": true,
+    "TopicPrefix": "home/controller1",
+    "PublishStateOnConnect": true,
+    "PublishIndividualState": true,
+    "Retry": {
+      "Attempts": 2
+    }
+  }
+}`)
+			gw := InterfaceConfig{}
+
+			err := json.Unmarshal(data, &gw)
+			assert.NoError(t, err)
+
+			brokerInt, ok := gw.Config.(*MQTTBrokerInterfaceConfig)
+			assert.True(t, ok)
+
+			assert.Equal(t, []MQTTBrokerListener{
+				{Type: "tcp", Address: ":1883"},
+				{Type: "websocket", Address: ":8883", TLS: &MQTTBrokerTLS{Key: "key.pem", Cert: "cert.pem"}},
+			}, brokerInt.Listeners)
+
+			assert.Equal(t, []MQTTCredentials{{Username: "user", Password: "pass"}}, brokerInt.Users)
+
+			assert.True(t, brokerInt.Retained)
+			assert.Equal(t, "home/controller1", brokerInt.TopicPrefix)
+			assert.True(t, brokerInt.PublishStateOnConnect)
+			assert.True(t, brokerInt.PublishIndividualState)
+			assert.False(t, brokerInt.PublishAggregatedState)
+			assert.Equal(t, 2, brokerInt.Retry.Attempts)
 		})
 	})
 }
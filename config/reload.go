@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+type ReloadAction string
+
+const (
+	ReloadStarted      ReloadAction = "started"
+	ReloadStopped      ReloadAction = "stopped"
+	ReloadRestarted    ReloadAction = "restarted"
+	ReloadReconfigured ReloadAction = "reconfigured"
+	ReloadFailed       ReloadAction = "failed"
+	ReloadReverted     ReloadAction = "reverted"
+	ReloadNotApplied   ReloadAction = "not-applied"
+)
+
+// ReloadReport describes the changes made to the running controller by reloading its configuration.
+type ReloadReport struct {
+	Time    time.Time
+	Changes []ReloadChange
+}
+
+// ReloadChange is a change made to a section of configuration, or to a single named configuration within it. Changes
+// which failed, or which could not be applied, include the error. A changed configuration which failed to start is
+// reverted, restarting its previous configuration.
+type ReloadChange struct {
+	Section string
+	Name    string `json:",omitempty"`
+	Action  ReloadAction
+	Error   string `json:",omitempty"`
+}
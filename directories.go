@@ -17,7 +17,9 @@ type Directories struct {
 	Log    string
 }
 
-func enumerateDirectories(ctx context.Context, l logwrap.Logger) Directories {
+// enumerateDirectories parses the directories from the command line or environment, returning them with any remaining
+// command line arguments.
+func enumerateDirectories(ctx context.Context, l logwrap.Logger) (Directories, []string) {
 	fs := flag.NewFlagSet("controller", flag.ExitOnError)
 
 	defaultConfigDirectory, err := defaultDirectory("config")
@@ -59,7 +61,7 @@ func enumerateDirectories(ctx context.Context, l logwrap.Logger) Directories {
 		Config: *configDirectory,
 		Data:   *dataDirectory,
 		Log:    *logDirectory,
-	}
+	}, fs.Args()
 }
 
 func defaultDirectory(t string) (string, error) {
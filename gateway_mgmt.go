@@ -24,6 +24,7 @@ import (
 
 type StartedGateway struct {
 	Name     string
+	Config   config.GatewayConfig
 	Gateway  da.Gateway
 	Shutdown func()
 }
@@ -41,6 +42,7 @@ func startGateways(cfgs []config.GatewayConfig, mux *state.GatewayMux, l logwrap
 			retGws = append(retGws, StartedGateway{
 				Gateway:  gw,
 				Name:     cfg.Name,
+				Config:   cfg,
 				Shutdown: shutdown,
 			})
 		}
@@ -11,6 +11,7 @@ require (
 	github.com/gorilla/handlers v1.5.2
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/websocket v1.5.3
+	github.com/mochi-mqtt/server/v2 v2.7.9
 	github.com/peterbourgon/ff/v3 v3.4.0
 	github.com/shimmeringbee/da v0.0.0-20240714070346-b84fc2e73097
 	github.com/shimmeringbee/logwrap v0.1.3
@@ -22,6 +23,7 @@ require (
 	github.com/tidwall/gjson v1.17.1
 	go.bug.st/serial.v1 v0.0.0-20191202182710-24a6610f0541
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -31,6 +33,7 @@ require (
 	github.com/felixge/httpsnoop v1.0.3 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rs/xid v1.4.0 // indirect
 	github.com/shimmeringbee/bytecodec v0.0.0-20240614104652-9d31c74dcd13 // indirect
 	github.com/shimmeringbee/callbacks v0.0.0-20240614104656-b56cd6b4b604 // indirect
 	github.com/shimmeringbee/retry v0.0.0-20240614104711-064c2726a8b4 // indirect
@@ -39,8 +42,7 @@ require (
 	github.com/stretchr/objx v0.5.2 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
-	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
-	golang.org/x/sys v0.21.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
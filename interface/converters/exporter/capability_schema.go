@@ -0,0 +1,37 @@
+package exporter
+
+import (
+	"github.com/shimmeringbee/controller/interface/converters/schema"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+)
+
+var capabilityStates = map[da.Capability]any{
+	capabilities.ProductInformationFlag:     ProductInformation{},
+	capabilities.TemperatureSensorFlag:      TemperatureSensor{},
+	capabilities.RelativeHumiditySensorFlag: RelativeHumiditySensor{},
+	capabilities.PressureSensorFlag:         PressureSensor{},
+	capabilities.DeviceDiscoveryFlag:        DeviceDiscovery{},
+	capabilities.EnumerateDeviceFlag:        EnumerateDevice{},
+	capabilities.IdentifyFlag:               IdentifyStatus{},
+	capabilities.AlarmSensorFlag:            AlarmSensor{},
+	capabilities.OnOffFlag:                  OnOff{},
+	capabilities.PowerSupplyFlag:            PowerStatus{},
+	capabilities.AlarmWarningDeviceFlag:     AlarmWarningDeviceStatus{},
+	capabilities.DeviceWorkaroundsFlag:      DeviceWorkaroundsStatus{},
+	capabilities.IlluminationSensorFlag:     IlluminationSensor{},
+	capabilities.OccupancySensorFlag:        OccupancySensor{},
+	capabilities.MessageCaptureDebugFlag:    MessageCaptureDebug{},
+	capabilities.LocalDebugFlag:             DebugStatus{},
+	capabilities.RemoteDebugFlag:            DebugStatus{},
+}
+
+// CapabilityStateSchema returns the schema of the state ExportCapability produces for a capability, capabilities
+// which export no state are described as an empty object.
+func CapabilityStateSchema(c da.Capability) *schema.Schema {
+	if state, found := capabilityStates[c]; found {
+		return schema.Generate(state)
+	}
+
+	return schema.Generate(struct{}{})
+}
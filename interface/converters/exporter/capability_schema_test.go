@@ -0,0 +1,26 @@
+package exporter
+
+import (
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCapabilityStateSchema(t *testing.T) {
+	t.Run("returns the schema of the exported state", func(t *testing.T) {
+		actual := CapabilityStateSchema(capabilities.TemperatureSensorFlag)
+
+		assert.Equal(t, "object", actual.Type)
+		assert.Equal(t, "array", actual.Properties["Readings"].Type)
+		assert.Equal(t, "number", actual.Properties["Readings"].Items.Properties["Value"].Type)
+		assert.Equal(t, "date-time", actual.Properties["LastUpdate"].Format)
+		assert.Equal(t, "date-time", actual.Properties["LastChange"].Format)
+	})
+
+	t.Run("returns an empty object for capabilities without state", func(t *testing.T) {
+		actual := CapabilityStateSchema(capabilities.DeviceRemovalFlag)
+
+		assert.Equal(t, "object", actual.Type)
+		assert.Empty(t, actual.Properties)
+	})
+}
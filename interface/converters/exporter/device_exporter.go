@@ -9,10 +9,11 @@ import (
 )
 
 type ExportedDevice struct {
-	Metadata     state.DeviceMetadata
-	Identifier   string
-	Capabilities map[string]any
-	Gateway      string
+	Metadata           state.DeviceMetadata
+	Identifier         string
+	Capabilities       map[string]any
+	CapabilityMetadata map[string]CapabilityMetadata `json:",omitempty"`
+	Gateway            string
 }
 
 type ExportedSimpleDevice struct {
@@ -42,13 +43,35 @@ func NewDeviceExporter(do *state.DeviceOrganiser, gm state.GatewayMapper) Device
 	}
 }
 
+type capabilityFieldsKey struct{}
+
+// WithCapabilityFields limits devices exported with the returned context to the named capabilities.
+func WithCapabilityFields(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, capabilityFieldsKey{}, names)
+}
+
+func capabilityRequested(ctx context.Context, name string) bool {
+	names, found := ctx.Value(capabilityFieldsKey{}).([]string)
+	if !found {
+		return true
+	}
+
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (de *deviceExporter) ExportDevice(ctx context.Context, daDevice da.Device) ExportedDevice {
 	capabilityList := map[string]any{}
 
 	for _, capFlag := range daDevice.Capabilities() {
 		uncastCapability := daDevice.Capability(capFlag)
 
-		if basicCapability, ok := uncastCapability.(da.BasicCapability); ok {
+		if basicCapability, ok := uncastCapability.(da.BasicCapability); ok && capabilityRequested(ctx, basicCapability.Name()) {
 			capabilityList[basicCapability.Name()] = de.ExportCapability(ctx, uncastCapability)
 		}
 	}
@@ -86,6 +109,10 @@ func (de *deviceExporter) ExportSimpleDevice(ctx context.Context, daDevice da.De
 	}
 }
 
+func (de *deviceExporter) ExportDeviceCapability(ctx context.Context, daDevice da.Device, capFlag da.Capability) any {
+	return de.ExportCapability(ctx, daDevice.Capability(capFlag))
+}
+
 func (de *deviceExporter) ExportCapability(pctx context.Context, uncastCapability any) any {
 	ctx, cancel := context.WithTimeout(pctx, DefaultCapabilityTimeout)
 	defer cancel()
@@ -117,6 +144,16 @@ func (de *deviceExporter) ExportCapability(pctx context.Context, uncastCapabilit
 		retVal = de.convertAlarmWarningDevice(ctx, capability)
 	case capabilities.DeviceWorkarounds:
 		retVal = de.convertDeviceWorkarounds(ctx, capability)
+	case capabilities.IlluminationSensor:
+		retVal = de.convertIlluminationSensor(ctx, capability)
+	case capabilities.OccupancySensor:
+		retVal = de.convertOccupancySensor(ctx, capability)
+	case capabilities.MessageCaptureDebug:
+		retVal = de.convertMessageCaptureDebug(ctx, capability)
+	case capabilities.LocalDebug, capabilities.RemoteDebug:
+		// Debug results are only available from the events raised once debug completes, see ExportDebugEvent. No
+		// state is returned, so that a refresh does not replace the status from those events.
+		return nil
 	default:
 		return struct{}{}
 	}
@@ -369,8 +406,121 @@ func (de *deviceExporter) convertDeviceWorkarounds(ctx context.Context, capabili
 	return status
 }
 
+func (de *deviceExporter) convertIlluminationSensor(ctx context.Context, is capabilities.IlluminationSensor) any {
+	isReadings, err := is.Reading(ctx)
+	if err != nil {
+		return nil
+	}
+
+	return &IlluminationSensor{
+		Readings: isReadings,
+	}
+}
+
+func (de *deviceExporter) convertOccupancySensor(ctx context.Context, os capabilities.OccupancySensor) any {
+	osReadings, err := os.Reading(ctx)
+	if err != nil {
+		return nil
+	}
+
+	readings := make([]OccupancySensorReading, 0, len(osReadings))
+
+	for _, r := range osReadings {
+		readings = append(readings, OccupancySensorReading{
+			Occupied: r.Occupied,
+			Duration: int(r.Duration / time.Millisecond),
+		})
+	}
+
+	return &OccupancySensor{
+		Readings: readings,
+	}
+}
+
+func (de *deviceExporter) convertMessageCaptureDebug(ctx context.Context, mcd capabilities.MessageCaptureDebug) any {
+	capturing, err := mcd.Status(ctx)
+	if err != nil {
+		return nil
+	}
+
+	captures, err := mcd.Get(ctx)
+	if err != nil {
+		return nil
+	}
+
+	messages := make([]CapturedMessage, 0, len(captures))
+
+	for _, c := range captures {
+		messages = append(messages, exportCapturedMessage(c.Message))
+	}
+
+	return &MessageCaptureDebug{
+		Capturing: capturing,
+		Messages:  messages,
+	}
+}
+
+func exportCapturedMessage(m capabilities.CapturedMessage) CapturedMessage {
+	cm := CapturedMessage{
+		Timestamp: m.Timestamp,
+		Outbound:  m.Outbound,
+		Payload:   m.Payload,
+	}
+
+	if m.Source != nil {
+		cm.Source = m.Source.String()
+	}
+
+	if m.Destination != nil {
+		cm.Destination = m.Destination.String()
+	}
+
+	return cm
+}
+
+// ExportDebugEvent converts a local or remote debug event into the status of the debug capability, as the results of
+// a debug request are only available from its events.
+func ExportDebugEvent(e any) (da.Device, da.Capability, *DebugStatus, bool) {
+	status := &DebugStatus{}
+	status.SetUpdateTime(time.Now())
+
+	switch event := e.(type) {
+	case capabilities.LocalDebugStart:
+		status.Running = true
+		return event.Device, capabilities.LocalDebugFlag, status, true
+	case capabilities.LocalDebugSuccess:
+		status.MediaType = event.MediaType
+		status.Debug = event.Debug
+		return event.Device, capabilities.LocalDebugFlag, status, true
+	case capabilities.LocalDebugFailure:
+		status.Error = errorText(event.Error)
+		return event.Device, capabilities.LocalDebugFlag, status, true
+	case capabilities.RemoteDebugStart:
+		status.Running = true
+		return event.Device, capabilities.RemoteDebugFlag, status, true
+	case capabilities.RemoteDebugSuccess:
+		status.MediaType = event.MediaType
+		status.Debug = event.Debug
+		return event.Device, capabilities.RemoteDebugFlag, status, true
+	case capabilities.RemoteDebugFailure:
+		status.Error = errorText(event.Error)
+		return event.Device, capabilities.RemoteDebugFlag, status, true
+	default:
+		return nil, 0, nil, false
+	}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
 type DeviceExporter interface {
 	ExportDevice(context.Context, da.Device) ExportedDevice
 	ExportSimpleDevice(context.Context, da.Device) ExportedSimpleDevice
 	ExportCapability(context.Context, any) any
+	ExportDeviceCapability(context.Context, da.Device, da.Capability) any
 }
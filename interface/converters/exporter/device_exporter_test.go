@@ -54,6 +54,7 @@ func TestDeviceExporter_ExportDevice(t *testing.T) {
 			Capabilities: map[string]any{"capOne": struct{}{}},
 			Metadata: state.DeviceMetadata{
 				Name:  "fancyname",
+				Alias: "fancyname",
 				Zones: []int{1},
 			},
 			Gateway: "gw",
@@ -101,6 +102,7 @@ func TestDeviceExporter_ExportSimpleDevice(t *testing.T) {
 			Capabilities: []string{"capOne"},
 			Metadata: state.DeviceMetadata{
 				Name:  "fancyname",
+				Alias: "fancyname",
 				Zones: []int{1},
 			},
 			Gateway: "gw",
@@ -453,6 +455,179 @@ func TestDeviceExporter_convertDeviceWorkarounds(t *testing.T) {
 	})
 }
 
+func TestDeviceExporter_convertIlluminationSensor(t *testing.T) {
+	t.Run("retrieves and returns all data from IlluminationSensor", func(t *testing.T) {
+		mis := mockIlluminationSensor{}
+		defer mis.AssertExpectations(t)
+
+		mis.On("Reading", mock.Anything).Return([]capabilities.IlluminationReading{{Value: 100}}, nil)
+
+		expected := &IlluminationSensor{
+			Readings: []capabilities.IlluminationReading{{Value: 100}},
+		}
+
+		dc := deviceExporter{}
+		actual := dc.convertIlluminationSensor(context.Background(), &mis)
+
+		assert.Equal(t, expected, actual)
+	})
+}
+
+func TestDeviceExporter_convertOccupancySensor(t *testing.T) {
+	t.Run("retrieves and returns all data from OccupancySensor", func(t *testing.T) {
+		mos := mockOccupancySensor{}
+		defer mos.AssertExpectations(t)
+
+		mos.On("Reading", mock.Anything).Return([]capabilities.OccupancyReading{{Occupied: true, Duration: time.Minute}}, nil)
+
+		expected := &OccupancySensor{
+			Readings: []OccupancySensorReading{{Occupied: true, Duration: 60000}},
+		}
+
+		dc := deviceExporter{}
+		actual := dc.convertOccupancySensor(context.Background(), &mos)
+
+		assert.Equal(t, expected, actual)
+	})
+}
+
+func TestDeviceExporter_convertMessageCaptureDebug(t *testing.T) {
+	t.Run("retrieves and returns all data from MessageCaptureDebug", func(t *testing.T) {
+		mmcd := mockMessageCaptureDebug{}
+		defer mmcd.AssertExpectations(t)
+
+		now := time.Now()
+
+		mmcd.On("Status", mock.Anything).Return(true, nil)
+		mmcd.On("Get", mock.Anything).Return([]capabilities.MessageCapture{
+			{
+				Message: capabilities.CapturedMessage{
+					Timestamp:   now,
+					Source:      SimpleIdentifier{id: "source"},
+					Destination: SimpleIdentifier{id: "destination"},
+					Outbound:    true,
+					Payload:     "payload",
+				},
+			},
+		}, nil)
+
+		expected := &MessageCaptureDebug{
+			Capturing: true,
+			Messages: []CapturedMessage{
+				{
+					Timestamp:   now,
+					Source:      "source",
+					Destination: "destination",
+					Outbound:    true,
+					Payload:     "payload",
+				},
+			},
+		}
+
+		dc := deviceExporter{}
+		actual := dc.convertMessageCaptureDebug(context.Background(), &mmcd)
+
+		assert.Equal(t, expected, actual)
+	})
+}
+
+func TestExportDebugEvent(t *testing.T) {
+	d := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+
+	t.Run("exports a running debug on start", func(t *testing.T) {
+		actualDevice, actualFlag, status, found := ExportDebugEvent(capabilities.LocalDebugStart{Device: d})
+		assert.True(t, found)
+		assert.Equal(t, d, actualDevice)
+		assert.Equal(t, capabilities.LocalDebugFlag, actualFlag)
+		assert.True(t, status.Running)
+		assert.NotNil(t, status.LastUpdate)
+	})
+
+	t.Run("exports the debug payload on success", func(t *testing.T) {
+		_, actualFlag, status, found := ExportDebugEvent(capabilities.RemoteDebugSuccess{Device: d, MediaType: "application/json", Debug: map[string]string{"a": "b"}})
+		assert.True(t, found)
+		assert.Equal(t, capabilities.RemoteDebugFlag, actualFlag)
+		assert.False(t, status.Running)
+		assert.Equal(t, "application/json", status.MediaType)
+		assert.Equal(t, map[string]string{"a": "b"}, status.Debug)
+	})
+
+	t.Run("exports the error on failure", func(t *testing.T) {
+		_, _, status, found := ExportDebugEvent(capabilities.LocalDebugFailure{Device: d, Error: io.EOF})
+		assert.True(t, found)
+		assert.Equal(t, io.EOF.Error(), status.Error)
+	})
+
+	t.Run("returns false for other events", func(t *testing.T) {
+		_, _, _, found := ExportDebugEvent(capabilities.OnOffUpdate{Device: d})
+		assert.False(t, found)
+	})
+
+	t.Run("debug capabilities export no state of their own", func(t *testing.T) {
+		de := deviceExporter{}
+
+		assert.Nil(t, de.ExportCapability(context.Background(), localDebug{}))
+	})
+}
+
+type localDebug struct{}
+
+func (localDebug) Start(context.Context) error {
+	return nil
+}
+
+type mockIlluminationSensor struct {
+	mock.Mock
+}
+
+func (m *mockIlluminationSensor) Reading(c context.Context) ([]capabilities.IlluminationReading, error) {
+	args := m.Called(c)
+	return args.Get(0).([]capabilities.IlluminationReading), args.Error(1)
+}
+
+type mockOccupancySensor struct {
+	mock.Mock
+}
+
+func (m *mockOccupancySensor) Reading(c context.Context) ([]capabilities.OccupancyReading, error) {
+	args := m.Called(c)
+	return args.Get(0).([]capabilities.OccupancyReading), args.Error(1)
+}
+
+type mockMessageCaptureDebug struct {
+	mock.Mock
+}
+
+func (m *mockMessageCaptureDebug) Start(c context.Context) error {
+	return m.Called(c).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) Stop(c context.Context) error {
+	return m.Called(c).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) Status(c context.Context) (bool, error) {
+	args := m.Called(c)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockMessageCaptureDebug) Get(c context.Context) ([]capabilities.MessageCapture, error) {
+	args := m.Called(c)
+	return args.Get(0).([]capabilities.MessageCapture), args.Error(1)
+}
+
+func (m *mockMessageCaptureDebug) Clear(c context.Context) error {
+	return m.Called(c).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) EnableCaptureOnJoin(c context.Context) error {
+	return m.Called(c).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) DisableCaptureOnJoin(c context.Context) error {
+	return m.Called(c).Error(0)
+}
+
 type mockTemperatureSensorWithUpdateTime struct {
 	mock.Mock
 }
@@ -547,6 +722,36 @@ func Test_convertCapabilityWithLastChangeTime(t *testing.T) {
 	})
 }
 
+func TestDeviceExporter_ExportDevice_CapabilityFields(t *testing.T) {
+	t.Run("only exports the capabilities requested", func(t *testing.T) {
+		capOne := da.Capability(1)
+		capTwo := da.Capability(2)
+
+		mockCapOne := &mocks.BasicCapability{}
+		mockCapOne.On("Name").Return("capOne")
+
+		mockCapTwo := &mocks.BasicCapability{}
+		mockCapTwo.On("Name").Return("capTwo")
+
+		mdev := &mocks.MockDevice{}
+		mdev.On("Gateway").Return(&mocks.Gateway{})
+		mdev.On("Identifier").Return(SimpleIdentifier{id: "one"})
+		mdev.On("Capabilities").Return([]da.Capability{capOne, capTwo})
+		mdev.On("Capability", capOne).Return(mockCapOne)
+		mdev.On("Capability", capTwo).Return(mockCapTwo)
+
+		mgm := state.MockGatewayMapper{}
+		mgm.On("GatewayName", mock.Anything).Return("gw", true)
+
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+		dc := NewDeviceExporter(&do, &mgm)
+		actual := dc.ExportDevice(WithCapabilityFields(context.Background(), []string{"capTwo"}), mdev)
+
+		assert.Equal(t, map[string]any{"capTwo": struct{}{}}, actual.Capabilities)
+	})
+}
+
 func TestNullableTime_MarshalJSON(t *testing.T) {
 	t.Run("empty time marshals as null", func(t *testing.T) {
 		n := NullableTime(time.Time{})
@@ -569,3 +774,26 @@ func TestNullableTime_MarshalJSON(t *testing.T) {
 		assert.Equal(t, expectedData, data)
 	})
 }
+
+func TestNullableTime_UnmarshalJSON(t *testing.T) {
+	t.Run("null unmarshals as empty time", func(t *testing.T) {
+		n := NullableTime(time.Now())
+
+		err := json.Unmarshal([]byte("null"), &n)
+
+		assert.NoError(t, err)
+		assert.True(t, time.Time(n).IsZero())
+	})
+
+	t.Run("full time unmarshals as normal", func(t *testing.T) {
+		tn := time.Now().Truncate(time.Second)
+		data, _ := json.Marshal(tn)
+
+		var n NullableTime
+
+		err := json.Unmarshal(data, &n)
+
+		assert.NoError(t, err)
+		assert.True(t, tn.Equal(time.Time(n)))
+	})
+}
@@ -117,10 +117,17 @@ func (w eventExporter) MapEvent(ctx context.Context, v any) ([]any, error) {
 	case state.ZoneRemove:
 		return w.generateZoneRemove(e)
 
+	case state.OperationComplete:
+		return w.generateOperationComplete(e)
+
 	case da.CapabilityAdded:
 	case da.CapabilityRemoved:
 
 	default:
+		if d, c, status, found := ExportDebugEvent(e); found {
+			return w.generateDeviceUpdateCapabilityMessageWithPayload(d, c, status)
+		}
+
 		if d, c, found := eventToCapability(e); found {
 			return w.generateDeviceUpdateCapabilityMessage(ctx, d, c)
 		}
@@ -140,6 +147,8 @@ func (w eventExporter) generateZoneCreate(zc state.ZoneCreate) ([]any, error) {
 		Name:   zc.Name,
 		Parent: 0,
 		After:  zc.AfterZone,
+		Kind:   zc.Kind,
+		Icon:   zc.Icon,
 	}}, nil
 }
 
@@ -151,9 +160,13 @@ func (w eventExporter) generateZoneUpdate(zu state.ZoneUpdate) ([]any, error) {
 				Type: ZoneUpdateMessageName,
 			},
 		},
-		Name:   zu.Name,
-		Parent: zu.ParentZone,
-		After:  zu.AfterZone,
+		Name:        zu.Name,
+		Parent:      zu.ParentZone,
+		After:       zu.AfterZone,
+		Kind:        zu.Kind,
+		Icon:        zu.Icon,
+		Attributes:  zu.Attributes,
+		Coordinates: zu.Coordinates,
 	}}, nil
 }
 
@@ -168,6 +181,17 @@ func (w eventExporter) generateZoneRemove(zu state.ZoneRemove) ([]any, error) {
 	}}, nil
 }
 
+func (w eventExporter) generateOperationComplete(oc state.OperationComplete) ([]any, error) {
+	return []any{OperationCompleteMessage{
+		OperationMessage: OperationMessage{
+			Message: Message{
+				Type: OperationCompleteMessageName,
+			},
+		},
+		Operation: oc.Operation,
+	}}, nil
+}
+
 func (w eventExporter) generateDeviceRemove(identifier da.Identifier) ([]any, error) {
 	return []any{DeviceRemoveMessage{
 		DeviceMessage: DeviceMessage{
@@ -207,14 +231,12 @@ func (w eventExporter) generateDeviceUpdateMessage(ctx context.Context, d da.Dev
 }
 
 func (w eventExporter) generateDeviceUpdateCapabilityMessage(ctx context.Context, daDevice da.Device, capFlag da.Capability) ([]any, error) {
-	uncastCapability := daDevice.Capability(capFlag)
-
-	basic, ok := uncastCapability.(da.BasicCapability)
+	basic, ok := daDevice.Capability(capFlag).(da.BasicCapability)
 	if !ok {
 		return nil, nil
 	}
 
-	out := w.deviceExporter.ExportCapability(ctx, uncastCapability)
+	out := w.deviceExporter.ExportDeviceCapability(ctx, daDevice, capFlag)
 
 	return []any{
 		DeviceUpdateCapabilityMessage{
@@ -230,6 +252,21 @@ func (w eventExporter) generateDeviceUpdateCapabilityMessage(ctx context.Context
 	}, nil
 }
 
+func (w eventExporter) generateDeviceUpdateCapabilityMessageWithPayload(daDevice da.Device, capFlag da.Capability, payload any) ([]any, error) {
+	return []any{
+		DeviceUpdateCapabilityMessage{
+			DeviceMessage: DeviceMessage{
+				Message: Message{
+					Type: DeviceUpdateCapabilityMessageName,
+				},
+			},
+			Identifier: daDevice.Identifier().String(),
+			Capability: capabilities.StandardNames[capFlag],
+			Payload:    payload,
+		},
+	}, nil
+}
+
 func (w eventExporter) generateZoneUpdateMessage(zone state.Zone, after int) (any, error) {
 	return ZoneUpdateMessage{
 		ZoneMessage: ZoneMessage{
@@ -238,9 +275,13 @@ func (w eventExporter) generateZoneUpdateMessage(zone state.Zone, after int) (an
 			},
 			Identifier: zone.Identifier,
 		},
-		Name:   zone.Name,
-		Parent: zone.ParentZone,
-		After:  after,
+		Name:        zone.Name,
+		Parent:      zone.ParentZone,
+		After:       after,
+		Kind:        zone.Kind,
+		Icon:        zone.Icon,
+		Attributes:  zone.Attributes,
+		Coordinates: zone.Coordinates,
 	}, nil
 }
 
@@ -387,6 +387,8 @@ func TestEventExporter_MapEvent(t *testing.T) {
 			Identifier: 1,
 			Name:       "one",
 			AfterZone:  2,
+			Kind:       state.ZoneKindRoom,
+			Icon:       "sofa",
 		})
 
 		expectedData := []any{
@@ -400,6 +402,8 @@ func TestEventExporter_MapEvent(t *testing.T) {
 				Name:   "one",
 				Parent: 0,
 				After:  2,
+				Kind:   state.ZoneKindRoom,
+				Icon:   "sofa",
 			},
 		}
 
@@ -435,6 +439,38 @@ func TestEventExporter_MapEvent(t *testing.T) {
 		assert.Equal(t, expectedData, actualData)
 	})
 
+	t.Run("maps update of zone with kind, icon, attributes and coordinates", func(t *testing.T) {
+		wem := eventExporter{}
+
+		actualData, err := wem.MapEvent(context.TODO(), state.ZoneUpdate{
+			Identifier:  1,
+			Name:        "Kitchen",
+			Kind:        state.ZoneKindRoom,
+			Icon:        "kettle",
+			Attributes:  map[string]any{"area": float64(12)},
+			Coordinates: &state.ZoneCoordinates{X: 1, Y: 2},
+		})
+
+		expectedData := []any{
+			ZoneUpdateMessage{
+				ZoneMessage: ZoneMessage{
+					Message: Message{
+						Type: ZoneUpdateMessageName,
+					},
+					Identifier: 1,
+				},
+				Name:        "Kitchen",
+				Kind:        state.ZoneKindRoom,
+				Icon:        "kettle",
+				Attributes:  map[string]any{"area": float64(12)},
+				Coordinates: &state.ZoneCoordinates{X: 1, Y: 2},
+			},
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedData, actualData)
+	})
+
 	t.Run("maps remove of zone", func(t *testing.T) {
 		wem := eventExporter{}
 
@@ -457,6 +493,34 @@ func TestEventExporter_MapEvent(t *testing.T) {
 		assert.Equal(t, expectedData, actualData)
 	})
 
+	t.Run("maps completion of operation", func(t *testing.T) {
+		wem := eventExporter{}
+
+		op := state.Operation{
+			Identifier: "op",
+			Device:     "one",
+			Capability: "OnOff",
+			Action:     "On",
+			Status:     state.OperationSucceeded,
+		}
+
+		actualData, err := wem.MapEvent(context.TODO(), state.OperationComplete{Operation: op})
+
+		expectedData := []any{
+			OperationCompleteMessage{
+				OperationMessage: OperationMessage{
+					Message: Message{
+						Type: OperationCompleteMessageName,
+					},
+				},
+				Operation: op,
+			},
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedData, actualData)
+	})
+
 	t.Run("maps remove of device", func(t *testing.T) {
 		wem := eventExporter{}
 
@@ -480,6 +544,26 @@ func TestEventExporter_MapEvent(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, expectedData, actualData)
 	})
+
+	t.Run("maps the result of a debug request from its event", func(t *testing.T) {
+		wem := eventExporter{}
+
+		actualData, err := wem.MapEvent(context.TODO(), capabilities.LocalDebugSuccess{
+			Device: mocks.SimpleDevice{
+				SIdentifier: SimpleIdentifier{id: "one"},
+			},
+			MediaType: "application/json",
+			Debug:     "debug",
+		})
+		assert.NoError(t, err)
+		assert.Len(t, actualData, 1)
+
+		msg := actualData[0].(DeviceUpdateCapabilityMessage)
+		assert.Equal(t, "one", msg.Identifier)
+		assert.Equal(t, "LocalDebug", msg.Capability)
+		assert.Equal(t, "debug", msg.Payload.(*DebugStatus).Debug)
+		assert.Equal(t, "application/json", msg.Payload.(*DebugStatus).MediaType)
+	})
 }
 
 func TestEventExporter_InitialEvents(t *testing.T) {
@@ -667,6 +751,7 @@ func TestEventExporter_InitialEvents(t *testing.T) {
 				ExportedSimpleDevice: ExportedSimpleDevice{
 					Metadata: state.DeviceMetadata{
 						Name:  "device name",
+						Alias: "device-name",
 						Zones: []int{1},
 					},
 					Identifier:   "device",
@@ -2,6 +2,7 @@ package exporter
 
 import (
 	"encoding/json"
+	"github.com/shimmeringbee/controller/state"
 	"github.com/shimmeringbee/da/capabilities"
 	"time"
 )
@@ -17,6 +18,8 @@ const (
 	DeviceUpdateMessageName           = "DeviceUpdate"
 	DeviceUpdateCapabilityMessageName = "DeviceUpdateCapability"
 	DeviceRemoveMessageName           = "DeviceRemove"
+
+	OperationCompleteMessageName = "OperationComplete"
 )
 
 type Message struct {
@@ -42,9 +45,13 @@ type ZoneMessage struct {
 
 type ZoneUpdateMessage struct {
 	ZoneMessage
-	Name   string
-	Parent int
-	After  int
+	Name        string
+	Parent      int
+	After       int
+	Kind        state.ZoneKind         `json:",omitempty"`
+	Icon        string                 `json:",omitempty"`
+	Attributes  map[string]any         `json:",omitempty"`
+	Coordinates *state.ZoneCoordinates `json:",omitempty"`
 }
 
 type ZoneRemoveMessage struct {
@@ -81,6 +88,15 @@ type DeviceRemoveMessage struct {
 	Identifier string
 }
 
+type OperationMessage struct {
+	Message
+}
+
+type OperationCompleteMessage struct {
+	OperationMessage
+	state.Operation
+}
+
 type SettableUpdateTime interface {
 	SetUpdateTime(time.Time)
 }
@@ -101,6 +117,21 @@ func (n NullableTime) MarshalJSON() ([]byte, error) {
 	}
 }
 
+func (n *NullableTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*n = NullableTime{}
+		return nil
+	}
+
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+
+	*n = NullableTime(t)
+	return nil
+}
+
 type LastUpdate struct {
 	LastUpdate *NullableTime `json:",omitempty"`
 }
@@ -194,6 +225,46 @@ type IdentifyStatus struct {
 	LastChange
 }
 
+type IlluminationSensor struct {
+	Readings []capabilities.IlluminationReading
+	LastUpdate
+	LastChange
+}
+
+type OccupancySensorReading struct {
+	Occupied bool
+	Duration int
+}
+
+type OccupancySensor struct {
+	Readings []OccupancySensorReading
+	LastUpdate
+	LastChange
+}
+
+type CapturedMessage struct {
+	Timestamp   time.Time
+	Source      string
+	Destination string
+	Outbound    bool
+	Payload     any
+}
+
+type MessageCaptureDebug struct {
+	Capturing bool
+	Messages  []CapturedMessage
+	LastUpdate
+	LastChange
+}
+
+type DebugStatus struct {
+	Running   bool
+	MediaType string `json:",omitempty"`
+	Debug     any    `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	LastUpdate
+}
+
 type DeviceWorkaroundsStatus struct {
 	Enabled []string
 }
@@ -25,6 +25,11 @@ func (m *MockDeviceExporter) ExportCapability(ctx context.Context, e any) any {
 	return args.Get(0)
 }
 
+func (m *MockDeviceExporter) ExportDeviceCapability(ctx context.Context, daDevice da.Device, capFlag da.Capability) any {
+	args := m.Called(ctx, daDevice, capFlag)
+	return args.Get(0)
+}
+
 type MockGatewayExporter struct {
 	mock.Mock
 }
@@ -0,0 +1,448 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/persistence"
+	"github.com/shimmeringbee/persistence/converter"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultStateMaxAge is the age after which cached capability state is reported as stale and refreshed.
+const DefaultStateMaxAge = 5 * time.Minute
+
+// DefaultStateRefreshInterval is how often the cache is checked for stale capability state to refresh.
+const DefaultStateRefreshInterval = 1 * time.Minute
+
+type CapabilityMetadata struct {
+	Fetched  time.Time
+	Stale    bool
+	Restored bool `json:",omitempty"`
+}
+
+type freshStateKey struct{}
+
+// WithFreshState requests that exports made with the returned context read capability state from the device, rather
+// than from any cache.
+func WithFreshState(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshStateKey{}, true)
+}
+
+// FreshStateRequested reports if the context requests capability state be read from the device.
+func FreshStateRequested(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshStateKey{}).(bool)
+	return fresh
+}
+
+type cachedState struct {
+	device    da.Device
+	flag      da.Capability
+	value     any
+	fetched   time.Time
+	attempted time.Time
+	restored  bool
+}
+
+// StateCache is a DeviceExporter which serves capability state from memory, rather than querying every capability of
+// every device on each export. Capability state is read on first use, updated when capability events are raised and
+// refreshed in the background once it exceeds MaxAge.
+//
+// The last state of each capability is persisted, and restored when the controller starts. Restored state is served
+// until the capability is successfully read from the device.
+//
+// StateCache is also an EventSubscriber, relaying each event once the cache has been updated by it. Subscribers may
+// then serve capability events from the cache, rather than each reading from the device. Events of each device are
+// handled in order by a worker of their own, so that a slow device does not delay the events of any other.
+type StateCache struct {
+	live    DeviceExporter
+	section persistence.Section
+
+	lock    *sync.Mutex
+	entries map[string]map[da.Capability]*cachedState
+
+	MaxAge          time.Duration
+	RefreshInterval time.Duration
+
+	subscriber state.EventSubscriber
+	relay      *state.EventBus
+	eventCh    chan any
+	workers    map[string]chan any
+	stop       chan struct{}
+	now        func() time.Time
+}
+
+func NewStateCache(live DeviceExporter, s persistence.Section) *StateCache {
+	c := &StateCache{
+		live:            live,
+		section:         s,
+		lock:            &sync.Mutex{},
+		entries:         map[string]map[da.Capability]*cachedState{},
+		MaxAge:          DefaultStateMaxAge,
+		RefreshInterval: DefaultStateRefreshInterval,
+		relay:           state.NewEventBus(),
+		now:             time.Now,
+	}
+
+	c.load()
+
+	return c
+}
+
+func (c *StateCache) ExportDevice(ctx context.Context, daDevice da.Device) ExportedDevice {
+	simple := c.live.ExportSimpleDevice(ctx, daDevice)
+
+	capabilityList := map[string]any{}
+	capabilityMetadata := map[string]CapabilityMetadata{}
+
+	for _, capFlag := range daDevice.Capabilities() {
+		if basicCapability, ok := daDevice.Capability(capFlag).(da.BasicCapability); ok && capabilityRequested(ctx, basicCapability.Name()) {
+			entry := c.state(ctx, daDevice, capFlag)
+
+			capabilityList[basicCapability.Name()] = entry.value
+			capabilityMetadata[basicCapability.Name()] = c.metadata(entry)
+		}
+	}
+
+	return ExportedDevice{
+		Metadata:           simple.Metadata,
+		Identifier:         simple.Identifier,
+		Capabilities:       capabilityList,
+		CapabilityMetadata: capabilityMetadata,
+		Gateway:            simple.Gateway,
+	}
+}
+
+func (c *StateCache) ExportSimpleDevice(ctx context.Context, daDevice da.Device) ExportedSimpleDevice {
+	return c.live.ExportSimpleDevice(ctx, daDevice)
+}
+
+// ExportCapability always reads from the capability, as the device it belongs to is unknown.
+func (c *StateCache) ExportCapability(ctx context.Context, uncastCapability any) any {
+	return c.live.ExportCapability(ctx, uncastCapability)
+}
+
+func (c *StateCache) ExportDeviceCapability(ctx context.Context, daDevice da.Device, capFlag da.Capability) any {
+	return c.state(ctx, daDevice, capFlag).value
+}
+
+// state returns the cached state of a devices capability, reading it from the device if absent or fresh state has
+// been requested.
+func (c *StateCache) state(ctx context.Context, daDevice da.Device, capFlag da.Capability) cachedState {
+	id := daDevice.Identifier().String()
+
+	if !FreshStateRequested(ctx) {
+		c.lock.Lock()
+		entry, found := c.entries[id][capFlag]
+
+		if found && entry.device == nil {
+			entry.device = daDevice
+		}
+
+		c.lock.Unlock()
+
+		if found {
+			return *entry
+		}
+	}
+
+	return c.refresh(ctx, daDevice, capFlag)
+}
+
+// refresh reads the state of a devices capability, if the read fails the last state is retained along with the time
+// it was fetched, so that it is reported as stale once it exceeds MaxAge.
+func (c *StateCache) refresh(ctx context.Context, daDevice da.Device, capFlag da.Capability) cachedState {
+	value := c.live.ExportDeviceCapability(ctx, daDevice, capFlag)
+	now := c.now()
+
+	id := daDevice.Identifier().String()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, found := c.entries[id]; !found {
+		c.entries[id] = map[da.Capability]*cachedState{}
+	}
+
+	if value == nil {
+		existing, found := c.entries[id][capFlag]
+		if !found {
+			existing = &cachedState{flag: capFlag}
+			c.entries[id][capFlag] = existing
+		}
+
+		existing.device = daDevice
+		existing.attempted = now
+		return *existing
+	}
+
+	return c.storeLocked(daDevice, capFlag, value, now)
+}
+
+// store replaces the state of a devices capability, such as with state carried by an event.
+func (c *StateCache) store(daDevice da.Device, capFlag da.Capability, value any) {
+	now := c.now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.storeLocked(daDevice, capFlag, value, now)
+}
+
+func (c *StateCache) storeLocked(daDevice da.Device, capFlag da.Capability, value any, now time.Time) cachedState {
+	id := daDevice.Identifier().String()
+
+	if _, found := c.entries[id]; !found {
+		c.entries[id] = map[da.Capability]*cachedState{}
+	}
+
+	entry := &cachedState{
+		device:    daDevice,
+		flag:      capFlag,
+		value:     value,
+		fetched:   now,
+		attempted: now,
+	}
+
+	c.entries[id][capFlag] = entry
+	c.persist(id, entry)
+
+	return *entry
+}
+
+func (c *StateCache) metadata(entry cachedState) CapabilityMetadata {
+	return CapabilityMetadata{
+		Fetched:  entry.fetched,
+		Stale:    c.now().Sub(entry.fetched) > c.MaxAge,
+		Restored: entry.restored,
+	}
+}
+
+// Forget removes all cached state for a device.
+func (c *StateCache) Forget(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, id)
+	c.section.SectionDelete(id)
+}
+
+// detach stops refreshing the state of a device removed from its gateway, its state is retained so that it can be
+// served again if the device returns before it is purged.
+func (c *StateCache) detach(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, entry := range c.entries[id] {
+		entry.device = nil
+	}
+}
+
+// RefreshStale reads the state of any cached capability which has exceeded MaxAge, restored state is only refreshed
+// once its device has been seen.
+func (c *StateCache) RefreshStale(ctx context.Context) {
+	var stale []cachedState
+
+	c.lock.Lock()
+	now := c.now()
+
+	for _, deviceEntries := range c.entries {
+		for _, entry := range deviceEntries {
+			if entry.device != nil && now.Sub(entry.attempted) > c.MaxAge {
+				stale = append(stale, *entry)
+			}
+		}
+	}
+
+	c.lock.Unlock()
+
+	for _, entry := range stale {
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.refresh(ctx, entry.device, entry.flag)
+	}
+}
+
+// Start subscribes to the event bus, updating cached state as capability events are raised, and starts refreshing
+// stale state in the background.
+func (c *StateCache) Start(s state.EventSubscriber) {
+	c.subscriber = s
+	c.eventCh = make(chan any, 100)
+	c.stop = make(chan struct{})
+	s.Subscribe(c.eventCh)
+
+	go func(ch chan any) {
+		c.workers = map[string]chan any{}
+
+		for e := range ch {
+			c.dispatch(e)
+		}
+
+		for _, worker := range c.workers {
+			close(worker)
+		}
+	}(c.eventCh)
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(c.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.RefreshStale(context.Background())
+			case <-stop:
+				return
+			}
+		}
+	}(c.stop)
+}
+
+func (c *StateCache) Stop() {
+	if c.subscriber == nil {
+		return
+	}
+
+	c.subscriber.Unsubscribe(c.eventCh)
+	close(c.eventCh)
+	close(c.stop)
+	c.subscriber = nil
+}
+
+// dispatch passes an event about a device to that devices worker, creating it if need be. Any other event is handled
+// immediately.
+func (c *StateCache) dispatch(e any) {
+	id, found := eventDevice(e)
+	if !found {
+		c.updateOnEvent(e)
+		c.relay.Publish(e)
+		return
+	}
+
+	worker, found := c.workers[id]
+	if !found {
+		worker = make(chan any, 100)
+		c.workers[id] = worker
+
+		go func(ch chan any) {
+			for e := range ch {
+				c.updateOnEvent(e)
+				c.relay.Publish(e)
+			}
+		}(worker)
+	}
+
+	worker <- e
+}
+
+// eventDevice returns the identifier of the device an event is about, if it is about one.
+func eventDevice(e any) (string, bool) {
+	switch event := e.(type) {
+	case da.DeviceAdded:
+		return event.Device.Identifier().String(), true
+	case da.DeviceRemoved:
+		return event.Device.Identifier().String(), true
+	default:
+		if d, _, found := eventToCapability(e); found {
+			return d.Identifier().String(), true
+		}
+
+		return "", false
+	}
+}
+
+func (c *StateCache) Subscribe(ch chan any) {
+	c.relay.Subscribe(ch)
+}
+
+func (c *StateCache) Unsubscribe(ch chan any) {
+	c.relay.Unsubscribe(ch)
+}
+
+func (c *StateCache) updateOnEvent(e any) {
+	switch event := e.(type) {
+	case da.DeviceRemoved:
+		c.detach(event.Device.Identifier().String())
+	case state.DevicePurged:
+		c.Forget(event.Identifier)
+	case state.DeviceReplaced:
+		c.Forget(event.OldIdentifier)
+	default:
+		if d, capFlag, status, found := ExportDebugEvent(e); found {
+			c.store(d, capFlag, status)
+		} else if d, capFlag, found := eventToCapability(e); found {
+			c.refresh(WithFreshState(context.Background()), d, capFlag)
+		}
+	}
+}
+
+func (c *StateCache) persist(id string, entry *cachedState) {
+	data, err := json.Marshal(entry.value)
+	if err != nil {
+		return
+	}
+
+	s := c.section.Section(id, strconv.Itoa(int(entry.flag)))
+	s.Set("Value", data)
+	converter.Store(s, "Fetched", entry.fetched, converter.TimeEncoder)
+}
+
+func (c *StateCache) load() {
+	for _, id := range c.section.SectionKeys() {
+		ds := c.section.Section(id)
+
+		for _, key := range ds.SectionKeys() {
+			flag, err := strconv.Atoi(key)
+			if err != nil {
+				continue
+			}
+
+			s := ds.Section(key)
+
+			data, found := s.Bytes("Value")
+			if !found {
+				continue
+			}
+
+			fetched, _ := converter.Retrieve(s, "Fetched", converter.TimeDecoder)
+
+			value := restoreState(da.Capability(flag), data)
+
+			if _, found := c.entries[id]; !found {
+				c.entries[id] = map[da.Capability]*cachedState{}
+			}
+
+			c.entries[id][da.Capability(flag)] = &cachedState{
+				flag:      da.Capability(flag),
+				value:     value,
+				fetched:   fetched,
+				attempted: fetched,
+				restored:  true,
+			}
+		}
+	}
+}
+
+// restoreState decodes persisted capability state into the type ExportCapability produces for the capability, state
+// of unknown capabilities is served as the raw JSON.
+func restoreState(c da.Capability, data []byte) any {
+	if string(data) == "null" {
+		return nil
+	}
+
+	if zero, found := capabilityStates[c]; found {
+		value := reflect.New(reflect.TypeOf(zero)).Interface()
+
+		if err := json.Unmarshal(data, value); err == nil {
+			return value
+		}
+	}
+
+	return json.RawMessage(data)
+}
@@ -0,0 +1,367 @@
+package exporter
+
+import (
+	"context"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestStateCache(t *testing.T) {
+	capOne := da.Capability(1)
+
+	newDevice := func() *mocks.MockDevice {
+		mockCapOne := &mocks.BasicCapability{}
+		mockCapOne.On("Name").Return("capOne").Maybe()
+
+		mdev := &mocks.MockDevice{}
+		mdev.On("Identifier").Return(SimpleIdentifier{id: "one"}).Maybe()
+		mdev.On("Capabilities").Return([]da.Capability{capOne}).Maybe()
+		mdev.On("Capability", capOne).Return(mockCapOne).Maybe()
+
+		return mdev
+	}
+
+	t.Run("reads capability state once and serves subsequent exports from the cache", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportSimpleDevice", mock.Anything, mdev).Return(ExportedSimpleDevice{Identifier: "one", Gateway: "gw"})
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("state").Once()
+
+		now := time.Now()
+
+		c := NewStateCache(live, memory.New())
+		c.now = func() time.Time { return now }
+
+		for n := 0; n < 2; n++ {
+			exported := c.ExportDevice(context.Background(), mdev)
+
+			assert.Equal(t, "one", exported.Identifier)
+			assert.Equal(t, "gw", exported.Gateway)
+			assert.Equal(t, map[string]any{"capOne": "state"}, exported.Capabilities)
+			assert.Equal(t, map[string]CapabilityMetadata{"capOne": {Fetched: now}}, exported.CapabilityMetadata)
+		}
+	})
+
+	t.Run("reads capability state from the device if fresh state is requested", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("old").Once()
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("new").Once()
+
+		c := NewStateCache(live, memory.New())
+
+		assert.Equal(t, "old", c.ExportDeviceCapability(context.Background(), mdev, capOne))
+		assert.Equal(t, "new", c.ExportDeviceCapability(WithFreshState(context.Background()), mdev, capOne))
+		assert.Equal(t, "new", c.ExportDeviceCapability(context.Background(), mdev, capOne))
+	})
+
+	t.Run("reports state older than the maximum age as stale, and refreshes it", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportSimpleDevice", mock.Anything, mdev).Return(ExportedSimpleDevice{Identifier: "one"})
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("old").Once()
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("new").Once()
+
+		now := time.Now()
+
+		c := NewStateCache(live, memory.New())
+		c.now = func() time.Time { return now }
+
+		c.ExportDevice(context.Background(), mdev)
+
+		now = now.Add(2 * c.MaxAge)
+
+		exported := c.ExportDevice(context.Background(), mdev)
+		assert.Equal(t, "old", exported.Capabilities["capOne"])
+		assert.True(t, exported.CapabilityMetadata["capOne"].Stale)
+
+		c.RefreshStale(context.Background())
+
+		exported = c.ExportDevice(context.Background(), mdev)
+		assert.Equal(t, "new", exported.Capabilities["capOne"])
+		assert.False(t, exported.CapabilityMetadata["capOne"].Stale)
+	})
+
+	t.Run("updates cached state when a capability event is raised", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capabilities.OnOffFlag).Return("on").Once()
+
+		c := NewStateCache(live, memory.New())
+		c.updateOnEvent(capabilities.OnOffUpdate{Device: mdev})
+
+		assert.Equal(t, "on", c.ExportDeviceCapability(context.Background(), mdev, capabilities.OnOffFlag))
+	})
+
+	t.Run("relays events to subscribers once cached state has been updated by them", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capabilities.OnOffFlag).Return("on").Once()
+
+		eb := state.NewEventBus()
+
+		c := NewStateCache(live, memory.New())
+		c.Start(eb)
+		defer c.Stop()
+
+		ch := make(chan any, 1)
+		c.Subscribe(ch)
+		defer c.Unsubscribe(ch)
+
+		event := capabilities.OnOffUpdate{Device: mdev}
+		eb.Publish(event)
+
+		select {
+		case e := <-ch:
+			assert.Equal(t, event, e)
+			assert.Equal(t, "on", c.ExportDeviceCapability(context.Background(), mdev, capabilities.OnOffFlag))
+		case <-time.After(time.Second):
+			assert.Fail(t, "event was not relayed")
+		}
+	})
+
+	t.Run("caches the debug status carried by events, retaining it when refreshed", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capabilities.LocalDebugFlag).Return(nil).Once()
+
+		now := time.Now()
+
+		c := NewStateCache(live, memory.New())
+		c.now = func() time.Time { return now }
+
+		c.updateOnEvent(capabilities.LocalDebugSuccess{Device: mdev, MediaType: "application/json", Debug: "debug"})
+
+		now = now.Add(2 * c.MaxAge)
+		c.RefreshStale(context.Background())
+
+		status, ok := c.ExportDeviceCapability(context.Background(), mdev, capabilities.LocalDebugFlag).(*DebugStatus)
+		assert.True(t, ok)
+		assert.Equal(t, "application/json", status.MediaType)
+		assert.Equal(t, "debug", status.Debug)
+	})
+
+	t.Run("relays events of other devices while a device is slow to read", func(t *testing.T) {
+		slow := newDevice()
+
+		fast := &mocks.MockDevice{}
+		fast.On("Identifier").Return(SimpleIdentifier{id: "two"}).Maybe()
+
+		release := make(chan struct{})
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, slow, capabilities.OnOffFlag).Run(func(mock.Arguments) {
+			<-release
+		}).Return("on").Once()
+		live.On("ExportDeviceCapability", mock.Anything, fast, capabilities.OnOffFlag).Return("off").Once()
+
+		eb := state.NewEventBus()
+
+		c := NewStateCache(live, memory.New())
+		c.Start(eb)
+		defer c.Stop()
+
+		ch := make(chan any, 2)
+		c.Subscribe(ch)
+		defer c.Unsubscribe(ch)
+
+		eb.Publish(capabilities.OnOffUpdate{Device: slow})
+		eb.Publish(capabilities.OnOffUpdate{Device: fast})
+
+		select {
+		case e := <-ch:
+			assert.Equal(t, capabilities.OnOffUpdate{Device: fast}, e)
+		case <-time.After(time.Second):
+			assert.Fail(t, "event was not relayed")
+		}
+
+		close(release)
+
+		select {
+		case e := <-ch:
+			assert.Equal(t, capabilities.OnOffUpdate{Device: slow}, e)
+		case <-time.After(time.Second):
+			assert.Fail(t, "event was not relayed")
+		}
+	})
+
+	t.Run("retains cached state when a device is removed, serving it if the device is added again", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("state").Once()
+
+		now := time.Now()
+
+		s := memory.New()
+
+		c := NewStateCache(live, s)
+		c.now = func() time.Time { return now }
+		c.ExportDeviceCapability(context.Background(), mdev, capOne)
+
+		c.updateOnEvent(da.DeviceRemoved{Device: mdev})
+
+		now = now.Add(2 * c.MaxAge)
+		c.RefreshStale(context.Background())
+
+		assert.True(t, s.SectionExists("one"))
+
+		c.updateOnEvent(da.DeviceAdded{Device: mdev})
+
+		assert.Equal(t, "state", c.ExportDeviceCapability(context.Background(), mdev, capOne))
+	})
+
+	t.Run("forgets cached state when a removed device is purged", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("state").Twice()
+
+		s := memory.New()
+
+		c := NewStateCache(live, s)
+		c.ExportDeviceCapability(context.Background(), mdev, capOne)
+
+		c.updateOnEvent(da.DeviceRemoved{Device: mdev})
+		c.updateOnEvent(state.DevicePurged{Identifier: "one"})
+
+		assert.False(t, s.SectionExists("one"))
+
+		c.ExportDeviceCapability(context.Background(), mdev, capOne)
+	})
+
+	t.Run("forgets cached state when a device is replaced", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("state").Twice()
+
+		c := NewStateCache(live, memory.New())
+		c.ExportDeviceCapability(context.Background(), mdev, capOne)
+
+		c.updateOnEvent(state.DeviceReplaced{OldIdentifier: "one", NewIdentifier: "two"})
+
+		c.ExportDeviceCapability(context.Background(), mdev, capOne)
+	})
+
+	t.Run("retains the last state if a read fails, reporting it as stale once it exceeds the maximum age", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportSimpleDevice", mock.Anything, mdev).Return(ExportedSimpleDevice{Identifier: "one"})
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return("good").Once()
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return(nil).Once()
+
+		now := time.Now()
+		fetched := now
+
+		s := memory.New()
+
+		c := NewStateCache(live, s)
+		c.now = func() time.Time { return now }
+
+		c.ExportDevice(context.Background(), mdev)
+
+		now = now.Add(2 * c.MaxAge)
+
+		entry := c.refresh(context.Background(), mdev, capOne)
+		assert.Equal(t, "good", entry.value)
+		assert.Equal(t, fetched, entry.fetched)
+		assert.Equal(t, now, entry.attempted)
+
+		exported := c.ExportDevice(context.Background(), mdev)
+		assert.Equal(t, "good", exported.Capabilities["capOne"])
+		assert.True(t, exported.CapabilityMetadata["capOne"].Stale)
+
+		data, _ := s.Section("one", "1").Bytes("Value")
+		assert.Equal(t, `"good"`, string(data))
+	})
+
+	t.Run("reports state which has never been read successfully as stale", func(t *testing.T) {
+		mdev := newDevice()
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capOne).Return(nil).Once()
+
+		c := NewStateCache(live, memory.New())
+
+		entry := c.state(context.Background(), mdev, capOne)
+		assert.Nil(t, entry.value)
+		assert.True(t, c.metadata(entry).Stale)
+	})
+
+	t.Run("restores persisted state until the capability is read successfully", func(t *testing.T) {
+		mdev := &mocks.MockDevice{}
+		mdev.On("Identifier").Return(SimpleIdentifier{id: "one"}).Maybe()
+
+		lastUpdate := NullableTime(time.Now().Truncate(time.Second))
+		onOff := &OnOff{State: true, LastUpdate: LastUpdate{LastUpdate: &lastUpdate}}
+
+		live := &MockDeviceExporter{}
+		defer live.AssertExpectations(t)
+
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capabilities.OnOffFlag).Return(onOff).Once()
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capabilities.OnOffFlag).Return(nil).Once()
+		live.On("ExportDeviceCapability", mock.Anything, mdev, capabilities.OnOffFlag).Return(&OnOff{}).Once()
+
+		s := memory.New()
+
+		NewStateCache(live, s).ExportDeviceCapability(context.Background(), mdev, capabilities.OnOffFlag)
+
+		c := NewStateCache(live, s)
+
+		entry := c.state(context.Background(), mdev, capabilities.OnOffFlag)
+		assert.True(t, entry.restored)
+		assert.True(t, c.metadata(entry).Restored)
+
+		restored, ok := entry.value.(*OnOff)
+		assert.True(t, ok)
+		assert.True(t, restored.State)
+		assert.True(t, time.Time(lastUpdate).Equal(time.Time(*restored.LastUpdate.LastUpdate)))
+
+		entry = c.refresh(context.Background(), mdev, capabilities.OnOffFlag)
+		assert.True(t, entry.restored)
+		assert.Equal(t, restored, entry.value)
+
+		entry = c.refresh(context.Background(), mdev, capabilities.OnOffFlag)
+		assert.False(t, entry.restored)
+		assert.Equal(t, &OnOff{}, entry.value)
+	})
+}
@@ -0,0 +1,134 @@
+package invoker
+
+import (
+	"github.com/shimmeringbee/controller/interface/converters/schema"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	"sort"
+)
+
+// ActionDescription describes an action that may be invoked upon a capability, Payload is nil if the action takes no
+// payload.
+type ActionDescription struct {
+	Name        string
+	Description string
+	Payload     *schema.Schema `json:",omitempty"`
+}
+
+func debugActions() []ActionDescription {
+	return []ActionDescription{
+		{Name: "Start", Description: "Start collecting debug information from the device."},
+	}
+}
+
+var capabilityActions = map[da.Capability]func() []ActionDescription{
+	capabilities.DeviceDiscoveryFlag: func() []ActionDescription {
+		return []ActionDescription{
+			{Name: "Enable", Description: "Allow new devices to join the gateway.", Payload: schema.Generate(DeviceDiscoveryEnable{})},
+			{Name: "Disable", Description: "Stop allowing new devices to join the gateway."},
+		}
+	},
+	capabilities.EnumerateDeviceFlag: func() []ActionDescription {
+		return []ActionDescription{
+			{Name: "Enumerate", Description: "Enumerate the device to discover its capabilities."},
+		}
+	},
+	capabilities.OnOffFlag: func() []ActionDescription {
+		return []ActionDescription{
+			{Name: "On", Description: "Turn the device on."},
+			{Name: "Off", Description: "Turn the device off."},
+		}
+	},
+	capabilities.AlarmWarningDeviceFlag: func() []ActionDescription {
+		alarm := schema.Generate(AlarmWarningDeviceAlarm{})
+		alarm.Properties["AlarmType"].Enum = alarmTypeNames()
+		alarm.Properties["Volume"].Minimum = schema.Float(0)
+		alarm.Properties["Volume"].Maximum = schema.Float(1)
+
+		alert := schema.Generate(AlarmWarningDeviceAlert{})
+		alert.Properties["AlarmType"].Enum = alarmTypeNames()
+		alert.Properties["AlertType"].Enum = alertTypeNames()
+		alert.Properties["Volume"].Minimum = schema.Float(0)
+		alert.Properties["Volume"].Maximum = schema.Float(1)
+
+		return []ActionDescription{
+			{Name: "Alarm", Description: "Sound an alarm on the device.", Payload: alarm},
+			{Name: "Clear", Description: "Clear any alarm sounding on the device."},
+			{Name: "Alert", Description: "Sound a brief alert on the device.", Payload: alert},
+		}
+	},
+	capabilities.DeviceRemovalFlag: func() []ActionDescription {
+		return []ActionDescription{
+			{Name: "Remove", Description: "Remove the device from the gateway.", Payload: schema.Generate(RemoveDevice{})},
+		}
+	},
+	capabilities.IdentifyFlag: func() []ActionDescription {
+		identify := schema.Generate(IdentifyStart{})
+		identify.Properties["Duration"].Minimum = schema.Float(1)
+
+		return []ActionDescription{
+			{Name: "Identify", Description: "Cause the device to identify itself.", Payload: identify},
+		}
+	},
+	capabilities.LightFlag: func() []ActionDescription {
+		brightness := schema.Generate(LightSetBrightness{})
+		brightness.Properties["Brightness"].Minimum = schema.Float(0)
+		brightness.Properties["Duration"].Minimum = schema.Float(0)
+
+		temperature := schema.Generate(LightSetTemperature{})
+		temperature.Properties["Temperature"].Minimum = schema.Float(1)
+		temperature.Properties["Duration"].Minimum = schema.Float(0)
+
+		setColor := schema.Generate(LightSetColor{})
+		setColor.Properties["Duration"].Minimum = schema.Float(0)
+
+		return []ActionDescription{
+			{Name: "SetBrightness", Description: "Set the brightness of the light.", Payload: brightness},
+			{Name: "SetTemperature", Description: "Set the color temperature of the light.", Payload: temperature},
+			{Name: "SetColor", Description: "Set the color of the light.", Payload: setColor},
+		}
+	},
+	capabilities.MessageCaptureDebugFlag: func() []ActionDescription {
+		return []ActionDescription{
+			{Name: "Start", Description: "Start capturing messages to and from the device."},
+			{Name: "Stop", Description: "Stop capturing messages."},
+			{Name: "Clear", Description: "Clear captured messages."},
+			{Name: "EnableCaptureOnJoin", Description: "Capture messages from devices as soon as they join."},
+			{Name: "DisableCaptureOnJoin", Description: "Stop capturing messages from devices when they join."},
+		}
+	},
+	capabilities.LocalDebugFlag:  debugActions,
+	capabilities.RemoteDebugFlag: debugActions,
+}
+
+// CapabilityActions returns the actions that may be invoked upon a capability, an empty slice is returned if the
+// capability has no actions.
+func CapabilityActions(c da.Capability) []ActionDescription {
+	if actions, found := capabilityActions[c]; found {
+		return actions()
+	}
+
+	return []ActionDescription{}
+}
+
+func alarmTypeNames() []string {
+	var names []string
+
+	for _, name := range capabilities.AlarmTypeNameMapping {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func alertTypeNames() []string {
+	var names []string
+
+	for _, name := range capabilities.AlertTypeNameMapping {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,38 @@
+package invoker
+
+import (
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCapabilityActions(t *testing.T) {
+	t.Run("returns actions with payload schemas", func(t *testing.T) {
+		actions := CapabilityActions(capabilities.AlarmWarningDeviceFlag)
+		assert.Len(t, actions, 3)
+
+		assert.Equal(t, "Alarm", actions[0].Name)
+		assert.Equal(t, "object", actions[0].Payload.Type)
+		assert.Contains(t, actions[0].Payload.Properties["AlarmType"].Enum, capabilities.AlarmTypeNameMapping[capabilities.FireAlarm])
+		assert.Len(t, actions[0].Payload.Properties["AlarmType"].Enum, len(capabilities.AlarmTypeNameMapping))
+		assert.Equal(t, "integer", actions[0].Payload.Properties["Duration"].Type)
+
+		assert.Equal(t, "Clear", actions[1].Name)
+		assert.Nil(t, actions[1].Payload)
+
+		assert.Len(t, actions[2].Payload.Properties["AlertType"].Enum, len(capabilities.AlertTypeNameMapping))
+	})
+
+	t.Run("returns an empty slice for capabilities without actions", func(t *testing.T) {
+		assert.Empty(t, CapabilityActions(capabilities.TemperatureSensorFlag))
+		assert.NotNil(t, CapabilityActions(capabilities.TemperatureSensorFlag))
+	})
+
+	t.Run("describes every capability with an action", func(t *testing.T) {
+		assert.NotEmpty(t, CapabilityActions(capabilities.LocalDebugFlag))
+		assert.NotEmpty(t, CapabilityActions(capabilities.RemoteDebugFlag))
+		assert.NotEmpty(t, CapabilityActions(capabilities.MessageCaptureDebugFlag))
+		assert.NotEmpty(t, CapabilityActions(capabilities.LightFlag))
+		assert.NotEmpty(t, CapabilityActions(capabilities.IdentifyFlag))
+	})
+}
@@ -0,0 +1,81 @@
+package invoker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"time"
+)
+
+type queueRequestKey struct{}
+
+// RequestQueueing marks actions invoked with the returned context to be queued, rather than being invoked immediately.
+// An expiry of zero uses the queues default.
+func RequestQueueing(ctx context.Context, expiry time.Duration) context.Context {
+	return context.WithValue(ctx, queueRequestKey{}, expiry)
+}
+
+// WithCommandQueue wraps an Invoker, queueing actions for sleepy devices, or if queueing has been requested by the
+// context or the payloads control metadata. Queued actions return the state.QueuedCommand and are attempted
+// immediately in the background.
+func WithCommandQueue(i Invoker, q *state.CommandQueue, o *state.DeviceOrganiser) Invoker {
+	return func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+		id := dad.Identifier().String()
+
+		expiry, queue := ctx.Value(queueRequestKey{}).(time.Duration)
+
+		if !queue {
+			md, _ := o.Device(id)
+			queue = md.Sleepy || queueRequestedInPayload(payload)
+		}
+
+		if !queue {
+			return i(ctx, s, l, r, dad, capabilityName, actionName, payload)
+		}
+
+		cmd, err := q.Enqueue(id, capabilityName, actionName, payload, l, r, expiry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to queue action: %w", err)
+		}
+
+		q.Retry(id)
+
+		return cmd, nil
+	}
+}
+
+func queueRequestedInPayload(payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+
+	var metadata MetadataPayload
+	if err := json.Unmarshal(payload, &metadata); err != nil {
+		return false
+	}
+
+	return metadata.Control.Queue
+}
+
+// CommandExecutor constructs a state.CommandExecutor which invokes queued commands, rejecting commands which will
+// never succeed.
+func CommandExecutor(i Invoker, g state.GatewayMapper, s layers.OutputStack) state.CommandExecutor {
+	return func(ctx context.Context, c state.QueuedCommand) error {
+		dad, found := g.Device(c.Device)
+		if !found {
+			return fmt.Errorf("%w: device not found", state.ErrCommandRejected)
+		}
+
+		_, err := i(ctx, s, c.Layer, c.Retention, dad, c.Capability, c.Action, c.Payload)
+
+		if errors.Is(err, ActionUserError) || errors.Is(err, ActionNotSupported) || errors.Is(err, CapabilityNotSupported) {
+			return fmt.Errorf("%w: %w", state.ErrCommandRejected, err)
+		}
+
+		return err
+	}
+}
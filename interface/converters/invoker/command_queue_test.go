@@ -0,0 +1,130 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestWithCommandQueue(t *testing.T) {
+	d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+	id := d.Identifier().String()
+
+	t.Run("invokes actions immediately on devices which are not sleepy", func(t *testing.T) {
+		mdi := &MockDeviceInvoker{}
+		defer mdi.AssertExpectations(t)
+
+		mdi.On("InvokeDevice", mock.Anything, mock.Anything, "http", layers.OneShot, d, "OnOff", "On", []byte(nil)).Return(struct{}{}, nil)
+
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		q := state.NewCommandQueue(memory.New(), func(ctx context.Context, c state.QueuedCommand) error { return errors.New("unreachable") })
+
+		result, err := WithCommandQueue(mdi.InvokeDevice, q, &do)(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, struct{}{}, result)
+		assert.Empty(t, q.Commands(id))
+	})
+
+	t.Run("queues actions for sleepy devices", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice(id)
+		do.SetDeviceSleepy(id, true)
+
+		q := state.NewCommandQueue(memory.New(), func(ctx context.Context, c state.QueuedCommand) error { return errors.New("unreachable") })
+
+		result, err := WithCommandQueue(nil, q, &do)(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+
+		cmd, ok := result.(state.QueuedCommand)
+		assert.True(t, ok)
+		assert.Equal(t, "On", cmd.Action)
+		assert.Len(t, q.Commands(id), 1)
+	})
+
+	t.Run("queues actions if requested by the context with an expiry", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		q := state.NewCommandQueue(memory.New(), func(ctx context.Context, c state.QueuedCommand) error { return errors.New("unreachable") })
+
+		ctx := RequestQueueing(context.Background(), time.Minute)
+
+		result, err := WithCommandQueue(nil, q, &do)(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+
+		cmd := result.(state.QueuedCommand)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), cmd.Expires, time.Second)
+	})
+
+	t.Run("queues actions if requested by the payload", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		q := state.NewCommandQueue(memory.New(), func(ctx context.Context, c state.QueuedCommand) error { return errors.New("unreachable") })
+
+		result, err := WithCommandQueue(nil, q, &do)(context.Background(), nil, "mqtt", layers.OneShot, d, "OnOff", "On", []byte(`{"control":{"queue":true}}`))
+		assert.NoError(t, err)
+
+		_, ok := result.(state.QueuedCommand)
+		assert.True(t, ok)
+	})
+}
+
+func TestCommandExecutor(t *testing.T) {
+	d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+	id := d.Identifier().String()
+
+	t.Run("invokes the queued command", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+		mgm.On("Device", id).Return(d, true)
+
+		mdi := &MockDeviceInvoker{}
+		defer mdi.AssertExpectations(t)
+		mdi.On("InvokeDevice", mock.Anything, mock.Anything, "http", layers.Maintain, d, "OnOff", "On", []byte(`{}`)).Return(struct{}{}, nil)
+
+		err := CommandExecutor(mdi.InvokeDevice, mgm, nil)(context.Background(), state.QueuedCommand{Device: id, Capability: "OnOff", Action: "On", Payload: []byte(`{}`), Layer: "http", Retention: layers.Maintain})
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects commands for missing devices", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+		mgm.On("Device", id).Return(d, false)
+
+		err := CommandExecutor(nil, mgm, nil)(context.Background(), state.QueuedCommand{Device: id})
+		assert.ErrorIs(t, err, state.ErrCommandRejected)
+	})
+
+	t.Run("rejects commands the device can never perform", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+		mgm.On("Device", id).Return(d, true)
+
+		mdi := &MockDeviceInvoker{}
+		defer mdi.AssertExpectations(t)
+		mdi.On("InvokeDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, d, "OnOff", "On", []byte(nil)).Return(nil, ActionNotSupported)
+
+		err := CommandExecutor(mdi.InvokeDevice, mgm, nil)(context.Background(), state.QueuedCommand{Device: id, Capability: "OnOff", Action: "On"})
+		assert.ErrorIs(t, err, state.ErrCommandRejected)
+		assert.ErrorIs(t, err, ActionNotSupported)
+	})
+
+	t.Run("does not reject commands which time out", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+		mgm.On("Device", id).Return(d, true)
+
+		mdi := &MockDeviceInvoker{}
+		defer mdi.AssertExpectations(t)
+		mdi.On("InvokeDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, d, "OnOff", "On", []byte(nil)).Return(nil, context.DeadlineExceeded)
+
+		err := CommandExecutor(mdi.InvokeDevice, mgm, nil)(context.Background(), state.QueuedCommand{Device: id, Capability: "OnOff", Action: "On"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NotErrorIs(t, err, state.ErrCommandRejected)
+	})
+}
@@ -3,10 +3,12 @@ package invoker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/shimmeringbee/controller/layers"
 	"github.com/shimmeringbee/da"
 	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/capabilities/color"
 	"time"
 )
 
@@ -22,8 +24,11 @@ const CapabilityNotSupported = ActionError("capability not available on device")
 const ActionNotSupported = ActionError("action not available on capability")
 const ActionUserError = ActionError("user provided bad data")
 
+// DefaultActionTimeout is applied to actions if the context provided has no deadline.
+const DefaultActionTimeout = 10 * time.Second
+
 func InvokeDeviceAction(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
-	invokeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	invokeCtx, cancel := withDefaultTimeout(ctx, DefaultActionTimeout)
 	defer cancel()
 
 	l, r, err := resolveOutputLayerAndRetention(l, r, payload)
@@ -50,13 +55,54 @@ func InvokeDeviceAction(ctx context.Context, s layers.OutputStack, l string, r l
 	return nil, CapabilityNotSupported
 }
 
+// WithCapabilityTimeouts wraps an Invoker, applying a timeout to actions upon the named capabilities. The timeout
+// replaces any deadline of the context provided, though the action is still cancelled if the context is.
+func WithCapabilityTimeouts(i Invoker, timeouts map[string]time.Duration) Invoker {
+	return func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+		if timeout, found := timeouts[capabilityName]; found && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = withReplacedTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return i(ctx, s, l, r, dad, capabilityName, actionName, payload)
+	}
+}
+
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, found := ctx.Deadline(); found {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// withReplacedTimeout returns a context with the timeout in place of any deadline of ctx, which is cancelled if ctx is
+// cancelled before its deadline.
+func withReplacedTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	timeoutCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+
+	return timeoutCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
 type OutputLayerMetadata struct {
 	Layer     string `json:"layer"`
 	Retention string `json:"retention"`
 }
 
 type ControlMetadata struct {
-	OutputLayer OutputLayerMetadata `json:"output"`
+	OutputLayer    OutputLayerMetadata `json:"output"`
+	Queue          bool                `json:"queue"`
+	IdempotencyKey string              `json:"idempotencyKey"`
 }
 
 type MetadataPayload struct {
@@ -99,13 +145,22 @@ func doDeviceCapabilityAction(ctx context.Context, c any, a string, b []byte) (a
 		return doAlarmWarningDevice(ctx, cast, a, b)
 	case capabilities.DeviceRemoval:
 		return doDeviceRemoval(ctx, cast, a, b)
+	case capabilities.Identify:
+		return doIdentify(ctx, cast, a, b)
+	case capabilities.Light:
+		return doLight(ctx, cast, a, b)
+	case capabilities.MessageCaptureDebug:
+		return doMessageCaptureDebug(ctx, cast, a)
+	case capabilities.LocalDebug:
+		// LocalDebug and RemoteDebug share a method set, so this handles both.
+		return doDebug(ctx, cast, a)
 	}
 
 	return nil, ActionNotSupported
 }
 
 type DeviceDiscoveryEnable struct {
-	Duration int
+	Duration int `description:"Duration to allow discovery for, in milliseconds."`
 }
 
 func doDeviceDiscovery(ctx context.Context, c capabilities.DeviceDiscovery, a string, b []byte) (any, error) {
@@ -146,17 +201,17 @@ func doOnOff(ctx context.Context, c capabilities.OnOff, a string) (any, error) {
 }
 
 type AlarmWarningDeviceAlarm struct {
-	AlarmType string
-	Volume    float64
-	Visual    bool
-	Duration  int
+	AlarmType string  `description:"Type of alarm to sound."`
+	Volume    float64 `description:"Volume of the alarm, between 0.0 and 1.0."`
+	Visual    bool    `description:"Whether the alarm should also be visual."`
+	Duration  int     `description:"Duration of the alarm, in milliseconds."`
 }
 
 type AlarmWarningDeviceAlert struct {
-	AlarmType string
-	AlertType string
-	Volume    float64
-	Visual    bool
+	AlarmType string  `description:"Type of alarm the alert is for."`
+	AlertType string  `description:"Type of alert to sound."`
+	Volume    float64 `description:"Volume of the alert, between 0.0 and 1.0."`
+	Visual    bool    `description:"Whether the alert should also be visual."`
 }
 
 func stringToAlarmType(alarmType string) (capabilities.AlarmType, bool) {
@@ -220,7 +275,7 @@ func doAlarmWarningDevice(ctx context.Context, c capabilities.AlarmWarningDevice
 }
 
 type RemoveDevice struct {
-	Force bool
+	Force bool `description:"Remove the device from the gateway without requesting the device leaves."`
 }
 
 func doDeviceRemoval(ctx context.Context, c capabilities.DeviceRemoval, a string, b []byte) (any, error) {
@@ -241,3 +296,157 @@ func doDeviceRemoval(ctx context.Context, c capabilities.DeviceRemoval, a string
 
 	return nil, ActionNotSupported
 }
+
+type IdentifyStart struct {
+	Duration int `description:"Duration to identify for, in milliseconds."`
+}
+
+func doIdentify(ctx context.Context, c capabilities.Identify, a string, b []byte) (any, error) {
+	switch a {
+	case "Identify":
+		input := IdentifyStart{}
+		if err := json.Unmarshal(b, &input); err != nil {
+			return nil, fmt.Errorf("%w: unable to parse user data: %s", ActionUserError, err.Error())
+		}
+
+		if input.Duration <= 0 {
+			return nil, fmt.Errorf("%w: unable to parse user data: duration must be positive", ActionUserError)
+		}
+
+		duration := time.Duration(input.Duration) * time.Millisecond
+		return struct{}{}, c.Identify(ctx, duration)
+	}
+
+	return nil, ActionNotSupported
+}
+
+type LightSetBrightness struct {
+	Brightness float64 `description:"Brightness of the light."`
+	Duration   int     `description:"Transition time, in milliseconds."`
+}
+
+type LightSetTemperature struct {
+	Temperature float64 `description:"Color temperature of the light, in Kelvin."`
+	Duration    int     `description:"Transition time, in milliseconds."`
+}
+
+type LightHSVColor struct {
+	Hue        float64
+	Saturation float64
+	Value      float64
+}
+
+type LightXYYColor struct {
+	X  float64
+	Y  float64
+	Y2 float64
+}
+
+type LightRGBColor struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+type LightSetColor struct {
+	HSV      *LightHSVColor `description:"Color as hue, saturation and value, exactly one color must be provided."`
+	XYY      *LightXYYColor `description:"Color as CIE xyY, exactly one color must be provided."`
+	RGB      *LightRGBColor `description:"Color as sRGB, exactly one color must be provided."`
+	Duration int            `description:"Transition time, in milliseconds."`
+}
+
+func (l LightSetColor) color() (color.ConvertibleColor, bool) {
+	var provided []color.ConvertibleColor
+
+	if l.HSV != nil {
+		provided = append(provided, color.HSVColor{Hue: l.HSV.Hue, Sat: l.HSV.Saturation, Value: l.HSV.Value})
+	}
+
+	if l.XYY != nil {
+		provided = append(provided, color.XYColor{X: l.XYY.X, Y: l.XYY.Y, Y2: l.XYY.Y2})
+	}
+
+	if l.RGB != nil {
+		provided = append(provided, color.SRGBColor{R: l.RGB.R, G: l.RGB.G, B: l.RGB.B})
+	}
+
+	if len(provided) != 1 {
+		return nil, false
+	}
+
+	return provided[0], true
+}
+
+func doLight(ctx context.Context, c capabilities.Light, a string, b []byte) (any, error) {
+	switch a {
+	case "SetBrightness":
+		input := LightSetBrightness{}
+		if err := json.Unmarshal(b, &input); err != nil {
+			return nil, fmt.Errorf("%w: unable to parse user data: %s", ActionUserError, err.Error())
+		}
+
+		if input.Brightness < 0 || input.Duration < 0 {
+			return nil, fmt.Errorf("%w: unable to parse user data: brightness and duration must not be negative", ActionUserError)
+		}
+
+		duration := time.Duration(input.Duration) * time.Millisecond
+		return struct{}{}, c.SetBrightness(ctx, input.Brightness, duration)
+	case "SetTemperature":
+		input := LightSetTemperature{}
+		if err := json.Unmarshal(b, &input); err != nil {
+			return nil, fmt.Errorf("%w: unable to parse user data: %s", ActionUserError, err.Error())
+		}
+
+		if input.Temperature <= 0 || input.Duration < 0 {
+			return nil, fmt.Errorf("%w: unable to parse user data: temperature must be positive and duration must not be negative", ActionUserError)
+		}
+
+		duration := time.Duration(input.Duration) * time.Millisecond
+		return struct{}{}, c.SetTemperature(ctx, input.Temperature, duration)
+	case "SetColor":
+		input := LightSetColor{}
+		if err := json.Unmarshal(b, &input); err != nil {
+			return nil, fmt.Errorf("%w: unable to parse user data: %s", ActionUserError, err.Error())
+		}
+
+		if input.Duration < 0 {
+			return nil, fmt.Errorf("%w: unable to parse user data: duration must not be negative", ActionUserError)
+		}
+
+		newColor, ok := input.color()
+		if !ok {
+			return nil, fmt.Errorf("%w: unable to parse user data: exactly one of HSV, XYY or RGB must be provided", ActionUserError)
+		}
+
+		duration := time.Duration(input.Duration) * time.Millisecond
+		return struct{}{}, c.SetColor(ctx, newColor, duration)
+	}
+
+	return nil, ActionNotSupported
+}
+
+func doMessageCaptureDebug(ctx context.Context, c capabilities.MessageCaptureDebug, a string) (any, error) {
+	switch a {
+	case "Start":
+		return struct{}{}, c.Start(ctx)
+	case "Stop":
+		return struct{}{}, c.Stop(ctx)
+	case "Clear":
+		return struct{}{}, c.Clear(ctx)
+	case "EnableCaptureOnJoin":
+		return struct{}{}, c.EnableCaptureOnJoin(ctx)
+	case "DisableCaptureOnJoin":
+		return struct{}{}, c.DisableCaptureOnJoin(ctx)
+	}
+
+	return nil, ActionNotSupported
+}
+
+func doDebug(ctx context.Context, c capabilities.LocalDebug, a string) (any, error) {
+	switch a {
+	case "Start":
+		return struct{}{}, c.Start(ctx)
+	}
+
+	return nil, ActionNotSupported
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/shimmeringbee/controller/layers"
 	"github.com/shimmeringbee/da"
 	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/capabilities/color"
 	"github.com/shimmeringbee/da/capabilities/mocks"
 	mocks2 "github.com/shimmeringbee/da/mocks"
 	"github.com/stretchr/testify/assert"
@@ -262,3 +263,259 @@ func Test_doDeviceCapabilityAction_DeviceRemoval(t *testing.T) {
 		assert.Equal(t, expectedResult, actualResult)
 	})
 }
+
+func Test_doDeviceCapabilityAction_Identify(t *testing.T) {
+	t.Run("Identify invokes the capability", func(t *testing.T) {
+		mockCapability := &mocks.Identify{}
+		defer mockCapability.AssertExpectations(t)
+
+		mockCapability.On("Identify", mock.Anything, 5*time.Second).Return(nil)
+
+		inputBytes, _ := json.Marshal(IdentifyStart{Duration: 5000})
+
+		actualResult, err := doDeviceCapabilityAction(context.Background(), mockCapability, "Identify", inputBytes)
+		assert.NoError(t, err)
+
+		assert.Equal(t, struct{}{}, actualResult)
+	})
+
+	t.Run("Identify returns a user error if the duration is not positive", func(t *testing.T) {
+		mockCapability := &mocks.Identify{}
+		defer mockCapability.AssertExpectations(t)
+
+		inputBytes, _ := json.Marshal(IdentifyStart{Duration: 0})
+
+		_, err := doDeviceCapabilityAction(context.Background(), mockCapability, "Identify", inputBytes)
+		assert.ErrorIs(t, err, ActionUserError)
+	})
+}
+
+func Test_doDeviceCapabilityAction_Light(t *testing.T) {
+	t.Run("SetBrightness invokes the capability", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		mockCapability.On("SetBrightness", mock.Anything, 0.5, time.Second).Return(nil)
+
+		inputBytes, _ := json.Marshal(LightSetBrightness{Brightness: 0.5, Duration: 1000})
+
+		actualResult, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetBrightness", inputBytes)
+		assert.NoError(t, err)
+
+		assert.Equal(t, struct{}{}, actualResult)
+	})
+
+	t.Run("SetBrightness returns a user error if brightness is negative", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		inputBytes, _ := json.Marshal(LightSetBrightness{Brightness: -1})
+
+		_, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetBrightness", inputBytes)
+		assert.ErrorIs(t, err, ActionUserError)
+	})
+
+	t.Run("SetTemperature invokes the capability", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		mockCapability.On("SetTemperature", mock.Anything, 2700.0, time.Duration(0)).Return(nil)
+
+		inputBytes, _ := json.Marshal(LightSetTemperature{Temperature: 2700})
+
+		actualResult, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetTemperature", inputBytes)
+		assert.NoError(t, err)
+
+		assert.Equal(t, struct{}{}, actualResult)
+	})
+
+	t.Run("SetTemperature returns a user error if temperature is not positive", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		inputBytes, _ := json.Marshal(LightSetTemperature{Temperature: 0})
+
+		_, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetTemperature", inputBytes)
+		assert.ErrorIs(t, err, ActionUserError)
+	})
+
+	t.Run("SetColor invokes the capability with the provided color", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		mockCapability.On("SetColor", mock.Anything, color.SRGBColor{R: 255, G: 128, B: 0}, 2*time.Second).Return(nil)
+
+		inputBytes, _ := json.Marshal(LightSetColor{RGB: &LightRGBColor{R: 255, G: 128, B: 0}, Duration: 2000})
+
+		actualResult, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetColor", inputBytes)
+		assert.NoError(t, err)
+
+		assert.Equal(t, struct{}{}, actualResult)
+	})
+
+	t.Run("SetColor returns a user error if no color is provided", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		inputBytes, _ := json.Marshal(LightSetColor{})
+
+		_, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetColor", inputBytes)
+		assert.ErrorIs(t, err, ActionUserError)
+	})
+
+	t.Run("SetColor returns a user error if multiple colors are provided", func(t *testing.T) {
+		mockCapability := &mocks.Light{}
+		defer mockCapability.AssertExpectations(t)
+
+		inputBytes, _ := json.Marshal(LightSetColor{HSV: &LightHSVColor{Hue: 120}, XYY: &LightXYYColor{X: 0.3}})
+
+		_, err := doDeviceCapabilityAction(context.Background(), mockCapability, "SetColor", inputBytes)
+		assert.ErrorIs(t, err, ActionUserError)
+	})
+}
+
+var _ capabilities.MessageCaptureDebug = (*mockMessageCaptureDebug)(nil)
+
+type mockMessageCaptureDebug struct {
+	mock.Mock
+}
+
+func (m *mockMessageCaptureDebug) Start(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) Stop(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) Status(ctx context.Context) (bool, error) {
+	args := m.Called(ctx)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockMessageCaptureDebug) Get(ctx context.Context) ([]capabilities.MessageCapture, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]capabilities.MessageCapture), args.Error(1)
+}
+
+func (m *mockMessageCaptureDebug) Clear(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) EnableCaptureOnJoin(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func (m *mockMessageCaptureDebug) DisableCaptureOnJoin(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func Test_doDeviceCapabilityAction_MessageCaptureDebug(t *testing.T) {
+	for _, action := range []string{"Start", "Stop", "Clear", "EnableCaptureOnJoin", "DisableCaptureOnJoin"} {
+		t.Run(action+" invokes the capability", func(t *testing.T) {
+			mockCapability := &mockMessageCaptureDebug{}
+			defer mockCapability.AssertExpectations(t)
+
+			mockCapability.On(action, mock.Anything).Return(nil)
+
+			actualResult, err := doDeviceCapabilityAction(context.Background(), mockCapability, action, nil)
+			assert.NoError(t, err)
+
+			assert.Equal(t, struct{}{}, actualResult)
+		})
+	}
+}
+
+type mockDebug struct {
+	mock.Mock
+}
+
+func (m *mockDebug) Start(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func Test_doDeviceCapabilityAction_Debug(t *testing.T) {
+	t.Run("Start invokes the capability", func(t *testing.T) {
+		mockCapability := &mockDebug{}
+		defer mockCapability.AssertExpectations(t)
+
+		mockCapability.On("Start", mock.Anything).Return(nil)
+
+		actualResult, err := doDeviceCapabilityAction(context.Background(), mockCapability, "Start", nil)
+		assert.NoError(t, err)
+
+		assert.Equal(t, struct{}{}, actualResult)
+	})
+
+	t.Run("unknown actions are not supported", func(t *testing.T) {
+		mockCapability := &mockDebug{}
+		defer mockCapability.AssertExpectations(t)
+
+		_, err := doDeviceCapabilityAction(context.Background(), mockCapability, "Stop", nil)
+		assert.ErrorIs(t, err, ActionNotSupported)
+	})
+}
+
+func TestWithCapabilityTimeouts(t *testing.T) {
+	t.Run("applies the capabilities timeout if the context has no deadline", func(t *testing.T) {
+		var deadline time.Time
+		var hasDeadline bool
+
+		wrapped := WithCapabilityTimeouts(func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			deadline, hasDeadline = ctx.Deadline()
+			return nil, nil
+		}, map[string]time.Duration{"EnumerateDevice": time.Minute})
+
+		wrapped(context.Background(), nil, "", layers.OneShot, nil, "EnumerateDevice", "Enumerate", nil)
+
+		assert.True(t, hasDeadline)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("does not apply a timeout to other capabilities", func(t *testing.T) {
+		var hasDeadline bool
+
+		wrapped := WithCapabilityTimeouts(func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			_, hasDeadline = ctx.Deadline()
+			return nil, nil
+		}, map[string]time.Duration{"EnumerateDevice": time.Minute})
+
+		wrapped(context.Background(), nil, "", layers.OneShot, nil, "OnOff", "On", nil)
+
+		assert.False(t, hasDeadline)
+	})
+
+	t.Run("replaces an existing deadline with the capabilities timeout", func(t *testing.T) {
+		var deadline time.Time
+		var err error
+
+		wrapped := WithCapabilityTimeouts(func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			deadline, _ = ctx.Deadline()
+			time.Sleep(20 * time.Millisecond)
+			err = ctx.Err()
+			return nil, nil
+		}, map[string]time.Duration{"EnumerateDevice": time.Minute})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		wrapped(ctx, nil, "", layers.OneShot, nil, "EnumerateDevice", "Enumerate", nil)
+
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+		assert.NoError(t, err)
+	})
+
+	t.Run("cancels the action if the context provided is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+
+		wrapped := WithCapabilityTimeouts(func(actionCtx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			cancel()
+			<-actionCtx.Done()
+			return nil, actionCtx.Err()
+		}, map[string]time.Duration{"EnumerateDevice": time.Minute})
+
+		_, err := wrapped(ctx, nil, "", layers.OneShot, nil, "EnumerateDevice", "Enumerate", nil)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
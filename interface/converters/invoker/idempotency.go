@@ -0,0 +1,161 @@
+package invoker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/da"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long the outcome of an action invoked with an idempotency key is retained.
+const DefaultIdempotencyWindow = 10 * time.Minute
+
+const IdempotencyKeyReused = ActionError("idempotency key reused for a different action")
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey attaches an idempotency key to actions invoked with the returned context.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+type idempotentResult struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	completed   time.Time
+	result      any
+	err         error
+	evicted     bool
+}
+
+// IdempotencyCache retains the outcome of actions invoked with an idempotency key, such that repeated requests with
+// the same key return the original outcome rather than invoking the action again.
+type IdempotencyCache struct {
+	lock    *sync.Mutex
+	results map[string]*idempotentResult
+	window  time.Duration
+	now     func() time.Time
+}
+
+func NewIdempotencyCache(window time.Duration) *IdempotencyCache {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+
+	return &IdempotencyCache{
+		lock:    &sync.Mutex{},
+		results: map[string]*idempotentResult{},
+		window:  window,
+		now:     time.Now,
+	}
+}
+
+// WithIdempotency wraps an Invoker, returning the cached outcome of any action previously invoked with the same
+// idempotency key, taken from the context or the payloads control metadata. Both results and errors are cached,
+// concurrent invocations with the same key wait for the first to complete. Errors caused by the context of the first
+// invocation ending are not cached, as the client is expected to retry, and waiting invocations try again.
+func WithIdempotency(i Invoker, c *IdempotencyCache) Invoker {
+	return func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+		key, found := ctx.Value(idempotencyKey{}).(string)
+		if !found || len(key) == 0 {
+			key = idempotencyKeyInPayload(payload)
+		}
+
+		if len(key) == 0 {
+			return i(ctx, s, l, r, dad, capabilityName, actionName, payload)
+		}
+
+		fingerprint := sha256.Sum256([]byte(dad.Identifier().String() + "\x00" + capabilityName + "\x00" + actionName + "\x00" + string(payload)))
+
+		for {
+			entry, owner := c.claim(key, fingerprint)
+
+			if entry.fingerprint != fingerprint {
+				return nil, IdempotencyKeyReused
+			}
+
+			if owner {
+				result, err := i(ctx, s, l, r, dad, capabilityName, actionName, payload)
+
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					c.evict(key, entry)
+					return result, err
+				}
+
+				entry.result, entry.err = result, err
+				c.complete(entry)
+				return entry.result, entry.err
+			}
+
+			select {
+			case <-entry.done:
+				if !entry.evicted {
+					return entry.result, entry.err
+				}
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+// claim returns the entry for a key, creating it if absent or expired, returning true if the caller created the entry
+// and must complete it.
+func (c *IdempotencyCache) claim(key string, fingerprint [sha256.Size]byte) (*idempotentResult, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+
+	for k, e := range c.results {
+		if !e.completed.IsZero() && now.Sub(e.completed) > c.window {
+			delete(c.results, k)
+		}
+	}
+
+	if entry, found := c.results[key]; found {
+		return entry, false
+	}
+
+	entry := &idempotentResult{fingerprint: fingerprint, done: make(chan struct{})}
+	c.results[key] = entry
+
+	return entry, true
+}
+
+func (c *IdempotencyCache) complete(entry *idempotentResult) {
+	c.lock.Lock()
+	entry.completed = c.now()
+	c.lock.Unlock()
+
+	close(entry.done)
+}
+
+// evict removes an entry without retaining its outcome, releasing any invocations waiting upon it to try again.
+func (c *IdempotencyCache) evict(key string, entry *idempotentResult) {
+	c.lock.Lock()
+	if c.results[key] == entry {
+		delete(c.results, key)
+	}
+	entry.evicted = true
+	c.lock.Unlock()
+
+	close(entry.done)
+}
+
+func idempotencyKeyInPayload(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+
+	var metadata MetadataPayload
+	if err := json.Unmarshal(payload, &metadata); err != nil {
+		return ""
+	}
+
+	return metadata.Control.IdempotencyKey
+}
@@ -0,0 +1,215 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+	counting := func(count *int, result any, err error) Invoker {
+		return func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			*count++
+			return result, err
+		}
+	}
+
+	t.Run("invokes every action without an idempotency key", func(t *testing.T) {
+		count := 0
+		i := WithIdempotency(counting(&count, true, nil), NewIdempotencyCache(time.Minute))
+
+		_, _ = i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		_, _ = i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("returns the cached result for a repeated idempotency key", func(t *testing.T) {
+		count := 0
+		i := WithIdempotency(counting(&count, "result", nil), NewIdempotencyCache(time.Minute))
+		ctx := WithIdempotencyKey(context.Background(), "key")
+
+		result, err := i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "result", result)
+
+		result, err = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "result", result)
+
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("caches errors for a repeated idempotency key", func(t *testing.T) {
+		count := 0
+		expectedErr := errors.New("failed")
+		i := WithIdempotency(counting(&count, nil, expectedErr), NewIdempotencyCache(time.Minute))
+		ctx := WithIdempotencyKey(context.Background(), "key")
+
+		_, err := i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.ErrorIs(t, err, expectedErr)
+
+		_, err = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.ErrorIs(t, err, expectedErr)
+
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("does not cache errors caused by the context ending, invoking the action again on retry", func(t *testing.T) {
+		count := 0
+		calls := 0
+
+		i := WithIdempotency(func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			calls++
+
+			if calls == 1 {
+				return nil, fmt.Errorf("invoking: %w", context.Canceled)
+			}
+
+			count++
+			return "result", nil
+		}, NewIdempotencyCache(time.Minute))
+
+		ctx := WithIdempotencyKey(context.Background(), "key")
+
+		_, err := i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		result, err := i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "result", result)
+
+		result, err = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "result", result)
+
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("reads the idempotency key from the payload", func(t *testing.T) {
+		count := 0
+		i := WithIdempotency(counting(&count, true, nil), NewIdempotencyCache(time.Minute))
+		payload := []byte(`{"control":{"idempotencyKey":"key"}}`)
+
+		_, _ = i(context.Background(), nil, "mqtt", layers.OneShot, d, "OnOff", "On", payload)
+		_, _ = i(context.Background(), nil, "mqtt", layers.OneShot, d, "OnOff", "On", payload)
+
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("returns an error if the key is reused for a different action", func(t *testing.T) {
+		count := 0
+		i := WithIdempotency(counting(&count, true, nil), NewIdempotencyCache(time.Minute))
+		ctx := WithIdempotencyKey(context.Background(), "key")
+
+		_, err := i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+
+		_, err = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "Off", nil)
+		assert.ErrorIs(t, err, IdempotencyKeyReused)
+
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("invokes the action again once the window has passed", func(t *testing.T) {
+		count := 0
+		now := time.Now()
+
+		c := NewIdempotencyCache(time.Minute)
+		c.now = func() time.Time { return now }
+
+		i := WithIdempotency(counting(&count, true, nil), c)
+		ctx := WithIdempotencyKey(context.Background(), "key")
+
+		_, _ = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+
+		now = now.Add(2 * time.Minute)
+
+		_, _ = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("concurrent invocations wait for the first to complete", func(t *testing.T) {
+		count := 0
+		release := make(chan struct{})
+
+		i := WithIdempotency(func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			count++
+			<-release
+			return "result", nil
+		}, NewIdempotencyCache(time.Minute))
+
+		ctx := WithIdempotencyKey(context.Background(), "key")
+
+		wg := &sync.WaitGroup{}
+		results := make([]any, 3)
+
+		for n := range results {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				results[n], _ = i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+			}(n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, 1, count)
+		assert.Equal(t, []any{"result", "result", "result"}, results)
+	})
+
+	t.Run("waiting invocations invoke the action if the first ends with its context", func(t *testing.T) {
+		calls := make(chan struct{}, 2)
+
+		i := WithIdempotency(func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			calls <- struct{}{}
+			<-ctx.Done()
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "result", nil
+			}
+
+			return nil, ctx.Err()
+		}, NewIdempotencyCache(time.Minute))
+
+		firstCtx, cancel := context.WithCancel(WithIdempotencyKey(context.Background(), "key"))
+
+		firstErr := make(chan error, 1)
+		go func() {
+			_, err := i(firstCtx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+			firstErr <- err
+		}()
+
+		<-calls
+
+		secondCtx, secondCancel := context.WithTimeout(WithIdempotencyKey(context.Background(), "key"), 50*time.Millisecond)
+		defer secondCancel()
+
+		secondResult := make(chan any, 1)
+		go func() {
+			result, _ := i(secondCtx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+			secondResult <- result
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		assert.ErrorIs(t, <-firstErr, context.Canceled)
+		assert.Equal(t, "result", <-secondResult)
+		assert.Len(t, calls, 1)
+	})
+}
@@ -0,0 +1,66 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/da"
+	"time"
+)
+
+// RetryPolicy controls how actions which fail with transient errors are retried.
+type RetryPolicy struct {
+	// Attempts is the total number of times an action is attempted, values below two disable retries.
+	Attempts int
+	// Backoff is the delay before the first retry, doubling for each subsequent retry up to MaximumBackoff.
+	Backoff        time.Duration
+	MaximumBackoff time.Duration
+	// Transient reports if an error may succeed if retried, nil uses IsTransientError.
+	Transient func(error) bool
+}
+
+// IsTransientError reports if an error is not a result of the action requested, that is that the capability or action
+// is supported and the payload was valid.
+func IsTransientError(err error) bool {
+	return !errors.Is(err, ActionUserError) && !errors.Is(err, ActionNotSupported) && !errors.Is(err, CapabilityNotSupported) && !errors.Is(err, IdempotencyKeyReused)
+}
+
+// IsTimeoutError reports if an error was the result of an attempt exceeding its deadline.
+func IsTimeoutError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// WithRetryPolicy wraps an Invoker, retrying actions which fail with a transient error. Retries stop early if the
+// context provided is done.
+func WithRetryPolicy(i Invoker, p RetryPolicy) Invoker {
+	if p.Attempts < 2 {
+		return i
+	}
+
+	transient := p.Transient
+	if transient == nil {
+		transient = IsTransientError
+	}
+
+	return func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+		backoff := p.Backoff
+
+		for attempt := 1; ; attempt++ {
+			result, err := i(ctx, s, l, r, dad, capabilityName, actionName, payload)
+			if err == nil || attempt >= p.Attempts || !transient(err) || ctx.Err() != nil {
+				return result, err
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return result, err
+			}
+
+			backoff *= 2
+			if p.MaximumBackoff > 0 && backoff > p.MaximumBackoff {
+				backoff = p.MaximumBackoff
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWithRetryPolicy(t *testing.T) {
+	d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+	failing := func(count *int, failures int, err error) Invoker {
+		return func(ctx context.Context, s layers.OutputStack, l string, r layers.RetentionLevel, dad da.Device, capabilityName string, actionName string, payload []byte) (any, error) {
+			*count++
+			if *count <= failures {
+				return nil, err
+			}
+			return true, nil
+		}
+	}
+
+	t.Run("retries transient errors until successful", func(t *testing.T) {
+		count := 0
+		i := WithRetryPolicy(failing(&count, 2, errors.New("dropped")), RetryPolicy{Attempts: 3})
+
+		result, err := i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, true, result)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("returns the last error once attempts are exhausted", func(t *testing.T) {
+		count := 0
+		expectedErr := errors.New("dropped")
+		i := WithRetryPolicy(failing(&count, 5, expectedErr), RetryPolicy{Attempts: 3})
+
+		_, err := i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.ErrorIs(t, err, expectedErr)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("does not retry user errors", func(t *testing.T) {
+		count := 0
+		i := WithRetryPolicy(failing(&count, 5, fmt.Errorf("%w: bad", ActionUserError)), RetryPolicy{Attempts: 3})
+
+		_, err := i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.ErrorIs(t, err, ActionUserError)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("uses the transient function provided", func(t *testing.T) {
+		count := 0
+		i := WithRetryPolicy(failing(&count, 5, errors.New("dropped")), RetryPolicy{Attempts: 3, Transient: IsTimeoutError})
+
+		_, err := i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.Error(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("returns the invoker unchanged if retries are disabled", func(t *testing.T) {
+		count := 0
+		i := WithRetryPolicy(failing(&count, 5, errors.New("dropped")), RetryPolicy{Attempts: 1})
+
+		_, err := i(context.Background(), nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.Error(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("stops retrying when the context is done", func(t *testing.T) {
+		count := 0
+		i := WithRetryPolicy(failing(&count, 5, errors.New("dropped")), RetryPolicy{Attempts: 5, Backoff: time.Hour})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := i(ctx, nil, "http", layers.OneShot, d, "OnOff", "On", nil)
+		assert.Error(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
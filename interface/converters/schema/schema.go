@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used to describe capability payloads and state.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Generate produces a schema for the JSON encoding of v, honouring json struct tags. Fields may be documented with a
+// description struct tag. Fields which are neither pointers nor omitempty are listed as required.
+func Generate(v any) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+
+	return generate(reflect.TypeOf(v))
+}
+
+func generate(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType || (t.Kind() == reflect.Struct && t.ConvertibleTo(timeType)) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := &Schema{Type: "integer", Minimum: Float(0)}
+
+		if t.Bits() < 64 {
+			s.Maximum = Float(float64(uint64(1)<<t.Bits() - 1))
+		}
+
+		return s
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: generate(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generate(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(s, t)
+		return s
+	default:
+		return &Schema{}
+	}
+}
+
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, omitEmpty, skip := jsonName(f)
+		if skip {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				addFields(s, embedded)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fieldSchema := generate(f.Type)
+		fieldSchema.Description = f.Tag.Get("description")
+		s.Properties[name] = fieldSchema
+
+		if !omitEmpty && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func jsonName(f reflect.StructField) (string, bool, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(options, "omitempty"), false
+}
+
+// Float returns a pointer to f, for use as a Minimum or Maximum.
+func Float(f float64) *float64 {
+	return &f
+}
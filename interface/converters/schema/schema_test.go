@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	Updated *time.Time `json:",omitempty"`
+}
+
+type example struct {
+	Name     string `description:"Name of the thing."`
+	Count    int
+	Level    uint8
+	Ratio    float64 `json:",omitempty"`
+	Enabled  *bool
+	Tags     []string
+	Values   map[string]float64
+	Renamed  bool `json:"renamed"`
+	Ignored  bool `json:"-"`
+	Anything any
+	hidden   bool
+	embedded
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("generates a schema for a struct", func(t *testing.T) {
+		actual := Generate(example{})
+
+		expected := &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"Name":     {Type: "string", Description: "Name of the thing."},
+				"Count":    {Type: "integer"},
+				"Level":    {Type: "integer", Minimum: Float(0), Maximum: Float(255)},
+				"Ratio":    {Type: "number"},
+				"Enabled":  {Type: "boolean"},
+				"Tags":     {Type: "array", Items: &Schema{Type: "string"}},
+				"Values":   {Type: "object", AdditionalProperties: &Schema{Type: "number"}},
+				"renamed":  {Type: "boolean"},
+				"Anything": {},
+				"Updated":  {Type: "string", Format: "date-time"},
+			},
+			Required: []string{"Name", "Count", "Level", "Tags", "Values", "renamed", "Anything"},
+		}
+
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("types convertible to time are date-time strings", func(t *testing.T) {
+		type nullableTime time.Time
+
+		assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, Generate(nullableTime{}))
+	})
+
+	t.Run("nil produces an empty schema", func(t *testing.T) {
+		assert.Equal(t, &Schema{}, Generate(nil))
+	})
+}
@@ -0,0 +1,129 @@
+package zigbee2mqtt
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+)
+
+// Configuration is the part of a zigbee2mqtt configuration which describes devices and groups, keyed by IEEE address
+// and group identifier respectively.
+type Configuration struct {
+	Devices map[string]Device
+	Groups  map[string]Group
+}
+
+type Device struct {
+	FriendlyName string `yaml:"friendly_name"`
+	Description  string `yaml:"description"`
+}
+
+type Group struct {
+	FriendlyName string   `yaml:"friendly_name"`
+	Devices      []string `yaml:"devices"`
+}
+
+type configurationFile struct {
+	Devices yaml.Node `yaml:"devices"`
+	Groups  yaml.Node `yaml:"groups"`
+}
+
+// Load reads a zigbee2mqtt configuration.yaml, including any separate devices.yaml or groups.yaml it refers to.
+func Load(filename string) (Configuration, error) {
+	cfg := Configuration{
+		Devices: map[string]Device{},
+		Groups:  map[string]Group{},
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+
+	file := configurationFile{}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	dir := filepath.Dir(filename)
+
+	if err := loadSection(&file.Devices, dir, cfg.Devices); err != nil {
+		return cfg, fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	if err := loadSection(&file.Groups, dir, cfg.Groups); err != nil {
+		return cfg, fmt.Errorf("failed to load groups: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// loadSection reads a section of the configuration, which is either provided inline or as the name of one or more
+// files relative to the configuration.
+func loadSection[T any](node *yaml.Node, dir string, into map[string]T) error {
+	switch {
+	case node.Kind == 0, node.Tag == "!!null":
+		return nil
+	case node.Kind == yaml.MappingNode:
+		return decodeSection(node, into)
+	case node.Kind == yaml.ScalarNode:
+		return loadSectionFile(node.Value, dir, into)
+	case node.Kind == yaml.SequenceNode:
+		for _, n := range node.Content {
+			if n.Kind != yaml.ScalarNode {
+				return fmt.Errorf("unexpected value at line %d", n.Line)
+			}
+
+			if err := loadSectionFile(n.Value, dir, into); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unexpected value at line %d", node.Line)
+	}
+}
+
+func loadSectionFile[T any](filename string, dir string, into map[string]T) error {
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	node := yaml.Node{}
+
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	if len(node.Content) == 0 {
+		return nil
+	}
+
+	if err := decodeSection(node.Content[0], into); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+func decodeSection[T any](node *yaml.Node, into map[string]T) error {
+	section := map[string]T{}
+
+	if err := node.Decode(&section); err != nil {
+		return err
+	}
+
+	for k, v := range section {
+		into[k] = v
+	}
+
+	return nil
+}
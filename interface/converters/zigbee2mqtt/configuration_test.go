@@ -0,0 +1,71 @@
+package zigbee2mqtt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	filename := filepath.Join(dir, name)
+
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("loads devices and groups provided inline", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := writeFile(t, dir, "configuration.yaml", `
+mqtt:
+  server: mqtt://localhost
+devices:
+  '0x00158d0001d82999':
+    friendly_name: living_room/lamp
+    description: Living Room
+groups:
+  '1':
+    friendly_name: lights
+    devices:
+      - living_room/lamp
+`)
+
+		cfg, err := Load(filename)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]Device{
+			"0x00158d0001d82999": {FriendlyName: "living_room/lamp", Description: "Living Room"},
+		}, cfg.Devices)
+
+		assert.Equal(t, map[string]Group{
+			"1": {FriendlyName: "lights", Devices: []string{"living_room/lamp"}},
+		}, cfg.Groups)
+	})
+
+	t.Run("loads devices and groups from separate files", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := writeFile(t, dir, "configuration.yaml", "devices: devices.yaml\ngroups: [groups.yaml, more_groups.yaml]\n")
+		writeFile(t, dir, "devices.yaml", "'0x00158d0001d82999':\n  friendly_name: lamp\n")
+		writeFile(t, dir, "groups.yaml", "'1':\n  friendly_name: lights\n")
+		writeFile(t, dir, "more_groups.yaml", "'2':\n  friendly_name: heating\n")
+
+		cfg, err := Load(filename)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "lamp", cfg.Devices["0x00158d0001d82999"].FriendlyName)
+		assert.Equal(t, "lights", cfg.Groups["1"].FriendlyName)
+		assert.Equal(t, "heating", cfg.Groups["2"].FriendlyName)
+	})
+
+	t.Run("returns an error if a referenced file is missing", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := writeFile(t, dir, "configuration.yaml", "devices: devices.yaml\n")
+
+		_, err := Load(filename)
+		assert.Error(t, err)
+	})
+}
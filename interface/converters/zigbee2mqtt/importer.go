@@ -0,0 +1,346 @@
+package zigbee2mqtt
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/controller/state"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Report describes the result of an import.
+type Report struct {
+	Matched             []MatchedDevice
+	Unmatched           []UnmatchedDevice
+	Zones               []ImportedZone
+	UnknownGroupMembers []UnknownGroupMember
+	Failures            []ImportFailure
+}
+
+// MatchedDevice is a zigbee2mqtt device found on the controller, a device may be represented by several controller
+// devices if it has more than one logical device.
+type MatchedDevice struct {
+	IEEEAddress  string
+	FriendlyName string
+	Identifiers  []string
+}
+
+// UnmatchedDevice is a zigbee2mqtt device which is not known to the controller, such as one that has not been paired.
+type UnmatchedDevice struct {
+	IEEEAddress  string
+	FriendlyName string
+}
+
+// ImportedZone is a zone a room or group was imported into, the identifier is zero if it would be created by a dry run.
+type ImportedZone struct {
+	Identifier int
+	Name       string
+	Created    bool
+	Devices    []string
+}
+
+// UnknownGroupMember is a member of a group which does not refer to any device in the configuration.
+type UnknownGroupMember struct {
+	Group  string
+	Member string
+}
+
+// ImportFailure is a change the import was unable to make to a device or zone.
+type ImportFailure struct {
+	Device string
+	Zone   string
+	Error  string
+}
+
+// Import names devices on the controller after their zigbee2mqtt friendly names, and places them in zones for the room
+// in their description and for each group they are a member of. Zones are reused if a root zone of the same name
+// already exists. If dryRun is set the report is produced without making any changes. The import is recorded as a
+// single change in the organisation history.
+func Import(do *state.DeviceOrganiser, cfg Configuration, dryRun bool) Report {
+	var report Report
+
+	err := do.Record("Zigbee2MQTTImport", func(do *state.DeviceOrganiser) error {
+		report = importConfiguration(do, cfg, dryRun)
+		return nil
+	})
+
+	if err != nil {
+		report.Failures = append(report.Failures, ImportFailure{Error: err.Error()})
+	}
+
+	return report
+}
+
+func importConfiguration(do *state.DeviceOrganiser, cfg Configuration, dryRun bool) Report {
+	i := importer{
+		deviceOrganiser: do,
+		dryRun:          dryRun,
+		devices:         controllerDevices(do.Devices()),
+		known:           map[string]bool{},
+		byFriendlyName:  map[string]string{},
+		byIEEEAddress:   map[string][]string{},
+		zones:           map[string]*ImportedZone{},
+	}
+
+	rooms := map[string][]string{}
+
+	for _, key := range sortedKeys(cfg.Devices) {
+		device := cfg.Devices[key]
+
+		ieeeAddress, ok := normaliseIEEEAddress(key)
+		if !ok {
+			i.report.Unmatched = append(i.report.Unmatched, UnmatchedDevice{IEEEAddress: key, FriendlyName: device.FriendlyName})
+			continue
+		}
+
+		i.known[ieeeAddress] = true
+
+		if device.FriendlyName != "" {
+			i.byFriendlyName[device.FriendlyName] = ieeeAddress
+		}
+
+		ids := i.devices[ieeeAddress]
+		if len(ids) == 0 {
+			i.report.Unmatched = append(i.report.Unmatched, UnmatchedDevice{IEEEAddress: key, FriendlyName: device.FriendlyName})
+			continue
+		}
+
+		i.byIEEEAddress[ieeeAddress] = ids
+		i.report.Matched = append(i.report.Matched, MatchedDevice{IEEEAddress: key, FriendlyName: device.FriendlyName, Identifiers: ids})
+
+		if device.FriendlyName != "" && !dryRun {
+			for n, id := range ids {
+				name := device.FriendlyName
+
+				if n > 0 {
+					name = fmt.Sprintf("%s %d", name, n+1)
+				}
+
+				if err := do.NameDevice(id, name); err != nil {
+					i.report.Failures = append(i.report.Failures, ImportFailure{Device: id, Error: err.Error()})
+				}
+			}
+		}
+
+		if room := strings.TrimSpace(device.Description); room != "" {
+			rooms[room] = append(rooms[room], ids...)
+		}
+	}
+
+	for _, room := range sortedKeys(rooms) {
+		i.addToZone(room, state.ZoneKindRoom, rooms[room])
+	}
+
+	for _, key := range sortedGroupKeys(cfg.Groups) {
+		group := cfg.Groups[key]
+
+		name := group.FriendlyName
+		if name == "" {
+			name = fmt.Sprintf("Group %s", key)
+		}
+
+		var ids []string
+
+		for _, member := range group.Devices {
+			ieeeAddress, found := i.resolveMember(member)
+			if !found {
+				i.report.UnknownGroupMembers = append(i.report.UnknownGroupMembers, UnknownGroupMember{Group: name, Member: member})
+				continue
+			}
+
+			ids = append(ids, i.byIEEEAddress[ieeeAddress]...)
+		}
+
+		i.addToZone(name, state.ZoneKindNone, ids)
+	}
+
+	for _, key := range i.zoneOrder {
+		i.report.Zones = append(i.report.Zones, *i.zones[key])
+	}
+
+	return i.report
+}
+
+type importer struct {
+	deviceOrganiser *state.DeviceOrganiser
+	dryRun          bool
+
+	devices        map[string][]string
+	known          map[string]bool
+	byFriendlyName map[string]string
+	byIEEEAddress  map[string][]string
+	zones          map[string]*ImportedZone
+	zoneOrder      []string
+
+	report Report
+}
+
+// resolveMember finds the IEEE address of a group member, which may be the address or friendly name of a device
+// optionally followed by an endpoint.
+func (i *importer) resolveMember(member string) (string, bool) {
+	candidates := []string{member}
+
+	if slash := strings.LastIndex(member, "/"); slash > 0 {
+		candidates = append(candidates, member[:slash])
+	}
+
+	for _, candidate := range candidates {
+		if ieeeAddress, found := i.byFriendlyName[candidate]; found {
+			return ieeeAddress, true
+		}
+
+		if ieeeAddress, ok := normaliseIEEEAddress(candidate); ok && i.known[ieeeAddress] {
+			return ieeeAddress, true
+		}
+	}
+
+	return "", false
+}
+
+func (i *importer) addToZone(name string, kind state.ZoneKind, ids []string) {
+	zone := i.zone(name, kind)
+
+	if !i.dryRun && zone.Identifier == state.RootZoneId {
+		return
+	}
+
+	for _, id := range ids {
+		if containsString(zone.Devices, id) {
+			continue
+		}
+
+		if !i.dryRun {
+			if dm, _ := i.deviceOrganiser.Device(id); !containsInt(dm.Zones, zone.Identifier) {
+				if err := i.deviceOrganiser.AddDeviceToZone(id, zone.Identifier); err != nil {
+					i.report.Failures = append(i.report.Failures, ImportFailure{Device: id, Zone: zone.Name, Error: err.Error()})
+					continue
+				}
+			}
+		}
+
+		zone.Devices = append(zone.Devices, id)
+	}
+}
+
+// zone finds the root zone with a name, creating it if needed. If the zone could not be created its identifier is left
+// as the root, and it is not reported.
+func (i *importer) zone(name string, kind state.ZoneKind) *ImportedZone {
+	key := strings.ToLower(name)
+
+	if zone, found := i.zones[key]; found {
+		return zone
+	}
+
+	zone := &ImportedZone{Name: name}
+
+	for _, existing := range i.deviceOrganiser.RootZones() {
+		if strings.EqualFold(existing.Name, name) {
+			zone.Identifier = existing.Identifier
+			zone.Name = existing.Name
+			break
+		}
+	}
+
+	i.zones[key] = zone
+
+	if zone.Identifier == state.RootZoneId {
+		if !i.dryRun {
+			created, err := i.deviceOrganiser.NewZoneOfKind(name, kind, "")
+			if err != nil {
+				i.report.Failures = append(i.report.Failures, ImportFailure{Zone: name, Error: err.Error()})
+				return zone
+			}
+
+			zone.Identifier = created.Identifier
+		}
+
+		zone.Created = true
+	}
+
+	i.zoneOrder = append(i.zoneOrder, key)
+
+	return zone
+}
+
+// controllerDevices groups the identifiers of Zigbee devices on the controller by IEEE address.
+func controllerDevices(ids []string) map[string][]string {
+	devices := map[string][]string{}
+
+	for _, id := range ids {
+		ieeeAddress, subIdentifier, found := strings.Cut(id, "-")
+		if !found || len(ieeeAddress) != 16 || len(subIdentifier) != 2 {
+			continue
+		}
+
+		if _, err := strconv.ParseUint(ieeeAddress, 16, 64); err != nil {
+			continue
+		}
+
+		devices[ieeeAddress] = append(devices[ieeeAddress], id)
+	}
+
+	return devices
+}
+
+// normaliseIEEEAddress converts an IEEE address as written by zigbee2mqtt, such as 0x00158d0001d82999, to the form used
+// in controller device identifiers.
+func normaliseIEEEAddress(address string) (string, bool) {
+	address = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(address)), "0x")
+
+	value, err := strconv.ParseUint(address, 16, 64)
+	if err != nil || len(address) != 16 {
+		return "", false
+	}
+
+	return fmt.Sprintf("%016x", value), true
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	var keys []string
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// sortedGroupKeys orders groups by their numeric identifier where possible.
+func sortedGroupKeys(groups map[string]Group) []string {
+	keys := sortedKeys(groups)
+
+	sort.SliceStable(keys, func(a, b int) bool {
+		na, errA := strconv.Atoi(keys[a])
+		nb, errB := strconv.Atoi(keys[b])
+
+		if errA != nil || errB != nil {
+			return errA == nil && errB != nil
+		}
+
+		return na < nb
+	})
+
+	return keys
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, check := range haystack {
+		if check == needle {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, check := range haystack {
+		if check == needle {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package zigbee2mqtt
+
+import (
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testConfiguration() Configuration {
+	return Configuration{
+		Devices: map[string]Device{
+			"0x00158d0001d82999": {FriendlyName: "living_room/lamp", Description: "Living Room"},
+			"0x00158d0001d8aaaa": {FriendlyName: "kitchen/switch", Description: "Kitchen"},
+			"0x00158d0001d8ffff": {FriendlyName: "garden/sensor", Description: "Garden"},
+		},
+		Groups: map[string]Group{
+			"1": {FriendlyName: "downstairs", Devices: []string{"living_room/lamp", "0x00158d0001d8aaaa/1", "garden/sensor", "missing"}},
+		},
+	}
+}
+
+func TestImport(t *testing.T) {
+	t.Run("names devices, creates zones for rooms and groups and reports unmatched devices", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("00158d0001d82999-00")
+		do.AddDevice("00158d0001d8aaaa-00")
+		do.AddDevice("00158d0001d8aaaa-01")
+
+		kitchen := do.NewZone("kitchen")
+
+		report := Import(&do, testConfiguration(), false)
+
+		assert.Equal(t, []MatchedDevice{
+			{IEEEAddress: "0x00158d0001d82999", FriendlyName: "living_room/lamp", Identifiers: []string{"00158d0001d82999-00"}},
+			{IEEEAddress: "0x00158d0001d8aaaa", FriendlyName: "kitchen/switch", Identifiers: []string{"00158d0001d8aaaa-00", "00158d0001d8aaaa-01"}},
+		}, report.Matched)
+
+		assert.Equal(t, []UnmatchedDevice{
+			{IEEEAddress: "0x00158d0001d8ffff", FriendlyName: "garden/sensor"},
+		}, report.Unmatched)
+
+		assert.Equal(t, []UnknownGroupMember{
+			{Group: "downstairs", Member: "missing"},
+		}, report.UnknownGroupMembers)
+
+		assert.Len(t, report.Zones, 3)
+		assert.Equal(t, ImportedZone{Identifier: kitchen.Identifier, Name: "kitchen", Devices: []string{"00158d0001d8aaaa-00", "00158d0001d8aaaa-01"}}, report.Zones[0])
+		assert.Equal(t, "Living Room", report.Zones[1].Name)
+		assert.True(t, report.Zones[1].Created)
+		assert.Equal(t, "downstairs", report.Zones[2].Name)
+		assert.Equal(t, []string{"00158d0001d82999-00", "00158d0001d8aaaa-00", "00158d0001d8aaaa-01"}, report.Zones[2].Devices)
+
+		dm, _ := do.Device("00158d0001d82999-00")
+		assert.Equal(t, "living_room/lamp", dm.Name)
+		assert.ElementsMatch(t, []int{report.Zones[1].Identifier, report.Zones[2].Identifier}, dm.Zones)
+
+		dm, _ = do.Device("00158d0001d8aaaa-01")
+		assert.Equal(t, "kitchen/switch 2", dm.Name)
+
+		room, _ := do.Zone(report.Zones[1].Identifier)
+		assert.Equal(t, state.ZoneKindRoom, room.Kind)
+
+		history := do.History()
+		assert.Equal(t, "Zigbee2MQTTImport", history[len(history)-1].Operation)
+		assert.Equal(t, "NewZone", history[len(history)-2].Operation)
+
+		Import(&do, testConfiguration(), false)
+		assert.Len(t, do.RootZones(), 3)
+	})
+
+	t.Run("creates room zones with their kind in a single change", func(t *testing.T) {
+		bus := state.NewEventBus()
+
+		ch := make(chan any, 10)
+		bus.Subscribe(ch)
+
+		do := state.NewDeviceOrganiser(memory.New(), bus)
+		do.AddDevice("00158d0001d82999-00")
+
+		cfg := Configuration{Devices: map[string]Device{"0x00158d0001d82999": {Description: "Lounge"}}}
+		Import(&do, cfg, false)
+
+		bus.Unsubscribe(ch)
+		close(ch)
+
+		var zoneEvents []any
+
+		for e := range ch {
+			switch e.(type) {
+			case state.ZoneCreate, state.ZoneUpdate:
+				zoneEvents = append(zoneEvents, e)
+			}
+		}
+
+		assert.Equal(t, []any{state.ZoneCreate{Identifier: 1, Name: "Lounge", Kind: state.ZoneKindRoom}}, zoneEvents)
+	})
+
+	t.Run("reports changes which could not be made", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+
+		i := importer{deviceOrganiser: &do, zones: map[string]*ImportedZone{}}
+
+		i.addToZone("Cupboard", "cupboard", []string{"one"})
+		i.addToZone("Lounge", state.ZoneKindRoom, []string{"missing"})
+
+		assert.Len(t, i.report.Failures, 2)
+		assert.Equal(t, "Cupboard", i.report.Failures[0].Zone)
+		assert.Equal(t, ImportFailure{Device: "missing", Zone: "Lounge", Error: state.ErrNotFound.Error()}, i.report.Failures[1])
+
+		assert.Len(t, do.RootZones(), 1)
+	})
+
+	t.Run("reports without making changes on a dry run", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("00158d0001d82999-00")
+
+		report := Import(&do, testConfiguration(), true)
+
+		assert.Len(t, report.Matched, 1)
+		assert.Len(t, report.Unmatched, 2)
+		assert.Equal(t, ImportedZone{Name: "Living Room", Created: true, Devices: []string{"00158d0001d82999-00"}}, report.Zones[0])
+
+		dm, _ := do.Device("00158d0001d82999-00")
+		assert.Empty(t, dm.Name)
+		assert.Empty(t, do.RootZones())
+	})
+}
@@ -0,0 +1,99 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/state"
+	"net/http"
+)
+
+type adminController struct {
+	gatewayMapper   state.GatewayMapper
+	deviceOrganiser *state.DeviceOrganiser
+	reloader        Reloader
+}
+
+// Reloader reloads the configuration of the running controller.
+type Reloader interface {
+	Reload() config.ReloadReport
+	LastReload() (config.ReloadReport, bool)
+}
+
+type organiserCheckResponse struct {
+	Problems []state.ConsistencyProblem
+}
+
+func (a *adminController) checkOrganiser(w http.ResponseWriter, r *http.Request) {
+	a.writeOrganiserCheck(w, a.deviceOrganiser.CheckConsistency(a.knownDevice(), false))
+}
+
+func (a *adminController) repairOrganiser(w http.ResponseWriter, r *http.Request) {
+	a.writeOrganiserCheck(w, actingOrganiser(a.deviceOrganiser, r).CheckConsistency(a.knownDevice(), true))
+}
+
+// knownDevice returns a function reporting if a device is known to a gateway, devices can only be reported as unknown
+// if the controller has gateways.
+func (a *adminController) knownDevice() func(string) bool {
+	if len(a.gatewayMapper.Gateways()) == 0 {
+		return nil
+	}
+
+	return func(id string) bool {
+		_, found := a.gatewayMapper.Device(id)
+		return found
+	}
+}
+
+func (a *adminController) writeOrganiserCheck(w http.ResponseWriter, problems []state.ConsistencyProblem) {
+	if problems == nil {
+		problems = []state.ConsistencyProblem{}
+	}
+
+	data, err := json.Marshal(organiserCheckResponse{Problems: problems})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
+
+// reload starts reloading configuration and returns immediately, the reload may restart the interface serving the
+// request. The outcome is available from getReload once complete.
+func (a *adminController) reload(w http.ResponseWriter, r *http.Request) {
+	if a.reloader == nil {
+		http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		return
+	}
+
+	go a.reloader.Reload()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *adminController) getReload(w http.ResponseWriter, r *http.Request) {
+	if a.reloader == nil {
+		http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		return
+	}
+
+	report, found := a.reloader.LastReload()
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if report.Changes == nil {
+		report.Changes = []config.ReloadChange{}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,156 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_adminController_organiser(t *testing.T) {
+	t.Run("checks and repairs the organiser, reporting devices unknown to any gateway", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		mgw := mocks.Gateway{}
+
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+		mgm.On("Gateways").Return(map[string]da.Gateway{"one": &mgw})
+		mgm.On("Device", "one").Return(mocks.SimpleDevice{}, true)
+		mgm.On("Device", "two").Return(mocks.SimpleDevice{}, false)
+
+		controller := adminController{gatewayMapper: &mgm, deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/organiser/fsck", controller.checkOrganiser).Methods("GET")
+		router.HandleFunc("/admin/organiser/fsck", controller.repairOrganiser).Methods("POST")
+
+		expected := state.ConsistencyProblem{Kind: state.ProblemUnknownDevice, Device: "two", Detail: "not known to any gateway"}
+
+		req, _ := http.NewRequest("GET", "/admin/organiser/fsck", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		response := organiserCheckResponse{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, []state.ConsistencyProblem{expected}, response.Problems)
+
+		req, _ = http.NewRequest("POST", "/admin/organiser/fsck", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		expected.Repaired = true
+
+		response = organiserCheckResponse{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, []state.ConsistencyProblem{expected}, response.Problems)
+
+		req, _ = http.NewRequest("GET", "/admin/organiser/fsck", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.JSONEq(t, `{"Problems":[]}`, rr.Body.String())
+	})
+}
+
+type mockReloader struct {
+	mock.Mock
+}
+
+func (m *mockReloader) Reload() config.ReloadReport {
+	return m.Called().Get(0).(config.ReloadReport)
+}
+
+func (m *mockReloader) LastReload() (config.ReloadReport, bool) {
+	args := m.Called()
+	return args.Get(0).(config.ReloadReport), args.Bool(1)
+}
+
+func Test_adminController_reload(t *testing.T) {
+	t.Run("starts a reload and returns accepted", func(t *testing.T) {
+		reloaded := make(chan struct{})
+
+		mr := mockReloader{}
+		defer mr.AssertExpectations(t)
+		mr.On("Reload").Return(config.ReloadReport{}).Run(func(mock.Arguments) {
+			close(reloaded)
+		})
+
+		controller := adminController{reloader: &mr}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/reload", controller.reload).Methods("POST")
+
+		req, _ := http.NewRequest("POST", "/admin/reload", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+
+		select {
+		case <-reloaded:
+		case <-time.After(time.Second):
+			assert.Fail(t, "reload was not started")
+		}
+	})
+
+	t.Run("returns the report of the last reload", func(t *testing.T) {
+		report := config.ReloadReport{
+			Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			Changes: []config.ReloadChange{{Section: "interfaces", Name: "http", Action: config.ReloadRestarted}},
+		}
+
+		mr := mockReloader{}
+		defer mr.AssertExpectations(t)
+		mr.On("LastReload").Return(report, true)
+
+		controller := adminController{reloader: &mr}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/reload", controller.getReload).Methods("GET")
+
+		req, _ := http.NewRequest("GET", "/admin/reload", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"Time":"2026-01-02T03:04:05Z","Changes":[{"Section":"interfaces","Name":"http","Action":"restarted"}]}`, rr.Body.String())
+	})
+
+	t.Run("returns not found if there has been no reload, and not implemented without a reloader", func(t *testing.T) {
+		mr := mockReloader{}
+		defer mr.AssertExpectations(t)
+		mr.On("LastReload").Return(config.ReloadReport{}, false)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/reload", (&adminController{reloader: &mr}).getReload).Methods("GET")
+		router.HandleFunc("/admin/reload", (&adminController{}).reload).Methods("POST")
+
+		req, _ := http.NewRequest("GET", "/admin/reload", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		req, _ = http.NewRequest("POST", "/admin/reload", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+}
@@ -2,7 +2,9 @@ package v1
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/shimmeringbee/controller/interface/http/auth"
+	"github.com/shimmeringbee/controller/state"
 	"net/http"
 )
 
@@ -53,3 +55,12 @@ func authenticationType(ap auth.AuthenticationProvider) http.HandlerFunc {
 		w.Write(data)
 	}
 }
+
+// actingOrganiser returns the device organiser, recording any changes made through it against the authenticated user.
+func actingOrganiser(do *state.DeviceOrganiser, r *http.Request) *state.DeviceOrganiser {
+	if identity := r.Context().Value(auth.UserIdentityContextKey); identity != nil {
+		return do.WithActor(fmt.Sprint(identity))
+	}
+
+	return do
+}
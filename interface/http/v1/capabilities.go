@@ -0,0 +1,44 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
+	"github.com/shimmeringbee/controller/interface/converters/invoker"
+	"github.com/shimmeringbee/controller/interface/converters/schema"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	"net/http"
+)
+
+type capabilityDescription struct {
+	Name    string
+	Actions []invoker.ActionDescription
+	State   *schema.Schema
+}
+
+func describeCapability(c da.Capability, name string) capabilityDescription {
+	return capabilityDescription{
+		Name:    name,
+		Actions: invoker.CapabilityActions(c),
+		State:   exporter.CapabilityStateSchema(c),
+	}
+}
+
+type capabilityController struct{}
+
+func (c *capabilityController) listCapabilities(w http.ResponseWriter, r *http.Request) {
+	descriptions := make(map[string]capabilityDescription)
+
+	for flag, name := range capabilities.StandardNames {
+		descriptions[name] = describeCapability(flag, name)
+	}
+
+	data, err := json.Marshal(descriptions)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_capabilityController_listCapabilities(t *testing.T) {
+	t.Run("returns a description of every standard capability", func(t *testing.T) {
+		controller := capabilityController{}
+
+		req, err := http.NewRequest("GET", "/capabilities", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/capabilities", controller.listCapabilities).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		actual := map[string]capabilityDescription{}
+		err = json.Unmarshal(rr.Body.Bytes(), &actual)
+		assert.NoError(t, err)
+
+		assert.Len(t, actual, len(capabilities.StandardNames))
+
+		alarmWarningDevice := actual[capabilities.StandardNames[capabilities.AlarmWarningDeviceFlag]]
+		assert.Equal(t, "Alarm", alarmWarningDevice.Actions[0].Name)
+		assert.Len(t, alarmWarningDevice.Actions[0].Payload.Properties["AlarmType"].Enum, len(capabilities.AlarmTypeNameMapping))
+		assert.Equal(t, "boolean", alarmWarningDevice.State.Properties["Warning"].Type)
+	})
+}
@@ -0,0 +1,308 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NextCursorHeader is the response header containing the cursor for the next page of a paginated device listing.
+const NextCursorHeader = "X-Next-Cursor"
+
+// deviceQuery holds the filtering, sorting and pagination requested for a device listing.
+type deviceQuery struct {
+	zone         int
+	recursive    bool
+	gateway      string
+	capabilities []string
+	name         string
+	tags         []string
+	attributes   map[string]string
+	fields       []string
+	sort         string
+	limit        int
+	cursor       *deviceCursor
+	ordered      bool
+}
+
+type deviceCursor struct {
+	Key        string `json:"k"`
+	Identifier string `json:"i"`
+}
+
+type sortedDevice struct {
+	device da.Device
+	key    string
+}
+
+// parseDeviceQuery reads the device listing query parameters, returning false if any are invalid.
+func parseDeviceQuery(r *http.Request) (deviceQuery, bool) {
+	query := r.URL.Query()
+
+	q := deviceQuery{
+		gateway:   query.Get("gateway"),
+		name:      strings.ToLower(query.Get("name")),
+		recursive: query.Get("recursive") == "true",
+		sort:      query.Get("sort"),
+		ordered:   query.Has("sort") || query.Has("limit") || query.Has("cursor"),
+	}
+
+	if zone := query.Get("zone"); zone != "" {
+		id, err := strconv.Atoi(zone)
+		if err != nil || id <= 0 {
+			return deviceQuery{}, false
+		}
+
+		q.zone = id
+	}
+
+	q.capabilities = splitParameter(query, "capability")
+	q.tags = splitParameter(query, "tag")
+
+	for _, attribute := range splitParameter(query, "attribute") {
+		key, value, _ := strings.Cut(attribute, ":")
+
+		if q.attributes == nil {
+			q.attributes = map[string]string{}
+		}
+
+		q.attributes[key] = value
+	}
+
+	if _, found := query["fields"]; found {
+		q.fields = splitParameter(query, "fields")
+
+		if q.fields == nil {
+			q.fields = []string{}
+		}
+	}
+
+	switch q.sort {
+	case "":
+		q.sort = "identifier"
+	case "identifier", "name":
+	default:
+		return deviceQuery{}, false
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 {
+			return deviceQuery{}, false
+		}
+
+		q.limit = parsed
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return deviceQuery{}, false
+		}
+
+		q.cursor = &deviceCursor{}
+
+		if err := json.Unmarshal(data, q.cursor); err != nil {
+			return deviceQuery{}, false
+		}
+	}
+
+	return q, true
+}
+
+func splitParameter(query url.Values, name string) []string {
+	var values []string
+
+	for _, value := range query[name] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+
+	return values
+}
+
+// selectDevices returns the devices on the gateways provided which match the query, sorted and paginated, along with
+// the cursor for the next page if there is one.
+func (q deviceQuery) selectDevices(gateways map[string]da.Gateway, o *state.DeviceOrganiser) ([]da.Device, *deviceCursor) {
+	var zones map[int]bool
+
+	if q.zone != 0 {
+		zones = map[int]bool{q.zone: true}
+
+		if q.recursive {
+			for _, id := range o.ZoneDescendents(q.zone) {
+				zones[id] = true
+			}
+		}
+	}
+
+	var selected []sortedDevice
+
+	for gwName, gw := range gateways {
+		if q.gateway != "" && q.gateway != gwName {
+			continue
+		}
+
+		for _, daDevice := range gw.Devices() {
+			var md state.DeviceMetadata
+
+			if zones != nil || q.name != "" || q.sort == "name" || q.tags != nil || q.attributes != nil {
+				md, _ = o.Device(daDevice.Identifier().String())
+			}
+
+			if !q.matches(daDevice, md, zones) {
+				continue
+			}
+
+			sd := sortedDevice{device: daDevice}
+
+			if q.sort == "name" {
+				sd.key = strings.ToLower(md.Name)
+			}
+
+			selected = append(selected, sd)
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return compareCursor(selected[i].key, selected[i].device.Identifier().String(), selected[j].key, selected[j].device.Identifier().String()) < 0
+	})
+
+	var devices []da.Device
+	var last sortedDevice
+
+	for _, sd := range selected {
+		if q.cursor != nil && compareCursor(sd.key, sd.device.Identifier().String(), q.cursor.Key, q.cursor.Identifier) <= 0 {
+			continue
+		}
+
+		if q.limit > 0 && len(devices) == q.limit {
+			return devices, &deviceCursor{Key: last.key, Identifier: last.device.Identifier().String()}
+		}
+
+		devices = append(devices, sd.device)
+		last = sd
+	}
+
+	return devices, nil
+}
+
+func (q deviceQuery) matches(daDevice da.Device, md state.DeviceMetadata, zones map[int]bool) bool {
+	if zones != nil {
+		inZone := false
+
+		for _, id := range md.Zones {
+			if zones[id] {
+				inZone = true
+				break
+			}
+		}
+
+		if !inZone {
+			return false
+		}
+	}
+
+	if q.name != "" && !strings.Contains(strings.ToLower(md.Name), q.name) {
+		return false
+	}
+
+	if !md.HasTags(q.tags) {
+		return false
+	}
+
+	for key, wanted := range q.attributes {
+		value, found := md.Attributes[key]
+		if !found || (wanted != "" && fmt.Sprint(value) != wanted) {
+			return false
+		}
+	}
+
+	for _, wanted := range q.capabilities {
+		found := false
+
+		for _, capFlag := range daDevice.Capabilities() {
+			if capabilities.StandardNames[capFlag] == wanted {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compareCursor(keyA string, idA string, keyB string, idB string) int {
+	if c := strings.Compare(keyA, keyB); c != 0 {
+		return c
+	}
+
+	return strings.Compare(idA, idB)
+}
+
+// writeDeviceListing exports the devices selected by the query, adding headers to locate the next page. Devices are
+// written as an object keyed by identifier, unless the listing is sorted or paginated, in which case they are written as
+// an array in order, as the order of an objects keys is not kept.
+func writeDeviceListing(w http.ResponseWriter, r *http.Request, q deviceQuery, devices []da.Device, next *deviceCursor, de exporter.DeviceExporter) {
+	ctx := exportContext(r)
+
+	if q.fields != nil {
+		ctx = exporter.WithCapabilityFields(ctx, q.fields)
+	}
+
+	apiDevices := make(map[string]exporter.ExportedDevice)
+	orderedDevices := []exporter.ExportedDevice{}
+
+	for _, daDevice := range devices {
+		d := de.ExportDevice(ctx, daDevice)
+		apiDevices[d.Identifier] = d
+		orderedDevices = append(orderedDevices, d)
+	}
+
+	var listing any = apiDevices
+
+	if q.ordered {
+		listing = orderedDevices
+	}
+
+	data, err := json.Marshal(listing)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if next != nil {
+		cursorData, err := json.Marshal(next)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		cursor := base64.RawURLEncoding.EncodeToString(cursorData)
+
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+
+		w.Header().Add(NextCursorHeader, cursor)
+		w.Header().Add("link", "<?"+query.Encode()+">; rel=\"next\"")
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,212 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_parseDeviceQuery(t *testing.T) {
+	t.Run("parses all parameters", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/devices?zone=2&recursive=true&gateway=gw&capability=OnOff,TemperatureSensor&name=Lamp&fields=OnOff&sort=name&limit=5", nil)
+
+		q, ok := parseDeviceQuery(r)
+		assert.True(t, ok)
+
+		assert.Equal(t, 2, q.zone)
+		assert.True(t, q.recursive)
+		assert.Equal(t, "gw", q.gateway)
+		assert.Equal(t, []string{"OnOff", "TemperatureSensor"}, q.capabilities)
+		assert.Equal(t, "lamp", q.name)
+		assert.Equal(t, []string{"OnOff"}, q.fields)
+		assert.Equal(t, "name", q.sort)
+		assert.Equal(t, 5, q.limit)
+	})
+
+	t.Run("parses tag and attribute filters", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/devices?tag=outdoor,lighting&attribute=circuit:12&attribute=notes", nil)
+
+		q, ok := parseDeviceQuery(r)
+		assert.True(t, ok)
+
+		assert.Equal(t, []string{"outdoor", "lighting"}, q.tags)
+		assert.Equal(t, map[string]string{"circuit": "12", "notes": ""}, q.attributes)
+	})
+
+	t.Run("an empty fields parameter requests no capabilities", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/devices?fields=", nil)
+
+		q, ok := parseDeviceQuery(r)
+		assert.True(t, ok)
+		assert.Equal(t, []string{}, q.fields)
+	})
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"zone=lounge", "limit=0", "sort=colour", "cursor=!!"} {
+			r, _ := http.NewRequest("GET", "/devices?"+query, nil)
+
+			_, ok := parseDeviceQuery(r)
+			assert.False(t, ok, query)
+		}
+	})
+}
+
+func Test_deviceQuery_selectDevices(t *testing.T) {
+	do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+	floor := do.NewZone("floor")
+	room := do.NewZone("room")
+	_ = do.MoveZone(room.Identifier, floor.Identifier)
+
+	devOne := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}, SCapabilities: []da.Capability{capabilities.OnOffFlag}}
+	devTwo := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "two"}, SCapabilities: []da.Capability{capabilities.TemperatureSensorFlag}}
+	devThree := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "three"}, SCapabilities: []da.Capability{capabilities.OnOffFlag}}
+
+	for id, name := range map[string]string{"one": "Zebra Lamp", "two": "Hall Sensor", "three": "Alpha Lamp"} {
+		do.AddDevice(id)
+		_ = do.NameDevice(id, name)
+	}
+
+	_ = do.AddDeviceToZone("one", floor.Identifier)
+	_ = do.SetDeviceTags("one", []string{"outdoor", "lighting"})
+	_ = do.SetDeviceTags("three", []string{"lighting"})
+	_ = do.UpdateDeviceAttributes("three", map[string]any{"circuit": 12})
+	_ = do.AddDeviceToZone("two", room.Identifier)
+
+	gwOne := &mocks.Gateway{}
+	gwOne.On("Devices").Return([]da.Device{devOne, devTwo})
+
+	gwTwo := &mocks.Gateway{}
+	gwTwo.On("Devices").Return([]da.Device{devThree})
+
+	gateways := map[string]da.Gateway{"gwOne": gwOne, "gwTwo": gwTwo}
+
+	t.Run("returns all devices sorted by identifier", func(t *testing.T) {
+		devices, next := deviceQuery{sort: "identifier"}.selectDevices(gateways, &do)
+
+		assert.Equal(t, []da.Device{devOne, devThree, devTwo}, devices)
+		assert.Nil(t, next)
+	})
+
+	t.Run("sorts by name", func(t *testing.T) {
+		devices, _ := deviceQuery{sort: "name"}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devThree, devTwo, devOne}, devices)
+	})
+
+	t.Run("filters by zone, optionally recursively", func(t *testing.T) {
+		devices, _ := deviceQuery{sort: "identifier", zone: floor.Identifier}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devOne}, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", zone: floor.Identifier, recursive: true}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devOne, devTwo}, devices)
+	})
+
+	t.Run("filters by gateway, capability and name", func(t *testing.T) {
+		devices, _ := deviceQuery{sort: "identifier", gateway: "gwTwo"}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devThree}, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", capabilities: []string{"TemperatureSensor"}}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devTwo}, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", name: "lamp"}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devOne, devThree}, devices)
+	})
+
+	t.Run("filters by tags and attributes", func(t *testing.T) {
+		devices, _ := deviceQuery{sort: "identifier", tags: []string{"lighting"}}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devOne, devThree}, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", tags: []string{"lighting", "outdoor"}}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devOne}, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", attributes: map[string]string{"circuit": "12"}}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devThree}, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", attributes: map[string]string{"circuit": "13"}}.selectDevices(gateways, &do)
+		assert.Empty(t, devices)
+
+		devices, _ = deviceQuery{sort: "identifier", attributes: map[string]string{"circuit": ""}}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devThree}, devices)
+	})
+
+	t.Run("paginates with a cursor", func(t *testing.T) {
+		devices, next := deviceQuery{sort: "name", limit: 2}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devThree, devTwo}, devices)
+		assert.Equal(t, &deviceCursor{Key: "hall sensor", Identifier: "two"}, next)
+
+		devices, next = deviceQuery{sort: "name", limit: 2, cursor: next}.selectDevices(gateways, &do)
+		assert.Equal(t, []da.Device{devOne}, devices)
+		assert.Nil(t, next)
+	})
+}
+
+func Test_writeDeviceListing(t *testing.T) {
+	t.Run("adds next page headers and limits exported capabilities", func(t *testing.T) {
+		dev := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+
+		mde := &exporter.MockDeviceExporter{}
+		defer mde.AssertExpectations(t)
+
+		mde.On("ExportDevice", mock.Anything, dev).Return(exporter.ExportedDevice{Identifier: "one"})
+
+		r, _ := http.NewRequest("GET", "/devices?limit=1&fields=OnOff", nil)
+		q, _ := parseDeviceQuery(r)
+
+		rr := httptest.NewRecorder()
+		writeDeviceListing(rr, r, q, []da.Device{dev}, &deviceCursor{Identifier: "one"}, mde)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		cursor := rr.Header().Get(NextCursorHeader)
+		assert.NotEmpty(t, cursor)
+		assert.Equal(t, "<?cursor="+cursor+"&fields=OnOff&limit=1>; rel=\"next\"", rr.Header().Get("link"))
+
+		next, _ := http.NewRequest("GET", "/devices?cursor="+cursor, nil)
+		nq, ok := parseDeviceQuery(next)
+		assert.True(t, ok)
+		assert.Equal(t, &deviceCursor{Identifier: "one"}, nq.cursor)
+	})
+
+	t.Run("writes sorted or paginated listings as an array in order, and others as an object", func(t *testing.T) {
+		devOne := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+		devTwo := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "two"}}
+
+		mde := &exporter.MockDeviceExporter{}
+		defer mde.AssertExpectations(t)
+
+		mde.On("ExportDevice", mock.Anything, devOne).Return(exporter.ExportedDevice{Identifier: "one"})
+		mde.On("ExportDevice", mock.Anything, devTwo).Return(exporter.ExportedDevice{Identifier: "two"})
+
+		for _, query := range []string{"sort=name", "limit=5", "cursor=e30"} {
+			r, _ := http.NewRequest("GET", "/devices?"+query, nil)
+			q, ok := parseDeviceQuery(r)
+			assert.True(t, ok)
+
+			rr := httptest.NewRecorder()
+			writeDeviceListing(rr, r, q, []da.Device{devTwo, devOne}, nil, mde)
+
+			var listing []exporter.ExportedDevice
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listing))
+			assert.Equal(t, []exporter.ExportedDevice{{Identifier: "two"}, {Identifier: "one"}}, listing)
+		}
+
+		r, _ := http.NewRequest("GET", "/devices", nil)
+		q, _ := parseDeviceQuery(r)
+
+		rr := httptest.NewRecorder()
+		writeDeviceListing(rr, r, q, []da.Device{devTwo, devOne}, nil, mde)
+
+		var listing map[string]exporter.ExportedDevice
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listing))
+		assert.Len(t, listing, 2)
+	})
+}
@@ -9,38 +9,42 @@ import (
 	"github.com/shimmeringbee/controller/interface/converters/invoker"
 	"github.com/shimmeringbee/controller/layers"
 	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 const DefaultHttpOutputLayer string = "http"
 
+// DevicePathPrefix is the location of device resources, used to reference a devices command queue.
+const DevicePathPrefix string = "/api/v1/devices/"
+
+// IdempotencyKeyHeader is the request header used to make an action invocation idempotent.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// OperationPathPrefix is the location of operation resources, returned when actions are invoked asynchronously.
+const OperationPathPrefix string = "/api/v1/operations/"
+
 type deviceController struct {
 	gatewayMapper   state.GatewayMapper
 	deviceExporter  exporter.DeviceExporter
 	deviceInvoker   invoker.Invoker
 	deviceOrganiser *state.DeviceOrganiser
+	operations      *state.OperationTracker
+	commandQueue    *state.CommandQueue
 	stack           layers.OutputStack
 }
 
 func (d *deviceController) listDevices(w http.ResponseWriter, r *http.Request) {
-	apiDevices := make(map[string]exporter.ExportedDevice)
-
-	for _, gateway := range d.gatewayMapper.Gateways() {
-		for _, daDevice := range gateway.Devices() {
-			d := d.deviceExporter.ExportDevice(r.Context(), daDevice)
-			apiDevices[d.Identifier] = d
-		}
-	}
-
-	data, err := json.Marshal(apiDevices)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	q, ok := parseDeviceQuery(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Add("content-type", "application/json")
-	w.Write(data)
+	devices, next := q.selectDevices(d.gatewayMapper.Gateways(), d.deviceOrganiser)
+	writeDeviceListing(w, r, q, devices, next, d.deviceExporter)
 }
 
 func (d *deviceController) getDevice(w http.ResponseWriter, r *http.Request) {
@@ -52,13 +56,17 @@ func (d *deviceController) getDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
 	daDevice, found := d.gatewayMapper.Device(id)
 	if !found {
 		http.NotFound(w, r)
 		return
 	}
 
-	apiDevice := d.deviceExporter.ExportDevice(r.Context(), daDevice)
+	apiDevice := d.deviceExporter.ExportDevice(exportContext(r), daDevice)
 	data, err := json.Marshal(apiDevice)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -70,7 +78,11 @@ func (d *deviceController) getDevice(w http.ResponseWriter, r *http.Request) {
 }
 
 type updateDeviceRequest struct {
-	Name *string
+	Name       *string
+	Alias      *string
+	Sleepy     *bool
+	Tags       *[]string
+	Attributes map[string]any
 }
 
 func (d *deviceController) updateDevice(w http.ResponseWriter, r *http.Request) {
@@ -82,6 +94,10 @@ func (d *deviceController) updateDevice(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
 	request := updateDeviceRequest{}
 
 	data, err := ioutil.ReadAll(r.Body)
@@ -97,7 +113,61 @@ func (d *deviceController) updateDevice(w http.ResponseWriter, r *http.Request)
 	}
 
 	if request.Name != nil {
-		if err := d.deviceOrganiser.NameDevice(id, *request.Name); err != nil {
+		if err := actingOrganiser(d.deviceOrganiser, r).NameDevice(id, *request.Name); err != nil {
+			if errors.Is(err, state.ErrNotFound) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	if request.Alias != nil {
+		if err := actingOrganiser(d.deviceOrganiser, r).SetDeviceAlias(id, *request.Alias); err != nil {
+			if errors.Is(err, state.ErrNotFound) {
+				http.NotFound(w, r)
+			} else if errors.Is(err, state.ErrInvalidAlias) {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			} else if errors.Is(err, state.ErrAliasInUse) {
+				http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			} else {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	if request.Tags != nil {
+		if err := actingOrganiser(d.deviceOrganiser, r).SetDeviceTags(id, *request.Tags); err != nil {
+			if errors.Is(err, state.ErrNotFound) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	if request.Attributes != nil {
+		if err := actingOrganiser(d.deviceOrganiser, r).UpdateDeviceAttributes(id, request.Attributes); err != nil {
+			if errors.Is(err, state.ErrNotFound) {
+				http.NotFound(w, r)
+			} else if errors.Is(err, state.ErrInvalidAttribute) {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			} else {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	if request.Sleepy != nil {
+		if err := actingOrganiser(d.deviceOrganiser, r).SetDeviceSleepy(id, *request.Sleepy); err != nil {
 			if errors.Is(err, state.ErrNotFound) {
 				http.NotFound(w, r)
 			} else {
@@ -120,6 +190,10 @@ func (d *deviceController) useDeviceCapabilityAction(w http.ResponseWriter, r *h
 		return
 	}
 
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
 	capabilityName, ok := params["name"]
 	if !ok {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -148,6 +222,21 @@ func (d *deviceController) useDeviceCapabilityAction(w http.ResponseWriter, r *h
 		retention = layers.Maintain
 	}
 
+	timeout, ok := durationParameter(r, "timeout")
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	expiry, ok := durationParameter(r, "expiry")
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	queue := r.URL.Query().Get("queue") == "true"
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+
 	var body []byte
 	var err error
 
@@ -164,13 +253,36 @@ func (d *deviceController) useDeviceCapabilityAction(w http.ResponseWriter, r *h
 		}
 	}
 
-	if data, err := d.deviceInvoker(r.Context(), d.stack, layer, retention, daDevice, capabilityName, capabilityAction, body); err != nil {
+	if r.URL.Query().Get("async") == "true" {
+		d.useDeviceCapabilityActionAsync(w, daDevice, layer, retention, capabilityName, capabilityAction, body, timeout, queue, expiry, idempotencyKey)
+		return
+	}
+
+	ctx := r.Context()
+
+	if idempotencyKey != "" {
+		ctx = invoker.WithIdempotencyKey(ctx, idempotencyKey)
+	}
+
+	if queue {
+		ctx = invoker.RequestQueueing(ctx, expiry)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if data, err := d.deviceInvoker(ctx, d.stack, layer, retention, daDevice, capabilityName, capabilityAction, body); err != nil {
 		if errors.Is(err, invoker.ActionNotSupported) {
 			http.NotFound(w, r)
 		} else if errors.Is(err, invoker.ActionUserError) {
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		} else if errors.Is(err, invoker.CapabilityNotSupported) {
 			http.NotFound(w, r)
+		} else if errors.Is(err, invoker.IdempotencyKeyReused) {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
 		} else if errors.Is(err, context.DeadlineExceeded) {
 			http.Error(w, "Device action exceeded permitted time.", http.StatusInternalServerError)
 		} else {
@@ -179,9 +291,264 @@ func (d *deviceController) useDeviceCapabilityAction(w http.ResponseWriter, r *h
 	} else {
 		if jsonData, err := json.Marshal(data); err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		} else if _, queued := data.(state.QueuedCommand); queued {
+			w.Header().Add("location", DevicePathPrefix+id+"/queue")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write(jsonData)
 		} else {
 			w.WriteHeader(http.StatusOK)
 			w.Write(jsonData)
 		}
 	}
 }
+
+func (d *deviceController) getDeviceCapabilityActions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	id, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
+	capabilityName, ok := params["name"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	daDevice, found := d.gatewayMapper.Device(id)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	for _, capFlag := range daDevice.Capabilities() {
+		if basicCapability := daDevice.Capability(capFlag); basicCapability != nil && basicCapability.Name() == capabilityName {
+			data, err := json.Marshal(describeCapability(capFlag, capabilityName))
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Add("content-type", "application/json")
+			w.Write(data)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (d *deviceController) useDeviceCapabilityActionAsync(w http.ResponseWriter, daDevice da.Device, layer string, retention layers.RetentionLevel, capabilityName string, capabilityAction string, body []byte, timeout time.Duration, queue bool, expiry time.Duration, idempotencyKey string) {
+	op, err := d.operations.Start(daDevice.Identifier().String(), capabilityName, capabilityAction)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(op)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	go func() {
+		ctx := context.Background()
+
+		if idempotencyKey != "" {
+			ctx = invoker.WithIdempotencyKey(ctx, idempotencyKey)
+		}
+
+		if queue {
+			ctx = invoker.RequestQueueing(ctx, expiry)
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		result, err := d.deviceInvoker(ctx, d.stack, layer, retention, daDevice, capabilityName, capabilityAction, body)
+		d.operations.Complete(op.Identifier, result, err)
+	}()
+
+	w.Header().Add("content-type", "application/json")
+	w.Header().Add("location", OperationPathPrefix+op.Identifier)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(data)
+}
+
+// resolveDeviceReference resolves a reference to a device by identifier, alias or name to its identifier, references
+// unknown to the organiser are returned unchanged. If the reference is ambiguous an error is written to the response
+// and false returned.
+func resolveDeviceReference(w http.ResponseWriter, o *state.DeviceOrganiser, ref string) (string, bool) {
+	if o == nil {
+		return ref, true
+	}
+
+	id, err := o.ResolveDevice(ref)
+	if errors.Is(err, state.ErrAmbiguous) {
+		http.Error(w, "Device reference matches more than one device, use its identifier or alias.", http.StatusConflict)
+		return "", false
+	} else if err != nil {
+		return ref, true
+	}
+
+	return id, true
+}
+
+// exportContext returns the context for exporting devices, reading live capability state if fresh is requested.
+func exportContext(r *http.Request) context.Context {
+	if r.URL.Query().Get("fresh") == "true" {
+		return exporter.WithFreshState(r.Context())
+	}
+
+	return r.Context()
+}
+
+// durationParameter parses an optional positive duration from the query string, returning false if it is invalid.
+func durationParameter(r *http.Request, name string) (time.Duration, bool) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return 0, true
+	}
+
+	parsed, err := time.ParseDuration(param)
+	if err != nil || parsed <= 0 {
+		return 0, false
+	}
+
+	return parsed, true
+}
+
+func (d *deviceController) getDeviceQueue(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	id, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
+	if _, found := d.gatewayMapper.Device(id); !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := json.Marshal(d.commandQueue.Commands(id))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
+
+func (d *deviceController) replaceDevice(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	oldId, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	newId, ok := params["newIdentifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if oldId, ok = resolveDeviceReference(w, d.deviceOrganiser, oldId); !ok {
+		return
+	}
+
+	if newId, ok = resolveDeviceReference(w, d.deviceOrganiser, newId); !ok {
+		return
+	}
+
+	if _, found := d.gatewayMapper.Device(newId); !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := actingOrganiser(d.deviceOrganiser, r).ReplaceDevice(oldId, newId); err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			http.NotFound(w, r)
+		} else if errors.Is(err, state.ErrSameDevice) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+}
+
+func (d *deviceController) clearDeviceQueue(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	id, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
+	if _, found := d.gatewayMapper.Device(id); !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	d.commandQueue.Clear(id)
+
+	http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+}
+
+func (d *deviceController) cancelDeviceQueuedCommand(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	id, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if id, ok = resolveDeviceReference(w, d.deviceOrganiser, id); !ok {
+		return
+	}
+
+	commandId, ok := params["commandIdentifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := d.commandQueue.Cancel(id, commandId); err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+}
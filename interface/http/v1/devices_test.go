@@ -1,14 +1,18 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/shimmeringbee/controller/interface/converters/exporter"
 	"github.com/shimmeringbee/controller/interface/converters/invoker"
+	"github.com/shimmeringbee/controller/interface/http/auth"
 	"github.com/shimmeringbee/controller/layers"
 	"github.com/shimmeringbee/controller/state"
 	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	capmocks "github.com/shimmeringbee/da/capabilities/mocks"
 	"github.com/shimmeringbee/da/mocks"
 	"github.com/shimmeringbee/persistence/impl/memory"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +22,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 type SimpleIdentifier struct {
@@ -194,6 +199,85 @@ func Test_deviceController_getDevice(t *testing.T) {
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
+	t.Run("requests fresh capability state if specified", func(t *testing.T) {
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		daDeviceOne := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one-one"}}
+		mgm.On("Device", "one").Return(daDeviceOne, true)
+
+		mdc := exporter.MockDeviceExporter{}
+		defer mdc.AssertExpectations(t)
+		mdc.On("ExportDevice", mock.MatchedBy(exporter.FreshStateRequested), daDeviceOne).Return(exporter.ExportedDevice{Identifier: "one-one"})
+
+		controller := deviceController{gatewayMapper: &mgm, deviceExporter: &mdc}
+
+		req, err := http.NewRequest("GET", "/devices/one?fresh=true", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.getDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+	t.Run("returns a device addressed by its alias", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+		_ = do.NameDevice("one", "Kitchen Lamp")
+
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		daDeviceOne := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+		mgm.On("Device", "one").Return(daDeviceOne, true)
+
+		mdc := exporter.MockDeviceExporter{}
+		defer mdc.AssertExpectations(t)
+		mdc.On("ExportDevice", mock.Anything, daDeviceOne).Return(exporter.ExportedDevice{Identifier: "one"})
+
+		controller := deviceController{gatewayMapper: &mgm, deviceExporter: &mdc, deviceOrganiser: &do}
+
+		req, err := http.NewRequest("GET", "/devices/kitchen-lamp", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.getDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("returns a 409 if the device reference is ambiguous", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		_ = do.NameDevice("one", "Lamp")
+		_ = do.NameDevice("two", "Lamp")
+
+		controller := deviceController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("GET", "/devices/Lamp", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.getDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
 }
 
 func Test_deviceController_updateDevice(t *testing.T) {
@@ -220,6 +304,220 @@ func Test_deviceController_updateDevice(t *testing.T) {
 		assert.True(t, found)
 		assert.Equal(t, "ExportedDevice", d.Name)
 	})
+
+	t.Run("updates an individual ExportedDevice as sleepy", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+
+		controller := deviceController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PATCH", "/devices/one", strings.NewReader(`{"Sleepy":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIdentityContextKey, "username"))
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.updateDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		d, _ := do.Device("one")
+		assert.True(t, d.Sleepy)
+
+		history := do.History()
+		last := history[len(history)-1]
+		assert.Equal(t, "username", last.Actor)
+		assert.Equal(t, "SetDeviceSleepy", last.Operation)
+	})
+	t.Run("updates the alias of a device", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+
+		controller := deviceController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PATCH", "/devices/one", strings.NewReader(`{"Alias":"hall-light"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.updateDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		d, _ := do.Device("one")
+		assert.Equal(t, "hall-light", d.Alias)
+	})
+
+	t.Run("updates the tags and attributes of a device", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+		_ = do.UpdateDeviceAttributes("one", map[string]any{"notes": "loft"})
+
+		controller := deviceController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PATCH", "/devices/one", strings.NewReader(`{"Tags":["outdoor"],"Attributes":{"circuit":12,"notes":null}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.updateDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		d, _ := do.Device("one")
+		assert.Equal(t, []string{"outdoor"}, d.Tags)
+		assert.Equal(t, map[string]any{"circuit": float64(12)}, d.Attributes)
+	})
+
+	t.Run("returns a 400 if an attribute value is not supported", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+
+		controller := deviceController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PATCH", "/devices/one", strings.NewReader(`{"Attributes":{"phases":[1,2]}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.updateDevice)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("returns a 400 if the alias is invalid, or 409 if in use", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		_ = do.SetDeviceAlias("two", "taken")
+
+		controller := deviceController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}", controller.updateDevice)
+
+		for body, expectedCode := range map[string]int{`{"Alias":"Not Valid"}`: http.StatusBadRequest, `{"Alias":"taken"}`: http.StatusConflict} {
+			req, err := http.NewRequest("PATCH", "/devices/one", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, expectedCode, rr.Code, body)
+		}
+	})
+}
+
+func Test_deviceController_replaceDevice(t *testing.T) {
+	t.Run("moves metadata and queued commands to the new device", func(t *testing.T) {
+		eb := state.NewEventBus()
+
+		do := state.NewDeviceOrganiser(memory.New(), eb)
+		do.AddDevice("old")
+		do.AddDevice("new")
+		_ = do.NameDevice("old", "Hall Sensor")
+
+		cq := state.NewCommandQueue(memory.New(), nil)
+		_, _ = cq.Enqueue("old", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		cq.Start(eb)
+		defer cq.Stop()
+
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "new").Return(mocks.SimpleDevice{}, true)
+
+		controller := deviceController{gatewayMapper: &mgm, deviceOrganiser: &do, commandQueue: cq}
+
+		req, err := http.NewRequest("POST", "/devices/hall-sensor/replace/new", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/replace/{newIdentifier}", controller.replaceDevice).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		dm, _ := do.Device("new")
+		assert.Equal(t, "Hall Sensor", dm.Name)
+
+		assert.Eventually(t, func() bool {
+			return len(cq.Commands("old")) == 0 && len(cq.Commands("new")) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("returns a 404 if the new device is not present", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("old")
+
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "new").Return(mocks.SimpleDevice{}, false)
+
+		controller := deviceController{gatewayMapper: &mgm, deviceOrganiser: &do}
+
+		req, err := http.NewRequest("POST", "/devices/old/replace/new", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/replace/{newIdentifier}", controller.replaceDevice).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("returns a 400 if a device is replaced with itself", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("old")
+
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "old").Return(mocks.SimpleDevice{}, true)
+
+		controller := deviceController{gatewayMapper: &mgm, deviceOrganiser: &do}
+
+		req, err := http.NewRequest("POST", "/devices/old/replace/old", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/replace/{newIdentifier}", controller.replaceDevice).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
 }
 
 func Test_deviceController_useDeviceCapabilityAction(t *testing.T) {
@@ -486,4 +784,394 @@ func Test_deviceController_useDeviceCapabilityAction(t *testing.T) {
 		bodyContent, _ := ioutil.ReadAll(rr.Body)
 		assert.Equal(t, "{}", string(bodyContent))
 	})
+
+	t.Run("returns a 400 if the timeout is invalid", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{}
+		mgm.On("Device", "one").Return(device, true)
+
+		controller := deviceController{gatewayMapper: mgm}
+
+		req, err := http.NewRequest("POST", "/devices/one/capabilities/name/action?timeout=never", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", controller.useDeviceCapabilityAction).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("applies the requested timeout to the action", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{}
+		mgm.On("Device", "one").Return(device, true)
+
+		mda := &invoker.MockDeviceInvoker{}
+		defer mda.AssertExpectations(t)
+
+		var deadline time.Time
+
+		mda.On("InvokeDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, device, "name", "action", []byte(nil)).Return(struct{}{}, nil).Run(func(args mock.Arguments) {
+			deadline, _ = args.Get(0).(context.Context).Deadline()
+		})
+
+		controller := deviceController{gatewayMapper: mgm, deviceInvoker: mda.InvokeDevice, stack: layers.PassThruStack{}}
+
+		req, err := http.NewRequest("POST", "/devices/one/capabilities/name/action?timeout=1m", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", controller.useDeviceCapabilityAction).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("returns a 202 with an operation if invoked asynchronously", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+		mgm.On("Device", "one").Return(device, true)
+
+		mda := &invoker.MockDeviceInvoker{}
+		defer mda.AssertExpectations(t)
+
+		mda.On("InvokeDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, device, "name", "action", []byte(nil)).Return(struct{}{}, nil)
+
+		operations := state.NewOperationTracker(state.NullEventPublisher)
+
+		controller := deviceController{gatewayMapper: mgm, deviceInvoker: mda.InvokeDevice, operations: operations, stack: layers.PassThruStack{}}
+
+		req, err := http.NewRequest("POST", "/devices/one/capabilities/name/action?async=true", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", controller.useDeviceCapabilityAction).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+
+		op := state.Operation{}
+		err = json.Unmarshal(rr.Body.Bytes(), &op)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "one", op.Device)
+		assert.Equal(t, OperationPathPrefix+op.Identifier, rr.Header().Get("location"))
+
+		assert.Eventually(t, func() bool {
+			found, _ := operations.Operation(op.Identifier)
+			return found.Status == state.OperationSucceeded
+		}, time.Second, 10*time.Millisecond)
+	})
+	t.Run("passes the idempotency key header to the invoker", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+		mgm.On("Device", "one").Return(device, true)
+
+		mda := &invoker.MockDeviceInvoker{}
+		defer mda.AssertExpectations(t)
+
+		mda.On("InvokeDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, device, "name", "action", []byte(nil)).Return(struct{}{}, nil).Once()
+
+		deviceInvoker := invoker.WithIdempotency(mda.InvokeDevice, invoker.NewIdempotencyCache(time.Minute))
+		controller := deviceController{gatewayMapper: mgm, deviceInvoker: deviceInvoker, stack: layers.PassThruStack{}}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", controller.useDeviceCapabilityAction).Methods("POST")
+
+		for n := 0; n < 2; n++ {
+			req, err := http.NewRequest("POST", "/devices/one/capabilities/name/action", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set(IdempotencyKeyHeader, "key")
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("returns a 409 if the idempotency key was used for a different action", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{}
+		mgm.On("Device", "one").Return(device, true)
+
+		mda := &invoker.MockDeviceInvoker{}
+		defer mda.AssertExpectations(t)
+
+		mda.On("InvokeDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, device, "name", "action", []byte(nil)).Return(nil, invoker.IdempotencyKeyReused)
+
+		controller := deviceController{gatewayMapper: mgm, deviceInvoker: mda.InvokeDevice, stack: layers.PassThruStack{}}
+
+		req, err := http.NewRequest("POST", "/devices/one/capabilities/name/action", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", controller.useDeviceCapabilityAction).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
+
+func Test_deviceController_getDeviceCapabilityActions(t *testing.T) {
+	t.Run("returns a 404 if device is not present", func(t *testing.T) {
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "one").Return(mocks.SimpleDevice{}, false)
+
+		controller := deviceController{gatewayMapper: &mgm}
+
+		req, err := http.NewRequest("GET", "/devices/one/capabilities/OnOff/actions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/actions", controller.getDeviceCapabilityActions).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("returns a 404 if device does not support capability", func(t *testing.T) {
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{SCapabilities: []da.Capability{}}
+		mgm.On("Device", "one").Return(device, true)
+
+		controller := deviceController{gatewayMapper: &mgm}
+
+		req, err := http.NewRequest("GET", "/devices/one/capabilities/OnOff/actions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/actions", controller.getDeviceCapabilityActions).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("returns the actions of the capability", func(t *testing.T) {
+		mgm := state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mockOnOff := &capmocks.OnOff{}
+		defer mockOnOff.AssertExpectations(t)
+		mockOnOff.Mock.On("Name").Return("OnOff")
+
+		device := &mocks.MockDevice{}
+		defer device.AssertExpectations(t)
+		device.On("Capabilities").Return([]da.Capability{capabilities.OnOffFlag})
+		device.On("Capability", capabilities.OnOffFlag).Return(mockOnOff)
+
+		mgm.On("Device", "one").Return(device, true)
+
+		controller := deviceController{gatewayMapper: &mgm}
+
+		req, err := http.NewRequest("GET", "/devices/one/capabilities/OnOff/actions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/actions", controller.getDeviceCapabilityActions).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		actual := capabilityDescription{}
+		err = json.Unmarshal(rr.Body.Bytes(), &actual)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "OnOff", actual.Name)
+		assert.Equal(t, []invoker.ActionDescription{
+			{Name: "On", Description: "Turn the device on."},
+			{Name: "Off", Description: "Turn the device off."},
+		}, actual.Actions)
+		assert.Equal(t, "boolean", actual.State.Properties["State"].Type)
+	})
+}
+
+func Test_deviceController_queue(t *testing.T) {
+	unreachable := func(ctx context.Context, c state.QueuedCommand) error {
+		return context.DeadlineExceeded
+	}
+
+	t.Run("queues an action if requested, returning a 202", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		device := mocks.SimpleDevice{SIdentifier: SimpleIdentifier{id: "one"}}
+		mgm.On("Device", "one").Return(device, true)
+
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		cq := state.NewCommandQueue(memory.New(), unreachable)
+
+		controller := deviceController{gatewayMapper: mgm, deviceInvoker: invoker.WithCommandQueue(nil, cq, &do), commandQueue: cq, stack: layers.PassThruStack{}}
+
+		req, err := http.NewRequest("POST", "/devices/one/capabilities/OnOff/On?queue=true&expiry=1h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", controller.useDeviceCapabilityAction).Methods("POST")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, DevicePathPrefix+"one/queue", rr.Header().Get("location"))
+
+		commands := cq.Commands("one")
+		assert.Len(t, commands, 1)
+		assert.Equal(t, "On", commands[0].Action)
+	})
+
+	t.Run("returns the queued commands for a device", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "one").Return(mocks.SimpleDevice{}, true)
+
+		cq := state.NewCommandQueue(memory.New(), unreachable)
+		cmd, _ := cq.Enqueue("one", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		controller := deviceController{gatewayMapper: mgm, commandQueue: cq}
+
+		req, err := http.NewRequest("GET", "/devices/one/queue", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/queue", controller.getDeviceQueue).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actual []state.QueuedCommand
+		err = json.Unmarshal(rr.Body.Bytes(), &actual)
+		assert.NoError(t, err)
+
+		assert.Len(t, actual, 1)
+		assert.Equal(t, cmd.Identifier, actual[0].Identifier)
+	})
+
+	t.Run("returns a 404 for the queue of a missing device", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "one").Return(mocks.SimpleDevice{}, false)
+
+		controller := deviceController{gatewayMapper: mgm}
+
+		req, err := http.NewRequest("GET", "/devices/one/queue", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/queue", controller.getDeviceQueue).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("clears the queue of a device", func(t *testing.T) {
+		mgm := &state.MockGatewayMapper{}
+		defer mgm.AssertExpectations(t)
+
+		mgm.On("Device", "one").Return(mocks.SimpleDevice{}, true)
+
+		cq := state.NewCommandQueue(memory.New(), unreachable)
+		cq.Enqueue("one", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		controller := deviceController{gatewayMapper: mgm, commandQueue: cq}
+
+		req, err := http.NewRequest("DELETE", "/devices/one/queue", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/queue", controller.clearDeviceQueue).Methods("DELETE")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, cq.Commands("one"))
+	})
+
+	t.Run("cancels a queued command", func(t *testing.T) {
+		cq := state.NewCommandQueue(memory.New(), unreachable)
+		cmd, _ := cq.Enqueue("one", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		controller := deviceController{commandQueue: cq}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/devices/{identifier}/queue/{commandIdentifier}", controller.cancelDeviceQueuedCommand).Methods("DELETE")
+
+		req, err := http.NewRequest("DELETE", "/devices/one/queue/"+cmd.Identifier, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, cq.Commands("one"))
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
 }
@@ -81,19 +81,12 @@ func (g *gatewayController) listDevicesOnGateway(w http.ResponseWriter, r *http.
 		return
 	}
 
-	apiDevices := make(map[string]exporter.ExportedDevice)
-
-	for _, daDevice := range gw.Devices() {
-		d := g.deviceConverter.ExportDevice(r.Context(), daDevice)
-		apiDevices[d.Identifier] = d
-	}
-
-	data, err := json.Marshal(apiDevices)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	q, ok := parseDeviceQuery(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Add("content-type", "application/json")
-	w.Write(data)
+	devices, next := q.selectDevices(map[string]da.Gateway{id: gw}, g.deviceOrganiser)
+	writeDeviceListing(w, r, q, devices, next, g.deviceConverter)
 }
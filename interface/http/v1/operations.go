@@ -0,0 +1,37 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/shimmeringbee/controller/state"
+	"net/http"
+)
+
+type operationController struct {
+	operations *state.OperationTracker
+}
+
+func (o *operationController) getOperation(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	id, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	op, found := o.operations.Operation(id)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := json.Marshal(op)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
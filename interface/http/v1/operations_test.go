@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_operationController_getOperation(t *testing.T) {
+	t.Run("returns a 404 if the operation is not present", func(t *testing.T) {
+		controller := operationController{operations: state.NewOperationTracker(state.NullEventPublisher)}
+
+		req, err := http.NewRequest("GET", "/operations/missing", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/operations/{identifier}", controller.getOperation).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("returns the operation", func(t *testing.T) {
+		operations := state.NewOperationTracker(state.NullEventPublisher)
+		op, _ := operations.Start("one", "OnOff", "On")
+		operations.Complete(op.Identifier, nil, nil)
+
+		controller := operationController{operations: operations}
+
+		req, err := http.NewRequest("GET", "/operations/"+op.Identifier, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/operations/{identifier}", controller.getOperation).Methods("GET")
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		actual := state.Operation{}
+		err = json.Unmarshal(rr.Body.Bytes(), &actual)
+		assert.NoError(t, err)
+
+		assert.Equal(t, op.Identifier, actual.Identifier)
+		assert.Equal(t, state.OperationSucceeded, actual.Status)
+	})
+}
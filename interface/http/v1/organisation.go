@@ -0,0 +1,230 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/shimmeringbee/controller/state"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type organisationController struct {
+	deviceOrganiser *state.DeviceOrganiser
+}
+
+var organisationContentTypes = map[state.OrganisationFormat]string{
+	state.OrganisationFormatJSON: "application/json",
+	state.OrganisationFormatYAML: "application/yaml",
+}
+
+func (o *organisationController) exportOrganisation(w http.ResponseWriter, r *http.Request) {
+	format := state.OrganisationFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = state.OrganisationFormatJSON
+	}
+
+	data, err := state.MarshalOrganisation(o.deviceOrganiser.ExportOrganisation(), format)
+	if err != nil {
+		if errors.Is(err, state.ErrUnsupportedFormat) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Add("content-type", organisationContentTypes[format])
+	w.Write(data)
+}
+
+type importOrganisationResponse struct {
+	DryRun  bool
+	Changes []state.OrganisationChange
+}
+
+func (o *organisationController) importOrganisation(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	mode := state.ImportMode(query.Get("mode"))
+	if mode == "" {
+		mode = state.ImportMerge
+	}
+
+	dryRun, _ := strconv.ParseBool(query.Get("dryRun"))
+
+	format := state.OrganisationFormat(query.Get("format"))
+	if format == "" {
+		if strings.Contains(r.Header.Get("content-type"), "yaml") {
+			format = state.OrganisationFormatYAML
+		} else {
+			format = state.OrganisationFormatJSON
+		}
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	doc, err := state.UnmarshalOrganisation(data, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := actingOrganiser(o.deviceOrganiser, r).ImportOrganisation(doc, mode, dryRun)
+	if err != nil {
+		if isOrganisationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	data, err = json.Marshal(importOrganisationResponse{DryRun: dryRun, Changes: changes})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
+
+func (o *organisationController) getHistory(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(o.deviceOrganiser.History())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
+
+type revertOrganisationRequest struct {
+	Version *int64
+	Time    *time.Time
+}
+
+type historyChangeResponse struct {
+	Changes []state.OrganisationChange
+}
+
+func (o *organisationController) revertOrganisation(w http.ResponseWriter, r *http.Request) {
+	request := revertOrganisationRequest{}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(data, &request); err != nil || (request.Version == nil) == (request.Time == nil) {
+		http.Error(w, "Exactly one of Version and Time must be provided.", http.StatusBadRequest)
+		return
+	}
+
+	var version int64
+
+	if request.Version != nil {
+		version = *request.Version
+	} else if version, err = o.deviceOrganiser.HistoryVersionAt(*request.Time); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	changes, err := actingOrganiser(o.deviceOrganiser, r).RevertOrganisation(version)
+	o.writeHistoryChanges(w, r, changes, err)
+}
+
+func (o *organisationController) undoChange(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.ParseInt(mux.Vars(r)["version"], 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := actingOrganiser(o.deviceOrganiser, r).UndoChange(version)
+	o.writeHistoryChanges(w, r, changes, err)
+}
+
+func (o *organisationController) writeHistoryChanges(w http.ResponseWriter, r *http.Request, changes []state.OrganisationChange, err error) {
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			http.NotFound(w, r)
+		} else if isOrganisationError(err) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	data, err := json.Marshal(historyChangeResponse{Changes: changes})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
+
+type batchRequest struct {
+	Operations []state.BatchOperation
+}
+
+func (o *organisationController) applyBatch(w http.ResponseWriter, r *http.Request) {
+	request := batchRequest{}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	result, err := actingOrganiser(o.deviceOrganiser, r).ApplyBatch(request.Operations)
+	if err != nil {
+		if isOrganisationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	data, err = json.Marshal(result)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
+}
+
+// isOrganisationError reports if an error was returned by the organiser because the change requested was invalid,
+// rather than because it failed.
+func isOrganisationError(err error) bool {
+	var zoneError state.ZoneError
+	var deviceError state.DeviceError
+	var organisationError state.OrganisationError
+
+	return errors.As(err, &zoneError) || errors.As(err, &deviceError) || errors.As(err, &organisationError)
+}
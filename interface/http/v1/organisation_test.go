@@ -0,0 +1,292 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/shimmeringbee/controller/interface/http/auth"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_organisationController_exportOrganisation(t *testing.T) {
+	t.Run("exports the organisation as json or yaml", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/export", controller.exportOrganisation)
+
+		req, _ := http.NewRequest("GET", "/organisation/export", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("content-type"))
+
+		doc := state.OrganisationDocument{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+		assert.Equal(t, do.ExportOrganisation(), doc)
+
+		req, _ = http.NewRequest("GET", "/organisation/export?format=yaml", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/yaml", rr.Header().Get("content-type"))
+		assert.Contains(t, rr.Body.String(), "Name: Kitchen")
+
+		req, _ = http.NewRequest("GET", "/organisation/export?format=xml", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func Test_organisationController_importOrganisation(t *testing.T) {
+	t.Run("returns the changes of a dry run without making them", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/import", controller.importOrganisation)
+
+		body := "Version: 1\nZones:\n  - Identifier: 5\n    Name: Kitchen\n"
+
+		req, _ := http.NewRequest("POST", "/organisation/import?dryRun=true", strings.NewReader(body))
+		req.Header.Set("content-type", "application/yaml")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		response := importOrganisationResponse{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, importOrganisationResponse{
+			DryRun:  true,
+			Changes: []state.OrganisationChange{{Action: state.ChangeCreate, Zone: 5}},
+		}, response)
+
+		_, found := do.Zone(5)
+		assert.False(t, found)
+	})
+
+	t.Run("imports a document, replacing the existing organisation", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("Old")
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/import", controller.importOrganisation)
+
+		req, _ := http.NewRequest("POST", "/organisation/import?mode=replace", strings.NewReader(`{"Version":1,"Zones":[{"Identifier":5,"Name":"Kitchen"}]}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		_, found := do.Zone(1)
+		assert.False(t, found)
+
+		z, found := do.Zone(5)
+		assert.True(t, found)
+		assert.Equal(t, "Kitchen", z.Name)
+	})
+
+	t.Run("returns a 400 for invalid documents or modes", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("a")
+		_ = do.NameDevice("a", "Kitchen Light")
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/import", controller.importOrganisation)
+
+		for _, request := range []struct {
+			url  string
+			body string
+		}{
+			{"/organisation/import", `{`},
+			{"/organisation/import", `{"Version":99}`},
+			{"/organisation/import?mode=append", `{"Version":1}`},
+			{"/organisation/import", `{"Version":1,"Devices":[{"Identifier":"one","Zones":[3]}]}`},
+			{"/organisation/import?mode=merge", `{"Version":1,"Devices":[{"Identifier":"b","Alias":"kitchen-light"}]}`},
+		} {
+			req, _ := http.NewRequest("POST", request.url, strings.NewReader(request.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, request.body)
+		}
+	})
+}
+
+func Test_organisationController_history(t *testing.T) {
+	t.Run("lists changes made by the authenticated user", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/import", controller.importOrganisation)
+		router.HandleFunc("/organisation/history", controller.getHistory)
+
+		body := `{"Version":1,"Zones":[{"Identifier":5,"Name":"Kitchen"}]}`
+
+		req, _ := http.NewRequest("POST", "/organisation/import", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIdentityContextKey, "username"))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest("GET", "/organisation/history", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var history []state.HistoryEntry
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+		assert.Len(t, history, 1)
+		assert.Equal(t, "username", history[0].Actor)
+		assert.Equal(t, "ImportOrganisation", history[0].Operation)
+		assert.Equal(t, []state.OrganisationChange{{Action: state.ChangeCreate, Zone: 5}}, history[0].Changes)
+	})
+
+	t.Run("reverts to a version or point in time", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+		do.NewZone("Lounge")
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/history/revert", controller.revertOrganisation)
+
+		req, _ := http.NewRequest("POST", "/organisation/history/revert", strings.NewReader(`{"Version":1}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		response := historyChangeResponse{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, []state.OrganisationChange{{Action: state.ChangeDelete, Zone: 2}}, response.Changes)
+		assert.Len(t, do.RootZones(), 1)
+
+		past, _ := json.Marshal(revertOrganisationRequest{Time: &time.Time{}})
+
+		req, _ = http.NewRequest("POST", "/organisation/history/revert", bytes.NewReader(past))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, do.RootZones())
+
+		for _, body := range []string{`{}`, `{"Version":1,"Time":"2024-01-01T00:00:00Z"}`} {
+			req, _ = http.NewRequest("POST", "/organisation/history/revert", strings.NewReader(body))
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		}
+
+		req, _ = http.NewRequest("POST", "/organisation/history/revert", strings.NewReader(`{"Version":100}`))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("undoes a single change", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+		_ = do.NameZone(1, "Galley")
+		do.NewZone("Lounge")
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/history/{version}/undo", controller.undoChange)
+
+		req, _ := http.NewRequest("POST", "/organisation/history/2/undo", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		zone, _ := do.Zone(1)
+		assert.Equal(t, "Kitchen", zone.Name)
+		assert.Len(t, do.RootZones(), 2)
+
+		req, _ = http.NewRequest("POST", "/organisation/history/100/undo", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func Test_organisationController_applyBatch(t *testing.T) {
+	t.Run("applies a batch, returning the identifiers of created zones", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/batch", controller.applyBatch)
+
+		body := `{"Operations":[
+			{"Action":"create-zone","Reference":"house","Name":"House"},
+			{"Action":"create-zone","Reference":"kitchen","Name":"Kitchen","Parent":"house","Kind":"room"},
+			{"Action":"assign-device","Device":"one","Zone":"kitchen"}
+		]}`
+
+		req, _ := http.NewRequest("POST", "/organisation/batch", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		result := state.BatchResult{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		assert.Equal(t, map[string]int{"house": 1, "kitchen": 2}, result.Zones)
+
+		dm, _ := do.Device("one")
+		assert.Equal(t, []int{2}, dm.Zones)
+	})
+
+	t.Run("returns a 400 without making changes if an operation is invalid", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+		controller := organisationController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/organisation/batch", controller.applyBatch)
+
+		for _, body := range []string{`{"Operations":[{"Action":"create-zone","Name":"House"},{"Action":"name-zone","Zone":7}]}`, `[`} {
+			req, _ := http.NewRequest("POST", "/organisation/batch", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		}
+
+		assert.Empty(t, do.RootZones())
+	})
+}
@@ -16,16 +16,16 @@ import (
 //go:embed openapi.json
 var openapi embed.FS
 
-func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOrganiser, stack layers.OutputStack, l logwrap.Logger, ap auth.AuthenticationProvider, eventbus state.EventSubscriber) http.Handler {
+func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOrganiser, stack layers.OutputStack, l logwrap.Logger, ap auth.AuthenticationProvider, eventbus state.EventSubscriber, deviceConverter exporter.DeviceExporter, deviceInvoker invoker.Invoker, operations *state.OperationTracker, commandQueue *state.CommandQueue, reloader Reloader) http.Handler {
 	protected := mux.NewRouter()
 
-	deviceConverter := exporter.NewDeviceExporter(deviceOrganiser, mapper)
-
 	dc := deviceController{
 		gatewayMapper:   mapper,
 		deviceExporter:  deviceConverter,
-		deviceInvoker:   invoker.InvokeDeviceAction,
+		deviceInvoker:   deviceInvoker,
 		deviceOrganiser: deviceOrganiser,
+		operations:      operations,
+		commandQueue:    commandQueue,
 		stack:           stack,
 	}
 
@@ -33,6 +33,7 @@ func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOr
 		gatewayMapper:    mapper,
 		gatewayConverter: exporter.ExportGateway,
 		deviceConverter:  deviceConverter,
+		deviceOrganiser:  deviceOrganiser,
 	}
 
 	zc := zoneController{
@@ -41,6 +42,22 @@ func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOr
 		deviceOrganiser: deviceOrganiser,
 	}
 
+	cc := capabilityController{}
+
+	orc := organisationController{
+		deviceOrganiser: deviceOrganiser,
+	}
+
+	ac := adminController{
+		gatewayMapper:   mapper,
+		deviceOrganiser: deviceOrganiser,
+		reloader:        reloader,
+	}
+
+	oc := operationController{
+		operations: operations,
+	}
+
 	wc := eventsController{
 		eventbus:    eventbus,
 		eventMapper: exporter.NewEventExporter(mapper, deviceConverter, deviceOrganiser),
@@ -50,8 +67,17 @@ func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOr
 	protected.HandleFunc("/devices", dc.listDevices).Methods("GET")
 	protected.HandleFunc("/devices/{identifier}", dc.getDevice).Methods("GET")
 	protected.HandleFunc("/devices/{identifier}", dc.updateDevice).Methods("PATCH")
+	protected.HandleFunc("/devices/{identifier}/replace/{newIdentifier}", dc.replaceDevice).Methods("POST")
+	protected.HandleFunc("/devices/{identifier}/queue", dc.getDeviceQueue).Methods("GET")
+	protected.HandleFunc("/devices/{identifier}/queue", dc.clearDeviceQueue).Methods("DELETE")
+	protected.HandleFunc("/devices/{identifier}/queue/{commandIdentifier}", dc.cancelDeviceQueuedCommand).Methods("DELETE")
+	protected.HandleFunc("/devices/{identifier}/capabilities/{name}/actions", dc.getDeviceCapabilityActions).Methods("GET")
 	protected.HandleFunc("/devices/{identifier}/capabilities/{name}/{action}", dc.useDeviceCapabilityAction).Methods("POST")
 
+	protected.HandleFunc("/capabilities", cc.listCapabilities).Methods("GET")
+
+	protected.HandleFunc("/operations/{identifier}", oc.getOperation).Methods("GET")
+
 	protected.HandleFunc("/gateways", gc.listGateways).Methods("GET")
 	protected.HandleFunc("/gateways/{identifier}", gc.getGateway).Methods("GET")
 	protected.HandleFunc("/gateways/{identifier}/devices", gc.listDevicesOnGateway).Methods("GET")
@@ -61,11 +87,25 @@ func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOr
 	protected.HandleFunc("/zones/{identifier}", zc.getZone).Methods("GET")
 	protected.HandleFunc("/zones/{identifier}", zc.deleteZone).Methods("DELETE")
 	protected.HandleFunc("/zones/{identifier}", zc.updateZone).Methods("PATCH")
+	protected.HandleFunc("/zones/{identifier}/clone", zc.cloneZone).Methods("POST")
+	protected.HandleFunc("/zones/{identifier}/devices/move", zc.moveZoneDevices).Methods("POST")
 	protected.HandleFunc("/zones/{identifier}/devices/{deviceIdentifier}", zc.addDeviceToZone).Methods("PUT")
 	protected.HandleFunc("/zones/{identifier}/devices/{deviceIdentifier}", zc.removeDeviceToZone).Methods("DELETE")
 	protected.HandleFunc("/zones/{identifier}/subzones/{subzoneIdentifier}", zc.addSubzoneToZone).Methods("PUT")
 	protected.HandleFunc("/zones/{identifier}/subzones/{subzoneIdentifier}", zc.removeSubzoneToZone).Methods("DELETE")
 
+	protected.HandleFunc("/organisation/export", orc.exportOrganisation).Methods("GET")
+	protected.HandleFunc("/organisation/import", orc.importOrganisation).Methods("POST")
+	protected.HandleFunc("/organisation/batch", orc.applyBatch).Methods("POST")
+	protected.HandleFunc("/organisation/history", orc.getHistory).Methods("GET")
+	protected.HandleFunc("/organisation/history/revert", orc.revertOrganisation).Methods("POST")
+	protected.HandleFunc("/organisation/history/{version}/undo", orc.undoChange).Methods("POST")
+
+	protected.HandleFunc("/admin/organiser/fsck", ac.checkOrganiser).Methods("GET")
+	protected.HandleFunc("/admin/organiser/fsck", ac.repairOrganiser).Methods("POST")
+	protected.HandleFunc("/admin/reload", ac.getReload).Methods("GET")
+	protected.HandleFunc("/admin/reload", ac.reload).Methods("POST")
+
 	protected.HandleFunc("/events/sse", wc.serveServerSideEvent).Methods("GET")
 	protected.HandleFunc("/events/ws", wc.serveWebsocket).Methods("GET")
 
@@ -78,6 +118,7 @@ func ConstructRouter(mapper state.GatewayMapper, deviceOrganiser *state.DeviceOr
 
 	return handlers.CORS(
 		handlers.AllowedMethods([]string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch}),
-		handlers.AllowedHeaders([]string{"content-type"}),
+		handlers.AllowedHeaders([]string{"content-type", "idempotency-key"}),
+		handlers.ExposedHeaders([]string{"location", "link", "x-next-cursor"}),
 	)(apiRoot)
 }
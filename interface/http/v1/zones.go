@@ -13,10 +13,14 @@ import (
 )
 
 type ExportedZone struct {
-	Identifier int
-	Name       string
-	SubZones   []ExportedZone            `json:",omitempty"`
-	Devices    []exporter.ExportedDevice `json:",omitempty"`
+	Identifier  int
+	Name        string
+	Kind        state.ZoneKind            `json:",omitempty"`
+	Icon        string                    `json:",omitempty"`
+	Attributes  map[string]any            `json:",omitempty"`
+	Coordinates *state.ZoneCoordinates    `json:",omitempty"`
+	SubZones    []ExportedZone            `json:",omitempty"`
+	Devices     []exporter.ExportedDevice `json:",omitempty"`
 }
 
 type zoneController struct {
@@ -74,10 +78,14 @@ func (z *zoneController) enumerateZone(nZ state.Zone, includeDevices bool, inclu
 	}
 
 	return ExportedZone{
-		Identifier: nZ.Identifier,
-		Name:       nZ.Name,
-		SubZones:   subZones,
-		Devices:    devices,
+		Identifier:  nZ.Identifier,
+		Name:        nZ.Name,
+		Kind:        nZ.Kind,
+		Icon:        nZ.Icon,
+		Attributes:  nZ.Attributes,
+		Coordinates: nZ.Coordinates,
+		SubZones:    subZones,
+		Devices:     devices,
 	}
 }
 
@@ -132,6 +140,8 @@ func (z *zoneController) getZone(w http.ResponseWriter, r *http.Request) {
 
 type createZoneRequest struct {
 	Name string
+	Kind state.ZoneKind
+	Icon string
 }
 
 func (z *zoneController) createZone(w http.ResponseWriter, r *http.Request) {
@@ -149,7 +159,17 @@ func (z *zoneController) createZone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	nZ := z.deviceOrganiser.NewZone(request.Name)
+	nZ, err := actingOrganiser(z.deviceOrganiser, r).NewZoneOfKind(request.Name, request.Kind, request.Icon)
+	if err != nil {
+		if errors.Is(err, state.ErrInvalidZoneKind) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
 	convertedZone := z.enumerateZone(nZ, false, false)
 
 	data, err = json.Marshal(convertedZone)
@@ -177,21 +197,144 @@ func (z *zoneController) deleteZone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = z.deviceOrganiser.DeleteZone(id)
+	query := r.URL.Query()
+
+	if recursive, _ := strconv.ParseBool(query.Get("recursive")); recursive {
+		moveDevicesTo := state.RootZoneId
+
+		if stringMoveId := query.Get("moveDevicesTo"); stringMoveId != "" {
+			if moveDevicesTo, err = strconv.Atoi(stringMoveId); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err = actingOrganiser(z.deviceOrganiser, r).DeleteZoneRecursive(id, moveDevicesTo)
+	} else {
+		err = actingOrganiser(z.deviceOrganiser, r).DeleteZone(id)
+	}
+
 	switch {
+	case err == nil:
+		http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
 	case errors.Is(err, state.ErrNotFound):
 		http.NotFound(w, r)
-	case errors.Is(err, state.ErrHasDevices):
+	case errors.Is(err, state.ErrHasDevices), errors.Is(err, state.ErrOrphanZone), errors.Is(err, state.ErrCircularReference):
 		http.Error(w, err.Error(), http.StatusBadRequest)
-	case errors.Is(err, state.ErrOrphanZone):
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+type moveZoneDevicesRequest struct {
+	Zone int
+}
+
+func (z *zoneController) moveZoneDevices(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	stringId, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.Atoi(stringId)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	request := moveZoneDevicesRequest{}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	err = actingOrganiser(z.deviceOrganiser, r).MoveZoneDevices(id, request.Zone)
+	switch {
+	case err == nil:
+		http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+	case errors.Is(err, state.ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, state.ErrSameZone):
 		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
+}
 
-	http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+type cloneZoneRequest struct {
+	Parent         int
+	IncludeDevices bool
+}
+
+func (z *zoneController) cloneZone(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	stringId, ok := params["identifier"]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.Atoi(stringId)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	request := cloneZoneRequest{}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &request); err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	nZ, err := actingOrganiser(z.deviceOrganiser, r).CloneZone(id, request.Parent, request.IncludeDevices)
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	convertedZone := z.enumerateZone(nZ, request.IncludeDevices, true)
+
+	data, err = json.Marshal(convertedZone)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(data)
 }
 
 type updateZoneRequest struct {
 	Name          *string
+	Kind          *state.ZoneKind
+	Icon          *string
+	Attributes    map[string]any
+	Coordinates   json.RawMessage
 	ReorderBefore *int
 	ReorderAfter  *int
 }
@@ -225,31 +368,81 @@ func (z *zoneController) updateZone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	nZ, found := z.deviceOrganiser.Zone(id)
-	if !found {
-		http.NotFound(w, r)
+	if request.ReorderBefore != nil && request.ReorderAfter != nil {
+		http.Error(w, "Only one of ReorderBefore and ReorderAfter may be provided.", http.StatusBadRequest)
 		return
 	}
 
-	if request.Name != nil {
-		if err := z.deviceOrganiser.NameZone(nZ.Identifier, *request.Name); err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+	if request.Kind != nil && !request.Kind.Valid() {
+		http.Error(w, state.ErrInvalidZoneKind.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if request.ReorderAfter != nil {
-		if err := z.deviceOrganiser.ReorderZoneAfter(nZ.Identifier, *request.ReorderAfter); err != nil {
+	var coordinates *state.ZoneCoordinates
+
+	if len(request.Coordinates) > 0 {
+		if err := json.Unmarshal(request.Coordinates, &coordinates); err != nil {
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
 	}
 
-	if request.ReorderBefore != nil {
-		if err := z.deviceOrganiser.ReorderZoneBefore(nZ.Identifier, *request.ReorderBefore); err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			return
+	nZ, found := z.deviceOrganiser.Zone(id)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = actingOrganiser(z.deviceOrganiser, r).Record("UpdateZone", func(do *state.DeviceOrganiser) error {
+		if request.ReorderBefore != nil {
+			if err := do.ReorderZoneBefore(nZ.Identifier, *request.ReorderBefore); err != nil {
+				return err
+			}
+		} else if request.ReorderAfter != nil {
+			if err := do.ReorderZoneAfter(nZ.Identifier, *request.ReorderAfter); err != nil {
+				return err
+			}
+		}
+
+		if request.Attributes != nil {
+			if err := do.UpdateZoneAttributes(nZ.Identifier, request.Attributes); err != nil {
+				return err
+			}
+		}
+
+		if request.Name != nil {
+			if err := do.NameZone(nZ.Identifier, *request.Name); err != nil {
+				return err
+			}
+		}
+
+		if request.Kind != nil {
+			if err := do.SetZoneKind(nZ.Identifier, *request.Kind); err != nil {
+				return err
+			}
+		}
+
+		if request.Icon != nil {
+			if err := do.SetZoneIcon(nZ.Identifier, *request.Icon); err != nil {
+				return err
+			}
+		}
+
+		if len(request.Coordinates) > 0 {
+			return do.SetZoneCoordinates(nZ.Identifier, coordinates)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) || errors.Is(err, state.ErrSameZone) || errors.Is(err, state.ErrMustHaveSameParent) || errors.Is(err, state.ErrInvalidAttribute) || errors.Is(err, state.ErrInvalidZoneKind) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
+
+		return
 	}
 
 	nZ, _ = z.deviceOrganiser.Zone(id)
@@ -281,13 +474,17 @@ func (z *zoneController) addDeviceToZone(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if deviceId, ok = resolveDeviceReference(w, z.deviceOrganiser, deviceId); !ok {
+		return
+	}
+
 	zoneId, err := strconv.Atoi(stringZoneId)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	if err := z.deviceOrganiser.AddDeviceToZone(deviceId, zoneId); err != nil {
+	if err := actingOrganiser(z.deviceOrganiser, r).AddDeviceToZone(deviceId, zoneId); err != nil {
 		if errors.Is(err, state.ErrNotFound) {
 			http.NotFound(w, r)
 		} else {
@@ -315,13 +512,17 @@ func (z *zoneController) removeDeviceToZone(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if deviceId, ok = resolveDeviceReference(w, z.deviceOrganiser, deviceId); !ok {
+		return
+	}
+
 	zoneId, err := strconv.Atoi(stringZoneId)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	if err := z.deviceOrganiser.RemoveDeviceFromZone(deviceId, zoneId); err != nil {
+	if err := actingOrganiser(z.deviceOrganiser, r).RemoveDeviceFromZone(deviceId, zoneId); err != nil {
 		if errors.Is(err, state.ErrNotFound) {
 			http.NotFound(w, r)
 		} else {
@@ -361,7 +562,7 @@ func (z *zoneController) addSubzoneToZone(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := z.deviceOrganiser.MoveZone(subzoneId, zoneId); err != nil {
+	if err := actingOrganiser(z.deviceOrganiser, r).MoveZone(subzoneId, zoneId); err != nil {
 		if errors.Is(err, state.ErrNotFound) {
 			http.NotFound(w, r)
 		} else {
@@ -406,7 +607,7 @@ func (z *zoneController) removeSubzoneToZone(w http.ResponseWriter, r *http.Requ
 		http.NotFound(w, r)
 	}
 
-	if err := z.deviceOrganiser.MoveZone(subzoneId, state.RootZoneId); err != nil {
+	if err := actingOrganiser(z.deviceOrganiser, r).MoveZone(subzoneId, state.RootZoneId); err != nil {
 		if errors.Is(err, state.ErrNotFound) {
 			http.NotFound(w, r)
 		} else {
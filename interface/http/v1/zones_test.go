@@ -373,6 +373,42 @@ func Test_zoneController_createZone(t *testing.T) {
 
 		assert.Equal(t, expectedZone, actualZone)
 	})
+
+	t.Run("creates a zone with a kind and icon, rejecting unknown kinds", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones", controller.createZone)
+
+		req, err := http.NewRequest("POST", "/zones", strings.NewReader(`{"Name":"Ground","Kind":"floor","Icon":"stairs"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		z, _ := do.Zone(1)
+		assert.Equal(t, state.ZoneKindFloor, z.Kind)
+		assert.Equal(t, "stairs", z.Icon)
+		assert.Len(t, do.History(), 1)
+
+		req, err = http.NewRequest("POST", "/zones", strings.NewReader(`{"Name":"Cupboard","Kind":"cupboard"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Len(t, do.RootZones(), 1)
+		assert.Len(t, do.History(), 1)
+	})
 }
 
 func Test_zoneController_deleteZone(t *testing.T) {
@@ -398,6 +434,120 @@ func Test_zoneController_deleteZone(t *testing.T) {
 		_, found := do.Zone(zoneOne.Identifier)
 		assert.False(t, found)
 	})
+
+	t.Run("refuses to delete a zone with subzones unless recursive", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("device")
+		parent := do.NewZone("parent")
+		child := do.NewZone("child")
+		target := do.NewZone("target")
+		_ = do.MoveZone(child.Identifier, parent.Identifier)
+		_ = do.AddDeviceToZone("device", child.Identifier)
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}", controller.deleteZone)
+
+		req, _ := http.NewRequest("DELETE", "/zones/1", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		req, _ = http.NewRequest("DELETE", "/zones/1?recursive=true&moveDevicesTo=two", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		req, _ = http.NewRequest("DELETE", "/zones/1?recursive=true&moveDevicesTo=3", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		_, found := do.Zone(child.Identifier)
+		assert.False(t, found)
+
+		z, _ := do.Zone(target.Identifier)
+		assert.Equal(t, []string{"device"}, z.Devices)
+	})
+}
+
+func Test_zoneController_moveZoneDevices(t *testing.T) {
+	t.Run("moves all devices from one zone to another", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("device")
+		from := do.NewZone("from")
+		to := do.NewZone("to")
+		_ = do.AddDeviceToZone("device", from.Identifier)
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}/devices/move", controller.moveZoneDevices)
+
+		req, _ := http.NewRequest("POST", "/zones/1/devices/move", strings.NewReader(`{"Zone":2}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		z, _ := do.Zone(to.Identifier)
+		assert.Equal(t, []string{"device"}, z.Devices)
+
+		req, _ = http.NewRequest("POST", "/zones/1/devices/move", strings.NewReader(`{"Zone":99}`))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		req, _ = http.NewRequest("POST", "/zones/1/devices/move", strings.NewReader(`{"Zone":1}`))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func Test_zoneController_cloneZone(t *testing.T) {
+	t.Run("clones a zone subtree under a new parent", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		parent := do.NewZone("parent")
+		child := do.NewZone("child")
+		_ = do.MoveZone(child.Identifier, parent.Identifier)
+		_ = do.SetZoneIcon(child.Identifier, "lamp")
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}/clone", controller.cloneZone)
+
+		req, _ := http.NewRequest("POST", "/zones/1/clone", strings.NewReader(`{"Parent":0}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		expectedZone := ExportedZone{
+			Identifier: 3,
+			Name:       "parent",
+			SubZones: []ExportedZone{
+				{Identifier: 4, Name: "child", Icon: "lamp"},
+			},
+		}
+
+		actualZone := ExportedZone{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actualZone))
+		assert.Equal(t, expectedZone, actualZone)
+
+		req, _ = http.NewRequest("POST", "/zones/99/clone", strings.NewReader(`{}`))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
 }
 
 func Test_zoneController_updateZone(t *testing.T) {
@@ -439,6 +589,53 @@ func Test_zoneController_updateZone(t *testing.T) {
 		assert.Equal(t, expectedZone, actualZone)
 	})
 
+	t.Run("applies every field of an update as a single change", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("one")
+		do.NewZone("two")
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}", controller.updateZone)
+
+		history := len(do.History())
+
+		req, err := http.NewRequest("PATCH", "/zones/2", strings.NewReader(`{"ReorderBefore":1,"Name":"Lounge","Kind":"room","Icon":"sofa","Attributes":{"area":12}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		z, _ := do.Zone(2)
+		assert.Equal(t, "Lounge", z.Name)
+		assert.Equal(t, state.ZoneKindRoom, z.Kind)
+		assert.Equal(t, "sofa", z.Icon)
+		assert.Equal(t, 2, do.RootZones()[0].Identifier)
+
+		assert.Len(t, do.History(), history+1)
+		assert.Equal(t, "UpdateZone", do.History()[history].Operation)
+
+		req, err = http.NewRequest("PATCH", "/zones/2", strings.NewReader(`{"ReorderAfter":1,"Name":"Kitchen","Attributes":{"area":[12]}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		z, _ = do.Zone(2)
+		assert.Equal(t, "Lounge", z.Name)
+		assert.Equal(t, 2, do.RootZones()[0].Identifier)
+		assert.Len(t, do.History(), history+1)
+	})
+
 	t.Run("updates an individual zone, moving before", func(t *testing.T) {
 		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
 		do.NewZone("one")
@@ -496,6 +693,97 @@ func Test_zoneController_updateZone(t *testing.T) {
 
 		assert.Equal(t, []int{2, 1}, actualZoneOrder)
 	})
+
+	t.Run("updates the kind, icon, attributes and coordinates of a zone", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PATCH", "/zones/1", strings.NewReader(`{"Kind":"room","Icon":"kettle","Attributes":{"area":12},"Coordinates":{"X":1,"Y":2,"Width":3,"Height":4}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}", controller.updateZone)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		expectedZone := ExportedZone{
+			Identifier:  1,
+			Name:        "Kitchen",
+			Kind:        state.ZoneKindRoom,
+			Icon:        "kettle",
+			Attributes:  map[string]any{"area": float64(12)},
+			Coordinates: &state.ZoneCoordinates{X: 1, Y: 2, Width: 3, Height: 4},
+		}
+
+		actualZone := ExportedZone{}
+
+		err = json.Unmarshal([]byte(rr.Body.String()), &actualZone)
+		assert.NoError(t, err)
+
+		assert.Equal(t, expectedZone, actualZone)
+	})
+
+	t.Run("removes a zone from the floor plan if coordinates are null", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+		_ = do.SetZoneCoordinates(1, &state.ZoneCoordinates{X: 1, Y: 2})
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PATCH", "/zones/1", strings.NewReader(`{"Coordinates":null}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}", controller.updateZone)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		z, _ := do.Zone(1)
+		assert.Nil(t, z.Coordinates)
+	})
+
+	t.Run("returns a 400 without changes if the update is invalid", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("one")
+		do.NewZone("two")
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}", controller.updateZone)
+
+		for _, body := range []string{
+			`{"Name":"changed","ReorderBefore":2,"ReorderAfter":2}`,
+			`{"Name":"changed","Kind":"cupboard"}`,
+			`{"Name":"changed","ReorderBefore":3}`,
+			`{"Name":"changed","ReorderAfter":1}`,
+		} {
+			req, err := http.NewRequest("PATCH", "/zones/1", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+
+			z, _ := do.Zone(1)
+			assert.Equal(t, "one", z.Name, body)
+		}
+	})
 }
 
 func Test_zoneController_addDeviceToZone(t *testing.T) {
@@ -522,6 +810,30 @@ func Test_zoneController_addDeviceToZone(t *testing.T) {
 		z, _ := do.Zone(1)
 		assert.Contains(t, z.Devices, "id")
 	})
+	t.Run("add a device addressed by its alias to a zone", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.NewZone("ExportedZone")
+		do.AddDevice("id")
+		_ = do.SetDeviceAlias("id", "porch-light")
+
+		controller := zoneController{deviceOrganiser: &do}
+
+		req, err := http.NewRequest("PUT", "/zones/1/devices/porch-light", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/zones/{identifier}/devices/{deviceIdentifier}", controller.addDeviceToZone)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		z, _ := do.Zone(1)
+		assert.Equal(t, []string{"id"}, z.Devices)
+	})
 }
 
 func Test_zoneController_removeDeviceToZone(t *testing.T) {
@@ -0,0 +1,92 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+)
+
+const AvailabilityCheckInterval = 5 * time.Second
+
+const AvailablePayload = "online"
+const UnavailablePayload = "offline"
+
+// availabilityTracker records when each device was last heard from, and the availability last published for it.
+type availabilityTracker struct {
+	lock      sync.Mutex
+	lastSeen  map[string]time.Time
+	published map[string]bool
+	now       func() time.Time
+}
+
+func newAvailabilityTracker() *availabilityTracker {
+	return &availabilityTracker{
+		lastSeen:  map[string]time.Time{},
+		published: map[string]bool{},
+		now:       time.Now,
+	}
+}
+
+// seen records activity from a device.
+func (a *availabilityTracker) seen(id string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.lastSeen[id] = a.now()
+}
+
+// failed marks a device as not having been seen, such that it will be unavailable until it is next seen.
+func (a *availabilityTracker) failed(id string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.lastSeen[id] = time.Time{}
+}
+
+func (a *availabilityTracker) forget(id string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.lastSeen, id)
+	delete(a.published, id)
+}
+
+// update calculates if a device is available given its timeout, returning true if this differs from the availability
+// last published. A device which has never been seen is given a full timeout from the first time it is checked.
+func (a *availabilityTracker) update(id string, timeout time.Duration) (bool, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := a.now()
+
+	lastSeen, found := a.lastSeen[id]
+	if !found {
+		lastSeen = now
+		a.lastSeen[id] = now
+	}
+
+	available := now.Sub(lastSeen) < timeout
+
+	previous, published := a.published[id]
+	a.published[id] = available
+
+	return available, !published || previous != available
+}
+
+// set records the availability published for a device, returning true if it differs from that last published.
+func (a *availabilityTracker) set(id string, available bool) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	previous, published := a.published[id]
+	a.published[id] = available
+
+	return !published || previous != available
+}
+
+// reset forgets the published availability of all devices, causing it to be published again.
+func (a *availabilityTracker) reset() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.published = map[string]bool{}
+}
@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_availabilityTracker(t *testing.T) {
+	t.Run("an unseen device is available until its timeout expires", func(t *testing.T) {
+		now := time.Now()
+
+		a := newAvailabilityTracker()
+		a.now = func() time.Time { return now }
+
+		available, changed := a.update("one", time.Minute)
+		assert.True(t, available)
+		assert.True(t, changed)
+
+		available, changed = a.update("one", time.Minute)
+		assert.True(t, available)
+		assert.False(t, changed)
+
+		now = now.Add(time.Minute)
+
+		available, changed = a.update("one", time.Minute)
+		assert.False(t, available)
+		assert.True(t, changed)
+	})
+
+	t.Run("activity makes a device available again", func(t *testing.T) {
+		now := time.Now()
+
+		a := newAvailabilityTracker()
+		a.now = func() time.Time { return now }
+
+		a.seen("one")
+		now = now.Add(2 * time.Minute)
+
+		available, _ := a.update("one", time.Minute)
+		assert.False(t, available)
+
+		a.seen("one")
+
+		available, changed := a.update("one", time.Minute)
+		assert.True(t, available)
+		assert.True(t, changed)
+	})
+
+	t.Run("a failed device is unavailable until seen", func(t *testing.T) {
+		a := newAvailabilityTracker()
+
+		a.seen("one")
+		a.failed("one")
+
+		available, _ := a.update("one", time.Minute)
+		assert.False(t, available)
+	})
+
+	t.Run("reset causes availability to be reported as changed", func(t *testing.T) {
+		a := newAvailabilityTracker()
+
+		assert.True(t, a.set("one", true))
+		assert.False(t, a.set("one", true))
+
+		a.reset()
+
+		assert.True(t, a.set("one", true))
+	})
+}
+
+func TestInterface_availabilityTimeout(t *testing.T) {
+	d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress(), SCapabilities: []da.Capability{capabilities.OnOffFlag, capabilities.TemperatureSensorFlag}}
+
+	t.Run("uses the default timeout", func(t *testing.T) {
+		i := Interface{AvailabilityTimeout: time.Minute}
+		assert.Equal(t, time.Minute, i.availabilityTimeout(d))
+	})
+
+	t.Run("uses the longest capability timeout over the default", func(t *testing.T) {
+		i := Interface{AvailabilityTimeout: time.Minute, CapabilityAvailabilityTimeouts: map[string]time.Duration{"OnOff": 2 * time.Minute, "TemperatureSensor": time.Hour}}
+		assert.Equal(t, time.Hour, i.availabilityTimeout(d))
+	})
+
+	t.Run("uses the device timeout over all others", func(t *testing.T) {
+		i := Interface{AvailabilityTimeout: time.Minute, CapabilityAvailabilityTimeouts: map[string]time.Duration{"OnOff": time.Hour}, DeviceAvailabilityTimeouts: map[string]time.Duration{d.Identifier().String(): time.Second}}
+		assert.Equal(t, time.Second, i.availabilityTimeout(d))
+	})
+}
@@ -0,0 +1,170 @@
+package mqtt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/template"
+)
+
+const DefaultFloatPrecision = 6
+
+// PayloadFormat controls how individual state values are rendered as MQTT payloads. The zero value matches the
+// historical output of the controller, floats to six decimal places, booleans as true/false and missing values as null.
+type PayloadFormat struct {
+	// FloatPrecision is the number of decimal places floats are published with, nil uses DefaultFloatPrecision.
+	FloatPrecision *int
+	// TrueValue and FalseValue replace the payloads used for booleans, such as ON and OFF.
+	TrueValue  string
+	FalseValue string
+	// NullValue replaces the payload used for values which are not present.
+	NullValue string
+	// Units are suffixed to float values published by a capability, separated by a space, keyed by capability name.
+	Units map[string]string
+}
+
+func (f PayloadFormat) null() []byte {
+	if len(f.NullValue) == 0 {
+		return []byte("null")
+	}
+
+	return []byte(f.NullValue)
+}
+
+func (f PayloadFormat) format(capName string, value any) []byte {
+	switch v := value.(type) {
+	case nil:
+		return f.null()
+	case bool:
+		if v {
+			if len(f.TrueValue) > 0 {
+				return []byte(f.TrueValue)
+			}
+		} else if len(f.FalseValue) > 0 {
+			return []byte(f.FalseValue)
+		}
+
+		return []byte(strconv.FormatBool(v))
+	case *bool:
+		if v == nil {
+			return f.null()
+		}
+
+		return f.format(capName, *v)
+	case float64:
+		precision := DefaultFloatPrecision
+		if f.FloatPrecision != nil {
+			precision = *f.FloatPrecision
+		}
+
+		formatted := strconv.FormatFloat(v, 'f', precision, 64)
+
+		if unit, found := f.Units[capName]; found && len(unit) > 0 {
+			formatted = fmt.Sprintf("%s %s", formatted, unit)
+		}
+
+		return []byte(formatted)
+	case *float64:
+		if v == nil {
+			return f.null()
+		}
+
+		return f.format(capName, *v)
+	case int:
+		return []byte(strconv.Itoa(v))
+	case *int:
+		if v == nil {
+			return f.null()
+		}
+
+		return f.format(capName, *v)
+	case string:
+		if len(v) == 0 {
+			return f.null()
+		}
+
+		return []byte(v)
+	case *string:
+		if v == nil {
+			return f.null()
+		}
+
+		return []byte(*v)
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
+
+// CapabilityTemplate overrides the topic and/or payload published for a capability, either template may be nil to
+// retain the default. Templates are executed with TemplateData.
+type CapabilityTemplate struct {
+	Topic   *template.Template
+	Payload *template.Template
+}
+
+// TemplateData is provided to capability templates when publishing a value.
+type TemplateData struct {
+	// Device is the identifier of the device the value belongs to.
+	Device string
+	// Capability is the name of the capability the value belongs to.
+	Capability string
+	// Field is the path of the value within the capability, such as Reading/0/Value, it is empty when publishing
+	// aggregated state.
+	Field string
+	// Topic is the topic the value would be published to without a template.
+	Topic string
+	// Value is the raw value being published, or the exported capability when publishing aggregated state.
+	Value any
+	// Payload is the payload that would be published without a template.
+	Payload string
+}
+
+// ParseCapabilityTemplate parses topic and payload templates, an empty string leaves that template unset.
+func ParseCapabilityTemplate(capName string, topic string, payload string) (CapabilityTemplate, error) {
+	var ct CapabilityTemplate
+
+	if len(topic) > 0 {
+		tmpl, err := template.New(fmt.Sprintf("%s-topic", capName)).Parse(topic)
+		if err != nil {
+			return ct, fmt.Errorf("failed to parse topic template for %s: %w", capName, err)
+		}
+
+		ct.Topic = tmpl
+	}
+
+	if len(payload) > 0 {
+		tmpl, err := template.New(fmt.Sprintf("%s-payload", capName)).Parse(payload)
+		if err != nil {
+			return ct, fmt.Errorf("failed to parse payload template for %s: %w", capName, err)
+		}
+
+		ct.Payload = tmpl
+	}
+
+	return ct, nil
+}
+
+func (ct CapabilityTemplate) apply(data TemplateData) (string, []byte, error) {
+	topic := data.Topic
+	payload := []byte(data.Payload)
+
+	if ct.Topic != nil {
+		buf := &bytes.Buffer{}
+		if err := ct.Topic.Execute(buf, data); err != nil {
+			return "", nil, fmt.Errorf("failed to execute topic template: %w", err)
+		}
+
+		topic = buf.String()
+	}
+
+	if ct.Payload != nil {
+		buf := &bytes.Buffer{}
+		if err := ct.Payload.Execute(buf, data); err != nil {
+			return "", nil, fmt.Errorf("failed to execute payload template: %w", err)
+		}
+
+		payload = buf.Bytes()
+	}
+
+	return topic, payload, nil
+}
@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPayloadFormat_format(t *testing.T) {
+	t.Run("zero value matches the default formatting", func(t *testing.T) {
+		f := PayloadFormat{}
+
+		floatValue := 0.5
+		var nilFloat *float64
+
+		assert.Equal(t, []byte("true"), f.format("OnOff", true))
+		assert.Equal(t, []byte("false"), f.format("OnOff", false))
+		assert.Equal(t, []byte("0.500000"), f.format("AlarmWarningDevice", &floatValue))
+		assert.Equal(t, []byte("null"), f.format("AlarmWarningDevice", nilFloat))
+		assert.Equal(t, []byte("null"), f.format("ProductInformation", ""))
+		assert.Equal(t, []byte("60000"), f.format("DeviceDiscovery", 60000))
+	})
+
+	t.Run("uses configured precision, boolean and null values", func(t *testing.T) {
+		precision := 2
+		f := PayloadFormat{FloatPrecision: &precision, TrueValue: "ON", FalseValue: "OFF", NullValue: "unknown"}
+
+		var nilBool *bool
+
+		assert.Equal(t, []byte("ON"), f.format("OnOff", true))
+		assert.Equal(t, []byte("OFF"), f.format("OnOff", false))
+		assert.Equal(t, []byte("unknown"), f.format("OnOff", nilBool))
+		assert.Equal(t, []byte("290.13"), f.format("TemperatureSensor", 290.126))
+	})
+
+	t.Run("appends units to floats of a capability", func(t *testing.T) {
+		precision := 1
+		f := PayloadFormat{FloatPrecision: &precision, Units: map[string]string{"TemperatureSensor": "K"}}
+
+		assert.Equal(t, []byte("290.0 K"), f.format("TemperatureSensor", 290.0))
+		assert.Equal(t, []byte("0.5"), f.format("RelativeHumiditySensor", 0.5))
+	})
+}
+
+func TestCapabilityTemplate_apply(t *testing.T) {
+	t.Run("retains the default topic and payload without templates", func(t *testing.T) {
+		ct, err := ParseCapabilityTemplate("OnOff", "", "")
+		assert.NoError(t, err)
+
+		topic, payload, err := ct.apply(TemplateData{Topic: "devices/one/capabilities/OnOff/Current", Payload: "true"})
+		assert.NoError(t, err)
+		assert.Equal(t, "devices/one/capabilities/OnOff/Current", topic)
+		assert.Equal(t, []byte("true"), payload)
+	})
+
+	t.Run("renders topic and payload templates", func(t *testing.T) {
+		ct, err := ParseCapabilityTemplate("OnOff", "stat/{{.Device}}/POWER", `{{if .Value}}ON{{else}}OFF{{end}}`)
+		assert.NoError(t, err)
+
+		topic, payload, err := ct.apply(TemplateData{Device: "one", Capability: "OnOff", Field: "Current", Value: false})
+		assert.NoError(t, err)
+		assert.Equal(t, "stat/one/POWER", topic)
+		assert.Equal(t, []byte("OFF"), payload)
+	})
+
+	t.Run("returns an error for an invalid template", func(t *testing.T) {
+		_, err := ParseCapabilityTemplate("OnOff", "{{.Device", "")
+		assert.Error(t, err)
+	})
+}
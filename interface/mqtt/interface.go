@@ -3,6 +3,7 @@ package mqtt
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/shimmeringbee/controller/interface/converters/exporter"
 	"github.com/shimmeringbee/controller/interface/converters/invoker"
@@ -12,6 +13,7 @@ import (
 	"github.com/shimmeringbee/da/capabilities"
 	"github.com/shimmeringbee/logwrap"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,6 +30,7 @@ const DefaultMqttOutputLayer string = "mqtt"
 const UnknownTopic = mqttError("unknown topic")
 const UnknownDevice = mqttError("unknown device")
 const UnknownOutputLayer = mqttError("output layer requested could not be found")
+const InvalidPayload = mqttError("payload could not be parsed")
 
 type Interface struct {
 	Publisher Publisher
@@ -39,12 +42,31 @@ type Interface struct {
 	OutputStack     layers.OutputStack
 	DeviceInvoker   invoker.Invoker
 
-	deviceExporter exporter.DeviceExporter
+	DeviceExporter exporter.DeviceExporter
 	Logger         logwrap.Logger
 
 	PublishStateOnConnect  bool
 	PublishAggregatedState bool
 	PublishIndividualState bool
+
+	PublishOnlyOnChange       bool
+	PublishRefreshInterval    time.Duration
+	CapabilityPublishPolicies map[string]CapabilityPublishPolicy
+
+	PublishQueueSize       int
+	PublishWorkers         int
+	PublishQueueStatistics bool
+
+	PayloadFormat       PayloadFormat
+	CapabilityTemplates map[string]CapabilityTemplate
+
+	AvailabilityTimeout            time.Duration
+	CapabilityAvailabilityTimeouts map[string]time.Duration
+	DeviceAvailabilityTimeouts     map[string]time.Duration
+
+	filter       *publishFilter
+	queue        *publishQueue
+	availability *availabilityTracker
 }
 
 func (i *Interface) IncomingMessage(ctx context.Context, topic string, payload []byte) error {
@@ -64,6 +86,15 @@ func (i *Interface) IncomingMessageDevices(ctx context.Context, topic []string,
 	if len(topic) > 0 {
 		d, ok := i.GatewayMux.Device(topic[0])
 
+		if !ok && i.DeviceOrganiser != nil {
+			id, err := i.DeviceOrganiser.ResolveDevice(topic[0])
+			if errors.Is(err, state.ErrAmbiguous) {
+				return fmt.Errorf("%w: %w", UnknownDevice, err)
+			} else if err == nil {
+				d, ok = i.GatewayMux.Device(id)
+			}
+		}
+
 		if ok {
 			return i.IncomingMessageDevicesWith(ctx, topic[1:], payload, d)
 		}
@@ -77,6 +108,8 @@ func (i *Interface) IncomingMessageDevicesWith(ctx context.Context, topic []stri
 		switch topic[0] {
 		case "capabilities":
 			return i.IncomingMessageDevicesWithCapabilities(ctx, topic[1:], payload, d)
+		case "metadata":
+			return i.IncomingMessageDevicesWithMetadata(ctx, topic[1:], payload, d)
 		}
 	}
 
@@ -95,6 +128,42 @@ func (i *Interface) IncomingMessageDevicesWithCapabilities(ctx context.Context,
 	return fmt.Errorf("%w: %s", UnknownTopic, topic)
 }
 
+type metadataUpdate struct {
+	Tags       *[]string
+	Attributes map[string]any
+}
+
+// IncomingMessageDevicesWithMetadata updates the tags and attributes of a device, attributes are merged into those
+// already present and removed if set to null.
+func (i *Interface) IncomingMessageDevicesWithMetadata(ctx context.Context, topic []string, payload []byte, d da.Device) error {
+	if len(topic) != 1 || topic[0] != "set" || i.DeviceOrganiser == nil {
+		return fmt.Errorf("%w: %s", UnknownTopic, topic)
+	}
+
+	update := metadataUpdate{}
+
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return fmt.Errorf("%w: %w", InvalidPayload, err)
+	}
+
+	id := d.Identifier().String()
+	do := i.DeviceOrganiser.WithActor("mqtt")
+
+	if update.Tags != nil {
+		if err := do.SetDeviceTags(id, *update.Tags); err != nil {
+			return fmt.Errorf("unable to set tags on device: %w", err)
+		}
+	}
+
+	if update.Attributes != nil {
+		if err := do.UpdateDeviceAttributes(id, update.Attributes); err != nil {
+			return fmt.Errorf("unable to update attributes on device: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func EmptyPublisher(ctx context.Context, topic string, payload []byte) error {
 	return nil
 }
@@ -102,6 +171,18 @@ func EmptyPublisher(ctx context.Context, topic string, payload []byte) error {
 func (i *Interface) Connected(ctx context.Context, publisher Publisher) error {
 	i.Publisher = publisher
 
+	if i.filter != nil {
+		i.filter.reset()
+	}
+
+	if i.queue != nil {
+		i.queue.connected(publisher)
+	}
+
+	if i.availability != nil {
+		i.availability.reset()
+	}
+
 	if i.PublishStateOnConnect {
 		i.Logger.LogInfo(ctx, "MQTT connected, publishing current state of all devices and capabilities.")
 		go i.publishAll()
@@ -110,15 +191,42 @@ func (i *Interface) Connected(ctx context.Context, publisher Publisher) error {
 	return nil
 }
 
+const DefaultPublishWorkers = 4
+const MaximumDevicePublishTime = 10 * time.Second
+
+// publishAll publishes the state of every device, devices are shared between a pool of workers so that a slow device
+// does not delay the publishing of others.
 func (i *Interface) publishAll() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	workers := i.PublishWorkers
+	if workers <= 0 {
+		workers = DefaultPublishWorkers
+	}
+
+	devices := make(chan da.Device)
+	wg := &sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for d := range devices {
+				ctx, cancel := context.WithTimeout(context.Background(), MaximumDevicePublishTime)
+				i.publishDevice(ctx, d)
+				cancel()
+			}
+		}()
+	}
 
 	for _, gw := range i.GatewayMux.Gateways() {
 		for _, d := range gw.Devices() {
-			i.publishDevice(ctx, d)
+			devices <- d
 		}
 	}
+
+	close(devices)
+	wg.Wait()
 }
 
 func (i *Interface) publishDevice(ctx context.Context, device da.Device) {
@@ -130,51 +238,205 @@ func (i *Interface) publishDevice(ctx context.Context, device da.Device) {
 }
 
 func (i *Interface) publishDeviceCapability(ctx context.Context, daDevice da.Device, capFlag da.Capability) {
-	capability := daDevice.Capability(capFlag)
-
-	basicCapability, ok := capability.(da.BasicCapability)
+	basicCapability, ok := daDevice.Capability(capFlag).(da.BasicCapability)
 	if !ok {
 		return
 	}
 
-	capName := basicCapability.Name()
-	result := i.deviceExporter.ExportCapability(ctx, capability)
+	i.publishDeviceCapabilityState(ctx, daDevice, basicCapability.Name(), i.DeviceExporter.ExportDeviceCapability(ctx, daDevice, capFlag))
+}
+
+func (i *Interface) publishDeviceCapabilityState(ctx context.Context, daDevice da.Device, capName string, result any) {
+	deviceId := daDevice.Identifier().String()
 
-	topic := fmt.Sprintf("devices/%s/capabilities/%s", daDevice.Identifier().String(), capName)
+	ct := capabilityTopic{
+		device:     deviceId,
+		capability: capName,
+		topic:      fmt.Sprintf("devices/%s/capabilities/%s", deviceId, capName),
+	}
 
 	if i.PublishAggregatedState {
-		if err := i.publishDeviceCapabilityAggregated(ctx, topic, result); err != nil {
+		if err := i.publishDeviceCapabilityAggregated(ctx, ct, result); err != nil {
 			i.Logger.LogError(ctx, "Failed to public Aggregated state of capability.", logwrap.Datum("capability", capName), logwrap.Err(err))
 		}
 	}
 
 	if i.PublishIndividualState {
-		if err := i.publishDeviceCapabilityIndividual(ctx, topic, result); err != nil {
+		if err := i.publishDeviceCapabilityIndividual(ctx, ct, result); err != nil {
 			i.Logger.LogError(ctx, "Failed to public Individual state of capability.", logwrap.Datum("capability", capName), logwrap.Err(err))
 		}
 	}
 }
 
-func (i *Interface) publishDeviceCapabilityAggregated(ctx context.Context, topic string, result any) error {
+// capabilityTopic identifies the capability of a device that state is being published for, and the default topic
+// under which it is published.
+type capabilityTopic struct {
+	device     string
+	capability string
+	topic      string
+}
+
+func (i *Interface) publishDeviceCapabilityAggregated(ctx context.Context, ct capabilityTopic, result any) error {
 	payload, err := json.Marshal(result)
 	if err != nil {
 		return fmt.Errorf("failed to marshal result: %w", err)
 	}
 
-	if err = i.Publisher(ctx, topic, payload); err != nil {
+	return i.publishTemplated(ctx, ct, "", result, payload)
+}
+
+// publishValue formats a single value of a capabilities state and publishes it to a topic under the capability.
+func (i *Interface) publishValue(ctx context.Context, ct capabilityTopic, field string, value any) error {
+	return i.publishTemplated(ctx, ct, field, value, i.PayloadFormat.format(ct.capability, value))
+}
+
+func (i *Interface) publishTemplated(ctx context.Context, ct capabilityTopic, field string, value any, payload []byte) error {
+	topic := ct.topic
+	if len(field) > 0 {
+		topic = fmt.Sprintf("%s/%s", ct.topic, field)
+	}
+
+	if tmpl, found := i.CapabilityTemplates[ct.capability]; found {
+		var err error
+
+		topic, payload, err = tmpl.apply(TemplateData{
+			Device:     ct.device,
+			Capability: ct.capability,
+			Field:      field,
+			Topic:      topic,
+			Value:      templateValue(value),
+			Payload:    string(payload),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply template: %w", err)
+		}
+	}
+
+	if err := i.publish(ctx, ct.capability, topic, value, payload); err != nil {
 		return fmt.Errorf("failed to publish data to mqtt: %w", err)
 	}
 
 	return nil
 }
 
+// templateValue dereferences pointers to basic values, so that templates can compare them directly.
+func templateValue(value any) any {
+	switch v := value.(type) {
+	case *bool:
+		if v != nil {
+			return *v
+		}
+	case *float64:
+		if v != nil {
+			return *v
+		}
+	case *int:
+		if v != nil {
+			return *v
+		}
+	case *string:
+		if v != nil {
+			return *v
+		}
+	default:
+		return value
+	}
+
+	return nil
+}
+
+func (i *Interface) publish(ctx context.Context, capName string, topic string, value any, payload []byte) error {
+	if i.filter != nil && !i.filter.admit(capName, topic, value, payload) {
+		return nil
+	}
+
+	if i.queue != nil {
+		i.queue.enqueue(topic, payload)
+		return nil
+	}
+
+	if err := i.Publisher(ctx, topic, payload); err != nil {
+		if i.filter != nil {
+			i.filter.forget(topic)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (i *Interface) publishPending() {
+	ctx, cancel := context.WithTimeout(context.Background(), MaximumServiceUpdateTime)
+	defer cancel()
+
+	for _, p := range i.filter.due() {
+		if i.queue != nil {
+			i.queue.enqueue(p.topic, p.payload)
+			continue
+		}
+
+		if err := i.Publisher(ctx, p.topic, p.payload); err != nil {
+			i.filter.forget(p.topic)
+			i.Logger.LogError(ctx, "Failed to publish held back state.", logwrap.Datum("topic", p.topic), logwrap.Err(err))
+		}
+	}
+}
+
 func (i *Interface) Disconnected() {
 	i.Publisher = EmptyPublisher
+
+	if i.queue != nil {
+		i.queue.disconnected()
+	}
+}
+
+// QueueStatistics returns the current state of the publishing queue.
+func (i *Interface) QueueStatistics() QueueStatistics {
+	if i.queue == nil {
+		return QueueStatistics{}
+	}
+
+	return i.queue.statistics()
+}
+
+func (i *Interface) publishQueueStatistics(lastDropped uint64) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), MaximumServiceUpdateTime)
+	defer cancel()
+
+	stats := i.QueueStatistics()
+
+	if stats.Dropped > lastDropped {
+		i.Logger.LogWarn(ctx, "MQTT publishing queue has dropped messages.", logwrap.Datum("dropped", stats.Dropped-lastDropped), logwrap.Datum("capacity", stats.Capacity))
+	}
+
+	if i.PublishQueueStatistics {
+		for topic, value := range map[string]uint64{"Depth": uint64(stats.Depth), "Capacity": uint64(stats.Capacity), "Published": stats.Published, "Dropped": stats.Dropped} {
+			if err := i.publish(ctx, "", fmt.Sprintf("controller/queue/%s", topic), value, []byte(fmt.Sprintf("%d", value))); err != nil {
+				i.Logger.LogError(ctx, "Failed to publish queue statistics.", logwrap.Err(err))
+			}
+		}
+	}
+
+	return stats.Dropped
 }
 
 func (i *Interface) Start() {
 	i.stop = make(chan bool, 1)
 
+	if i.DeviceExporter == nil {
+		i.DeviceExporter = exporter.NewDeviceExporter(i.DeviceOrganiser, i.GatewayMux)
+	}
+
+	i.filter = newPublishFilter(i.PublishOnlyOnChange, i.CapabilityPublishPolicies)
+	i.queue = newPublishQueue(i.PublishQueueSize, i.filter.forget)
+
+	if i.availabilityEnabled() {
+		i.availability = newAvailabilityTracker()
+	}
+
+	go i.queue.run()
+
 	ch := make(chan any, 100)
 	i.EventSubscriber.Subscribe(ch)
 
@@ -185,13 +447,52 @@ func (i *Interface) Stop() {
 	if i.stop != nil {
 		i.stop <- true
 	}
+
+	if i.availability != nil {
+		i.publishAllUnavailable()
+	}
+
+	if i.queue != nil {
+		i.queue.drain()
+		i.queue.shutdown()
+	}
 }
 
 func (i *Interface) handleEvents(ch chan any) {
+	pendingTicker := time.NewTicker(PendingPublishCheckInterval)
+	defer pendingTicker.Stop()
+
+	var refreshCh <-chan time.Time
+
+	if i.PublishRefreshInterval > 0 {
+		refreshTicker := time.NewTicker(i.PublishRefreshInterval)
+		defer refreshTicker.Stop()
+
+		refreshCh = refreshTicker.C
+	}
+
+	statisticsTicker := time.NewTicker(QueueStatisticsInterval)
+	defer statisticsTicker.Stop()
+
+	var lastDropped uint64
+
+	availabilityTicker := time.NewTicker(AvailabilityCheckInterval)
+	defer availabilityTicker.Stop()
+
 	for {
 		select {
 		case event := <-ch:
 			i.serviceUpdateOnEvent(event)
+		case <-pendingTicker.C:
+			i.publishPending()
+		case <-availabilityTicker.C:
+			i.checkAvailability()
+		case <-statisticsTicker.C:
+			lastDropped = i.publishQueueStatistics(lastDropped)
+		case <-refreshCh:
+			i.Logger.LogDebug(context.Background(), "Refreshing published state of all devices and capabilities.")
+			i.filter.reset()
+			go i.publishAll()
 		case <-i.stop:
 			return
 		}
@@ -199,11 +500,17 @@ func (i *Interface) handleEvents(ch chan any) {
 }
 
 const MaximumServiceUpdateTime = 1 * time.Second
+const PendingPublishCheckInterval = 250 * time.Millisecond
+const QueueStatisticsInterval = 10 * time.Second
 
 func (i *Interface) serviceUpdateOnEvent(e any) {
 	ctx, cancel := context.WithTimeout(context.Background(), MaximumServiceUpdateTime)
 	defer cancel()
 
+	if i.availability != nil {
+		i.updateAvailabilityOnEvent(ctx, e)
+	}
+
 	switch event := e.(type) {
 	case da.DeviceAdded:
 		i.publishDevice(ctx, event.Device)
@@ -229,239 +536,393 @@ func (i *Interface) serviceUpdateOnEvent(e any) {
 		i.publishDeviceCapability(ctx, event.Device, capabilities.RelativeHumiditySensorFlag)
 	case capabilities.TemperatureSensorUpdate:
 		i.publishDeviceCapability(ctx, event.Device, capabilities.TemperatureSensorFlag)
+	case capabilities.IdentifyUpdate:
+		i.publishDeviceCapability(ctx, event.Device, capabilities.IdentifyFlag)
+	case capabilities.IlluminationSensorUpdate:
+		i.publishDeviceCapability(ctx, event.Device, capabilities.IlluminationSensorFlag)
+	case capabilities.OccupancySensorUpdate:
+		i.publishDeviceCapability(ctx, event.Device, capabilities.OccupancySensorFlag)
+	case capabilities.MessageCaptureStart:
+		i.publishDeviceCapability(ctx, event.Device, capabilities.MessageCaptureDebugFlag)
+	case capabilities.MessageCaptureStop:
+		i.publishDeviceCapability(ctx, event.Device, capabilities.MessageCaptureDebugFlag)
+	default:
+		if d, c, status, found := exporter.ExportDebugEvent(e); found {
+			i.publishDeviceCapabilityState(ctx, d, capabilities.StandardNames[c], status)
+		}
+	}
+}
+
+func (i *Interface) availabilityEnabled() bool {
+	return i.AvailabilityTimeout > 0 || len(i.CapabilityAvailabilityTimeouts) > 0 || len(i.DeviceAvailabilityTimeouts) > 0
+}
+
+// availabilityTimeout returns how long a device may be silent before it is considered unavailable. A timeout for the
+// device takes precedence, followed by the longest timeout of its capabilities, and then the default, zero disables
+// availability for the device.
+func (i *Interface) availabilityTimeout(d da.Device) time.Duration {
+	if timeout, found := i.DeviceAvailabilityTimeouts[d.Identifier().String()]; found {
+		return timeout
+	}
+
+	var timeout time.Duration
+	found := false
+
+	for _, c := range d.Capabilities() {
+		if capTimeout, ok := i.CapabilityAvailabilityTimeouts[capabilities.StandardNames[c]]; ok {
+			found = true
+
+			if capTimeout > timeout {
+				timeout = capTimeout
+			}
+		}
+	}
+
+	if found {
+		return timeout
+	}
+
+	return i.AvailabilityTimeout
+}
+
+func (i *Interface) publishAvailability(ctx context.Context, id string, available bool) {
+	payload := UnavailablePayload
+	if available {
+		payload = AvailablePayload
+	}
+
+	if err := i.publish(ctx, "", fmt.Sprintf("devices/%s/available", id), available, []byte(payload)); err != nil {
+		i.Logger.LogError(ctx, "Failed to publish device availability.", logwrap.Datum("device", id), logwrap.Err(err))
+	}
+}
+
+func (i *Interface) updateAvailabilityOnEvent(ctx context.Context, e any) {
+	switch event := e.(type) {
+	case da.DeviceRemoved:
+		i.availability.forget(event.Device.Identifier().String())
+		return
+	case state.GatewayFailed:
+		for _, d := range event.Gateway.Devices() {
+			if i.availabilityTimeout(d) <= 0 {
+				continue
+			}
+
+			id := d.Identifier().String()
+			i.availability.failed(id)
+
+			if i.availability.set(id, false) {
+				i.publishAvailability(ctx, id, false)
+			}
+		}
+		return
+	}
+
+	if d, ok := state.EventDevice(e); ok && i.availabilityTimeout(d) > 0 {
+		id := d.Identifier().String()
+		i.availability.seen(id)
+
+		if i.availability.set(id, true) {
+			i.publishAvailability(ctx, id, true)
+		}
+	}
+}
+
+func (i *Interface) checkAvailability() {
+	if i.availability == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MaximumServiceUpdateTime)
+	defer cancel()
+
+	for _, gw := range i.GatewayMux.Gateways() {
+		for _, d := range gw.Devices() {
+			timeout := i.availabilityTimeout(d)
+			if timeout <= 0 {
+				continue
+			}
+
+			id := d.Identifier().String()
+
+			if available, changed := i.availability.update(id, timeout); changed {
+				i.publishAvailability(ctx, id, available)
+			}
+		}
 	}
 }
 
-func (i *Interface) publishDeviceCapabilityIndividual(ctx context.Context, topic string, result any) error {
+// publishAllUnavailable marks every device as unavailable, used when the controller is shutting down.
+func (i *Interface) publishAllUnavailable() {
+	ctx, cancel := context.WithTimeout(context.Background(), MaximumServiceUpdateTime)
+	defer cancel()
+
+	for _, gw := range i.GatewayMux.Gateways() {
+		for _, d := range gw.Devices() {
+			if i.availabilityTimeout(d) <= 0 {
+				continue
+			}
+
+			id := d.Identifier().String()
+			i.availability.set(id, false)
+			i.publishAvailability(ctx, id, false)
+		}
+	}
+}
+
+func (i *Interface) publishDeviceCapabilityIndividual(ctx context.Context, ct capabilityTopic, result any) error {
 	switch c := result.(type) {
 	case *exporter.AlarmSensor:
-		return i.publishDeviceCapabilityIndividualAlarmSensor(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualAlarmSensor(ctx, ct, c)
 	case *exporter.AlarmWarningDeviceStatus:
-		return i.publishDeviceCapabilityIndividualAlarmWarningDevice(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualAlarmWarningDevice(ctx, ct, c)
 	case *exporter.DeviceDiscovery:
-		return i.publishDeviceCapabilityIndividualDeviceDiscovery(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualDeviceDiscovery(ctx, ct, c)
 	case *exporter.EnumerateDevice:
-		return i.publishDeviceCapabilityIndividualEnumerateDevice(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualEnumerateDevice(ctx, ct, c)
 	case *exporter.OnOff:
-		return i.publishDeviceCapabilityIndividualOnOff(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualOnOff(ctx, ct, c)
 	case *exporter.PowerStatus:
-		return i.publishDeviceCapabilityIndividualPower(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualPower(ctx, ct, c)
 	case *exporter.PressureSensor:
-		return i.publishDeviceCapabilityIndividualPressureSensor(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualPressureSensor(ctx, ct, c)
 	case *exporter.RelativeHumiditySensor:
-		return i.publishDeviceCapabilityIndividualRelativeHumiditySensor(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualRelativeHumiditySensor(ctx, ct, c)
 	case *exporter.TemperatureSensor:
-		return i.publishDeviceCapabilityIndividualTemperatureSensor(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualTemperatureSensor(ctx, ct, c)
 	case *exporter.ProductInformation:
-		return i.publishDeviceCapabilityIndividualHasProductInformation(ctx, topic, c)
+		return i.publishDeviceCapabilityIndividualHasProductInformation(ctx, ct, c)
+	case *exporter.IdentifyStatus:
+		return i.publishDeviceCapabilityIndividualIdentify(ctx, ct, c)
+	case *exporter.IlluminationSensor:
+		return i.publishDeviceCapabilityIndividualIlluminationSensor(ctx, ct, c)
+	case *exporter.OccupancySensor:
+		return i.publishDeviceCapabilityIndividualOccupancySensor(ctx, ct, c)
+	case *exporter.MessageCaptureDebug:
+		return i.publishDeviceCapabilityIndividualMessageCaptureDebug(ctx, ct, c)
+	case *exporter.DebugStatus:
+		return i.publishDeviceCapabilityIndividualDebug(ctx, ct, c)
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualAlarmSensor(ctx context.Context, topic string, c *exporter.AlarmSensor) error {
+func (i *Interface) publishDeviceCapabilityIndividualAlarmSensor(ctx context.Context, ct capabilityTopic, c *exporter.AlarmSensor) error {
 	for alarm, state := range c.Alarms {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Alarms/%s", topic, alarm), []byte(fmt.Sprintf("%v", state))); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Alarms/%s", alarm), state); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualAlarmWarningDevice(ctx context.Context, topic string, c *exporter.AlarmWarningDeviceStatus) error {
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Warning", topic), []byte(fmt.Sprintf("%v", c.Warning))); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+func (i *Interface) publishDeviceCapabilityIndividualAlarmWarningDevice(ctx context.Context, ct capabilityTopic, c *exporter.AlarmWarningDeviceStatus) error {
+	if err := i.publishValue(ctx, ct, "Warning", c.Warning); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/AlarmType", topic), fmtPtrString(c.AlarmType)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "AlarmType", c.AlarmType); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Volume", topic), fmtPtrFloat64(c.Volume)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "Volume", c.Volume); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Visual", topic), fmtPtrBool(c.Visual)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "Visual", c.Visual); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Duration", topic), fmtPtrInt(c.Duration)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "Duration", c.Duration); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualDeviceDiscovery(ctx context.Context, topic string, c *exporter.DeviceDiscovery) error {
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Discovering", topic), []byte(fmt.Sprintf("%v", c.Discovering))); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+func (i *Interface) publishDeviceCapabilityIndividualDeviceDiscovery(ctx context.Context, ct capabilityTopic, c *exporter.DeviceDiscovery) error {
+	if err := i.publishValue(ctx, ct, "Discovering", c.Discovering); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Duration", topic), []byte(fmt.Sprintf("%d", c.Duration))); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "Duration", c.Duration); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualEnumerateDevice(ctx context.Context, topic string, c *exporter.EnumerateDevice) error {
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Enumerating", topic), []byte(fmt.Sprintf("%v", c.Enumerating))); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+func (i *Interface) publishDeviceCapabilityIndividualEnumerateDevice(ctx context.Context, ct capabilityTopic, c *exporter.EnumerateDevice) error {
+	if err := i.publishValue(ctx, ct, "Enumerating", c.Enumerating); err != nil {
+		return err
 	}
 
-	for capName, status := range c.Status {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Status/%s/Attached", topic, capName), []byte(fmt.Sprintf("%v", status.Attached))); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	for statusName, status := range c.Status {
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Status/%s/Attached", statusName), status.Attached); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualOnOff(ctx context.Context, topic string, c *exporter.OnOff) error {
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Current", topic), []byte(fmt.Sprintf("%v", c.State))); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
-	}
-
-	return nil
+func (i *Interface) publishDeviceCapabilityIndividualOnOff(ctx context.Context, ct capabilityTopic, c *exporter.OnOff) error {
+	return i.publishValue(ctx, ct, "Current", c.State)
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualPower(ctx context.Context, topic string, c *exporter.PowerStatus) error {
+func (i *Interface) publishDeviceCapabilityIndividualPower(ctx context.Context, ct capabilityTopic, c *exporter.PowerStatus) error {
 	for j, mains := range c.Mains {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Mains/%d/Voltage", topic, j), fmtPtrFloat64(mains.Voltage)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Mains/%d/Voltage", j), mains.Voltage); err != nil {
+			return err
 		}
 
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Mains/%d/Frequency", topic, j), fmtPtrFloat64(mains.Frequency)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Mains/%d/Frequency", j), mains.Frequency); err != nil {
+			return err
 		}
 
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Mains/%d/Available", topic, j), fmtPtrBool(mains.Available)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Mains/%d/Available", j), mains.Available); err != nil {
+			return err
 		}
 	}
 
 	for j, battery := range c.Battery {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Battery/%d/Voltage", topic, j), fmtPtrFloat64(battery.Voltage)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Battery/%d/Voltage", j), battery.Voltage); err != nil {
+			return err
 		}
 
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Battery/%d/MinimumVoltage", topic, j), fmtPtrFloat64(battery.MinimumVoltage)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Battery/%d/MinimumVoltage", j), battery.MinimumVoltage); err != nil {
+			return err
 		}
 
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Battery/%d/MaximumVoltage", topic, j), fmtPtrFloat64(battery.MaximumVoltage)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Battery/%d/MaximumVoltage", j), battery.MaximumVoltage); err != nil {
+			return err
 		}
 
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Battery/%d/Remaining", topic, j), fmtPtrFloat64(battery.Remaining)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Battery/%d/Remaining", j), battery.Remaining); err != nil {
+			return err
 		}
 
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Battery/%d/Available", topic, j), fmtPtrBool(battery.Available)); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Battery/%d/Available", j), battery.Available); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualPressureSensor(ctx context.Context, topic string, c *exporter.PressureSensor) error {
+func (i *Interface) publishDeviceCapabilityIndividualPressureSensor(ctx context.Context, ct capabilityTopic, c *exporter.PressureSensor) error {
 	for j, reading := range c.Readings {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Reading/%d/Value", topic, j), []byte(fmt.Sprintf("%f", reading.Value))); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Reading/%d/Value", j), reading.Value); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualRelativeHumiditySensor(ctx context.Context, topic string, c *exporter.RelativeHumiditySensor) error {
+func (i *Interface) publishDeviceCapabilityIndividualRelativeHumiditySensor(ctx context.Context, ct capabilityTopic, c *exporter.RelativeHumiditySensor) error {
 	for j, reading := range c.Readings {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Reading/%d/Value", topic, j), []byte(fmt.Sprintf("%f", reading.Value))); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Reading/%d/Value", j), reading.Value); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualTemperatureSensor(ctx context.Context, topic string, c *exporter.TemperatureSensor) error {
+func (i *Interface) publishDeviceCapabilityIndividualTemperatureSensor(ctx context.Context, ct capabilityTopic, c *exporter.TemperatureSensor) error {
 	for j, reading := range c.Readings {
-		if err := i.Publisher(ctx, fmt.Sprintf("%s/Reading/%d/Value", topic, j), []byte(fmt.Sprintf("%f", reading.Value))); err != nil {
-			return fmt.Errorf("failed to publish data to mqtt: %w", err)
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Reading/%d/Value", j), reading.Value); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (i *Interface) publishDeviceCapabilityIndividualHasProductInformation(ctx context.Context, topic string, c *exporter.ProductInformation) error {
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Product", topic), fmtString(c.Name)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+func (i *Interface) publishDeviceCapabilityIndividualHasProductInformation(ctx context.Context, ct capabilityTopic, c *exporter.ProductInformation) error {
+	if err := i.publishValue(ctx, ct, "Product", c.Name); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Manufacturer", topic), fmtString(c.Manufacturer)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "Manufacturer", c.Manufacturer); err != nil {
+		return err
 	}
 
-	if err := i.Publisher(ctx, fmt.Sprintf("%s/Serial", topic), fmtString(c.Serial)); err != nil {
-		return fmt.Errorf("failed to publish data to mqtt: %w", err)
+	if err := i.publishValue(ctx, ct, "Serial", c.Serial); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func fmtPtrToJSON(v any) []byte {
-	if v == nil {
-		return []byte("null")
+func (i *Interface) publishDeviceCapabilityIndividualIdentify(ctx context.Context, ct capabilityTopic, c *exporter.IdentifyStatus) error {
+	if err := i.publishValue(ctx, ct, "Identifying", c.Identifying); err != nil {
+		return err
 	}
 
-	data, err := json.Marshal(v)
-	if err != nil {
-		return []byte("null")
+	if err := i.publishValue(ctx, ct, "Duration", c.Duration); err != nil {
+		return err
 	}
 
-	return data
+	return nil
 }
 
-func fmtPtrString(s *string) []byte {
-	if s == nil {
-		return []byte("null")
+func (i *Interface) publishDeviceCapabilityIndividualIlluminationSensor(ctx context.Context, ct capabilityTopic, c *exporter.IlluminationSensor) error {
+	for j, reading := range c.Readings {
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Reading/%d/Value", j), reading.Value); err != nil {
+			return err
+		}
 	}
 
-	return []byte(*s)
+	return nil
 }
 
-func fmtString(s string) []byte {
-	if len(s) == 0 {
-		return []byte("null")
+func (i *Interface) publishDeviceCapabilityIndividualOccupancySensor(ctx context.Context, ct capabilityTopic, c *exporter.OccupancySensor) error {
+	for j, reading := range c.Readings {
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Reading/%d/Occupied", j), reading.Occupied); err != nil {
+			return err
+		}
+
+		if err := i.publishValue(ctx, ct, fmt.Sprintf("Reading/%d/Duration", j), reading.Duration); err != nil {
+			return err
+		}
 	}
 
-	return []byte(s)
+	return nil
 }
 
-func fmtPtrFloat64(s *float64) []byte {
-	if s == nil {
-		return []byte("null")
+func (i *Interface) publishDeviceCapabilityIndividualMessageCaptureDebug(ctx context.Context, ct capabilityTopic, c *exporter.MessageCaptureDebug) error {
+	return i.publishValue(ctx, ct, "Capturing", c.Capturing)
+}
+
+func (i *Interface) publishDeviceCapabilityIndividualDebug(ctx context.Context, ct capabilityTopic, c *exporter.DebugStatus) error {
+	if err := i.publishValue(ctx, ct, "Running", c.Running); err != nil {
+		return err
 	}
 
-	return []byte(fmt.Sprintf("%f", *s))
-}
+	if err := i.publishValue(ctx, ct, "MediaType", c.MediaType); err != nil {
+		return err
+	}
 
-func fmtPtrInt(s *int) []byte {
-	if s == nil {
-		return []byte("null")
+	if err := i.publishValue(ctx, ct, "Error", c.Error); err != nil {
+		return err
 	}
 
-	return []byte(fmt.Sprintf("%d", *s))
-}
+	var debug string
+
+	if c.Debug != nil {
+		data, err := json.Marshal(c.Debug)
+		if err != nil {
+			return fmt.Errorf("failed to marshal debug: %w", err)
+		}
 
-func fmtPtrBool(s *bool) []byte {
-	if s == nil {
-		return []byte("null")
+		debug = string(data)
 	}
 
-	return []byte(fmt.Sprintf("%v", *s))
+	if err := i.publishValue(ctx, ct, "Debug", debug); err != nil {
+		return err
+	}
+
+	return nil
 }
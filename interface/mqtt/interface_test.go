@@ -14,6 +14,7 @@ import (
 	"github.com/shimmeringbee/da/mocks"
 	"github.com/shimmeringbee/logwrap"
 	"github.com/shimmeringbee/logwrap/impl/discard"
+	"github.com/shimmeringbee/persistence/impl/memory"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -69,7 +70,7 @@ func TestInterface_Connected(t *testing.T) {
 		mdev.On("Capability", capFlagOne).Return(hpi)
 		mdev.On("Capability", capFlagTwo).Return(oo)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishStateOnConnect: true, PublishAggregatedState: true, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishStateOnConnect: true, PublishAggregatedState: true, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m := &MockPublisher{}
 		defer m.AssertExpectations(t)
@@ -177,6 +178,77 @@ func TestInterface_IncomingMessage(t *testing.T) {
 
 		assert.NoError(t, err)
 	})
+	t.Run("resolves devices addressed by alias", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("devId")
+		_ = do.NameDevice("devId", "Kitchen Lamp")
+
+		mgw := state.MockGatewayMapper{}
+		defer mgw.AssertExpectations(t)
+
+		d := mocks.SimpleDevice{}
+		mgw.On("Device", "kitchen-lamp").Return(mocks.SimpleDevice{}, false)
+		mgw.On("Device", "devId").Return(d, true)
+
+		mdi := invoker.MockDeviceInvoker{}
+		defer mdi.AssertExpectations(t)
+
+		mos := layers.MockOutputStack{}
+		defer mos.AssertExpectations(t)
+
+		mdi.On("InvokeDevice", mock.Anything, &mos, "mqtt", layers.OneShot, d, "capName", "actionName", []byte(nil)).Return(nil, nil)
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), DeviceInvoker: mdi.InvokeDevice, OutputStack: &mos, GatewayMux: &mgw, DeviceOrganiser: &do}
+
+		err := i.IncomingMessage(context.Background(), "devices/kitchen-lamp/capabilities/capName/actionName/invoke", nil)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("updates the tags and attributes of a device", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+		mgw := state.MockGatewayMapper{}
+		defer mgw.AssertExpectations(t)
+
+		mgw.On("Device", "devId").Return(mocks.SimpleDevice{SIdentifier: zigbee.IEEEAddress(1)}, true)
+		do.AddDevice(zigbee.IEEEAddress(1).String())
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), GatewayMux: &mgw, DeviceOrganiser: &do}
+
+		err := i.IncomingMessage(context.Background(), "devices/devId/metadata/set", []byte(`{"Tags":["outdoor"],"Attributes":{"circuit":12}}`))
+		assert.NoError(t, err)
+
+		dm, _ := do.Device(zigbee.IEEEAddress(1).String())
+		assert.Equal(t, []string{"outdoor"}, dm.Tags)
+		assert.Equal(t, map[string]any{"circuit": float64(12)}, dm.Attributes)
+
+		err = i.IncomingMessage(context.Background(), "devices/devId/metadata/set", []byte(`not json`))
+		assert.ErrorIs(t, err, InvalidPayload)
+
+		err = i.IncomingMessage(context.Background(), "devices/devId/metadata/set", []byte(`{"Attributes":{"phases":[1]}}`))
+		assert.ErrorIs(t, err, state.ErrInvalidAttribute)
+	})
+
+	t.Run("returns an error if a device name is ambiguous", func(t *testing.T) {
+		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		_ = do.NameDevice("one", "Lamp")
+		_ = do.NameDevice("two", "Lamp")
+
+		mgw := state.MockGatewayMapper{}
+		defer mgw.AssertExpectations(t)
+
+		mgw.On("Device", "Lamp").Return(mocks.SimpleDevice{}, false)
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), GatewayMux: &mgw, DeviceOrganiser: &do}
+
+		err := i.IncomingMessage(context.Background(), "devices/Lamp/capabilities/capName/actionName/invoke", nil)
+
+		assert.ErrorIs(t, err, UnknownDevice)
+		assert.ErrorIs(t, err, state.ErrAmbiguous)
+	})
 }
 
 func TestInterface_serviceUpdateOnEvent(t *testing.T) {
@@ -203,7 +275,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.AlarmSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Alarms":{"General":true}}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -238,7 +310,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.AlarmSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `true`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Alarms/General", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -279,7 +351,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.AlarmWarningDeviceFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Warning":true,"AlarmType":"Fire","Volume":0.5,"Visual":true,"Duration":60000}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -320,7 +392,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.AlarmWarningDeviceFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Warning", mdev.Identifier().String(), name), []byte(`true`)).Return(nil)
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/AlarmType", mdev.Identifier().String(), name), []byte(`Fire`)).Return(nil)
@@ -363,7 +435,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.DeviceDiscoveryFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Discovering":true,"Duration":60000}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -403,7 +475,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.DeviceDiscoveryFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Discovering", mdev.Identifier().String(), name), []byte(`true`)).Return(nil)
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Duration", mdev.Identifier().String(), name), []byte(`60000`)).Return(nil)
@@ -442,7 +514,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.DeviceDiscoveryFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Discovering":false}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -481,7 +553,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.DeviceDiscoveryFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Discovering", mdev.Identifier().String(), name), []byte(`false`)).Return(nil)
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Duration", mdev.Identifier().String(), name), []byte(`0`)).Return(nil)
@@ -518,7 +590,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.EnumerateDeviceFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Enumerating":true,"Status":{}}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -555,7 +627,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.EnumerateDeviceFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Enumerating", mdev.Identifier().String(), name), []byte(`true`)).Return(nil)
 
@@ -592,7 +664,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.EnumerateDeviceFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Enumerating":false,"Status":{}}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -633,7 +705,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.EnumerateDeviceFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Enumerating", mdev.Identifier().String(), name), []byte(`false`)).Return(nil)
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Status/OnOff/Attached", mdev.Identifier().String(), name), []byte(`true`)).Return(nil)
@@ -668,7 +740,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.OnOffFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"State":true}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -703,7 +775,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.OnOffFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Current", mdev.Identifier().String(), name), []byte(`true`)).Return(nil)
 
@@ -756,7 +828,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.PowerSupplyFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Mains":[{"Voltage":220,"Frequency":50,"Available":true}],"Battery":[{"Voltage":3.8,"MaximumVoltage":4.2,"MinimumVoltage":3.7,"Remaining":0.8,"Available":true}]}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -810,7 +882,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.PowerSupplyFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Mains/0/Voltage", mdev.Identifier().String(), name), []byte(`220.000000`)).Return(nil)
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Mains/0/Frequency", mdev.Identifier().String(), name), []byte(`50.000000`)).Return(nil)
@@ -856,7 +928,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.PressureSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Readings":[{"Value":1024000}]}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -895,7 +967,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.PressureSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Reading/0/Value", mdev.Identifier().String(), name), []byte(`1024000.000000`)).Return(nil)
 
@@ -933,7 +1005,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.RelativeHumiditySensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Readings":[{"Value":0.8}]}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -972,7 +1044,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.RelativeHumiditySensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Reading/0/Value", mdev.Identifier().String(), name), []byte(`0.800000`)).Return(nil)
 
@@ -1010,7 +1082,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.TemperatureSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Readings":[{"Value":290}]}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -1049,7 +1121,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.TemperatureSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Reading/0/Value", mdev.Identifier().String(), name), []byte(`290.000000`)).Return(nil)
 
@@ -1088,7 +1160,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.TemperatureSensorFlag).Return(mc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s/Reading/0/Value", mdev.Identifier().String(), name), []byte(`290.000000`)).Return(nil)
 
@@ -1137,7 +1209,7 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 
 		mdev.On("Capability", capabilities.TemperatureSensorFlag).Return(tmc)
 
-		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, deviceExporter: exporter.NewDeviceExporter(nil, nil)}
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), PublishAggregatedState: true, Publisher: m.Publish, DeviceExporter: exporter.NewDeviceExporter(nil, nil)}
 
 		expectedPayload := `{"Enumerating":false,"Status":{}}`
 		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/capabilities/%s", mdev.Identifier().String(), name), []byte(expectedPayload)).Return(nil)
@@ -1152,6 +1224,133 @@ func TestInterface_serviceUpdateOnEvent(t *testing.T) {
 	})
 }
 
+func TestInterface_serviceUpdateOnEventDebug(t *testing.T) {
+	t.Run("LocalDebugSuccess publishes the debug result as a Individual update if enabled", func(t *testing.T) {
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), PublishIndividualState: true, Publisher: m.Publish}
+
+		topic := fmt.Sprintf("devices/%s/capabilities/LocalDebug", d.Identifier().String())
+
+		m.On("Publish", mock.Anything, topic+"/Running", []byte(`false`)).Return(nil)
+		m.On("Publish", mock.Anything, topic+"/MediaType", []byte(`application/json`)).Return(nil)
+		m.On("Publish", mock.Anything, topic+"/Error", []byte(`null`)).Return(nil)
+		m.On("Publish", mock.Anything, topic+"/Debug", []byte(`{"a":"b"}`)).Return(nil)
+
+		i.serviceUpdateOnEvent(capabilities.LocalDebugSuccess{Device: d, MediaType: "application/json", Debug: map[string]string{"a": "b"}})
+	})
+}
+
+func TestInterface_publish(t *testing.T) {
+	t.Run("only publishes changed state when configured to publish on change", func(t *testing.T) {
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), Publisher: m.Publish, filter: newPublishFilter(true, nil)}
+
+		m.On("Publish", mock.Anything, "devices/one/capabilities/OnOff/Current", []byte(`true`)).Return(nil).Once()
+		m.On("Publish", mock.Anything, "devices/one/capabilities/OnOff/Current", []byte(`false`)).Return(nil).Once()
+
+		assert.NoError(t, i.publish(context.Background(), "OnOff", "devices/one/capabilities/OnOff/Current", true, []byte(`true`)))
+		assert.NoError(t, i.publish(context.Background(), "OnOff", "devices/one/capabilities/OnOff/Current", true, []byte(`true`)))
+		assert.NoError(t, i.publish(context.Background(), "OnOff", "devices/one/capabilities/OnOff/Current", false, []byte(`false`)))
+	})
+
+	t.Run("republishes state after a failed publish", func(t *testing.T) {
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), Publisher: m.Publish, filter: newPublishFilter(true, nil)}
+
+		expectedError := errors.New("failed")
+
+		m.On("Publish", mock.Anything, "topic", []byte(`true`)).Return(expectedError).Once()
+		m.On("Publish", mock.Anything, "topic", []byte(`true`)).Return(nil).Once()
+
+		assert.ErrorIs(t, i.publish(context.Background(), "OnOff", "topic", true, []byte(`true`)), expectedError)
+		assert.NoError(t, i.publish(context.Background(), "OnOff", "topic", true, []byte(`true`)))
+	})
+
+	t.Run("republishes all state after connecting", func(t *testing.T) {
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), Publisher: m.Publish, filter: newPublishFilter(true, nil)}
+
+		m.On("Publish", mock.Anything, "topic", []byte(`true`)).Return(nil).Twice()
+
+		assert.NoError(t, i.publish(context.Background(), "OnOff", "topic", true, []byte(`true`)))
+		assert.NoError(t, i.Connected(context.Background(), m.Publish))
+		assert.NoError(t, i.publish(context.Background(), "OnOff", "topic", true, []byte(`true`)))
+	})
+}
+
+func TestInterface_publishValue(t *testing.T) {
+	t.Run("publishes a value using the payload format and capability template", func(t *testing.T) {
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		ct, err := ParseCapabilityTemplate("OnOff", "stat/{{.Device}}/POWER", "")
+		assert.NoError(t, err)
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), Publisher: m.Publish, PayloadFormat: PayloadFormat{TrueValue: "ON", FalseValue: "OFF"}, CapabilityTemplates: map[string]CapabilityTemplate{"OnOff": ct}}
+
+		m.On("Publish", mock.Anything, "stat/one/POWER", []byte(`ON`)).Return(nil)
+		m.On("Publish", mock.Anything, "devices/one/capabilities/TemperatureSensor/Reading/0/Value", []byte(`290.000000`)).Return(nil)
+
+		assert.NoError(t, i.publishValue(context.Background(), capabilityTopic{device: "one", capability: "OnOff", topic: "devices/one/capabilities/OnOff"}, "Current", true))
+		assert.NoError(t, i.publishValue(context.Background(), capabilityTopic{device: "one", capability: "TemperatureSensor", topic: "devices/one/capabilities/TemperatureSensor"}, "Reading/0/Value", 290.0))
+	})
+}
+
+func TestInterface_availability(t *testing.T) {
+	t.Run("publishes a device as available on activity and unavailable on gateway failure", func(t *testing.T) {
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		gw := &mocks.Gateway{}
+		defer gw.AssertExpectations(t)
+
+		d := mocks.SimpleDevice{SGateway: gw, SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+		gw.On("Devices").Return([]da.Device{d})
+
+		i := Interface{Logger: logwrap.New(discard.Discard()), Publisher: m.Publish, AvailabilityTimeout: time.Minute, availability: newAvailabilityTracker()}
+
+		topic := fmt.Sprintf("devices/%s/available", d.Identifier().String())
+
+		m.On("Publish", mock.Anything, topic, []byte(AvailablePayload)).Return(nil).Once()
+		m.On("Publish", mock.Anything, topic, []byte(UnavailablePayload)).Return(nil).Once()
+
+		i.serviceUpdateOnEvent(capabilities.MessageCapture{Device: d})
+		i.serviceUpdateOnEvent(capabilities.MessageCapture{Device: d})
+		i.serviceUpdateOnEvent(state.GatewayFailed{Name: "one", Gateway: gw})
+	})
+
+	t.Run("publishes all devices as unavailable on stop", func(t *testing.T) {
+		mapper := &state.MockGatewayMapper{}
+		defer mapper.AssertExpectations(t)
+
+		m := &MockPublisher{}
+		defer m.AssertExpectations(t)
+
+		gw := &mocks.Gateway{}
+		defer gw.AssertExpectations(t)
+
+		d := mocks.SimpleDevice{SGateway: gw, SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+		gw.On("Devices").Return([]da.Device{d})
+		mapper.On("Gateways").Return(map[string]da.Gateway{"one": gw})
+
+		i := Interface{GatewayMux: mapper, Logger: logwrap.New(discard.Discard()), Publisher: m.Publish, AvailabilityTimeout: time.Minute, availability: newAvailabilityTracker()}
+
+		m.On("Publish", mock.Anything, fmt.Sprintf("devices/%s/available", d.Identifier().String()), []byte(UnavailablePayload)).Return(nil).Once()
+
+		i.Stop()
+	})
+}
+
 type MockPublisher struct {
 	mock.Mock
 }
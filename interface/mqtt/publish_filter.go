@@ -0,0 +1,220 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// CapabilityPublishPolicy limits how often the state of a capability is published to MQTT.
+type CapabilityPublishPolicy struct {
+	// MinimumInterval is the shortest time permitted between two publishes to the same topic, changes made within
+	// the interval are held back and the latest is published once the interval has elapsed.
+	MinimumInterval time.Duration
+	// Deadband is the amount a numeric value must differ from the last published value before it is published. Values
+	// are compared before being formatted, and for aggregated state every numeric field must be within the deadband
+	// and all others unchanged. The time state was last updated or changed is not compared.
+	Deadband float64
+}
+
+type topicState struct {
+	capability   string
+	value        any
+	payload      []byte
+	published    time.Time
+	pendingValue any
+	pending      []byte
+}
+
+type pendingPublish struct {
+	topic   string
+	payload []byte
+}
+
+// publishFilter remembers the last payload published to each topic, and decides if a new payload should be published
+// based upon whether it has changed and the policy of the capability it belongs to.
+type publishFilter struct {
+	lock         sync.Mutex
+	onlyOnChange bool
+	policies     map[string]CapabilityPublishPolicy
+	topics       map[string]*topicState
+	now          func() time.Time
+}
+
+func newPublishFilter(onlyOnChange bool, policies map[string]CapabilityPublishPolicy) *publishFilter {
+	return &publishFilter{
+		onlyOnChange: onlyOnChange,
+		policies:     policies,
+		topics:       map[string]*topicState{},
+		now:          time.Now,
+	}
+}
+
+// admit returns true if the payload should be published to the topic now, recording it as published. The value is the
+// capability state the payload was formatted from.
+func (f *publishFilter) admit(capability string, topic string, value any, payload []byte) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := f.now()
+	policy := f.policies[capability]
+
+	state, found := f.topics[topic]
+	if !found {
+		f.topics[topic] = &topicState{capability: capability, value: value, payload: payload, published: now}
+		return true
+	}
+
+	if f.onlyOnChange && (bytes.Equal(state.payload, payload) || withinDeadband(state.value, value, 0)) {
+		state.pending = nil
+		return false
+	}
+
+	if policy.Deadband > 0 && withinDeadband(state.value, value, policy.Deadband) {
+		state.pending = nil
+		return false
+	}
+
+	if policy.MinimumInterval > 0 && now.Sub(state.published) < policy.MinimumInterval {
+		state.pendingValue = value
+		state.pending = payload
+		return false
+	}
+
+	state.value = value
+	state.payload = payload
+	state.published = now
+	state.pending = nil
+
+	return true
+}
+
+// forget removes any memory of a topic, used if a publish fails so that it will be attempted again.
+func (f *publishFilter) forget(topic string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.topics, topic)
+}
+
+// due returns any payloads which were held back by a minimum interval which has now elapsed, recording them as
+// published.
+func (f *publishFilter) due() []pendingPublish {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := f.now()
+
+	var ready []pendingPublish
+
+	for topic, state := range f.topics {
+		if state.pending == nil {
+			continue
+		}
+
+		if now.Sub(state.published) < f.policies[state.capability].MinimumInterval {
+			continue
+		}
+
+		ready = append(ready, pendingPublish{topic: topic, payload: state.pending})
+
+		state.value = state.pendingValue
+		state.payload = state.pending
+		state.published = now
+		state.pending = nil
+	}
+
+	return ready
+}
+
+// reset forgets all previously published payloads, causing the next publish of every topic to be admitted.
+func (f *publishFilter) reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.topics = map[string]*topicState{}
+}
+
+// withinDeadband compares two capability values, returning true if they differ only by numeric values which are within
+// the deadband of each other, or by the times they were last updated or changed.
+func withinDeadband(previous any, current any, deadband float64) bool {
+	previousValue, ok := genericValue(previous)
+	if !ok {
+		return false
+	}
+
+	currentValue, ok := genericValue(current)
+	if !ok {
+		return false
+	}
+
+	return deadbandEqual(previousValue, currentValue, deadband)
+}
+
+// genericValue converts a value into its JSON representation of maps, slices and float64s, so that values of any
+// capability can be compared field by field.
+func genericValue(value any) (any, bool) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+
+	var generic any
+
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, false
+	}
+
+	return generic, true
+}
+
+// timestampFields are the fields of exported capability state recording when it was last updated or changed, which
+// differ between reports of otherwise identical state.
+var timestampFields = map[string]struct{}{"LastUpdate": {}, "LastChange": {}}
+
+func deadbandEqual(previous any, current any, deadband float64) bool {
+	switch p := previous.(type) {
+	case float64:
+		c, ok := current.(float64)
+		return ok && (c == p || math.Abs(c-p) < deadband)
+	case map[string]any:
+		c, ok := current.(map[string]any)
+		if !ok {
+			return false
+		}
+
+		for key := range timestampFields {
+			delete(p, key)
+			delete(c, key)
+		}
+
+		if len(c) != len(p) {
+			return false
+		}
+
+		for key, value := range p {
+			if cv, found := c[key]; !found || !deadbandEqual(value, cv, deadband) {
+				return false
+			}
+		}
+
+		return true
+	case []any:
+		c, ok := current.([]any)
+		if !ok || len(c) != len(p) {
+			return false
+		}
+
+		for idx := range p {
+			if !deadbandEqual(p[idx], c[idx], deadband) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return previous == current
+	}
+}
@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type timedTemperatureSensor struct {
+	value   float64
+	updated time.Time
+}
+
+func (s *timedTemperatureSensor) Reading(_ context.Context) ([]capabilities.TemperatureReading, error) {
+	return []capabilities.TemperatureReading{{Value: s.value}}, nil
+}
+
+func (s *timedTemperatureSensor) LastUpdateTime(_ context.Context) (time.Time, error) {
+	return s.updated, nil
+}
+
+func Test_publishFilter(t *testing.T) {
+	t.Run("admits the first publish to a topic", func(t *testing.T) {
+		f := newPublishFilter(true, nil)
+
+		assert.True(t, f.admit("OnOff", "topic", true, []byte("true")))
+	})
+
+	t.Run("suppresses an unchanged payload if only on change", func(t *testing.T) {
+		f := newPublishFilter(true, nil)
+
+		assert.True(t, f.admit("OnOff", "topic", true, []byte("true")))
+		assert.False(t, f.admit("OnOff", "topic", true, []byte("true")))
+		assert.True(t, f.admit("OnOff", "topic", false, []byte("false")))
+	})
+
+	t.Run("admits an unchanged payload if not only on change", func(t *testing.T) {
+		f := newPublishFilter(false, nil)
+
+		assert.True(t, f.admit("OnOff", "topic", true, []byte("true")))
+		assert.True(t, f.admit("OnOff", "topic", true, []byte("true")))
+	})
+
+	t.Run("suppresses numeric values within the capabilities deadband, regardless of payload format", func(t *testing.T) {
+		f := newPublishFilter(false, map[string]CapabilityPublishPolicy{"TemperatureSensor": {Deadband: 0.5}})
+
+		assert.True(t, f.admit("TemperatureSensor", "topic", 290.0, []byte("290.0 K")))
+		assert.False(t, f.admit("TemperatureSensor", "topic", 290.4, []byte("290.4 K")))
+		assert.True(t, f.admit("TemperatureSensor", "topic", 290.5, []byte("290.5 K")))
+	})
+
+	t.Run("suppresses aggregated values only if every numeric field is within the deadband", func(t *testing.T) {
+		type reading struct {
+			Value float64
+			Unit  string
+		}
+
+		f := newPublishFilter(false, map[string]CapabilityPublishPolicy{"TemperatureSensor": {Deadband: 0.5}})
+
+		assert.True(t, f.admit("TemperatureSensor", "topic", []reading{{Value: 290, Unit: "K"}, {Value: 300, Unit: "K"}}, []byte("1")))
+		assert.False(t, f.admit("TemperatureSensor", "topic", []reading{{Value: 290.2, Unit: "K"}, {Value: 300.4, Unit: "K"}}, []byte("2")))
+		assert.True(t, f.admit("TemperatureSensor", "topic", []reading{{Value: 290.2, Unit: "K"}, {Value: 300.6, Unit: "K"}}, []byte("3")))
+		assert.True(t, f.admit("TemperatureSensor", "topic", []reading{{Value: 290.2, Unit: "C"}, {Value: 300.6, Unit: "K"}}, []byte("4")))
+	})
+
+	t.Run("ignores the time exported state was last updated when comparing it", func(t *testing.T) {
+		de := exporter.NewDeviceExporter(nil, nil)
+		sensor := &timedTemperatureSensor{value: 290, updated: time.Now()}
+
+		export := func(value float64) (any, []byte) {
+			sensor.value = value
+			sensor.updated = sensor.updated.Add(time.Minute)
+
+			exported := de.ExportCapability(context.Background(), sensor)
+			payload, _ := json.Marshal(exported)
+
+			return exported, payload
+		}
+
+		deadband := newPublishFilter(false, map[string]CapabilityPublishPolicy{"TemperatureSensor": {Deadband: 0.5}})
+
+		value, payload := export(290)
+		assert.True(t, deadband.admit("TemperatureSensor", "topic", value, payload))
+		value, payload = export(290.4)
+		assert.False(t, deadband.admit("TemperatureSensor", "topic", value, payload))
+		value, payload = export(291)
+		assert.True(t, deadband.admit("TemperatureSensor", "topic", value, payload))
+
+		onChange := newPublishFilter(true, nil)
+
+		value, payload = export(290)
+		assert.True(t, onChange.admit("TemperatureSensor", "topic", value, payload))
+		value, payload = export(290)
+		assert.False(t, onChange.admit("TemperatureSensor", "topic", value, payload))
+		value, payload = export(291)
+		assert.True(t, onChange.admit("TemperatureSensor", "topic", value, payload))
+	})
+
+	t.Run("holds back changes within the minimum interval until they are due", func(t *testing.T) {
+		now := time.Now()
+
+		f := newPublishFilter(true, map[string]CapabilityPublishPolicy{"TemperatureSensor": {MinimumInterval: time.Minute}})
+		f.now = func() time.Time { return now }
+
+		assert.True(t, f.admit("TemperatureSensor", "topic", 1, []byte("1")))
+		assert.False(t, f.admit("TemperatureSensor", "topic", 2, []byte("2")))
+		assert.False(t, f.admit("TemperatureSensor", "topic", 3, []byte("3")))
+
+		assert.Empty(t, f.due())
+
+		now = now.Add(time.Minute)
+
+		assert.Equal(t, []pendingPublish{{topic: "topic", payload: []byte("3")}}, f.due())
+		assert.Empty(t, f.due())
+	})
+
+	t.Run("discards a held back change if the payload returns to the published value", func(t *testing.T) {
+		now := time.Now()
+
+		f := newPublishFilter(true, map[string]CapabilityPublishPolicy{"TemperatureSensor": {MinimumInterval: time.Minute}})
+		f.now = func() time.Time { return now }
+
+		assert.True(t, f.admit("TemperatureSensor", "topic", 1, []byte("1")))
+		assert.False(t, f.admit("TemperatureSensor", "topic", 2, []byte("2")))
+		assert.False(t, f.admit("TemperatureSensor", "topic", 1, []byte("1")))
+
+		now = now.Add(time.Minute)
+
+		assert.Empty(t, f.due())
+	})
+
+	t.Run("admits unchanged payloads after a reset or forget", func(t *testing.T) {
+		f := newPublishFilter(true, nil)
+
+		assert.True(t, f.admit("OnOff", "one", true, []byte("true")))
+		assert.True(t, f.admit("OnOff", "two", true, []byte("true")))
+
+		f.forget("one")
+		assert.True(t, f.admit("OnOff", "one", true, []byte("true")))
+		assert.False(t, f.admit("OnOff", "two", true, []byte("true")))
+
+		f.reset()
+		assert.True(t, f.admit("OnOff", "two", true, []byte("true")))
+	})
+}
@@ -0,0 +1,202 @@
+package mqtt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DefaultPublishQueueSize = 1000
+const PublishQueueRetryInterval = 1 * time.Second
+const MaximumQueuedPublishTime = 5 * time.Second
+
+// QueueStatistics provides information on the state of the MQTT publishing queue.
+type QueueStatistics struct {
+	Depth     int
+	Capacity  int
+	Published uint64
+	Dropped   uint64
+}
+
+// publishQueue is a bounded buffer of messages waiting to be published to MQTT. Messages are held while the broker is
+// disconnected, if a topic is already queued the waiting payload is replaced by the newer one, and if the queue is full
+// the oldest message is dropped.
+type publishQueue struct {
+	lock      sync.Mutex
+	order     []string
+	payloads  map[string][]byte
+	capacity  int
+	publisher Publisher
+
+	published uint64
+	dropped   uint64
+
+	onDrop func(topic string)
+
+	wake chan struct{}
+	stop chan struct{}
+}
+
+func newPublishQueue(capacity int, onDrop func(string)) *publishQueue {
+	if capacity <= 0 {
+		capacity = DefaultPublishQueueSize
+	}
+
+	return &publishQueue{
+		payloads: map[string][]byte{},
+		capacity: capacity,
+		onDrop:   onDrop,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}, 1),
+	}
+}
+
+func (q *publishQueue) enqueue(topic string, payload []byte) {
+	var droppedTopic string
+
+	q.lock.Lock()
+
+	if _, found := q.payloads[topic]; !found {
+		if len(q.order) >= q.capacity {
+			droppedTopic = q.order[0]
+			q.order = q.order[1:]
+			delete(q.payloads, droppedTopic)
+			q.dropped++
+		}
+
+		q.order = append(q.order, topic)
+	}
+
+	q.payloads[topic] = payload
+
+	q.lock.Unlock()
+
+	if len(droppedTopic) > 0 && q.onDrop != nil {
+		q.onDrop(droppedTopic)
+	}
+
+	q.signal()
+}
+
+func (q *publishQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *publishQueue) connected(p Publisher) {
+	q.lock.Lock()
+	q.publisher = p
+	q.lock.Unlock()
+
+	q.signal()
+}
+
+func (q *publishQueue) disconnected() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.publisher = nil
+}
+
+func (q *publishQueue) statistics() QueueStatistics {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return QueueStatistics{
+		Depth:     len(q.order),
+		Capacity:  q.capacity,
+		Published: q.published,
+		Dropped:   q.dropped,
+	}
+}
+
+// next removes the oldest message from the queue, returning false if there is no message or no connected publisher.
+func (q *publishQueue) next() (Publisher, string, []byte, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.publisher == nil || len(q.order) == 0 {
+		return nil, "", nil, false
+	}
+
+	topic := q.order[0]
+	payload := q.payloads[topic]
+
+	q.order = q.order[1:]
+	delete(q.payloads, topic)
+
+	return q.publisher, topic, payload, true
+}
+
+// requeue returns a message which failed to publish to the front of the queue, unless a newer payload for the topic
+// has been queued while it was being published.
+func (q *publishQueue) requeue(topic string, payload []byte) {
+	q.lock.Lock()
+
+	if _, found := q.payloads[topic]; found {
+		q.lock.Unlock()
+		return
+	}
+
+	if len(q.order) >= q.capacity {
+		q.dropped++
+		q.lock.Unlock()
+
+		if q.onDrop != nil {
+			q.onDrop(topic)
+		}
+
+		return
+	}
+
+	q.order = append([]string{topic}, q.order...)
+	q.payloads[topic] = payload
+
+	q.lock.Unlock()
+}
+
+// drain publishes queued messages until the queue is empty, the broker disconnects or a publish fails. After a
+// failure the remaining messages are left for the next retry.
+func (q *publishQueue) drain() {
+	for {
+		publisher, topic, payload, ok := q.next()
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), MaximumQueuedPublishTime)
+		err := publisher(ctx, topic, payload)
+		cancel()
+
+		if err != nil {
+			q.requeue(topic, payload)
+			return
+		}
+
+		q.lock.Lock()
+		q.published++
+		q.lock.Unlock()
+	}
+}
+
+func (q *publishQueue) run() {
+	retry := time.NewTicker(PublishQueueRetryInterval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-q.wake:
+			q.drain()
+		case <-retry.C:
+			q.drain()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+func (q *publishQueue) shutdown() {
+	q.stop <- struct{}{}
+}
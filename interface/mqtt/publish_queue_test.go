@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordedPublish struct {
+	topic   string
+	payload string
+}
+
+func recordingPublisher(published *[]recordedPublish, err error) Publisher {
+	return func(ctx context.Context, topic string, payload []byte) error {
+		if err != nil {
+			return err
+		}
+
+		*published = append(*published, recordedPublish{topic: topic, payload: string(payload)})
+		return nil
+	}
+}
+
+func Test_publishQueue(t *testing.T) {
+	t.Run("holds messages while disconnected and publishes them once connected", func(t *testing.T) {
+		q := newPublishQueue(10, nil)
+
+		q.enqueue("one", []byte("1"))
+		q.enqueue("two", []byte("2"))
+		q.drain()
+
+		assert.Equal(t, 2, q.statistics().Depth)
+
+		var published []recordedPublish
+		q.connected(recordingPublisher(&published, nil))
+		q.drain()
+
+		assert.Equal(t, []recordedPublish{{"one", "1"}, {"two", "2"}}, published)
+		assert.Equal(t, QueueStatistics{Depth: 0, Capacity: 10, Published: 2}, q.statistics())
+	})
+
+	t.Run("coalesces messages to the same topic keeping their position", func(t *testing.T) {
+		q := newPublishQueue(10, nil)
+
+		q.enqueue("one", []byte("1"))
+		q.enqueue("two", []byte("2"))
+		q.enqueue("one", []byte("3"))
+
+		var published []recordedPublish
+		q.connected(recordingPublisher(&published, nil))
+		q.drain()
+
+		assert.Equal(t, []recordedPublish{{"one", "3"}, {"two", "2"}}, published)
+	})
+
+	t.Run("drops the oldest message when full and reports it", func(t *testing.T) {
+		var droppedTopics []string
+
+		q := newPublishQueue(2, func(topic string) {
+			droppedTopics = append(droppedTopics, topic)
+		})
+
+		q.enqueue("one", []byte("1"))
+		q.enqueue("two", []byte("2"))
+		q.enqueue("three", []byte("3"))
+
+		assert.Equal(t, []string{"one"}, droppedTopics)
+
+		var published []recordedPublish
+		q.connected(recordingPublisher(&published, nil))
+		q.drain()
+
+		assert.Equal(t, []recordedPublish{{"two", "2"}, {"three", "3"}}, published)
+		assert.Equal(t, uint64(1), q.statistics().Dropped)
+	})
+
+	t.Run("returns a failed message to the front of the queue", func(t *testing.T) {
+		q := newPublishQueue(10, nil)
+
+		q.enqueue("one", []byte("1"))
+		q.enqueue("two", []byte("2"))
+
+		var published []recordedPublish
+		q.connected(recordingPublisher(&published, fmt.Errorf("failed")))
+		q.drain()
+
+		assert.Empty(t, published)
+		assert.Equal(t, 2, q.statistics().Depth)
+
+		q.connected(recordingPublisher(&published, nil))
+		q.drain()
+
+		assert.Equal(t, []recordedPublish{{"one", "1"}, {"two", "2"}}, published)
+	})
+
+	t.Run("uses the default capacity if none is provided", func(t *testing.T) {
+		q := newPublishQueue(0, nil)
+
+		assert.Equal(t, DefaultPublishQueueSize, q.statistics().Capacity)
+	})
+}
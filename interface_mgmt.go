@@ -11,7 +11,12 @@ import (
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gorilla/handlers"
 	gorillamux "github.com/gorilla/mux"
+	mochi "github.com/mochi-mqtt/server/v2"
+	mochiauth "github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
 	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
 	"github.com/shimmeringbee/controller/interface/converters/invoker"
 	"github.com/shimmeringbee/controller/interface/http/auth"
 	"github.com/shimmeringbee/controller/interface/http/auth/null"
@@ -35,11 +40,15 @@ import (
 
 type StartedInterface struct {
 	Name     string
+	Config   config.InterfaceConfig
 	Shutdown func() error
 }
 
 const DefaultMQTTEventDuration = 1 * time.Second
 
+// mqttIncomingTopics are the topics, below the topic prefix, which MQTT interfaces accept messages on.
+var mqttIncomingTopics = []string{"devices/+/capabilities/+/+/invoke", "devices/+/metadata/set"}
+
 func loadInterfaceConfigurations(dir string) ([]config.InterfaceConfig, error) {
 	if err := os.MkdirAll(dir, DefaultDirectoryPermissions); err != nil {
 		return nil, fmt.Errorf("failed to ensure interface configuration directory exists: %w", err)
@@ -77,15 +86,16 @@ func loadInterfaceConfigurations(dir string) ([]config.InterfaceConfig, error) {
 	return retCfgs, nil
 }
 
-func startInterfaces(cfgs []config.InterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, stack layers.OutputStack, l logwrap.Logger) ([]StartedInterface, error) {
+func startInterfaces(cfgs []config.InterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, de exporter.DeviceExporter, ot *state.OperationTracker, cq *state.CommandQueue, inv invoker.Invoker, stack layers.OutputStack, rl v1.Reloader, l logwrap.Logger) ([]StartedInterface, error) {
 	var retGws []StartedInterface
 
 	for _, cfg := range cfgs {
-		if shutdown, err := startInterface(cfg, g, e, o, stack, l); err != nil {
+		if shutdown, err := startInterface(cfg, g, e, o, de, ot, cq, inv, stack, rl, l); err != nil {
 			return nil, fmt.Errorf("failed to start interface '%s': %w", cfg.Name, err)
 		} else {
 			retGws = append(retGws, StartedInterface{
 				Name:     cfg.Name,
+				Config:   cfg,
 				Shutdown: shutdown,
 			})
 		}
@@ -94,17 +104,20 @@ func startInterfaces(cfgs []config.InterfaceConfig, g *state.GatewayMux, e state
 	return retGws, nil
 }
 
-func startInterface(cfg config.InterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, stack layers.OutputStack, l logwrap.Logger) (func() error, error) {
+func startInterface(cfg config.InterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, de exporter.DeviceExporter, ot *state.OperationTracker, cq *state.CommandQueue, inv invoker.Invoker, stack layers.OutputStack, rl v1.Reloader, l logwrap.Logger) (func() error, error) {
 	wl := logwrap.New(nest.Wrap(l))
 	wl.AddOptionsToLogger(logwrap.Datum("interface", cfg.Name))
 
 	switch gwCfg := cfg.Config.(type) {
 	case *config.HTTPInterfaceConfig:
 		wl.AddOptionsToLogger(logwrap.Source("http"))
-		return startHTTPInterface(*gwCfg, g, e, o, stack, wl)
+		return startHTTPInterface(*gwCfg, g, e, o, de, ot, cq, inv, stack, rl, wl)
 	case *config.MQTTInterfaceConfig:
 		wl.AddOptionsToLogger(logwrap.Source("mqtt"))
-		return startMQTTInterface(*gwCfg, g, e, o, stack, wl)
+		return startMQTTInterface(*gwCfg, g, e, o, de, inv, stack, wl)
+	case *config.MQTTBrokerInterfaceConfig:
+		wl.AddOptionsToLogger(logwrap.Source("mqtt-broker"))
+		return startMQTTBrokerInterface(*gwCfg, g, e, o, de, inv, stack, wl)
 	default:
 		return nil, fmt.Errorf("unknown gateway type loaded: %s", cfg.Type)
 	}
@@ -120,7 +133,7 @@ func containsString(haystack []string, needle string) bool {
 	return false
 }
 
-func startHTTPInterface(cfg config.HTTPInterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, stack layers.OutputStack, l logwrap.Logger) (func() error, error) {
+func startHTTPInterface(cfg config.HTTPInterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, de exporter.DeviceExporter, ot *state.OperationTracker, cq *state.CommandQueue, inv invoker.Invoker, stack layers.OutputStack, rl v1.Reloader, l logwrap.Logger) (func() error, error) {
 	r := gorillamux.NewRouter()
 
 	authenticator := null.Authenticator{}
@@ -140,7 +153,8 @@ func startHTTPInterface(cfg config.HTTPInterfaceConfig, g *state.GatewayMux, e s
 	if containsString(cfg.EnabledAPIs, "v1") {
 		l.LogInfo(context.Background(), "Mounting v1 API endpoint on: /api/v1.")
 
-		v1Router := v1.ConstructRouter(g, o, stack, l, authenticator, e)
+		deviceInvoker := configureInvoker(inv, cfg.InvokerConfig)
+		v1Router := v1.ConstructRouter(g, o, stack, l, authenticator, e, de, deviceInvoker, ot, cq, rl)
 
 		// Use http.StripPrefix to obscure the real path from the v1 api code, though this will cause issues if we
 		// ever issue redirects from the API.
@@ -182,7 +196,7 @@ type errorReply struct {
 	Error error `json:"error"`
 }
 
-func startMQTTInterface(cfg config.MQTTInterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, stack layers.OutputStack, l logwrap.Logger) (func() error, error) {
+func startMQTTInterface(cfg config.MQTTInterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, de exporter.DeviceExporter, inv invoker.Invoker, stack layers.OutputStack, l logwrap.Logger) (func() error, error) {
 	clientId, err := randomClientID()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate random client id: %w", err)
@@ -200,28 +214,36 @@ func startMQTTInterface(cfg config.MQTTInterfaceConfig, g *state.GatewayMux, e s
 		clientOptions.Servers = []*url2.URL{url}
 	}
 
-	i := mqtt.Interface{GatewayMux: g, EventSubscriber: e, DeviceOrganiser: o, DeviceInvoker: invoker.InvokeDeviceAction, OutputStack: stack, Logger: l, Publisher: mqtt.EmptyPublisher, PublishStateOnConnect: cfg.PublishStateOnConnect, PublishIndividualState: cfg.PublishIndividualState, PublishAggregatedState: cfg.PublishAggregatedState}
+	i, err := newMQTTInterface(cfg.MQTTPublishing, g, e, o, de, configureInvoker(inv, cfg.InvokerConfig), stack, l)
+	if err != nil {
+		return nil, err
+	}
 
 	lastWillTopic := prefixTopic(cfg.TopicPrefix, "controller/online")
 
 	clientOptions.OnConnect = func(client pahomqtt.Client) {
 		l.LogInfo(context.Background(), "MQTT client successfully connected.", logwrap.Datum("clientId", clientId), logwrap.Datum("server", cfg.Server))
 
-		subTopic := prefixTopic(cfg.TopicPrefix, "devices/+/capabilities/+/+/invoke")
-		subscribeToken := client.Subscribe(subTopic, 0, func(client pahomqtt.Client, message pahomqtt.Message) {
+		handler := func(client pahomqtt.Client, message pahomqtt.Message) {
 			ctx, cancel := context.WithTimeout(context.Background(), DefaultMQTTEventDuration)
 			defer cancel()
 
 			if err := i.IncomingMessage(ctx, stripPrefixTopic(cfg.TopicPrefix, message.Topic()), message.Payload()); err != nil {
 				l.LogError(ctx, "Failed to handle incoming message.", logwrap.Datum("topic", message.Topic()), logwrap.Err(err))
 			}
-		})
+		}
+
+		for _, topic := range mqttIncomingTopics {
+			subTopic := prefixTopic(cfg.TopicPrefix, topic)
+			subscribeToken := client.Subscribe(subTopic, 0, handler)
+
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultMQTTEventDuration)
 
-		ctx, cancel := context.WithTimeout(context.Background(), DefaultMQTTEventDuration)
-		defer cancel()
+			if err := awaitToken(ctx, subscribeToken); err != nil {
+				l.LogError(ctx, "Failed to subscribe to topic in MQTT.", logwrap.Datum("topic", subTopic), logwrap.Err(err))
+			}
 
-		if err := awaitToken(ctx, subscribeToken); err != nil {
-			l.LogError(ctx, "Failed to subscribe to topic in MQTT.", logwrap.Datum("topic", subTopic), logwrap.Err(err))
+			cancel()
 		}
 
 		client.Publish(lastWillTopic, cfg.QOS, cfg.Retained, `true`)
@@ -327,12 +349,205 @@ func startMQTTInterface(cfg config.MQTTInterfaceConfig, g *state.GatewayMux, e s
 	}()
 
 	return func() error {
-		client.Disconnect(1500)
+		// Stop the interface before disconnecting, so that devices can be marked as unavailable.
 		i.Stop()
+		client.Disconnect(1500)
+		return nil
+	}, nil
+}
+
+func newMQTTInterface(cfg config.MQTTPublishing, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, de exporter.DeviceExporter, inv invoker.Invoker, stack layers.OutputStack, l logwrap.Logger) (*mqtt.Interface, error) {
+	templates, err := capabilityTemplates(cfg.CapabilityTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadFormat := mqtt.PayloadFormat{FloatPrecision: cfg.PayloadFormat.FloatPrecision, TrueValue: cfg.PayloadFormat.TrueValue, FalseValue: cfg.PayloadFormat.FalseValue, NullValue: cfg.PayloadFormat.NullValue, Units: cfg.PayloadFormat.Units}
+
+	return &mqtt.Interface{GatewayMux: g, EventSubscriber: e, DeviceOrganiser: o, DeviceExporter: de, DeviceInvoker: inv, OutputStack: stack, Logger: l, Publisher: mqtt.EmptyPublisher, PublishStateOnConnect: cfg.PublishStateOnConnect, PublishIndividualState: cfg.PublishIndividualState, PublishAggregatedState: cfg.PublishAggregatedState, PublishOnlyOnChange: cfg.PublishOnlyOnChange, PublishRefreshInterval: cfg.PublishRefreshInterval.Duration(), CapabilityPublishPolicies: capabilityPublishPolicies(cfg.PublishCapabilities), PublishQueueSize: cfg.PublishQueueSize, PublishWorkers: cfg.PublishWorkers, PublishQueueStatistics: cfg.PublishQueueStatistics, PayloadFormat: payloadFormat, CapabilityTemplates: templates, AvailabilityTimeout: cfg.AvailabilityTimeout.Duration(), CapabilityAvailabilityTimeouts: durations(cfg.CapabilityAvailabilityTimeouts), DeviceAvailabilityTimeouts: durations(cfg.DeviceAvailabilityTimeouts)}, nil
+}
+
+func startMQTTBrokerInterface(cfg config.MQTTBrokerInterfaceConfig, g *state.GatewayMux, e state.EventSubscriber, o *state.DeviceOrganiser, de exporter.DeviceExporter, inv invoker.Invoker, stack layers.OutputStack, l logwrap.Logger) (func() error, error) {
+	i, err := newMQTTInterface(cfg.MQTTPublishing, g, e, o, de, configureInvoker(inv, cfg.InvokerConfig), stack, l)
+	if err != nil {
+		return nil, err
+	}
+
+	server := mochi.New(&mochi.Options{InlineClient: true, Logger: newSlogLogger(l)})
+
+	if len(cfg.Users) > 0 {
+		users := mochiauth.Users{}
+
+		for _, user := range cfg.Users {
+			users[user.Username] = mochiauth.UserRule{Username: mochiauth.RString(user.Username), Password: mochiauth.RString(user.Password)}
+		}
+
+		if err := server.AddHook(new(mochiauth.Hook), &mochiauth.Options{Ledger: &mochiauth.Ledger{Users: users}}); err != nil {
+			return nil, fmt.Errorf("failed to add authentication to mqtt broker: %w", err)
+		}
+	} else {
+		l.LogWarn(context.Background(), "No users configured for MQTT broker, anonymous connections will be permitted.")
+
+		if err := server.AddHook(new(mochiauth.AllowHook), nil); err != nil {
+			return nil, fmt.Errorf("failed to add authentication to mqtt broker: %w", err)
+		}
+	}
+
+	listenerCfgs := cfg.Listeners
+	if len(listenerCfgs) == 0 {
+		listenerCfgs = []config.MQTTBrokerListener{{Type: "tcp", Address: DefaultMQTTBrokerAddress}}
+	}
+
+	for idx, listenerCfg := range listenerCfgs {
+		listener, err := mqttBrokerListener(fmt.Sprintf("%s-%d", listenerCfg.Type, idx), listenerCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := server.AddListener(listener); err != nil {
+			return nil, fmt.Errorf("failed to add listener to mqtt broker: %w", err)
+		}
+
+		l.LogInfo(context.Background(), "MQTT broker listening.", logwrap.Datum("type", listenerCfg.Type), logwrap.Datum("address", listenerCfg.Address))
+	}
+
+	if err := server.Serve(); err != nil {
+		return nil, fmt.Errorf("failed to start mqtt broker: %w", err)
+	}
+
+	onlineTopic := prefixTopic(cfg.TopicPrefix, "controller/online")
+
+	handler := func(cl *mochi.Client, sub packets.Subscription, pk packets.Packet) {
+		// Handle the message outside of the brokers delivery, as invoking an action may block.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultMQTTEventDuration)
+			defer cancel()
+
+			if err := i.IncomingMessage(ctx, stripPrefixTopic(cfg.TopicPrefix, pk.TopicName), pk.Payload); err != nil {
+				l.LogError(ctx, "Failed to handle incoming message.", logwrap.Datum("topic", pk.TopicName), logwrap.Err(err))
+			}
+		}()
+	}
+
+	for idx, topic := range mqttIncomingTopics {
+		if err := server.Subscribe(prefixTopic(cfg.TopicPrefix, topic), idx+1, handler); err != nil {
+			_ = server.Close()
+			return nil, fmt.Errorf("failed to subscribe to topic in mqtt broker: %w", err)
+		}
+	}
+
+	i.Start()
+
+	if err := server.Publish(onlineTopic, []byte(`true`), cfg.Retained, cfg.QOS); err != nil {
+		l.LogError(context.Background(), "Failed to publish online state to MQTT broker.", logwrap.Err(err))
+	}
+
+	if err := i.Connected(context.Background(), func(ctx context.Context, topic string, payload []byte) error {
+		prefixedTopic := prefixTopic(cfg.TopicPrefix, topic)
+
+		if err := server.Publish(prefixedTopic, payload, cfg.Retained, cfg.QOS); err != nil {
+			l.LogError(ctx, "Failed to publish message to MQTT broker.", logwrap.Datum("topic", prefixedTopic), logwrap.Err(err))
+			return err
+		}
+
 		return nil
+	}); err != nil {
+		l.LogError(context.Background(), "Failed to execute connection handler in MQTT interface.", logwrap.Err(err))
+	}
+
+	return func() error {
+		i.Stop()
+		i.Disconnected()
+
+		if err := server.Publish(onlineTopic, []byte(`false`), cfg.Retained, cfg.QOS); err != nil {
+			l.LogError(context.Background(), "Failed to publish offline state to MQTT broker.", logwrap.Err(err))
+		}
+
+		return server.Close()
 	}, nil
 }
 
+const DefaultMQTTBrokerAddress = ":1883"
+
+func mqttBrokerListener(id string, cfg config.MQTTBrokerListener) (listeners.Listener, error) {
+	listenerCfg := listeners.Config{ID: id, Address: cfg.Address}
+
+	if cfg.TLS != nil {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate/key for mqtt broker: %w", err)
+		}
+
+		listenerCfg.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	switch cfg.Type {
+	case "tcp":
+		return listeners.NewTCP(listenerCfg), nil
+	case "websocket":
+		return listeners.NewWebsocket(listenerCfg), nil
+	default:
+		return nil, fmt.Errorf("unknown mqtt broker listener type: %s", cfg.Type)
+	}
+}
+
+func capabilityPublishPolicies(cfgs map[string]config.MQTTCapabilityPublishing) map[string]mqtt.CapabilityPublishPolicy {
+	policies := make(map[string]mqtt.CapabilityPublishPolicy, len(cfgs))
+
+	for capName, cfg := range cfgs {
+		policies[capName] = mqtt.CapabilityPublishPolicy{
+			MinimumInterval: cfg.MinimumInterval.Duration(),
+			Deadband:        cfg.Deadband,
+		}
+	}
+
+	return policies
+}
+
+// configureInvoker wraps an invoker with an interfaces idempotency cache, action timeouts and retry policy. Timeouts
+// bound all attempts of an action, and a repeated idempotent request does not retry.
+func configureInvoker(inv invoker.Invoker, cfg config.InvokerConfig) invoker.Invoker {
+	policy := invoker.RetryPolicy{
+		Attempts:       cfg.Retry.Attempts,
+		Backoff:        cfg.Retry.Backoff.Duration(),
+		MaximumBackoff: cfg.Retry.MaximumBackoff.Duration(),
+	}
+
+	if cfg.Retry.OnlyRetryTimeouts {
+		policy.Transient = invoker.IsTimeoutError
+	}
+
+	inv = invoker.WithRetryPolicy(inv, policy)
+	inv = invoker.WithCapabilityTimeouts(inv, durations(cfg.ActionTimeouts))
+
+	return invoker.WithIdempotency(inv, invoker.NewIdempotencyCache(cfg.IdempotencyWindow.Duration()))
+}
+
+func durations(cfgs map[string]config.Duration) map[string]time.Duration {
+	result := make(map[string]time.Duration, len(cfgs))
+
+	for k, v := range cfgs {
+		result[k] = v.Duration()
+	}
+
+	return result
+}
+
+func capabilityTemplates(cfgs map[string]config.MQTTCapabilityTemplate) (map[string]mqtt.CapabilityTemplate, error) {
+	templates := make(map[string]mqtt.CapabilityTemplate, len(cfgs))
+
+	for capName, cfg := range cfgs {
+		tmpl, err := mqtt.ParseCapabilityTemplate(capName, cfg.Topic, cfg.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[capName] = tmpl
+	}
+
+	return templates, nil
+}
+
 func prefixTopic(topicPrefix string, topic string) string {
 	if len(topicPrefix) > 0 {
 		return fmt.Sprintf("%s/%s", topicPrefix, topic)
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
+	"github.com/shimmeringbee/controller/interface/converters/invoker"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/logwrap/impl/discard"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+	"time"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func Test_startMQTTBrokerInterface(t *testing.T) {
+	startBroker := func(t *testing.T, users []config.MQTTCredentials) (string, *state.GatewayMux, *state.DeviceOrganiser, func() error) {
+		address := freeAddress(t)
+
+		eb := state.NewEventBus()
+		gm := state.NewGatewayMux(eb)
+		do := state.NewDeviceOrganiser(memory.New(), eb)
+
+		cfg := config.MQTTBrokerInterfaceConfig{
+			Listeners: []config.MQTTBrokerListener{{Type: "tcp", Address: address}},
+			Users:     users,
+			MQTTPublishing: config.MQTTPublishing{
+				Retained:    true,
+				TopicPrefix: "controller1",
+			},
+		}
+
+		shutdown, err := startMQTTBrokerInterface(cfg, gm, eb, &do, exporter.NewDeviceExporter(&do, gm), invoker.InvokeDeviceAction, &layers.PassThruStack{}, logwrap.New(discard.Discard()))
+		assert.NoError(t, err)
+
+		return address, gm, &do, shutdown
+	}
+
+	connect := func(address string, username string, password string) (pahomqtt.Client, error) {
+		opts := pahomqtt.NewClientOptions()
+		opts.AddBroker(fmt.Sprintf("tcp://%s", address))
+		opts.SetUsername(username)
+		opts.SetPassword(password)
+		opts.SetConnectTimeout(time.Second)
+
+		client := pahomqtt.NewClient(opts)
+		token := client.Connect()
+		token.WaitTimeout(time.Second)
+
+		return client, token.Error()
+	}
+
+	t.Run("publishes controller state into the broker for clients to receive", func(t *testing.T) {
+		address, _, _, shutdown := startBroker(t, nil)
+		defer shutdown()
+
+		client, err := connect(address, "", "")
+		assert.NoError(t, err)
+		defer client.Disconnect(0)
+
+		received := make(chan string, 1)
+
+		token := client.Subscribe("controller1/controller/online", 0, func(client pahomqtt.Client, message pahomqtt.Message) {
+			received <- string(message.Payload())
+		})
+		assert.True(t, token.WaitTimeout(time.Second))
+		assert.NoError(t, token.Error())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		select {
+		case payload := <-received:
+			assert.Equal(t, "true", payload)
+		case <-ctx.Done():
+			assert.Fail(t, "did not receive retained online state")
+		}
+	})
+
+	t.Run("rejects clients with incorrect credentials when users are configured", func(t *testing.T) {
+		address, _, _, shutdown := startBroker(t, []config.MQTTCredentials{{Username: "user", Password: "pass"}})
+		defer shutdown()
+
+		client, err := connect(address, "user", "wrong")
+		assert.Error(t, err)
+		client.Disconnect(0)
+
+		client, err = connect(address, "user", "pass")
+		assert.NoError(t, err)
+		client.Disconnect(0)
+	})
+
+	t.Run("updates device metadata from messages published to the broker", func(t *testing.T) {
+		address, gm, do, shutdown := startBroker(t, nil)
+		defer shutdown()
+
+		self := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		mg := &mocks.Gateway{}
+		mg.On("Self").Return(self)
+		mg.On("ReadEvent", mock.Anything).Return(nil, context.DeadlineExceeded).Maybe()
+
+		gm.Add("gw", mg)
+		defer gm.Stop()
+
+		id := self.Identifier().String()
+		do.AddDevice(id)
+
+		client, err := connect(address, "", "")
+		assert.NoError(t, err)
+		defer client.Disconnect(0)
+
+		token := client.Publish(fmt.Sprintf("controller1/devices/%s/metadata/set", id), 1, false, `{"Tags":["outdoor"]}`)
+		assert.True(t, token.WaitTimeout(time.Second))
+		assert.NoError(t, token.Error())
+
+		assert.Eventually(t, func() bool {
+			dm, _ := do.Device(id)
+			return len(dm.Tags) == 1 && dm.Tags[0] == "outdoor"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("fails to start with an unknown listener type", func(t *testing.T) {
+		_, err := mqttBrokerListener("unknown-0", config.MQTTBrokerListener{Type: "unknown"})
+		assert.Error(t, err)
+	})
+}
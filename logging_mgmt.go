@@ -13,19 +13,81 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 )
 
-func configureLogging(cfgDir string, logDir string, l logwrap.Logger) (logwrap.Logger, error) {
+// reloadableLogging is a logging implementation which can be replaced while in use, allowing logging configuration
+// to be reloaded without reconstructing every logger.
+type reloadableLogging struct {
+	impl  atomic.Pointer[logwrap.Impl]
+	base  logwrap.Impl
+	close func()
+}
+
+func newReloadableLogging(base logwrap.Impl) *reloadableLogging {
+	r := &reloadableLogging{base: base}
+	r.impl.Store(&base)
+	return r
+}
+
+func (r *reloadableLogging) Log(ctx context.Context, message logwrap.Message) {
+	(*r.impl.Load())(ctx, message)
+}
+
+// Set replaces the logging implementation, closing any files held open by the previous one. A nil implementation
+// returns logging to the base it was constructed with.
+func (r *reloadableLogging) Set(impl logwrap.Impl, close func()) {
+	if impl == nil {
+		impl = r.base
+	}
+
+	r.impl.Store(&impl)
+
+	if r.close != nil {
+		r.close()
+	}
+
+	r.close = close
+}
+
+func configureLogging(cfgDir string, logDir string, logging *reloadableLogging, l logwrap.Logger) ([]config.LoggingConfig, error) {
+	logCfg, err := loadLoggingConfigurations(cfgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cfg := range logCfg {
+		l.LogInfo(context.Background(), "Loaded logging configuration.", logwrap.Datum("name", cfg.Name), logwrap.Datum("type", cfg.Type))
+	}
+
+	impl, closer, err := constructLogging(logCfg, logDir, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if impl == nil {
+		l.LogWarn(context.Background(), "No logging configurations loaded, continuing with stdout/stderr only.")
+	} else {
+		l.LogDebug(context.Background(), "Handing over to new logging configuration.")
+	}
+
+	logging.Set(impl, closer)
+
+	return logCfg, nil
+}
+
+func loadLoggingConfigurations(cfgDir string) ([]config.LoggingConfig, error) {
 	if err := os.MkdirAll(cfgDir, DefaultDirectoryPermissions); err != nil {
-		return l, fmt.Errorf("failed to ensure logging configuration directory exists: %w", err)
+		return nil, fmt.Errorf("failed to ensure logging configuration directory exists: %w", err)
 	}
 
 	files, err := ioutil.ReadDir(cfgDir)
 	if err != nil {
-		return l, fmt.Errorf("failed to read directory listing for logging configurations: %w", err)
+		return nil, fmt.Errorf("failed to read directory listing for logging configurations: %w", err)
 	}
 
 	var logCfg []config.LoggingConfig
@@ -38,7 +100,7 @@ func configureLogging(cfgDir string, logDir string, l logwrap.Logger) (logwrap.L
 		fullPath := filepath.Join(cfgDir, file.Name())
 		data, err := ioutil.ReadFile(fullPath)
 		if err != nil {
-			return l, fmt.Errorf("failed to read logging configuration file '%s': %w", fullPath, err)
+			return nil, fmt.Errorf("failed to read logging configuration file '%s': %w", fullPath, err)
 		}
 
 		cfg := config.LoggingConfig{
@@ -46,14 +108,26 @@ func configureLogging(cfgDir string, logDir string, l logwrap.Logger) (logwrap.L
 		}
 
 		if err := json.Unmarshal(data, &cfg); err != nil {
-			return l, fmt.Errorf("failed to parse logging configuration file '%s': %w", fullPath, err)
+			return nil, fmt.Errorf("failed to parse logging configuration file '%s': %w", fullPath, err)
 		}
 
-		l.LogInfo(context.Background(), "Loaded logging configuration.", logwrap.Datum("name", cfg.Name), logwrap.Datum("type", cfg.Type))
 		logCfg = append(logCfg, cfg)
 	}
 
+	return logCfg, nil
+}
+
+// constructLogging builds a logging implementation from the configurations provided, and a function to close any
+// files it holds open. If there are no configurations the implementation is nil.
+func constructLogging(logCfg []config.LoggingConfig, logDir string, l logwrap.Logger) (logwrap.Impl, func(), error) {
 	var impls []logwrap.Impl
+	var files []*lumberjack.Logger
+
+	closer := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
 
 	for _, cfg := range logCfg {
 		var logWriter io.Writer
@@ -67,17 +141,21 @@ func configureLogging(cfgDir string, logDir string, l logwrap.Logger) (logwrap.L
 			outFile := filepath.Join(logDir, lCfg.Filename)
 			baseCfg = lCfg.BaseLogging
 
-			logWriter = &lumberjack.Logger{
+			file := &lumberjack.Logger{
 				Filename:   outFile,
 				MaxSize:    lCfg.Size,
 				MaxBackups: lCfg.Count,
 				Compress:   lCfg.Compress,
 			}
+
+			files = append(files, file)
+			logWriter = file
 		}
 
 		impl, err := constructFilter(baseCfg, golog.Wrap(log.New(logWriter, "", log.LstdFlags)))
 		if err != nil {
-			return l, fmt.Errorf("failed to construct filter for logging '%s': %w", cfg.Name, err)
+			closer()
+			return nil, nil, fmt.Errorf("failed to construct filter for logging '%s': %w", cfg.Name, err)
 		}
 
 		impls = append(impls, impl)
@@ -86,13 +164,10 @@ func configureLogging(cfgDir string, logDir string, l logwrap.Logger) (logwrap.L
 	}
 
 	if len(impls) == 0 {
-		l.LogWarn(context.Background(), "No logging configurations loaded, continuing with stdout/stderr only.")
-		return l, nil
+		return nil, closer, nil
 	}
 
-	l.LogDebug(context.Background(), "Handing over to new logging configuration.")
-
-	return logwrap.New(tee.Tee(impls...)), nil
+	return tee.Tee(impls...), closer, nil
 }
 
 func constructFilter(cfg config.BaseLogging, base logwrap.Impl) (logwrap.Impl, error) {
@@ -142,3 +217,63 @@ func constructFilter(cfg config.BaseLogging, base logwrap.Impl) (logwrap.Impl, e
 		return cfg.NegateSubsystems != found
 	}), nil
 }
+
+// slogHandler adapts a logwrap logger for libraries which log with slog, levels are mapped to their nearest logwrap
+// equivalent and filtering is left to the logging configuration.
+type slogHandler struct {
+	l       logwrap.Logger
+	prefix  string
+	options []logwrap.Option
+}
+
+func newSlogLogger(l logwrap.Logger) *slog.Logger {
+	return slog.New(&slogHandler{l: l})
+}
+
+func (h *slogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	options := append([]logwrap.Option{}, h.options...)
+
+	record.Attrs(func(attr slog.Attr) bool {
+		options = append(options, h.datum(attr))
+		return true
+	})
+
+	switch {
+	case record.Level >= slog.LevelError:
+		h.l.LogError(ctx, record.Message, options...)
+	case record.Level >= slog.LevelWarn:
+		h.l.LogWarn(ctx, record.Message, options...)
+	case record.Level >= slog.LevelInfo:
+		h.l.LogInfo(ctx, record.Message, options...)
+	default:
+		h.l.LogDebug(ctx, record.Message, options...)
+	}
+
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.options = append([]logwrap.Option{}, h.options...)
+
+	for _, attr := range attrs {
+		nh.options = append(nh.options, h.datum(attr))
+	}
+
+	return &nh
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	nh := *h
+	nh.prefix = h.prefix + name + "."
+
+	return &nh
+}
+
+func (h *slogHandler) datum(attr slog.Attr) logwrap.Option {
+	return logwrap.Datum(h.prefix+attr.Key, attr.Value.Resolve().Any())
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_newSlogLogger(t *testing.T) {
+	t.Run("logs slog records to the logwrap logger with mapped levels and attributes", func(t *testing.T) {
+		var messages []logwrap.Message
+
+		l := logwrap.New(func(ctx context.Context, message logwrap.Message) {
+			messages = append(messages, message)
+		})
+
+		sl := newSlogLogger(l).With("listener", "tcp-0").WithGroup("client")
+
+		sl.Warn("Client disconnected.", "id", "abc")
+		sl.Debug("Packet received.")
+
+		assert.Len(t, messages, 2)
+
+		assert.Equal(t, logwrap.Warn, messages[0].Level)
+		assert.Equal(t, "Client disconnected.", messages[0].Message)
+		assert.Equal(t, "tcp-0", messages[0].Data["listener"])
+		assert.Equal(t, "abc", messages[0].Data["client.id"])
+
+		assert.Equal(t, logwrap.Debug, messages[1].Level)
+	})
+}
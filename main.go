@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/interface/converters/exporter"
+	"github.com/shimmeringbee/controller/interface/converters/invoker"
 	"github.com/shimmeringbee/controller/layers"
 	"github.com/shimmeringbee/controller/state"
 	"github.com/shimmeringbee/da"
@@ -13,28 +16,33 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 )
 
 func main() {
 	ctx := context.Background()
-	l := lw.New(golog.Wrap(log.New(os.Stderr, "", log.LstdFlags)))
+	logging := newReloadableLogging(golog.Wrap(log.New(os.Stderr, "", log.LstdFlags)))
+	l := lw.New(logging.Log)
 
 	l.LogInfo(ctx, "Shimmering Bee: Controller - Copyright 2019-2020 Shimmering Bee Contributors - Starting...")
 
-	directories := enumerateDirectories(ctx, l)
+	directories, args := enumerateDirectories(ctx, l)
 
 	l.LogInfo(ctx, "Directory enumeration complete.", lw.Datum("directories", directories))
 
+	if len(args) > 0 {
+		os.Exit(runCommand(args, file.New(directories.Data), os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	l.LogInfo(ctx, "Persisted data initialising.")
 	section := file.New(directories.Data)
 
-	newLogger, err := configureLogging(filepath.Join(directories.Config, "logging"), directories.Log, l)
+	loggingCfgs, err := configureLogging(filepath.Join(directories.Config, "logging"), directories.Log, logging, l)
 	if err != nil {
 		l.LogFatal(ctx, "Failed to load logging configuration.", lw.Err(err))
 	}
 
-	l = newLogger
-
 	gatewayCfgs, err := loadGatewayConfigurations(filepath.Join(directories.Config, "gateways"))
 	if err != nil {
 		l.LogFatal(ctx, "Failed to load gateway configurations.", lw.Err(err))
@@ -54,22 +62,58 @@ func main() {
 	l.LogInfo(ctx, "Initialising device organiser.")
 	deviceOrganiser := state.NewDeviceOrganiser(section.Section("Organiser"), eventbus)
 
+	for _, problem := range deviceOrganiser.CheckConsistency(nil, false) {
+		l.LogWarn(ctx, "Device organiser problem found, repair with 'controller organiser fsck -repair'.", lw.Datum("problem", problem.String()))
+	}
+
 	gwMux := state.NewGatewayMux(eventbus)
 
+	operationTracker := state.NewOperationTracker(eventbus)
+
+	outputStack := layers.PassThruStack{}
+
+	l.LogInfo(ctx, "Initialising command queue.")
+	commandQueue := state.NewCommandQueue(section.Section("CommandQueue"), invoker.CommandExecutor(invoker.InvokeDeviceAction, gwMux, outputStack))
+	commandQueue.Start(eventbus)
+
+	deviceInvoker := invoker.WithCommandQueue(invoker.InvokeDeviceAction, commandQueue, &deviceOrganiser)
+
+	l.LogInfo(ctx, "Initialising capability state cache.")
+	stateCache := exporter.NewStateCache(exporter.NewDeviceExporter(&deviceOrganiser, gwMux), section.Section("StateCache"))
+	stateCache.Start(eventbus)
+
 	l.LogInfo(ctx, "Linking device organiser to mux.")
 	deviceOrganiserMuxCh := updateDeviceOrganiserFromMux(&deviceOrganiser)
 	eventbus.Subscribe(deviceOrganiserMuxCh)
 
-	outputStack := layers.PassThruStack{}
+	rl := &reloader{
+		configDir:   directories.Config,
+		logDir:      directories.Log,
+		logging:     logging,
+		loggingCfgs: loggingCfgs,
+		mux:         gwMux,
+		organiser:   &deviceOrganiser,
+		l:           l,
+	}
+
+	// Interfaces subscribe to events through the state cache, so that capability state is current when they handle
+	// capability events and is not read from the device again.
+	rl.startInterface = func(cfg config.InterfaceConfig) (func() error, error) {
+		return startInterface(cfg, gwMux, stateCache, &deviceOrganiser, stateCache, operationTracker, commandQueue, deviceInvoker, outputStack, rl, l)
+	}
+
+	rl.startGateway = func(cfg config.GatewayConfig) (da.Gateway, func(), error) {
+		return startGateway(cfg, l, section.Section("Gateway").Section(cfg.Name))
+	}
 
 	l.LogInfo(ctx, "Starting interfaces.")
-	startedInterfaces, err := startInterfaces(interfaceCfgs, gwMux, eventbus, &deviceOrganiser, outputStack, l)
+	rl.interfaces, err = startInterfaces(interfaceCfgs, gwMux, stateCache, &deviceOrganiser, stateCache, operationTracker, commandQueue, deviceInvoker, outputStack, rl, l)
 	if err != nil {
 		l.LogFatal(ctx, "Failed to start interfaces.", lw.Err(err))
 	}
 
 	l.LogInfo(ctx, "Starting gateways.")
-	startedGateways, err := startGateways(gatewayCfgs, gwMux, l, section.Section("Gateway"))
+	rl.gateways, err = startGateways(gatewayCfgs, gwMux, l, section.Section("Gateway"))
 	if err != nil {
 		l.LogFatal(ctx, "Failed to start gateways.", lw.Err(err))
 	}
@@ -81,12 +125,20 @@ func main() {
 	l.LogInfo(ctx, "Controller ready.")
 
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, os.Kill)
+	signal.Notify(signalCh, os.Interrupt, os.Kill, syscall.SIGHUP)
 
 	s := <-signalCh
+
+	for s == syscall.SIGHUP {
+		l.LogInfo(ctx, "Hangup received, reloading configuration.")
+		logReloadReport(ctx, l, rl.Reload())
+
+		s = <-signalCh
+	}
+
 	l.LogInfo(ctx, "Signal received, shutting down.", lw.Datum("signal", s.String()))
 
-	for _, intf := range startedInterfaces {
+	for _, intf := range rl.Interfaces() {
 		l.LogInfo(ctx, "Shutting down interface.", lw.Datum("interface", intf.Name))
 
 		if err := intf.Shutdown(); err != nil {
@@ -94,7 +146,10 @@ func main() {
 		}
 	}
 
-	for _, gw := range startedGateways {
+	l.LogInfo(ctx, "Shutting down gateway mux.")
+	gwMux.Stop()
+
+	for _, gw := range rl.Gateways() {
 		l.LogInfo(ctx, "Shutting down gateway.", lw.Datum("gateway", gw.Name))
 
 		if err := gw.Gateway.Stop(ctx); err != nil {
@@ -104,8 +159,11 @@ func main() {
 		gw.Shutdown()
 	}
 
-	l.LogInfo(ctx, "Shutting down gateway mux.")
-	gwMux.Stop()
+	l.LogInfo(ctx, "Shutting down capability state cache.")
+	stateCache.Stop()
+
+	l.LogInfo(ctx, "Shutting down command queue.")
+	commandQueue.Stop()
 
 	l.LogInfo(ctx, "Shutting device organiser mux link.")
 	deviceOrganiserMuxCh <- nil
@@ -118,10 +176,16 @@ func main() {
 	l.LogInfo(ctx, "Shut down complete.")
 }
 
+// removedDevicePurgeInterval is how often devices removed for longer than their grace period are purged.
+const removedDevicePurgeInterval = time.Hour
+
 func updateDeviceOrganiserFromMux(do *state.DeviceOrganiser) chan any {
 	ch := make(chan any, 100)
 
 	go func() {
+		ticker := time.NewTicker(removedDevicePurgeInterval)
+		defer ticker.Stop()
+
 		for {
 			select {
 			case e := <-ch:
@@ -129,10 +193,12 @@ func updateDeviceOrganiserFromMux(do *state.DeviceOrganiser) chan any {
 				case da.DeviceAdded:
 					do.AddDevice(ce.Device.Identifier().String())
 				case da.DeviceRemoved:
-					do.RemoveDevice(ce.Device.Identifier().String())
+					do.MarkDeviceRemoved(ce.Device.Identifier().String())
 				case nil:
 					return
 				}
+			case <-ticker.C:
+				do.PurgeRemovedDevices(state.DefaultRemovedDeviceGracePeriod)
 			}
 		}
 	}()
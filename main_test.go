@@ -33,7 +33,7 @@ func Test_updateDeviceOrganiserFromMux(t *testing.T) {
 		assert.True(t, found)
 	})
 
-	t.Run("removes a device when a DeviceRemoved event is received", func(t *testing.T) {
+	t.Run("marks a device as removed when a DeviceRemoved event is received, retaining it for the grace period", func(t *testing.T) {
 		do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
 		addr := zigbee.GenerateLocalAdministeredIEEEAddress()
 
@@ -53,6 +53,11 @@ func Test_updateDeviceOrganiserFromMux(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 
 		_, found := do.Device(addr.String())
+		assert.True(t, found)
+
+		do.PurgeRemovedDevices(0)
+
+		_, found = do.Device(addr.String())
 		assert.False(t, found)
 	})
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/shimmeringbee/controller/state"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func exportOrganisationCommand(do *state.DeviceOrganiser, args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("organisation export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	format := fs.String("format", string(state.OrganisationFormatJSON), "format of document, json or yaml")
+	output := fs.String("output", "", "file to write document to, defaults to standard output")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := state.MarshalOrganisation(do.ExportOrganisation(), state.OrganisationFormat(*format))
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = stdout.Write(data)
+		return err
+	}
+
+	return os.WriteFile(*output, data, 0600)
+}
+
+func importOrganisationCommand(do *state.DeviceOrganiser, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("organisation import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	format := fs.String("format", "", "format of document, json or yaml, defaults to the extension of the file or json")
+	mode := fs.String("mode", string(state.ImportMerge), "merge the document into the organisation, or replace it")
+	dryRun := fs.Bool("dry-run", false, "list the changes the import would make without making them")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a single document to import must be provided, use - for standard input")
+	}
+
+	filename := fs.Arg(0)
+
+	var data []byte
+	var err error
+
+	if filename == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".yaml", ".yml":
+			*format = string(state.OrganisationFormatYAML)
+		default:
+			*format = string(state.OrganisationFormatJSON)
+		}
+	}
+
+	doc, err := state.UnmarshalOrganisation(data, state.OrganisationFormat(*format))
+	if err != nil {
+		return err
+	}
+
+	changes, err := do.ImportOrganisation(doc, state.ImportMode(*mode), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		fmt.Fprintln(stdout, describeOrganisationChange(change))
+	}
+
+	if *dryRun {
+		fmt.Fprintf(stdout, "%d changes would be made, dry run only.\n", len(changes))
+	} else {
+		fmt.Fprintf(stdout, "%d changes made.\n", len(changes))
+	}
+
+	return nil
+}
+
+func describeOrganisationChange(change state.OrganisationChange) string {
+	subject := fmt.Sprintf("zone %d", change.Zone)
+
+	if change.Device != "" {
+		subject = fmt.Sprintf("device %s", change.Device)
+	}
+
+	if len(change.Fields) == 0 {
+		return fmt.Sprintf("%s %s", change.Action, subject)
+	}
+
+	return fmt.Sprintf("%s %s: %s", change.Action, subject, strings.Join(change.Fields, ", "))
+}
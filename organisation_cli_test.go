@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_runCommand(t *testing.T) {
+	t.Run("exports and imports the organisation", func(t *testing.T) {
+		source := memory.New()
+		do := state.NewDeviceOrganiser(source.Section("Organiser"), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+
+		document := filepath.Join(t.TempDir(), "organisation.yaml")
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		code := runCommand([]string{"organisation", "export", "-format", "yaml", "-output", document}, source, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+
+		data, err := os.ReadFile(document)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "Name: Kitchen")
+
+		destination := memory.New()
+
+		stdout.Reset()
+		code = runCommand([]string{"organisation", "import", "-mode", "replace", "-dry-run", document}, destination, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "create zone 1\n1 changes would be made, dry run only.\n", stdout.String())
+
+		stdout.Reset()
+		code = runCommand([]string{"organisation", "import", "-mode", "replace", document}, destination, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "create zone 1\n1 changes made.\n", stdout.String())
+
+		imported := state.NewDeviceOrganiser(destination.Section("Organiser"), state.NullEventPublisher)
+		z, found := imported.Zone(1)
+		assert.True(t, found)
+		assert.Equal(t, "Kitchen", z.Name)
+	})
+
+	t.Run("reads documents from standard input and reports failures", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		code := runCommand([]string{"organisation", "import", "-"}, memory.New(), strings.NewReader(`{"Version":2}`), stdout, stderr)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr.String(), state.ErrUnsupportedVersion.Error())
+
+		code = runCommand([]string{"unknown"}, memory.New(), nil, stdout, stderr)
+		assert.Equal(t, 2, code)
+	})
+}
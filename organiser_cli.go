@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/shimmeringbee/controller/state"
+	"io"
+)
+
+func fsckOrganiserCommand(do *state.DeviceOrganiser, args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("organiser fsck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	repair := fs.Bool("repair", false, "repair any problems found")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	problems := do.CheckConsistency(nil, *repair)
+
+	for _, problem := range problems {
+		fmt.Fprintln(stdout, problem)
+	}
+
+	switch {
+	case len(problems) == 0:
+		fmt.Fprintln(stdout, "No problems found.")
+	case *repair:
+		fmt.Fprintf(stdout, "%d problems repaired.\n", len(problems))
+	default:
+		return fmt.Errorf("%d problems found, run with -repair to repair them", len(problems))
+	}
+
+	return nil
+}
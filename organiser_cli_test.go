@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_fsckOrganiserCommand(t *testing.T) {
+	t.Run("reports problems, and repairs them if requested", func(t *testing.T) {
+		section := memory.New()
+		do := state.NewDeviceOrganiser(section.Section("Organiser"), state.NullEventPublisher)
+		do.NewZone("Kitchen")
+		section.Section("Organiser", "Zones", "1").Set("ParentZone", int64(5))
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		code := runCommand([]string{"organiser", "fsck"}, section, nil, stdout, stderr)
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "orphan-zone: zone 1: parent 5 does not exist\n", stdout.String())
+		assert.Equal(t, "1 problems found, run with -repair to repair them\n", stderr.String())
+
+		stdout.Reset()
+
+		code = runCommand([]string{"organiser", "fsck", "-repair"}, section, nil, stdout, stderr)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "orphan-zone: zone 1: parent 5 does not exist (repaired)\n1 problems repaired.\n", stdout.String())
+
+		stdout.Reset()
+
+		code = runCommand([]string{"organiser", "fsck"}, section, nil, stdout, stderr)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "No problems found.\n", stdout.String())
+	})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/logwrap"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	reloadSectionLogging    = "logging"
+	reloadSectionInterfaces = "interfaces"
+	reloadSectionGateways   = "gateways"
+)
+
+// reloader re-reads the logging, interface and gateway configurations, starting, stopping or restarting only those
+// which have changed. If a changed interface or gateway fails to start, its previous configuration is started again.
+type reloader struct {
+	lock sync.Mutex
+
+	configDir string
+	logDir    string
+
+	logging     *reloadableLogging
+	loggingCfgs []config.LoggingConfig
+
+	interfaces []StartedInterface
+	gateways   []StartedGateway
+
+	startInterface func(config.InterfaceConfig) (func() error, error)
+	startGateway   func(config.GatewayConfig) (da.Gateway, func(), error)
+
+	mux       *state.GatewayMux
+	organiser *state.DeviceOrganiser
+	l         logwrap.Logger
+
+	last *config.ReloadReport
+}
+
+// Reload reloads all configuration, reporting each change made. Sections whose configuration can not be read are left
+// running as they are.
+func (r *reloader) Reload() config.ReloadReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := config.ReloadReport{Time: time.Now()}
+
+	r.reloadLogging(&report)
+	r.reloadInterfaces(&report)
+	r.reloadGateways(&report)
+
+	r.last = &report
+
+	return report
+}
+
+func (r *reloader) LastReload() (config.ReloadReport, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.last == nil {
+		return config.ReloadReport{}, false
+	}
+
+	return *r.last, true
+}
+
+// Interfaces returns the interfaces currently running.
+func (r *reloader) Interfaces() []StartedInterface {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]StartedInterface{}, r.interfaces...)
+}
+
+// Gateways returns the gateways currently running.
+func (r *reloader) Gateways() []StartedGateway {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]StartedGateway{}, r.gateways...)
+}
+
+func (r *reloader) reloadLogging(report *config.ReloadReport) {
+	cfgs, err := loadLoggingConfigurations(filepath.Join(r.configDir, "logging"))
+	if err != nil {
+		report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionLogging, Action: config.ReloadNotApplied, Error: err.Error()})
+		return
+	}
+
+	if reflect.DeepEqual(cfgs, r.loggingCfgs) {
+		return
+	}
+
+	impl, closer, err := constructLogging(cfgs, r.logDir, r.l)
+	if err != nil {
+		report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionLogging, Action: config.ReloadFailed, Error: err.Error()})
+		return
+	}
+
+	r.logging.Set(impl, closer)
+	r.loggingCfgs = cfgs
+
+	report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionLogging, Action: config.ReloadReconfigured})
+}
+
+func (r *reloader) reloadInterfaces(report *config.ReloadReport) {
+	cfgs, err := loadInterfaceConfigurations(filepath.Join(r.configDir, "interfaces"))
+	if err != nil {
+		report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Action: config.ReloadNotApplied, Error: err.Error()})
+		return
+	}
+
+	wanted := map[string]config.InterfaceConfig{}
+	for _, cfg := range cfgs {
+		wanted[cfg.Name] = cfg
+	}
+
+	var running []StartedInterface
+	existing := map[string]bool{}
+
+	for _, intf := range r.interfaces {
+		existing[intf.Name] = true
+		cfg, found := wanted[intf.Name]
+
+		if found && reflect.DeepEqual(cfg, intf.Config) {
+			running = append(running, intf)
+			continue
+		}
+
+		r.l.LogInfo(context.Background(), "Shutting down interface.", logwrap.Datum("interface", intf.Name))
+
+		if err := intf.Shutdown(); err != nil {
+			r.l.LogError(context.Background(), "Failed to shutdown interface.", logwrap.Err(err), logwrap.Datum("interface", intf.Name))
+		}
+
+		if !found {
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Name: intf.Name, Action: config.ReloadStopped})
+			continue
+		}
+
+		started, err := r.startInterfaceWithConfig(cfg)
+		if err == nil {
+			running = append(running, started)
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Name: intf.Name, Action: config.ReloadRestarted})
+			continue
+		}
+
+		if previous, restoreErr := r.startInterfaceWithConfig(intf.Config); restoreErr == nil {
+			running = append(running, previous)
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Name: intf.Name, Action: config.ReloadReverted, Error: err.Error()})
+		} else {
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Name: intf.Name, Action: config.ReloadFailed, Error: err.Error()})
+		}
+	}
+
+	for _, cfg := range cfgs {
+		if existing[cfg.Name] {
+			continue
+		}
+
+		if started, err := r.startInterfaceWithConfig(cfg); err != nil {
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Name: cfg.Name, Action: config.ReloadFailed, Error: err.Error()})
+		} else {
+			running = append(running, started)
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionInterfaces, Name: cfg.Name, Action: config.ReloadStarted})
+		}
+	}
+
+	r.interfaces = running
+}
+
+func (r *reloader) startInterfaceWithConfig(cfg config.InterfaceConfig) (StartedInterface, error) {
+	r.l.LogInfo(context.Background(), "Starting interface.", logwrap.Datum("interface", cfg.Name))
+
+	shutdown, err := r.startInterface(cfg)
+	if err != nil {
+		r.l.LogError(context.Background(), "Failed to start interface.", logwrap.Err(err), logwrap.Datum("interface", cfg.Name))
+		return StartedInterface{}, err
+	}
+
+	return StartedInterface{Name: cfg.Name, Config: cfg, Shutdown: shutdown}, nil
+}
+
+func (r *reloader) reloadGateways(report *config.ReloadReport) {
+	cfgs, err := loadGatewayConfigurations(filepath.Join(r.configDir, "gateways"))
+	if err != nil {
+		report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Action: config.ReloadNotApplied, Error: err.Error()})
+		return
+	}
+
+	wanted := map[string]config.GatewayConfig{}
+	for _, cfg := range cfgs {
+		wanted[cfg.Name] = cfg
+	}
+
+	var running []StartedGateway
+	existing := map[string]bool{}
+
+	for _, gw := range r.gateways {
+		existing[gw.Name] = true
+		cfg, found := wanted[gw.Name]
+
+		if found && reflect.DeepEqual(cfg, gw.Config) {
+			running = append(running, gw)
+			continue
+		}
+
+		r.l.LogInfo(context.Background(), "Shutting down gateway.", logwrap.Datum("gateway", gw.Name))
+
+		r.mux.Remove(gw.Name)
+
+		if err := gw.Gateway.Stop(context.Background()); err != nil {
+			r.l.LogError(context.Background(), "Failed to shutdown gateway.", logwrap.Err(err), logwrap.Datum("gateway", gw.Name))
+		}
+
+		gw.Shutdown()
+
+		if !found {
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Name: gw.Name, Action: config.ReloadStopped})
+			continue
+		}
+
+		started, err := r.startGatewayWithConfig(cfg)
+		if err == nil {
+			running = append(running, started)
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Name: gw.Name, Action: config.ReloadRestarted})
+			continue
+		}
+
+		if previous, restoreErr := r.startGatewayWithConfig(gw.Config); restoreErr == nil {
+			running = append(running, previous)
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Name: gw.Name, Action: config.ReloadReverted, Error: err.Error()})
+		} else {
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Name: gw.Name, Action: config.ReloadFailed, Error: err.Error()})
+		}
+	}
+
+	for _, cfg := range cfgs {
+		if existing[cfg.Name] {
+			continue
+		}
+
+		if started, err := r.startGatewayWithConfig(cfg); err != nil {
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Name: cfg.Name, Action: config.ReloadFailed, Error: err.Error()})
+		} else {
+			running = append(running, started)
+			report.Changes = append(report.Changes, config.ReloadChange{Section: reloadSectionGateways, Name: cfg.Name, Action: config.ReloadStarted})
+		}
+	}
+
+	r.gateways = running
+}
+
+func (r *reloader) startGatewayWithConfig(cfg config.GatewayConfig) (StartedGateway, error) {
+	r.l.LogInfo(context.Background(), "Starting gateway.", logwrap.Datum("gateway", cfg.Name))
+
+	gw, shutdown, err := r.startGateway(cfg)
+	if err != nil {
+		r.l.LogError(context.Background(), "Failed to start gateway.", logwrap.Err(err), logwrap.Datum("gateway", cfg.Name))
+		return StartedGateway{}, err
+	}
+
+	r.mux.Add(cfg.Name, gw)
+	r.organiser.AddDevice(gw.Self().Identifier().String())
+
+	return StartedGateway{Name: cfg.Name, Config: cfg, Gateway: gw, Shutdown: shutdown}, nil
+}
+
+func logReloadReport(ctx context.Context, l logwrap.Logger, report config.ReloadReport) {
+	if len(report.Changes) == 0 {
+		l.LogInfo(ctx, "Configuration reloaded, no changes found.")
+		return
+	}
+
+	for _, change := range report.Changes {
+		options := []logwrap.Option{logwrap.Datum("section", change.Section), logwrap.Datum("name", change.Name), logwrap.Datum("action", change.Action)}
+
+		if change.Error != "" {
+			l.LogWarn(ctx, "Configuration change could not be applied.", append(options, logwrap.Datum("error", change.Error))...)
+		} else {
+			l.LogInfo(ctx, "Configuration change applied.", options...)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/controller/config"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/da"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/logwrap/impl/discard"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeReloadConfig(t *testing.T, dir string, section string, files map[string]string) {
+	sectionDir := filepath.Join(dir, section)
+	assert.NoError(t, os.RemoveAll(sectionDir))
+	assert.NoError(t, os.MkdirAll(sectionDir, DefaultDirectoryPermissions))
+
+	for name, data := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(sectionDir, name+".json"), []byte(data), 0600))
+	}
+}
+
+func newTestReloader(t *testing.T) *reloader {
+	l := logwrap.New(discard.Discard())
+	do := state.NewDeviceOrganiser(memory.New(), state.NullEventPublisher)
+
+	return &reloader{
+		configDir: t.TempDir(),
+		logDir:    t.TempDir(),
+		logging:   newReloadableLogging(discard.Discard()),
+		mux:       state.NewGatewayMux(state.NullEventPublisher),
+		organiser: &do,
+		l:         l,
+	}
+}
+
+func Test_reloader_Reload(t *testing.T) {
+	t.Run("starts, stops and restarts only the interfaces which have changed", func(t *testing.T) {
+		r := newTestReloader(t)
+
+		var started []string
+		var stopped []string
+
+		r.startInterface = func(cfg config.InterfaceConfig) (func() error, error) {
+			port := cfg.Config.(*config.HTTPInterfaceConfig).Port
+			if port == 0 {
+				return nil, fmt.Errorf("no port")
+			}
+
+			started = append(started, cfg.Name)
+
+			return func() error {
+				stopped = append(stopped, cfg.Name)
+				return nil
+			}, nil
+		}
+
+		writeReloadConfig(t, r.configDir, "interfaces", map[string]string{
+			"same":    `{"Type": "http", "Config": {"Port": 1}}`,
+			"changed": `{"Type": "http", "Config": {"Port": 2}}`,
+			"removed": `{"Type": "http", "Config": {"Port": 3}}`,
+		})
+
+		report := r.Reload()
+		assert.Len(t, report.Changes, 3)
+		assert.ElementsMatch(t, []string{"same", "changed", "removed"}, started)
+
+		started = nil
+
+		writeReloadConfig(t, r.configDir, "interfaces", map[string]string{
+			"same":    `{"Type": "http", "Config": {"Port": 1}}`,
+			"changed": `{"Type": "http", "Config": {"Port": 4}}`,
+			"added":   `{"Type": "http", "Config": {"Port": 5}}`,
+			"broken":  `{"Type": "http", "Config": {"Port": 0}}`,
+		})
+
+		report = r.Reload()
+		assert.Equal(t, []config.ReloadChange{
+			{Section: "interfaces", Name: "changed", Action: config.ReloadRestarted},
+			{Section: "interfaces", Name: "removed", Action: config.ReloadStopped},
+			{Section: "interfaces", Name: "added", Action: config.ReloadStarted},
+			{Section: "interfaces", Name: "broken", Action: config.ReloadFailed, Error: "no port"},
+		}, report.Changes)
+
+		assert.Equal(t, []string{"changed", "added"}, started)
+		assert.Equal(t, []string{"changed", "removed"}, stopped)
+
+		var running []string
+		for _, intf := range r.Interfaces() {
+			running = append(running, intf.Name)
+		}
+
+		assert.ElementsMatch(t, []string{"same", "changed", "added"}, running)
+
+		last, found := r.LastReload()
+		assert.True(t, found)
+		assert.Equal(t, report, last)
+	})
+
+	t.Run("adds started gateways to the mux and organiser, and removes stopped gateways", func(t *testing.T) {
+		r := newTestReloader(t)
+
+		self := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		mg := &mocks.Gateway{}
+		defer mg.AssertExpectations(t)
+		mg.On("Self").Return(self)
+		mg.On("ReadEvent", mock.Anything).Return(nil, context.DeadlineExceeded).Maybe()
+		mg.On("Stop", mock.Anything).Return(nil).Once()
+
+		shutdown := 0
+
+		r.startGateway = func(cfg config.GatewayConfig) (da.Gateway, func(), error) {
+			return mg, func() { shutdown++ }, nil
+		}
+
+		writeReloadConfig(t, r.configDir, "gateways", map[string]string{
+			"one": `{"Type": "zda", "Config": {"Provider": {"Type": "zstack", "Config": {}}, "Network": {"PANID": 1}}}`,
+		})
+
+		report := r.Reload()
+		assert.Equal(t, []config.ReloadChange{{Section: "gateways", Name: "one", Action: config.ReloadStarted}}, report.Changes)
+
+		assert.Contains(t, r.mux.Gateways(), "one")
+
+		_, found := r.organiser.Device(self.Identifier().String())
+		assert.True(t, found)
+
+		writeReloadConfig(t, r.configDir, "gateways", nil)
+
+		report = r.Reload()
+		assert.Equal(t, []config.ReloadChange{{Section: "gateways", Name: "one", Action: config.ReloadStopped}}, report.Changes)
+
+		assert.Empty(t, r.mux.Gateways())
+		assert.Empty(t, r.Gateways())
+		assert.Equal(t, 1, shutdown)
+	})
+
+	t.Run("restarts the previous configuration of an interface which fails to start with its new one", func(t *testing.T) {
+		r := newTestReloader(t)
+
+		var started []int
+
+		r.startInterface = func(cfg config.InterfaceConfig) (func() error, error) {
+			port := cfg.Config.(*config.HTTPInterfaceConfig).Port
+			if port == 0 {
+				return nil, fmt.Errorf("no port")
+			}
+
+			started = append(started, port)
+
+			return func() error { return nil }, nil
+		}
+
+		writeReloadConfig(t, r.configDir, "interfaces", map[string]string{"http": `{"Type": "http", "Config": {"Port": 1}}`})
+		r.Reload()
+
+		writeReloadConfig(t, r.configDir, "interfaces", map[string]string{"http": `{"Type": "http", "Config": {"Port": 0}}`})
+
+		report := r.Reload()
+		assert.Equal(t, []config.ReloadChange{
+			{Section: "interfaces", Name: "http", Action: config.ReloadReverted, Error: "no port"},
+		}, report.Changes)
+
+		assert.Equal(t, []int{1, 1}, started)
+
+		running := r.Interfaces()
+		assert.Len(t, running, 1)
+		assert.Equal(t, 1, running[0].Config.Config.(*config.HTTPInterfaceConfig).Port)
+	})
+
+	t.Run("restarts the previous configuration of a gateway which fails to start with its new one", func(t *testing.T) {
+		r := newTestReloader(t)
+
+		self := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		mg := &mocks.Gateway{}
+		defer mg.AssertExpectations(t)
+		mg.On("Self").Return(self)
+		mg.On("ReadEvent", mock.Anything).Return(nil, context.DeadlineExceeded).Maybe()
+		mg.On("Stop", mock.Anything).Return(nil).Once()
+
+		r.startGateway = func(cfg config.GatewayConfig) (da.Gateway, func(), error) {
+			if cfg.Config.(*config.ZDAConfig).Network.PANID != 1 {
+				return nil, nil, fmt.Errorf("unable to form network")
+			}
+
+			return mg, func() {}, nil
+		}
+
+		writeReloadConfig(t, r.configDir, "gateways", map[string]string{
+			"one": `{"Type": "zda", "Config": {"Provider": {"Type": "zstack", "Config": {}}, "Network": {"PANID": 1}}}`,
+		})
+		r.Reload()
+
+		writeReloadConfig(t, r.configDir, "gateways", map[string]string{
+			"one": `{"Type": "zda", "Config": {"Provider": {"Type": "zstack", "Config": {}}, "Network": {"PANID": 2}}}`,
+		})
+
+		report := r.Reload()
+		assert.Equal(t, []config.ReloadChange{
+			{Section: "gateways", Name: "one", Action: config.ReloadReverted, Error: "unable to form network"},
+		}, report.Changes)
+
+		assert.Contains(t, r.mux.Gateways(), "one")
+		assert.Len(t, r.Gateways(), 1)
+	})
+
+	t.Run("reports sections which can not be read as not applied, leaving them running", func(t *testing.T) {
+		r := newTestReloader(t)
+
+		r.interfaces = []StartedInterface{{Name: "existing"}}
+
+		writeReloadConfig(t, r.configDir, "interfaces", map[string]string{"invalid": `{"Type": "carrier-pigeon"}`})
+		writeReloadConfig(t, r.configDir, "logging", map[string]string{"stdout": `{"Type": "stdout", "Config": {"Level": "debug"}}`})
+
+		report := r.Reload()
+		assert.Len(t, report.Changes, 2)
+
+		assert.Equal(t, config.ReloadChange{Section: "logging", Action: config.ReloadReconfigured}, report.Changes[0])
+
+		assert.Equal(t, "interfaces", report.Changes[1].Section)
+		assert.Equal(t, config.ReloadNotApplied, report.Changes[1].Action)
+		assert.NotEmpty(t, report.Changes[1].Error)
+
+		assert.Equal(t, []StartedInterface{{Name: "existing"}}, r.Interfaces())
+	})
+}
@@ -0,0 +1,392 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/persistence"
+	"github.com/shimmeringbee/persistence/converter"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCommandExpiry is how long a command is queued for if no expiry is requested.
+const DefaultCommandExpiry = 24 * time.Hour
+
+// DefaultCommandTimeout is the time permitted for each attempt to execute a queued command.
+const DefaultCommandTimeout = 10 * time.Second
+
+// ErrCommandRejected should be wrapped by a CommandExecutor if a command can never succeed, such that it is not retried.
+var ErrCommandRejected = errors.New("command rejected")
+
+type QueuedCommand struct {
+	Identifier string
+	Device     string
+	Capability string
+	Action     string
+	Payload    []byte `json:"-"`
+	Layer      string
+	Retention  layers.RetentionLevel
+	Queued     time.Time
+	Expires    time.Time
+	Attempts   int
+	LastError  string `json:",omitempty"`
+
+	sequence int64
+}
+
+// CommandExecutor attempts to execute a queued command.
+type CommandExecutor func(ctx context.Context, c QueuedCommand) error
+
+// CommandQueue holds actions for devices which are not currently reachable, retrying them when the device is next
+// seen to be active on the event bus. Commands are persisted, such that they survive restarts.
+type CommandQueue struct {
+	lock     *sync.Mutex
+	commands map[string][]*QueuedCommand
+	running  map[string]bool
+	sequence int64
+
+	section  persistence.Section
+	executor CommandExecutor
+
+	subscriber EventSubscriber
+	eventCh    chan any
+	now        func() time.Time
+}
+
+func NewCommandQueue(s persistence.Section, e CommandExecutor) *CommandQueue {
+	q := &CommandQueue{
+		lock:     &sync.Mutex{},
+		commands: map[string][]*QueuedCommand{},
+		running:  map[string]bool{},
+		section:  s,
+		executor: e,
+		now:      time.Now,
+	}
+
+	q.load()
+
+	return q
+}
+
+// Enqueue adds a command to a devices queue, superseding any queued command for the same capability and action.
+func (q *CommandQueue) Enqueue(device string, capability string, action string, payload []byte, layer string, retention layers.RetentionLevel, expiry time.Duration) (QueuedCommand, error) {
+	id, err := randomOperationIdentifier()
+	if err != nil {
+		return QueuedCommand{}, err
+	}
+
+	if expiry <= 0 {
+		expiry = DefaultCommandExpiry
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := q.now()
+	q.sequence++
+
+	cmd := &QueuedCommand{
+		Identifier: id,
+		Device:     device,
+		Capability: capability,
+		Action:     action,
+		Payload:    payload,
+		Layer:      layer,
+		Retention:  retention,
+		Queued:     now,
+		Expires:    now.Add(expiry),
+		sequence:   q.sequence,
+	}
+
+	var retained []*QueuedCommand
+
+	for _, existing := range q.commands[device] {
+		if existing.Capability == capability && existing.Action == action {
+			q.section.Section(device).SectionDelete(existing.Identifier)
+		} else {
+			retained = append(retained, existing)
+		}
+	}
+
+	q.commands[device] = append(retained, cmd)
+	q.persist(cmd)
+
+	return *cmd, nil
+}
+
+// Commands returns the unexpired commands queued for a device, in the order they will be executed.
+func (q *CommandQueue) Commands(device string) []QueuedCommand {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.expire(device)
+
+	commands := []QueuedCommand{}
+
+	for _, cmd := range q.commands[device] {
+		commands = append(commands, *cmd)
+	}
+
+	return commands
+}
+
+// Cancel removes a queued command from a device.
+func (q *CommandQueue) Cancel(device string, id string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, cmd := range q.commands[device] {
+		if cmd.Identifier == id {
+			q.remove(cmd)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// Clear removes all queued commands from a device.
+func (q *CommandQueue) Clear(device string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.commands, device)
+	q.section.SectionDelete(device)
+}
+
+// Reassign moves the commands queued for a device to another device, such as when a device has been replaced. Where
+// both devices have a command queued for the same capability and action, the most recently queued is retained.
+func (q *CommandQueue) Reassign(device string, newDevice string) {
+	if device == newDevice {
+		return
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	moving := q.commands[device]
+
+	delete(q.commands, device)
+	q.section.SectionDelete(device)
+
+	for _, cmd := range moving {
+		superseded := false
+
+		for _, existing := range q.commands[newDevice] {
+			if existing.Capability == cmd.Capability && existing.Action == cmd.Action {
+				if existing.sequence > cmd.sequence {
+					superseded = true
+				} else {
+					q.remove(existing)
+				}
+			}
+		}
+
+		if superseded {
+			continue
+		}
+
+		cmd.Device = newDevice
+		q.commands[newDevice] = append(q.commands[newDevice], cmd)
+		q.persist(cmd)
+	}
+
+	sort.Slice(q.commands[newDevice], func(i, j int) bool {
+		return q.commands[newDevice][i].sequence < q.commands[newDevice][j].sequence
+	})
+}
+
+// Retry attempts to execute the commands queued for a device in order, stopping at the first failure. Only one retry
+// may be in progress for a device at a time.
+func (q *CommandQueue) Retry(device string) {
+	q.lock.Lock()
+
+	if q.running[device] || len(q.commands[device]) == 0 {
+		q.lock.Unlock()
+		return
+	}
+
+	q.running[device] = true
+	q.lock.Unlock()
+
+	go q.retry(device)
+}
+
+func (q *CommandQueue) retry(device string) {
+	defer func() {
+		q.lock.Lock()
+		delete(q.running, device)
+		q.lock.Unlock()
+	}()
+
+	for {
+		q.lock.Lock()
+		q.expire(device)
+
+		if len(q.commands[device]) == 0 {
+			q.lock.Unlock()
+			return
+		}
+
+		cmd := q.commands[device][0]
+		q.lock.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultCommandTimeout)
+		err := q.executor(ctx, *cmd)
+		cancel()
+
+		q.lock.Lock()
+
+		if err == nil || errors.Is(err, ErrCommandRejected) {
+			q.remove(cmd)
+			q.lock.Unlock()
+			continue
+		}
+
+		if q.present(cmd) {
+			cmd.Attempts++
+			cmd.LastError = err.Error()
+			q.persist(cmd)
+		}
+
+		q.lock.Unlock()
+		return
+	}
+}
+
+// Start subscribes to the event bus, retrying a devices queued commands when it raises any event, and moving queued
+// commands to a new device when a device is replaced.
+func (q *CommandQueue) Start(s EventSubscriber) {
+	q.subscriber = s
+	q.eventCh = make(chan any, 100)
+	s.Subscribe(q.eventCh)
+
+	go func(ch chan any) {
+		for e := range ch {
+			q.updateOnEvent(e)
+		}
+	}(q.eventCh)
+}
+
+func (q *CommandQueue) Stop() {
+	if q.subscriber == nil {
+		return
+	}
+
+	q.subscriber.Unsubscribe(q.eventCh)
+	close(q.eventCh)
+	q.subscriber = nil
+}
+
+func (q *CommandQueue) updateOnEvent(e any) {
+	if replaced, ok := e.(DeviceReplaced); ok {
+		q.Reassign(replaced.OldIdentifier, replaced.NewIdentifier)
+	} else if d, found := EventDevice(e); found {
+		q.Retry(d.Identifier().String())
+	}
+}
+
+func (q *CommandQueue) expire(device string) {
+	now := q.now()
+
+	for _, cmd := range q.commands[device] {
+		if now.After(cmd.Expires) {
+			q.remove(cmd)
+		}
+	}
+}
+
+func (q *CommandQueue) present(cmd *QueuedCommand) bool {
+	for _, existing := range q.commands[cmd.Device] {
+		if existing == cmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (q *CommandQueue) remove(cmd *QueuedCommand) {
+	var retained []*QueuedCommand
+
+	for _, existing := range q.commands[cmd.Device] {
+		if existing != cmd {
+			retained = append(retained, existing)
+		}
+	}
+
+	if len(retained) == 0 {
+		delete(q.commands, cmd.Device)
+		q.section.SectionDelete(cmd.Device)
+	} else {
+		q.commands[cmd.Device] = retained
+		q.section.Section(cmd.Device).SectionDelete(cmd.Identifier)
+	}
+}
+
+func (q *CommandQueue) persist(cmd *QueuedCommand) {
+	s := q.section.Section(cmd.Device, cmd.Identifier)
+
+	s.Set("Capability", cmd.Capability)
+	s.Set("Action", cmd.Action)
+	s.Set("Payload", cmd.Payload)
+	s.Set("Layer", cmd.Layer)
+	s.Set("Retention", int64(cmd.Retention))
+	converter.Store(s, "Queued", cmd.Queued, converter.TimeEncoder)
+	converter.Store(s, "Expires", cmd.Expires, converter.TimeEncoder)
+	s.Set("Attempts", int64(cmd.Attempts))
+	s.Set("LastError", cmd.LastError)
+	s.Set("Sequence", cmd.sequence)
+}
+
+func (q *CommandQueue) load() {
+	for _, device := range q.section.SectionKeys() {
+		ds := q.section.Section(device)
+
+		var commands []*QueuedCommand
+
+		for _, id := range ds.SectionKeys() {
+			s := ds.Section(id)
+
+			capability, _ := s.String("Capability")
+			action, _ := s.String("Action")
+			payload, _ := s.Bytes("Payload")
+			layer, _ := s.String("Layer")
+			retention, _ := s.Int("Retention")
+			queued, _ := converter.Retrieve(s, "Queued", converter.TimeDecoder)
+			expires, _ := converter.Retrieve(s, "Expires", converter.TimeDecoder)
+			attempts, _ := s.Int("Attempts")
+			lastError, _ := s.String("LastError")
+			sequence, _ := s.Int("Sequence")
+
+			commands = append(commands, &QueuedCommand{
+				Identifier: id,
+				Device:     device,
+				Capability: capability,
+				Action:     action,
+				Payload:    payload,
+				Layer:      layer,
+				Retention:  layers.RetentionLevel(retention),
+				Queued:     queued,
+				Expires:    expires,
+				Attempts:   int(attempts),
+				LastError:  lastError,
+				sequence:   sequence,
+			})
+
+			if sequence > q.sequence {
+				q.sequence = sequence
+			}
+		}
+
+		sort.Slice(commands, func(i, j int) bool {
+			return commands[i].sequence < commands[j].sequence
+		})
+
+		if len(commands) > 0 {
+			q.commands[device] = commands
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/controller/layers"
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingExecutor struct {
+	lock     sync.Mutex
+	executed []QueuedCommand
+	err      error
+}
+
+func (r *recordingExecutor) execute(_ context.Context, c QueuedCommand) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.executed = append(r.executed, c)
+	return r.err
+}
+
+func (r *recordingExecutor) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.executed)
+}
+
+func TestCommandQueue(t *testing.T) {
+	t.Run("Enqueue adds commands in order", func(t *testing.T) {
+		q := NewCommandQueue(memory.New(), (&recordingExecutor{}).execute)
+
+		first, err := q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+		assert.NoError(t, err)
+
+		second, err := q.Enqueue("device", "Identify", "Identify", []byte(`{"Duration":1000}`), "http", layers.OneShot, time.Hour)
+		assert.NoError(t, err)
+
+		commands := q.Commands("device")
+		assert.Equal(t, []QueuedCommand{first, second}, commands)
+	})
+
+	t.Run("Enqueue supersedes commands for the same capability and action", func(t *testing.T) {
+		q := NewCommandQueue(memory.New(), (&recordingExecutor{}).execute)
+
+		q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+		off, _ := q.Enqueue("device", "OnOff", "Off", nil, "http", layers.OneShot, time.Hour)
+		on, _ := q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		assert.Equal(t, []QueuedCommand{off, on}, q.Commands("device"))
+	})
+
+	t.Run("expired commands are removed", func(t *testing.T) {
+		now := time.Now()
+
+		q := NewCommandQueue(memory.New(), (&recordingExecutor{}).execute)
+		q.now = func() time.Time { return now }
+
+		q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Minute)
+		identify, _ := q.Enqueue("device", "Identify", "Identify", nil, "http", layers.OneShot, time.Hour)
+
+		now = now.Add(2 * time.Minute)
+
+		assert.Equal(t, []QueuedCommand{identify}, q.Commands("device"))
+	})
+
+	t.Run("Cancel removes a command", func(t *testing.T) {
+		q := NewCommandQueue(memory.New(), (&recordingExecutor{}).execute)
+
+		on, _ := q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		assert.NoError(t, q.Cancel("device", on.Identifier))
+		assert.Empty(t, q.Commands("device"))
+		assert.ErrorIs(t, q.Cancel("device", on.Identifier), ErrNotFound)
+	})
+
+	t.Run("Clear removes all commands", func(t *testing.T) {
+		q := NewCommandQueue(memory.New(), (&recordingExecutor{}).execute)
+
+		q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+		q.Enqueue("device", "Identify", "Identify", nil, "http", layers.OneShot, time.Hour)
+
+		q.Clear("device")
+		assert.Empty(t, q.Commands("device"))
+	})
+
+	t.Run("Reassign moves commands to another device, retaining the most recent of any duplicates", func(t *testing.T) {
+		s := memory.New()
+		q := NewCommandQueue(s, (&recordingExecutor{}).execute)
+
+		q.Enqueue("new", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+		identify, _ := q.Enqueue("old", "Identify", "Identify", nil, "http", layers.OneShot, time.Hour)
+		on, _ := q.Enqueue("old", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		q.Reassign("old", "new")
+
+		identify.Device = "new"
+		on.Device = "new"
+
+		assert.Empty(t, q.Commands("old"))
+		assert.Equal(t, []QueuedCommand{identify, on}, q.Commands("new"))
+
+		reloaded := NewCommandQueue(s, (&recordingExecutor{}).execute)
+		assert.Empty(t, reloaded.Commands("old"))
+		assert.Len(t, reloaded.Commands("new"), 2)
+	})
+
+	t.Run("Retry executes commands in order and removes them on success", func(t *testing.T) {
+		re := &recordingExecutor{}
+		q := NewCommandQueue(memory.New(), re.execute)
+
+		on, _ := q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+		identify, _ := q.Enqueue("device", "Identify", "Identify", nil, "http", layers.OneShot, time.Hour)
+
+		q.Retry("device")
+
+		assert.Eventually(t, func() bool { return len(q.Commands("device")) == 0 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []QueuedCommand{on, identify}, re.executed)
+	})
+
+	t.Run("Retry stops at the first failure and records the error", func(t *testing.T) {
+		re := &recordingExecutor{err: errors.New("timeout")}
+		q := NewCommandQueue(memory.New(), re.execute)
+
+		q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+		q.Enqueue("device", "Identify", "Identify", nil, "http", layers.OneShot, time.Hour)
+
+		q.Retry("device")
+
+		assert.Eventually(t, func() bool {
+			commands := q.Commands("device")
+			return len(commands) == 2 && commands[0].Attempts == 1
+		}, time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, 1, re.count())
+		assert.Equal(t, "timeout", q.Commands("device")[0].LastError)
+	})
+
+	t.Run("Retry drops rejected commands", func(t *testing.T) {
+		re := &recordingExecutor{err: fmt.Errorf("%w: bad data", ErrCommandRejected)}
+		q := NewCommandQueue(memory.New(), re.execute)
+
+		q.Enqueue("device", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		q.Retry("device")
+
+		assert.Eventually(t, func() bool { return len(q.Commands("device")) == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("commands are retried when the device raises an event", func(t *testing.T) {
+		d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		re := &recordingExecutor{}
+		q := NewCommandQueue(memory.New(), re.execute)
+
+		eb := NewEventBus()
+		q.Start(eb)
+		defer q.Stop()
+
+		q.Enqueue(d.Identifier().String(), "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		eb.Publish(capabilities.PowerStatusUpdate{Device: d})
+
+		assert.Eventually(t, func() bool { return re.count() == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("commands are moved to the new device when a device is replaced", func(t *testing.T) {
+		q := NewCommandQueue(memory.New(), (&recordingExecutor{}).execute)
+
+		eb := NewEventBus()
+		q.Start(eb)
+		defer q.Stop()
+
+		q.Enqueue("old", "OnOff", "On", nil, "http", layers.OneShot, time.Hour)
+
+		eb.Publish(DeviceReplaced{OldIdentifier: "old", NewIdentifier: "new"})
+
+		assert.Eventually(t, func() bool {
+			return len(q.Commands("old")) == 0 && len(q.Commands("new")) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("commands are persisted and reloaded in order", func(t *testing.T) {
+		s := memory.New()
+		q := NewCommandQueue(s, (&recordingExecutor{}).execute)
+
+		on, _ := q.Enqueue("device", "OnOff", "On", []byte(`{}`), "http", layers.Maintain, time.Hour)
+		identify, _ := q.Enqueue("device", "Identify", "Identify", nil, "mqtt", layers.OneShot, time.Hour)
+
+		reloaded := NewCommandQueue(s, (&recordingExecutor{}).execute)
+		commands := reloaded.Commands("device")
+
+		assert.Len(t, commands, 2)
+		assert.Equal(t, on.Identifier, commands[0].Identifier)
+		assert.Equal(t, []byte(`{}`), commands[0].Payload)
+		assert.Equal(t, layers.Maintain, commands[0].Retention)
+		assert.Equal(t, on.Expires.UnixMilli(), commands[0].Expires.UnixMilli())
+		assert.Equal(t, identify.Identifier, commands[1].Identifier)
+		assert.Equal(t, "mqtt", commands[1].Layer)
+
+		next, _ := reloaded.Enqueue("device", "OnOff", "Off", nil, "http", layers.OneShot, time.Hour)
+		assert.Equal(t, next.Identifier, reloaded.Commands("device")[2].Identifier)
+	})
+}
@@ -0,0 +1,151 @@
+package state
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var aliasPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug converts a name into a URL safe alias, consisting of lowercase letters, numbers and hyphens.
+func Slug(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// SetDeviceAlias sets the alias a device can be referred to by, an empty alias reverts to an alias derived from the
+// devices name.
+func (d *DeviceOrganiser) SetDeviceAlias(id string, alias string) error {
+	defer d.record("SetDeviceAlias")()
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	dm, found := d.devices[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	if alias == "" {
+		d.setAlias(id, dm, d.uniqueAlias(id, Slug(dm.Name)), false)
+	} else {
+		if !aliasPattern.MatchString(alias) {
+			return ErrInvalidAlias
+		}
+
+		if !d.aliasAvailable(id, alias) {
+			return ErrAliasInUse
+		}
+
+		d.setAlias(id, dm, alias, true)
+	}
+
+	d.publishDeviceMetadataUpdate(id, dm)
+
+	return nil
+}
+
+// ResolveDevice returns the identifier of the device referred to by its identifier, alias or name, in that order of
+// precedence. Names are matched ignoring case, and must only match a single device.
+func (d *DeviceOrganiser) ResolveDevice(ref string) (string, error) {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	if _, found := d.devices[ref]; found {
+		return ref, nil
+	}
+
+	if owner, found := d.aliasOwner(ref); found {
+		return owner, nil
+	}
+
+	var matches []string
+
+	for id, dm := range d.devices {
+		if dm.Name != "" && strings.EqualFold(dm.Name, ref) {
+			matches = append(matches, id)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", ErrNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrAmbiguous, strings.Join(matches, ", "))
+	}
+}
+
+func (d *DeviceOrganiser) aliasOwner(alias string) (string, bool) {
+	for id, dm := range d.devices {
+		if dm.Alias == alias {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// aliasAvailable reports if a device may use an alias, which must not be the alias or identifier of another device as
+// identifiers are resolved before aliases.
+func (d *DeviceOrganiser) aliasAvailable(id string, alias string) bool {
+	if _, found := d.devices[alias]; found && alias != id {
+		return false
+	}
+
+	owner, found := d.aliasOwner(alias)
+
+	return !found || owner == id
+}
+
+// uniqueAlias returns the base alias, suffixed with a number if it is not available to the device.
+func (d *DeviceOrganiser) uniqueAlias(id string, base string) string {
+	if base == "" {
+		return ""
+	}
+
+	candidate := base
+
+	for n := 2; ; n++ {
+		if d.aliasAvailable(id, candidate) {
+			return candidate
+		}
+
+		candidate = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+func (d *DeviceOrganiser) setAlias(id string, dm *DeviceMetadata, alias string, custom bool) {
+	dm.Alias = alias
+	dm.customAlias = custom
+
+	if !d.loading {
+		s := d.deviceConfig.Section(id)
+		s.Set("Alias", alias)
+		s.Set("CustomAlias", custom)
+	}
+}
+
+// loadAliases restores persisted aliases, deriving aliases for any devices without one once all persisted aliases
+// are known.
+func (d *DeviceOrganiser) loadAliases() {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	for id, dm := range d.devices {
+		s := d.deviceConfig.Section(id)
+
+		if alias, found := s.String("Alias"); found {
+			custom, _ := s.Bool("CustomAlias")
+			d.setAlias(id, dm, alias, custom)
+		}
+	}
+
+	for id, dm := range d.devices {
+		if dm.Alias == "" && dm.Name != "" {
+			d.setAlias(id, dm, d.uniqueAlias(id, Slug(dm.Name)), false)
+		}
+	}
+}
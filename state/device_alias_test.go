@@ -0,0 +1,154 @@
+package state
+
+import (
+	"errors"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	t.Run("converts names to lowercase hyphenated aliases", func(t *testing.T) {
+		assert.Equal(t, "kitchen-lamp", Slug("Kitchen Lamp"))
+		assert.Equal(t, "hall-sensor-2", Slug("  Hall / Sensor #2 "))
+		assert.Equal(t, "", Slug("!!!"))
+	})
+}
+
+func TestDeviceOrganiser_Aliases(t *testing.T) {
+	t.Run("naming a device derives a unique alias", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		_ = do.NameDevice("one", "Kitchen Lamp")
+		_ = do.NameDevice("two", "Kitchen lamp")
+
+		one, _ := do.Device("one")
+		assert.Equal(t, "kitchen-lamp", one.Alias)
+
+		two, _ := do.Device("two")
+		assert.Equal(t, "kitchen-lamp-2", two.Alias)
+	})
+
+	t.Run("a custom alias is retained when the device is renamed, until cleared", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+
+		assert.NoError(t, do.SetDeviceAlias("one", "lamp"))
+		_ = do.NameDevice("one", "Kitchen Lamp")
+
+		one, _ := do.Device("one")
+		assert.Equal(t, "lamp", one.Alias)
+
+		assert.NoError(t, do.SetDeviceAlias("one", ""))
+
+		one, _ = do.Device("one")
+		assert.Equal(t, "kitchen-lamp", one.Alias)
+	})
+
+	t.Run("rejects invalid or duplicate aliases", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		assert.ErrorIs(t, do.SetDeviceAlias("one", "Not Valid"), ErrInvalidAlias)
+		assert.ErrorIs(t, do.SetDeviceAlias("missing", "lamp"), ErrNotFound)
+
+		assert.NoError(t, do.SetDeviceAlias("one", "lamp"))
+		assert.ErrorIs(t, do.SetDeviceAlias("two", "lamp"), ErrAliasInUse)
+	})
+
+	t.Run("rejects aliases which are the identifier of another device, and does not derive them", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("lamp")
+
+		assert.ErrorIs(t, do.SetDeviceAlias("one", "lamp"), ErrAliasInUse)
+		assert.NoError(t, do.SetDeviceAlias("lamp", "lamp"))
+
+		_ = do.NameDevice("one", "Lamp")
+
+		one, _ := do.Device("one")
+		assert.Equal(t, "lamp-2", one.Alias)
+
+		id, err := do.ResolveDevice("lamp")
+		assert.NoError(t, err)
+		assert.Equal(t, "lamp", id)
+	})
+
+	t.Run("alias errors are device errors", func(t *testing.T) {
+		var deviceError DeviceError
+
+		for _, err := range []error{ErrInvalidAlias, ErrAliasInUse, ErrAmbiguous, ErrSameDevice} {
+			assert.ErrorAs(t, err, &deviceError)
+		}
+	})
+
+	t.Run("publishes a metadata update when the alias is set", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		mep.On("Publish", DeviceMetadataUpdate{Identifier: "one", Alias: "lamp"})
+
+		do := NewDeviceOrganiser(memory.New(), mep)
+		do.AddDevice("one")
+
+		assert.NoError(t, do.SetDeviceAlias("one", "lamp"))
+	})
+
+	t.Run("resolves devices by identifier, alias and then name", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		do.AddDevice("three")
+
+		_ = do.NameDevice("one", "Lamp")
+		_ = do.NameDevice("two", "two")
+		_ = do.SetDeviceAlias("two", "hall")
+		_ = do.NameDevice("three", "lamp")
+
+		id, err := do.ResolveDevice("two")
+		assert.NoError(t, err)
+		assert.Equal(t, "two", id)
+
+		id, err = do.ResolveDevice("hall")
+		assert.NoError(t, err)
+		assert.Equal(t, "two", id)
+
+		id, err = do.ResolveDevice("lamp-2")
+		assert.NoError(t, err)
+		assert.Equal(t, "three", id)
+
+		_, err = do.ResolveDevice("LAMP")
+		assert.True(t, errors.Is(err, ErrAmbiguous))
+
+		_, err = do.ResolveDevice("missing")
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("aliases are persisted and reloaded", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		_ = do.NameDevice("one", "Lamp")
+		_ = do.NameDevice("two", "Lamp")
+		_ = do.SetDeviceAlias("one", "reading-lamp")
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+
+		one, _ := reloaded.Device("one")
+		assert.Equal(t, "reading-lamp", one.Alias)
+
+		two, _ := reloaded.Device("two")
+		assert.Equal(t, "lamp-2", two.Alias)
+
+		_ = reloaded.NameDevice("one", "Desk Lamp")
+
+		one, _ = reloaded.Device("one")
+		assert.Equal(t, "reading-lamp", one.Alias)
+	})
+}
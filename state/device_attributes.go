@@ -0,0 +1,202 @@
+package state
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/persistence"
+	"sort"
+	"strings"
+)
+
+// SetDeviceTags replaces the tags of a device. Tags are trimmed of whitespace, and empty or duplicate tags are dropped.
+func (d *DeviceOrganiser) SetDeviceTags(id string, tags []string) error {
+	defer d.record("SetDeviceTags")()
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	dm, found := d.devices[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	dm.Tags = normaliseTags(tags)
+
+	if !d.loading {
+		s := d.deviceConfig.Section(id)
+		s.SectionDelete("Tags")
+
+		for _, tag := range dm.Tags {
+			s.Section("Tags", tag)
+		}
+	}
+
+	d.publishDeviceMetadataUpdate(id, dm)
+
+	return nil
+}
+
+// UpdateDeviceAttributes merges attributes into those of a device, an attribute with a nil value is removed. Values
+// must be strings, numbers or booleans, numbers are stored as float64.
+func (d *DeviceOrganiser) UpdateDeviceAttributes(id string, attributes map[string]any) error {
+	defer d.record("UpdateDeviceAttributes")()
+
+	normalised, err := normaliseAttributes(attributes)
+	if err != nil {
+		return err
+	}
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	dm, found := d.devices[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	dm.Attributes = mergeAttributes(dm.Attributes, normalised, d.deviceConfig.Section(id, "Attributes"), !d.loading)
+
+	d.publishDeviceMetadataUpdate(id, dm)
+
+	return nil
+}
+
+// HasTags reports if the device has all the tags provided.
+func (dm DeviceMetadata) HasTags(tags []string) bool {
+	for _, wanted := range tags {
+		found := false
+
+		for _, tag := range dm.Tags {
+			if tag == wanted {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mergeAttributes applies updates to a set of attributes, removing those updated to nil, and optionally persisting the
+// changes to a section.
+func mergeAttributes(attributes map[string]any, updates map[string]any, s persistence.Section, persist bool) map[string]any {
+	for key, value := range updates {
+		if value == nil {
+			delete(attributes, key)
+
+			if persist {
+				s.Delete(key)
+			}
+
+			continue
+		}
+
+		if attributes == nil {
+			attributes = map[string]any{}
+		}
+
+		attributes[key] = value
+
+		if persist {
+			s.Set(key, value)
+		}
+	}
+
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	return attributes
+}
+
+func normaliseTags(tags []string) []string {
+	seen := map[string]bool{}
+	var normalised []string
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalised = append(normalised, tag)
+	}
+
+	sort.Strings(normalised)
+
+	return normalised
+}
+
+func normaliseAttributes(attributes map[string]any) (map[string]any, error) {
+	normalised := map[string]any{}
+
+	for key, value := range attributes {
+		if strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%w: empty key", ErrInvalidAttribute)
+		}
+
+		v, ok := normaliseAttribute(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAttribute, key)
+		}
+
+		normalised[key] = v
+	}
+
+	return normalised, nil
+}
+
+func normaliseAttribute(value any) (any, bool) {
+	switch v := value.(type) {
+	case nil, string, bool, float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	default:
+		return nil, false
+	}
+}
+
+func (d *DeviceOrganiser) loadDeviceAttributes() {
+	for id := range d.devices {
+		s := d.deviceConfig.Section(id)
+
+		if tags := s.Section("Tags").SectionKeys(); len(tags) > 0 {
+			d.SetDeviceTags(id, tags)
+		}
+
+		if attributes := loadAttributes(s.Section("Attributes")); len(attributes) > 0 {
+			d.UpdateDeviceAttributes(id, attributes)
+		}
+	}
+}
+
+// loadAttributes reads attributes persisted in a section, restoring their types.
+func loadAttributes(s persistence.Section) map[string]any {
+	attributes := map[string]any{}
+
+	for _, key := range s.Keys() {
+		switch s.Type(key) {
+		case persistence.String:
+			attributes[key], _ = s.String(key)
+		case persistence.Bool:
+			attributes[key], _ = s.Bool(key)
+		case persistence.Float:
+			attributes[key], _ = s.Float(key)
+		case persistence.Int:
+			v, _ := s.Int(key)
+			attributes[key] = float64(v)
+		}
+	}
+
+	return attributes
+}
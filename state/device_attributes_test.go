@@ -0,0 +1,85 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDeviceOrganiser_Tags(t *testing.T) {
+	t.Run("SetDeviceTags stores normalised tags and publishes an update", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		mep.On("Publish", DeviceMetadataUpdate{Identifier: "one", Tags: []string{"lighting", "outdoor"}})
+
+		do := NewDeviceOrganiser(memory.New(), mep)
+		do.AddDevice("one")
+
+		assert.NoError(t, do.SetDeviceTags("one", []string{" outdoor", "lighting", "", "outdoor"}))
+
+		dm, _ := do.Device("one")
+		assert.Equal(t, []string{"lighting", "outdoor"}, dm.Tags)
+		assert.True(t, dm.HasTags([]string{"outdoor"}))
+		assert.False(t, dm.HasTags([]string{"outdoor", "heating"}))
+	})
+
+	t.Run("SetDeviceTags errors if the device does not exist", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		assert.ErrorIs(t, do.SetDeviceTags("missing", []string{"tag"}), ErrNotFound)
+	})
+}
+
+func TestDeviceOrganiser_Attributes(t *testing.T) {
+	t.Run("UpdateDeviceAttributes merges attributes, removing those set to nil", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+
+		assert.NoError(t, do.UpdateDeviceAttributes("one", map[string]any{"circuit": 12, "installed": "2024-03-01", "notes": "loft"}))
+		assert.NoError(t, do.UpdateDeviceAttributes("one", map[string]any{"notes": nil, "rcd": true}))
+
+		dm, _ := do.Device("one")
+		assert.Equal(t, map[string]any{"circuit": float64(12), "installed": "2024-03-01", "rcd": true}, dm.Attributes)
+	})
+
+	t.Run("UpdateDeviceAttributes rejects unsupported values without applying any", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+
+		err := do.UpdateDeviceAttributes("one", map[string]any{"circuit": 12, "phases": []int{1, 2}})
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+
+		dm, _ := do.Device("one")
+		assert.Nil(t, dm.Attributes)
+
+		assert.ErrorIs(t, do.UpdateDeviceAttributes("missing", map[string]any{"circuit": 12}), ErrNotFound)
+	})
+
+	t.Run("Device returns a copy which does not share attributes", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		_ = do.UpdateDeviceAttributes("one", map[string]any{"circuit": 12})
+
+		dm, _ := do.Device("one")
+		dm.Attributes["circuit"] = 13
+
+		dm, _ = do.Device("one")
+		assert.Equal(t, float64(12), dm.Attributes["circuit"])
+	})
+
+	t.Run("tags and attributes are persisted and reloaded", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		_ = do.SetDeviceTags("one", []string{"outdoor", "lighting"})
+		_ = do.UpdateDeviceAttributes("one", map[string]any{"circuit": 12, "installed": "2024-03-01", "rcd": true, "notes": "loft"})
+		_ = do.UpdateDeviceAttributes("one", map[string]any{"notes": nil})
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+
+		dm, _ := reloaded.Device("one")
+		assert.Equal(t, []string{"lighting", "outdoor"}, dm.Tags)
+		assert.Equal(t, map[string]any{"circuit": float64(12), "installed": "2024-03-01", "rcd": true}, dm.Attributes)
+	})
+}
@@ -3,23 +3,36 @@ package state
 import (
 	"fmt"
 	"github.com/shimmeringbee/persistence"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Zone struct {
-	Identifier int
-	Name       string
-	ParentZone int
+	Identifier  int
+	Name        string
+	ParentZone  int
+	Kind        ZoneKind         `json:",omitempty"`
+	Icon        string           `json:",omitempty"`
+	Attributes  map[string]any   `json:",omitempty"`
+	Coordinates *ZoneCoordinates `json:",omitempty"`
 
 	SubZones []int    `json:"-"`
 	Devices  []string `json:"-"`
 }
 
 type DeviceMetadata struct {
-	Name  string `json:",omitempty"`
-	Zones []int  `json:",omitempty"`
+	Name       string         `json:",omitempty"`
+	Alias      string         `json:",omitempty"`
+	Zones      []int          `json:",omitempty"`
+	Sleepy     bool           `json:",omitempty"`
+	Tags       []string       `json:",omitempty"`
+	Attributes map[string]any `json:",omitempty"`
+
+	customAlias bool
+	removed     time.Time
 }
 
 type DeviceOrganiser struct {
@@ -35,6 +48,10 @@ type DeviceOrganiser struct {
 	zoneConfig   persistence.Section
 	deviceConfig persistence.Section
 
+	history   *organisationHistory
+	actor     string
+	recording bool
+
 	loading        bool
 	eventPublisher EventPublisher
 }
@@ -52,6 +69,35 @@ const (
 	ErrOrphanZone         = ZoneError("operation would result in orphaned zone")
 	ErrHasDevices         = ZoneError("zone has devices")
 	ErrMustHaveSameParent = ZoneError("zones being reordered must have same parent")
+	ErrInvalidAttribute   = ZoneError("attribute values must be a string, number or boolean")
+	ErrInvalidZoneKind    = ZoneError("zone kind must be one of site, floor, room or outdoor")
+)
+
+type OrganisationError string
+
+func (e OrganisationError) Error() string {
+	return string(e)
+}
+
+const (
+	ErrUnsupportedVersion    = OrganisationError("organisation document version is not supported")
+	ErrUnsupportedFormat     = OrganisationError("organisation document format must be json or yaml")
+	ErrInvalidDocument       = OrganisationError("organisation document is invalid")
+	ErrInvalidImportMode     = OrganisationError("import mode must be merge or replace")
+	ErrInvalidBatchOperation = OrganisationError("batch operation is invalid")
+)
+
+type DeviceError string
+
+func (e DeviceError) Error() string {
+	return string(e)
+}
+
+const (
+	ErrInvalidAlias = DeviceError("alias must only contain lowercase letters, numbers and hyphens")
+	ErrAliasInUse   = DeviceError("alias is in use by another device")
+	ErrAmbiguous    = DeviceError("reference matches more than one device")
+	ErrSameDevice   = DeviceError("device can not be replaced by itself")
 )
 
 const RootZoneId int = 0
@@ -69,6 +115,7 @@ func NewDeviceOrganiser(config persistence.Section, e EventPublisher) DeviceOrga
 		devices:        map[string]*DeviceMetadata{},
 		zoneConfig:     config.Section("Zones"),
 		deviceConfig:   config.Section("Devices"),
+		history:        newOrganisationHistory(config.Section("History"), DefaultHistoryLength),
 		eventPublisher: e,
 	}
 
@@ -84,12 +131,24 @@ func (d *DeviceOrganiser) Zone(id int) (Zone, bool) {
 	defer d.zoneLock.Unlock()
 
 	if zone, found := d.zones[id]; found {
-		return *zone, found
+		return zone.copy(), found
 	} else {
 		return Zone{}, found
 	}
 }
 
+// ZoneDescendents returns the identifiers of every zone beneath a zone.
+func (d *DeviceOrganiser) ZoneDescendents(id int) []int {
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	if _, found := d.zones[id]; !found {
+		return nil
+	}
+
+	return d.enumerateZoneDescendents(id)
+}
+
 func (d *DeviceOrganiser) RootZones() []Zone {
 	d.zoneLock.Lock()
 	defer d.zoneLock.Unlock()
@@ -97,34 +156,56 @@ func (d *DeviceOrganiser) RootZones() []Zone {
 	var rootZones []Zone
 
 	for _, zoneId := range d.hiddenRoot.SubZones {
-		rootZones = append(rootZones, *d.zones[zoneId])
+		rootZones = append(rootZones, d.zones[zoneId].copy())
 	}
 
 	return rootZones
 }
 
 func (d *DeviceOrganiser) NewZone(name string) Zone {
+	zone, _ := d.NewZoneOfKind(name, ZoneKindNone, "")
+	return zone
+}
+
+// NewZoneOfKind creates a zone of a kind and with an icon, as a single change to the organisation.
+func (d *DeviceOrganiser) NewZoneOfKind(name string, kind ZoneKind, icon string) (Zone, error) {
+	defer d.record("NewZone")()
+
+	if !kind.Valid() {
+		return Zone{}, ErrInvalidZoneKind
+	}
+
 	newId := int(atomic.AddInt64(d.nextZoneId, 1))
 
 	if !d.loading {
 		d.zoneConfig.Set("NextZoneId", *d.nextZoneId)
 	}
 
-	return d.newZoneWithId(name, newId)
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	return *d.newZoneLocked(name, kind, icon, newId), nil
 }
 
 func (d *DeviceOrganiser) newZoneWithId(name string, newId int) Zone {
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	return *d.newZoneLocked(name, ZoneKindNone, "", newId)
+}
+
+// newZoneLocked creates a zone at the root, the zone lock must be held.
+func (d *DeviceOrganiser) newZoneLocked(name string, kind ZoneKind, icon string, newId int) *Zone {
 	newZone := &Zone{
 		Identifier: newId,
 		Name:       name,
 		ParentZone: RootZoneId,
+		Kind:       kind,
+		Icon:       icon,
 		SubZones:   nil,
 		Devices:    nil,
 	}
 
-	d.zoneLock.Lock()
-	defer d.zoneLock.Unlock()
-
 	d.hiddenRoot.SubZones = append(d.hiddenRoot.SubZones, newId)
 	d.zones[newId] = newZone
 
@@ -132,6 +213,14 @@ func (d *DeviceOrganiser) newZoneWithId(name string, newId int) Zone {
 		s := d.zoneConfig.Section(strconv.Itoa(newId))
 		s.Set("Name", name)
 		s.Set("ParentZone", RootZoneId)
+
+		if kind != ZoneKindNone {
+			s.Set("Kind", string(kind))
+		}
+
+		if icon != "" {
+			s.Set("Icon", icon)
+		}
 	}
 
 	afterZone := 0
@@ -145,9 +234,11 @@ func (d *DeviceOrganiser) newZoneWithId(name string, newId int) Zone {
 		Identifier: newZone.Identifier,
 		Name:       newZone.Name,
 		AfterZone:  afterZone,
+		Kind:       newZone.Kind,
+		Icon:       newZone.Icon,
 	})
 
-	return *newZone
+	return newZone
 }
 
 func filterInt(haystack []int, needle int) []int {
@@ -175,9 +266,16 @@ func filterString(haystack []string, needle string) []string {
 }
 
 func (d *DeviceOrganiser) DeleteZone(id int) error {
+	defer d.record("DeleteZone")()
+
 	d.zoneLock.Lock()
 	defer d.zoneLock.Unlock()
 
+	return d.deleteZoneLocked(id)
+}
+
+// deleteZoneLocked deletes an empty zone, the zone lock must be held.
+func (d *DeviceOrganiser) deleteZoneLocked(id int) error {
 	zone, found := d.zones[id]
 	if !found {
 		return fmt.Errorf("zone not found: %w", ErrNotFound)
@@ -210,6 +308,8 @@ func (d *DeviceOrganiser) DeleteZone(id int) error {
 }
 
 func (d *DeviceOrganiser) MoveZone(id int, newParentId int) error {
+	defer d.record("MoveZone")()
+
 	if id == newParentId {
 		return ErrSameZone
 	}
@@ -217,6 +317,11 @@ func (d *DeviceOrganiser) MoveZone(id int, newParentId int) error {
 	d.zoneLock.Lock()
 	defer d.zoneLock.Unlock()
 
+	return d.moveZoneLocked(id, newParentId)
+}
+
+// moveZoneLocked moves a zone to a new parent, the zone lock must be held.
+func (d *DeviceOrganiser) moveZoneLocked(id int, newParentId int) error {
 	zone, found := d.zones[id]
 	if !found {
 		return fmt.Errorf("zone not found: %w", ErrNotFound)
@@ -267,15 +372,23 @@ func (d *DeviceOrganiser) publishZoneUpdate(z *Zone) {
 		beforeId = id
 	}
 
+	c := z.copy()
+
 	d.eventPublisher.Publish(ZoneUpdate{
-		Identifier: z.Identifier,
-		Name:       z.Name,
-		ParentZone: z.ParentZone,
-		AfterZone:  beforeId,
+		Identifier:  c.Identifier,
+		Name:        c.Name,
+		ParentZone:  c.ParentZone,
+		AfterZone:   beforeId,
+		Kind:        c.Kind,
+		Icon:        c.Icon,
+		Attributes:  c.Attributes,
+		Coordinates: c.Coordinates,
 	})
 }
 
 func (d *DeviceOrganiser) ReorderZoneBefore(id int, beforeId int) error {
+	defer d.record("ReorderZoneBefore")()
+
 	if id == beforeId {
 		return ErrSameZone
 	}
@@ -330,6 +443,8 @@ func (d *DeviceOrganiser) ReorderZoneBefore(id int, beforeId int) error {
 }
 
 func (d *DeviceOrganiser) ReorderZoneAfter(id int, afterId int) error {
+	defer d.record("ReorderZoneAfter")()
+
 	if id == afterId {
 		return ErrSameZone
 	}
@@ -384,6 +499,8 @@ func (d *DeviceOrganiser) ReorderZoneAfter(id int, afterId int) error {
 }
 
 func (d *DeviceOrganiser) NameZone(id int, name string) error {
+	defer d.record("NameZone")()
+
 	d.zoneLock.Lock()
 	defer d.zoneLock.Unlock()
 
@@ -402,7 +519,15 @@ func (d *DeviceOrganiser) NameZone(id int, name string) error {
 	}
 }
 
+// AddDevice adds a device to the organiser, devices already known are only restored if they were marked as removed,
+// without recording a change in the history.
 func (d *DeviceOrganiser) AddDevice(id string) {
+	if d.restoreDevice(id) {
+		return
+	}
+
+	defer d.record("AddDevice")()
+
 	d.deviceLock.Lock()
 	defer d.deviceLock.Unlock()
 
@@ -417,18 +542,57 @@ func (d *DeviceOrganiser) AddDevice(id string) {
 	}
 }
 
+// restoreDevice clears the removal of a device, returning false if the device is not known.
+func (d *DeviceOrganiser) restoreDevice(id string) bool {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	dm, found := d.devices[id]
+	if !found {
+		return false
+	}
+
+	if !dm.removed.IsZero() {
+		dm.removed = time.Time{}
+
+		if !d.loading {
+			d.deviceConfig.Section(id).Delete("Removed")
+		}
+	}
+
+	return true
+}
+
 func (d *DeviceOrganiser) Device(id string) (DeviceMetadata, bool) {
 	d.deviceLock.Lock()
 	defer d.deviceLock.Unlock()
 
 	if dm, found := d.devices[id]; found {
-		return *dm, true
+		return dm.copy(), true
 	} else {
 		return DeviceMetadata{}, false
 	}
 }
 
+// Devices returns the identifiers of all devices known to the organiser, in order.
+func (d *DeviceOrganiser) Devices() []string {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	var ids []string
+
+	for id := range d.devices {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
 func (d *DeviceOrganiser) NameDevice(id string, name string) error {
+	defer d.record("NameDevice")()
+
 	d.deviceLock.Lock()
 	defer d.deviceLock.Unlock()
 
@@ -438,12 +602,13 @@ func (d *DeviceOrganiser) NameDevice(id string, name string) error {
 		if !d.loading {
 			s := d.deviceConfig.Section(id)
 			s.Set("Name", name)
+
+			if !dm.customAlias {
+				d.setAlias(id, dm, d.uniqueAlias(id, Slug(name)), false)
+			}
 		}
 
-		d.eventPublisher.Publish(DeviceMetadataUpdate{
-			Identifier: id,
-			Name:       dm.Name,
-		})
+		d.publishDeviceMetadataUpdate(id, dm)
 
 		return nil
 	} else {
@@ -451,7 +616,68 @@ func (d *DeviceOrganiser) NameDevice(id string, name string) error {
 	}
 }
 
+// SetDeviceSleepy marks a device as sleepy, actions sent to sleepy devices are queued until the device is next active.
+func (d *DeviceOrganiser) SetDeviceSleepy(id string, sleepy bool) error {
+	defer d.record("SetDeviceSleepy")()
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	if dm, found := d.devices[id]; found {
+		dm.Sleepy = sleepy
+
+		if !d.loading {
+			s := d.deviceConfig.Section(id)
+			s.Set("Sleepy", sleepy)
+		}
+
+		d.publishDeviceMetadataUpdate(id, dm)
+
+		return nil
+	} else {
+		return ErrNotFound
+	}
+}
+
+func (d *DeviceOrganiser) publishDeviceMetadataUpdate(id string, dm *DeviceMetadata) {
+	c := dm.copy()
+
+	d.eventPublisher.Publish(DeviceMetadataUpdate{
+		Identifier: id,
+		Name:       c.Name,
+		Alias:      c.Alias,
+		Sleepy:     c.Sleepy,
+		Tags:       c.Tags,
+		Attributes: c.Attributes,
+	})
+}
+
+// copy returns a copy of the metadata which does not share slices or maps with the original.
+func (dm *DeviceMetadata) copy() DeviceMetadata {
+	c := *dm
+
+	if dm.Zones != nil {
+		c.Zones = append([]int{}, dm.Zones...)
+	}
+
+	if dm.Tags != nil {
+		c.Tags = append([]string{}, dm.Tags...)
+	}
+
+	if dm.Attributes != nil {
+		c.Attributes = make(map[string]any, len(dm.Attributes))
+
+		for k, v := range dm.Attributes {
+			c.Attributes[k] = v
+		}
+	}
+
+	return c
+}
+
 func (d *DeviceOrganiser) RemoveDevice(id string) {
+	defer d.record("RemoveDevice")()
+
 	d.deviceLock.Lock()
 	defer d.deviceLock.Unlock()
 
@@ -468,6 +694,11 @@ func (d *DeviceOrganiser) RemoveDevice(id string) {
 			zone, zoneFound := d.zones[zoneId]
 			if zoneFound {
 				zone.Devices = filterString(zone.Devices, id)
+
+				d.eventPublisher.Publish(DeviceRemovedFromZone{
+					ZoneIdentifier:   zoneId,
+					DeviceIdentifier: id,
+				})
 			}
 		}
 	}
@@ -480,6 +711,8 @@ func (d *DeviceOrganiser) RemoveDevice(id string) {
 }
 
 func (d *DeviceOrganiser) AddDeviceToZone(deviceId string, zoneId int) error {
+	defer d.record("AddDeviceToZone")()
+
 	d.deviceLock.Lock()
 	defer d.deviceLock.Unlock()
 
@@ -496,6 +729,19 @@ func (d *DeviceOrganiser) AddDeviceToZone(deviceId string, zoneId int) error {
 		return ErrNotFound
 	}
 
+	if containsInt(device.Zones, zoneId) {
+		return nil
+	}
+
+	d.addDeviceToZoneLocked(deviceId, device, zone)
+
+	return nil
+}
+
+// addDeviceToZoneLocked adds a device to a zone, both the device and zone locks must be held.
+func (d *DeviceOrganiser) addDeviceToZoneLocked(deviceId string, device *DeviceMetadata, zone *Zone) {
+	zoneId := zone.Identifier
+
 	device.Zones = append(device.Zones, zoneId)
 	zone.Devices = append(zone.Devices, deviceId)
 
@@ -507,11 +753,11 @@ func (d *DeviceOrganiser) AddDeviceToZone(deviceId string, zoneId int) error {
 		ZoneIdentifier:   zoneId,
 		DeviceIdentifier: deviceId,
 	})
-
-	return nil
 }
 
 func (d *DeviceOrganiser) RemoveDeviceFromZone(deviceId string, zoneId int) error {
+	defer d.record("RemoveDeviceFromZone")()
+
 	d.deviceLock.Lock()
 	defer d.deviceLock.Unlock()
 
@@ -528,6 +774,15 @@ func (d *DeviceOrganiser) RemoveDeviceFromZone(deviceId string, zoneId int) erro
 		return ErrNotFound
 	}
 
+	d.removeDeviceFromZoneLocked(deviceId, device, zone)
+
+	return nil
+}
+
+// removeDeviceFromZoneLocked removes a device from a zone, both the device and zone locks must be held.
+func (d *DeviceOrganiser) removeDeviceFromZoneLocked(deviceId string, device *DeviceMetadata, zone *Zone) {
+	zoneId := zone.Identifier
+
 	device.Zones = filterInt(device.Zones, zoneId)
 	zone.Devices = filterString(zone.Devices, deviceId)
 
@@ -539,8 +794,6 @@ func (d *DeviceOrganiser) RemoveDeviceFromZone(deviceId string, zoneId int) erro
 		ZoneIdentifier:   zoneId,
 		DeviceIdentifier: deviceId,
 	})
-
-	return nil
 }
 
 func (d *DeviceOrganiser) enumerateZoneDescendents(id int) []int {
@@ -561,6 +814,8 @@ func (d *DeviceOrganiser) enumerateZoneDescendents(id int) []int {
 func (d *DeviceOrganiser) load() {
 	d.loadZones()
 	d.loadDevices()
+	d.history.load()
+	d.history.current, _ = planOrganisation(d.ExportOrganisation())
 }
 
 func (d *DeviceOrganiser) loadZones() {
@@ -572,37 +827,85 @@ func (d *DeviceOrganiser) loadZones() {
 
 	for _, sid := range d.zoneConfig.SectionKeys() {
 		id, err := strconv.Atoi(sid)
-		if err != nil {
+		if err != nil || id <= RootZoneId {
 			continue
 		}
 
 		s := d.zoneConfig.Section(sid)
-		name, _ := s.String("Name")
 
 		parentId, _ := s.Int("ParentZone", int64(RootZoneId))
 		parentMapping[id] = int(parentId)
 
 		orderAfterId, _ := s.Int("OrderAfter")
 		orderAfterMapping[id] = int(orderAfterId)
+	}
+
+	for _, id := range sortedKeys(parentMapping) {
+		name, _ := d.zoneConfig.Section(strconv.Itoa(id)).String("Name")
 
 		d.newZoneWithId(name, id)
+		d.loadZoneAttributes(id)
 	}
 
-	for zone, zoneParent := range parentMapping {
-		if zoneParent != RootZoneId {
+	for _, zone := range sortedKeys(parentMapping) {
+		if zoneParent := parentMapping[zone]; zoneParent != RootZoneId {
 			if err := d.MoveZone(zone, zoneParent); err != nil {
 				continue
 			}
 		}
 	}
 
-	for zone, afterZone := range orderAfterMapping {
-		if afterZone != 0 {
-			if err := d.ReorderZoneAfter(zone, afterZone); err != nil {
-				continue
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	for _, zone := range d.zones {
+		zone.SubZones = orderSubZones(zone.SubZones, orderAfterMapping)
+	}
+}
+
+// orderSubZones orders sibling zones by following the chain of zones each is persisted as being ordered after. Zones
+// ordered after a zone which is not a sibling start a chain, and zones in the same position are ordered by identifier.
+func orderSubZones(siblings []int, orderAfter map[int]int) []int {
+	followers := map[int][]int{}
+
+	sorted := append([]int{}, siblings...)
+	sort.Ints(sorted)
+
+	for _, id := range sorted {
+		after := orderAfter[id]
+
+		if after == id || !containsInt(siblings, after) {
+			after = RootZoneId
+		}
+
+		followers[after] = append(followers[after], id)
+	}
+
+	var ordered []int
+	placed := map[int]bool{}
+
+	var follow func(int)
+	follow = func(id int) {
+		for _, follower := range followers[id] {
+			if !placed[follower] {
+				placed[follower] = true
+				ordered = append(ordered, follower)
+				follow(follower)
 			}
 		}
 	}
+
+	follow(RootZoneId)
+
+	for _, id := range sorted {
+		if !placed[id] {
+			placed[id] = true
+			ordered = append(ordered, id)
+			follow(id)
+		}
+	}
+
+	return ordered
 }
 
 func (d *DeviceOrganiser) loadDevices() {
@@ -614,6 +917,10 @@ func (d *DeviceOrganiser) loadDevices() {
 		d.AddDevice(id)
 		d.NameDevice(id, name)
 
+		if sleepy, _ := devConfig.Bool("Sleepy"); sleepy {
+			d.SetDeviceSleepy(id, sleepy)
+		}
+
 		for _, sid := range devConfig.Section("Zones").SectionKeys() {
 			zoneId, err := strconv.Atoi(sid)
 			if err != nil {
@@ -623,19 +930,29 @@ func (d *DeviceOrganiser) loadDevices() {
 			d.AddDeviceToZone(id, zoneId)
 		}
 	}
+
+	d.loadDeviceAttributes()
+	d.loadAliases()
+	d.loadRemoved()
 }
 
 type ZoneCreate struct {
 	Identifier int
 	Name       string
 	AfterZone  int
+	Kind       ZoneKind
+	Icon       string
 }
 
 type ZoneUpdate struct {
-	Identifier int
-	Name       string
-	ParentZone int
-	AfterZone  int
+	Identifier  int
+	Name        string
+	ParentZone  int
+	AfterZone   int
+	Kind        ZoneKind
+	Icon        string
+	Attributes  map[string]any
+	Coordinates *ZoneCoordinates
 }
 
 type ZoneRemove struct {
@@ -652,7 +969,20 @@ type DeviceRemovedFromZone struct {
 	DeviceIdentifier string
 }
 
+type DeviceReplaced struct {
+	OldIdentifier string
+	NewIdentifier string
+}
+
+type DevicePurged struct {
+	Identifier string
+}
+
 type DeviceMetadataUpdate struct {
 	Identifier string
 	Name       string
+	Alias      string
+	Sleepy     bool
+	Tags       []string
+	Attributes map[string]any
 }
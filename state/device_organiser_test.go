@@ -594,6 +594,20 @@ func TestDeviceOrganiser_Zones(t *testing.T) {
 		assert.NotContains(t, do.zones, zoneOne.Identifier)
 		assert.NotContains(t, do.hiddenRoot.SubZones, zoneOne.Identifier)
 	})
+	t.Run("ZoneDescendents returns every zone beneath a zone", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		zoneOne := do.NewZone("one")
+		zoneTwo := do.NewZone("two")
+		zoneThree := do.NewZone("three")
+
+		_ = do.MoveZone(zoneTwo.Identifier, zoneOne.Identifier)
+		_ = do.MoveZone(zoneThree.Identifier, zoneTwo.Identifier)
+
+		assert.ElementsMatch(t, []int{zoneTwo.Identifier, zoneThree.Identifier}, do.ZoneDescendents(zoneOne.Identifier))
+		assert.Empty(t, do.ZoneDescendents(zoneThree.Identifier))
+		assert.Nil(t, do.ZoneDescendents(99))
+	})
 }
 
 func TestDeviceOrganiser_Devices(t *testing.T) {
@@ -633,6 +647,7 @@ func TestDeviceOrganiser_Devices(t *testing.T) {
 		mep.On("Publish", DeviceMetadataUpdate{
 			Identifier: "id",
 			Name:       "name",
+			Alias:      "name",
 		})
 
 		do := NewDeviceOrganiser(memory.New(), mep)
@@ -653,6 +668,32 @@ func TestDeviceOrganiser_Devices(t *testing.T) {
 		assert.True(t, errors.Is(err, ErrNotFound))
 	})
 
+	t.Run("SetDeviceSleepy marks a device as sleepy", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		mep.On("Publish", DeviceMetadataUpdate{
+			Identifier: "id",
+			Sleepy:     true,
+		})
+
+		do := NewDeviceOrganiser(memory.New(), mep)
+		do.AddDevice("id")
+
+		err := do.SetDeviceSleepy("id", true)
+		assert.NoError(t, err)
+
+		dm, _ := do.Device("id")
+		assert.True(t, dm.Sleepy)
+	})
+
+	t.Run("SetDeviceSleepy errors if the device does not exist", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		err := do.SetDeviceSleepy("id", true)
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
 	t.Run("AddDevice does not overwrite an existing device", func(t *testing.T) {
 		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
 		do.AddDevice("id")
@@ -676,6 +717,25 @@ func TestDeviceOrganiser_Devices(t *testing.T) {
 		assert.False(t, found)
 	})
 
+	t.Run("RemoveDevice removes the device from its zones, publishing the removal", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		mep.On("Publish", ZoneCreate{Identifier: 1, Name: "zone"})
+		mep.On("Publish", DeviceAddedToZone{ZoneIdentifier: 1, DeviceIdentifier: "id"})
+		mep.On("Publish", DeviceRemovedFromZone{ZoneIdentifier: 1, DeviceIdentifier: "id"})
+
+		do := NewDeviceOrganiser(memory.New(), mep)
+		do.AddDevice("id")
+		zone := do.NewZone("zone")
+		_ = do.AddDeviceToZone("id", zone.Identifier)
+
+		do.RemoveDevice("id")
+
+		zone, _ = do.Zone(zone.Identifier)
+		assert.Empty(t, zone.Devices)
+	})
+
 	t.Run("AddDeviceToZone errors if the device can not be found", func(t *testing.T) {
 		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
 
@@ -811,6 +871,28 @@ func TestDeviceOrganiser_persistZones(t *testing.T) {
 		assert.Equal(t, do.nextZoneId, newDo.nextZoneId)
 		assert.Equal(t, do.zones, newDo.zones)
 	})
+
+	t.Run("reloads zone order by following the persisted order", func(t *testing.T) {
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+
+		for _, name := range []string{"one", "two", "three", "four", "five"} {
+			do.NewZone(name)
+		}
+
+		assert.NoError(t, do.ReorderZoneBefore(5, 1))
+		assert.NoError(t, do.ReorderZoneAfter(2, 3))
+
+		root, _ := do.Zone(RootZoneId)
+
+		for n := 0; n < 20; n++ {
+			newDo := NewDeviceOrganiser(s, NullEventPublisher)
+			reloaded, _ := newDo.Zone(RootZoneId)
+
+			assert.Equal(t, []int{5, 1, 3, 2, 4}, reloaded.SubZones)
+			assert.Equal(t, root.SubZones, reloaded.SubZones)
+		}
+	})
 }
 
 func TestDeviceOrganiser_persistDevices(t *testing.T) {
@@ -821,6 +903,7 @@ func TestDeviceOrganiser_persistDevices(t *testing.T) {
 
 		do.AddDevice("id")
 		do.NameDevice("id", "name")
+		do.SetDeviceSleepy("id", true)
 		do.AddDeviceToZone("id", zone.Identifier)
 
 		newDo := NewDeviceOrganiser(s, NullEventPublisher)
@@ -829,6 +912,7 @@ func TestDeviceOrganiser_persistDevices(t *testing.T) {
 		device, found := newDo.Device("id")
 		assert.True(t, found)
 		assert.Equal(t, "name", device.Name)
+		assert.True(t, device.Sleepy)
 		assert.Contains(t, device.Zones, zone.Identifier)
 
 		zone, _ = newDo.Zone(zone.Identifier)
@@ -0,0 +1,163 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/converter"
+	"strconv"
+	"time"
+)
+
+// DefaultRemovedDeviceGracePeriod is how long the metadata of a device removed from its gateway is retained, such
+// that it can be re-paired or replaced without losing its name and zones.
+const DefaultRemovedDeviceGracePeriod = 7 * 24 * time.Hour
+
+// MarkDeviceRemoved records that a device has been removed from its gateway, its metadata is retained until purged by
+// PurgeRemovedDevices. The mark is cleared if the device is added again.
+func (d *DeviceOrganiser) MarkDeviceRemoved(id string) {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	dm, found := d.devices[id]
+	if !found {
+		return
+	}
+
+	dm.removed = time.Now()
+
+	if !d.loading {
+		converter.Store(d.deviceConfig.Section(id), "Removed", dm.removed, converter.TimeEncoder)
+	}
+}
+
+// PurgeRemovedDevices removes the metadata of any device which was removed from its gateway longer ago than the grace
+// period, publishing DevicePurged for each.
+func (d *DeviceOrganiser) PurgeRemovedDevices(gracePeriod time.Duration) {
+	defer d.record("PurgeRemovedDevices")()
+
+	d.deviceLock.Lock()
+
+	var expired []string
+	now := time.Now()
+
+	for id, dm := range d.devices {
+		if !dm.removed.IsZero() && now.Sub(dm.removed) >= gracePeriod {
+			expired = append(expired, id)
+		}
+	}
+
+	d.deviceLock.Unlock()
+
+	for _, id := range expired {
+		d.nested().RemoveDevice(id)
+		d.eventPublisher.Publish(DevicePurged{Identifier: id})
+	}
+}
+
+// ReplaceDevice moves the metadata and zone membership of a device to a new identifier, such as when a failed device
+// is swapped for a new one. Any existing metadata of the new device is replaced, and the old device is removed.
+func (d *DeviceOrganiser) ReplaceDevice(oldId string, newId string) error {
+	defer d.record("ReplaceDevice")()
+
+	if oldId == newId {
+		return ErrSameDevice
+	}
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	old, found := d.devices[oldId]
+	if !found {
+		return ErrNotFound
+	}
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	if existing, found := d.devices[newId]; found {
+		for _, zoneId := range existing.Zones {
+			if zone, found := d.zones[zoneId]; found {
+				zone.Devices = filterString(zone.Devices, newId)
+
+				d.eventPublisher.Publish(DeviceRemovedFromZone{
+					ZoneIdentifier:   zoneId,
+					DeviceIdentifier: newId,
+				})
+			}
+		}
+	}
+
+	replacement := &DeviceMetadata{
+		Name:        old.Name,
+		Alias:       old.Alias,
+		Zones:       old.Zones,
+		Sleepy:      old.Sleepy,
+		Tags:        old.Tags,
+		Attributes:  old.Attributes,
+		customAlias: old.customAlias,
+	}
+
+	for _, zoneId := range replacement.Zones {
+		if zone, found := d.zones[zoneId]; found {
+			for i, deviceId := range zone.Devices {
+				if deviceId == oldId {
+					zone.Devices[i] = newId
+				}
+			}
+
+			d.eventPublisher.Publish(DeviceRemovedFromZone{
+				ZoneIdentifier:   zoneId,
+				DeviceIdentifier: oldId,
+			})
+
+			d.eventPublisher.Publish(DeviceAddedToZone{
+				ZoneIdentifier:   zoneId,
+				DeviceIdentifier: newId,
+			})
+		}
+	}
+
+	delete(d.devices, oldId)
+	d.devices[newId] = replacement
+
+	if !d.loading {
+		d.deviceConfig.SectionDelete(oldId)
+		d.deviceConfig.SectionDelete(newId)
+
+		s := d.deviceConfig.Section(newId)
+		s.Set("Name", replacement.Name)
+		s.Set("Alias", replacement.Alias)
+		s.Set("CustomAlias", replacement.customAlias)
+		s.Set("Sleepy", replacement.Sleepy)
+
+		for _, zoneId := range replacement.Zones {
+			s.Section("Zones", strconv.Itoa(zoneId))
+		}
+
+		for _, tag := range replacement.Tags {
+			s.Section("Tags", tag)
+		}
+
+		for key, value := range replacement.Attributes {
+			s.Section("Attributes").Set(key, value)
+		}
+	}
+
+	d.publishDeviceMetadataUpdate(newId, replacement)
+
+	d.eventPublisher.Publish(DeviceReplaced{
+		OldIdentifier: oldId,
+		NewIdentifier: newId,
+	})
+
+	return nil
+}
+
+func (d *DeviceOrganiser) loadRemoved() {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	for id, dm := range d.devices {
+		if removed, found := converter.Retrieve(d.deviceConfig.Section(id), "Removed", converter.TimeDecoder); found {
+			dm.removed = removed
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDeviceOrganiser_ReplaceDevice(t *testing.T) {
+	t.Run("moves metadata and zone membership to the new device", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("zone")
+
+		do.AddDevice("before")
+		do.AddDevice("old")
+		do.AddDevice("new")
+
+		_ = do.AddDeviceToZone("old", zone.Identifier)
+		_ = do.AddDeviceToZone("before", zone.Identifier)
+		_ = do.NameDevice("old", "Hall Sensor")
+		_ = do.SetDeviceSleepy("old", true)
+		_ = do.SetDeviceTags("old", []string{"outdoor"})
+		_ = do.UpdateDeviceAttributes("old", map[string]any{"circuit": 12})
+
+		assert.NoError(t, do.ReplaceDevice("old", "new"))
+
+		_, found := do.Device("old")
+		assert.False(t, found)
+
+		dm, found := do.Device("new")
+		assert.True(t, found)
+		assert.Equal(t, "Hall Sensor", dm.Name)
+		assert.Equal(t, "hall-sensor", dm.Alias)
+		assert.True(t, dm.Sleepy)
+		assert.Equal(t, []string{"outdoor"}, dm.Tags)
+		assert.Equal(t, map[string]any{"circuit": float64(12)}, dm.Attributes)
+		assert.Equal(t, []int{zone.Identifier}, dm.Zones)
+
+		z, _ := do.Zone(zone.Identifier)
+		assert.Equal(t, []string{"new", "before"}, z.Devices)
+	})
+
+	t.Run("publishes zone membership, metadata and replacement events", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("zone")
+
+		do.AddDevice("old")
+		_ = do.AddDeviceToZone("old", zone.Identifier)
+		_ = do.NameDevice("old", "Lamp")
+
+		do.eventPublisher = mep
+
+		mep.On("Publish", DeviceRemovedFromZone{ZoneIdentifier: zone.Identifier, DeviceIdentifier: "old"}).Once()
+		mep.On("Publish", DeviceAddedToZone{ZoneIdentifier: zone.Identifier, DeviceIdentifier: "new"}).Once()
+		mep.On("Publish", DeviceMetadataUpdate{Identifier: "new", Name: "Lamp", Alias: "lamp"}).Once()
+		mep.On("Publish", DeviceReplaced{OldIdentifier: "old", NewIdentifier: "new"}).Once()
+
+		assert.NoError(t, do.ReplaceDevice("old", "new"))
+	})
+
+	t.Run("persists the replacement", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		zone := do.NewZone("zone")
+
+		do.AddDevice("old")
+		_ = do.AddDeviceToZone("old", zone.Identifier)
+		_ = do.SetDeviceAlias("old", "porch")
+		_ = do.SetDeviceTags("old", []string{"outdoor"})
+		_ = do.UpdateDeviceAttributes("old", map[string]any{"circuit": 12})
+
+		assert.NoError(t, do.ReplaceDevice("old", "new"))
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+
+		_, found := reloaded.Device("old")
+		assert.False(t, found)
+
+		dm, found := reloaded.Device("new")
+		assert.True(t, found)
+		assert.Equal(t, "porch", dm.Alias)
+		assert.Equal(t, []string{"outdoor"}, dm.Tags)
+		assert.Equal(t, map[string]any{"circuit": float64(12)}, dm.Attributes)
+		assert.Equal(t, []int{zone.Identifier}, dm.Zones)
+
+		z, _ := reloaded.Zone(zone.Identifier)
+		assert.Equal(t, []string{"new"}, z.Devices)
+	})
+
+	t.Run("errors if the device is missing or replaced by itself", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("old")
+
+		assert.ErrorIs(t, do.ReplaceDevice("missing", "new"), ErrNotFound)
+		assert.ErrorIs(t, do.ReplaceDevice("old", "old"), ErrSameDevice)
+	})
+}
+
+func TestDeviceOrganiser_RemovedDevices(t *testing.T) {
+	t.Run("retains metadata of removed devices until purged after the grace period", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		_ = do.NameDevice("one", "Lamp")
+
+		do.MarkDeviceRemoved("one")
+
+		do.PurgeRemovedDevices(time.Hour)
+
+		dm, found := do.Device("one")
+		assert.True(t, found)
+		assert.Equal(t, "Lamp", dm.Name)
+
+		do.PurgeRemovedDevices(0)
+
+		_, found = do.Device("one")
+		assert.False(t, found)
+	})
+
+	t.Run("publishes an event for each purged device", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		do.MarkDeviceRemoved("one")
+
+		do.eventPublisher = mep
+		mep.On("Publish", DevicePurged{Identifier: "one"}).Once()
+
+		do.PurgeRemovedDevices(0)
+	})
+
+	t.Run("re-adding a removed device clears its removal", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		_ = do.NameDevice("one", "Lamp")
+
+		do.MarkDeviceRemoved("one")
+		do.AddDevice("one")
+
+		do.PurgeRemovedDevices(0)
+
+		dm, found := do.Device("one")
+		assert.True(t, found)
+		assert.Equal(t, "Lamp", dm.Name)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		reloaded.PurgeRemovedDevices(0)
+
+		_, found = reloaded.Device("one")
+		assert.True(t, found)
+	})
+
+	t.Run("removals are persisted", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		do.MarkDeviceRemoved("one")
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		reloaded.PurgeRemovedDevices(0)
+
+		_, found := reloaded.Device("one")
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,23 @@
+package state
+
+import (
+	"github.com/shimmeringbee/da"
+	"reflect"
+)
+
+// EventDevice returns the device an event was raised by, events from gateways carry their device in a field named
+// Device.
+func EventDevice(e any) (da.Device, bool) {
+	v := reflect.ValueOf(e)
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	f := v.FieldByName("Device")
+	if !f.IsValid() || !f.CanInterface() {
+		return nil, false
+	}
+
+	d, ok := f.Interface().(da.Device)
+	return d, ok && d != nil
+}
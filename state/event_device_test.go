@@ -0,0 +1,30 @@
+package state
+
+import (
+	"github.com/shimmeringbee/da/capabilities"
+	"github.com/shimmeringbee/da/mocks"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventDevice(t *testing.T) {
+	t.Run("returns the device from an event with a Device field", func(t *testing.T) {
+		d := mocks.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		actual, found := EventDevice(capabilities.OnOffUpdate{Device: d})
+		assert.True(t, found)
+		assert.Equal(t, d, actual)
+	})
+
+	t.Run("returns false for events without a device", func(t *testing.T) {
+		_, found := EventDevice(capabilities.DeviceDiscoveryEnabled{})
+		assert.False(t, found)
+
+		_, found = EventDevice(capabilities.OnOffUpdate{})
+		assert.False(t, found)
+
+		_, found = EventDevice("string")
+		assert.False(t, found)
+	})
+}
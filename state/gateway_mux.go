@@ -21,7 +21,7 @@ type GatewayMux struct {
 
 	deviceByIdentifier map[string]da.Device
 	gatewayByName      map[string]da.Gateway
-	shutdownCh         []chan struct{}
+	shutdownCh         map[string]chan struct{}
 
 	eventPublisher EventPublisher
 }
@@ -40,21 +40,71 @@ func (m *GatewayMux) Add(n string, g da.Gateway) {
 
 	m.gatewayByName[n] = g
 
-	ch := make(chan struct{}, 1)
-	m.shutdownCh = append(m.shutdownCh, ch)
+	if m.shutdownCh == nil {
+		m.shutdownCh = map[string]chan struct{}{}
+	}
+
+	ch := make(chan struct{})
+	m.shutdownCh[n] = ch
 
 	selfDevice := g.Self()
 	m.deviceByIdentifier[selfDevice.Identifier().String()] = selfDevice
 
-	go m.monitorGateway(g, ch)
+	go m.monitorGateway(n, g, ch)
+}
+
+// Remove stops monitoring a gateway, forgetting it and its devices. No events are published for the devices, they are
+// expected to be announced again if the gateway is restarted.
+func (m *GatewayMux) Remove(n string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	g, found := m.gatewayByName[n]
+	if !found {
+		return
+	}
+
+	delete(m.gatewayByName, n)
+
+	if self := g.Self(); self != nil {
+		delete(m.deviceByIdentifier, self.Identifier().String())
+	}
+
+	for id, d := range m.deviceByIdentifier {
+		if d.Gateway() == g {
+			delete(m.deviceByIdentifier, id)
+		}
+	}
+
+	if ch, found := m.shutdownCh[n]; found {
+		close(ch)
+		delete(m.shutdownCh, n)
+	}
+}
+
+// GatewayFailed is published if reading events from a gateway fails, no further events will be received from it. It
+// is not published if the gateway fails once the mux has been told to stop monitoring it, as the gateway is expected to
+// be stopped.
+type GatewayFailed struct {
+	Name    string
+	Gateway da.Gateway
+	Error   error
 }
 
-func (m *GatewayMux) monitorGateway(g da.Gateway, shutCh chan struct{}) {
+func (m *GatewayMux) monitorGateway(n string, g da.Gateway, shutCh chan struct{}) {
 	for {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		event, err := g.ReadEvent(ctx)
+		cancel()
 
-		if event, err := g.ReadEvent(ctx); err != nil && err != context.DeadlineExceeded {
-			cancel()
+		select {
+		case <-shutCh:
+			return
+		default:
+		}
+
+		if err != nil && err != context.DeadlineExceeded {
+			m.eventPublisher.Publish(GatewayFailed{Name: n, Gateway: g, Error: err})
 			return
 		} else if event != nil {
 			switch e := event.(type) {
@@ -74,14 +124,6 @@ func (m *GatewayMux) monitorGateway(g da.Gateway, shutCh chan struct{}) {
 
 			m.eventPublisher.Publish(event)
 		}
-
-		cancel()
-
-		select {
-		case _ = <-shutCh:
-			return
-		default:
-		}
 	}
 }
 
@@ -114,11 +156,13 @@ func (m *GatewayMux) Device(id string) (da.Device, bool) {
 	return d, found
 }
 
+// Stop stops monitoring all gateways, it should be called before the gateways themselves are stopped.
 func (m *GatewayMux) Stop() {
-	m.lock.RLock()
-	defer m.lock.RUnlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	for _, ch := range m.shutdownCh {
-		ch <- struct{}{}
+	for n, ch := range m.shutdownCh {
+		close(ch)
+		delete(m.shutdownCh, n)
 	}
 }
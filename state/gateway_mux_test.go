@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"errors"
 	"github.com/shimmeringbee/da"
 	"github.com/shimmeringbee/da/capabilities"
 	mocks2 "github.com/shimmeringbee/da/mocks"
@@ -194,6 +195,99 @@ func TestGatewayMux_Add(t *testing.T) {
 	})
 }
 
+func TestGatewayMux_Remove(t *testing.T) {
+	t.Run("removed gateway and its devices are no longer available", func(t *testing.T) {
+		mg := &mocks2.Gateway{}
+		mg.On("ReadEvent", mock.Anything).Return(nil, context.DeadlineExceeded).Maybe()
+
+		selfD := mocks2.SimpleDevice{SGateway: mg, SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+		mg.On("Self").Return(selfD)
+
+		d := mocks2.SimpleDevice{SGateway: mg, SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		other := &mocks2.Gateway{}
+		otherD := mocks2.SimpleDevice{SGateway: other, SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+
+		m := GatewayMux{gatewayByName: map[string]da.Gateway{}, deviceByIdentifier: map[string]da.Device{}}
+		m.Add("mock", mg)
+		defer m.Stop()
+
+		m.deviceByIdentifier[d.Identifier().String()] = d
+		m.deviceByIdentifier[otherD.Identifier().String()] = otherD
+
+		m.Remove("mock")
+
+		assert.Empty(t, m.Gateways())
+		assert.Empty(t, m.shutdownCh)
+
+		_, found := m.Device(d.Identifier().String())
+		assert.False(t, found)
+
+		_, found = m.Device(selfD.Identifier().String())
+		assert.False(t, found)
+
+		_, found = m.Device(otherD.Identifier().String())
+		assert.True(t, found)
+	})
+}
+
+func TestGatewayMux_monitorGateway(t *testing.T) {
+	t.Run("publishes a GatewayFailed event if reading events from the gateway fails", func(t *testing.T) {
+		mg := &mocks2.Gateway{}
+
+		expectedErr := errors.New("failed")
+
+		mg.On("ReadEvent", mock.Anything).Return(nil, expectedErr).Once()
+		defer mg.AssertExpectations(t)
+
+		mep := mockEventPublisher{}
+		mep.On("Publish", GatewayFailed{Name: "mock", Gateway: mg, Error: expectedErr})
+		defer mep.AssertExpectations(t)
+
+		selfD := mocks2.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+		mg.On("Self").Return(selfD)
+
+		m := GatewayMux{gatewayByName: map[string]da.Gateway{}, deviceByIdentifier: map[string]da.Device{}, eventPublisher: &mep}
+		m.Add("mock", mg)
+		time.Sleep(50 * time.Millisecond)
+		m.Stop()
+	})
+
+	t.Run("does not publish GatewayFailed if reading fails once the mux stops monitoring the gateway", func(t *testing.T) {
+		for name, stop := range map[string]func(*GatewayMux){
+			"removed": func(m *GatewayMux) { m.Remove("mock") },
+			"stopped": func(m *GatewayMux) { m.Stop() },
+		} {
+			t.Run(name, func(t *testing.T) {
+				mg := &mocks2.Gateway{}
+				defer mg.AssertExpectations(t)
+
+				gatewayStopped := make(chan struct{})
+
+				mg.On("ReadEvent", mock.Anything).Run(func(mock.Arguments) {
+					<-gatewayStopped
+				}).Return(nil, errors.New("gateway stopped")).Once()
+
+				selfD := mocks2.SimpleDevice{SIdentifier: zigbee.GenerateLocalAdministeredIEEEAddress()}
+				mg.On("Self").Return(selfD)
+
+				mep := mockEventPublisher{}
+				mep.On("Publish", mock.Anything).Maybe()
+
+				m := NewGatewayMux(&mep)
+				m.Add("mock", mg)
+				time.Sleep(10 * time.Millisecond)
+
+				stop(m)
+				close(gatewayStopped)
+				time.Sleep(50 * time.Millisecond)
+
+				mep.AssertNotCalled(t, "Publish", mock.Anything)
+			})
+		}
+	})
+}
+
 type mockEventPublisher struct {
 	mock.Mock
 }
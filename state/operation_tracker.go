@@ -0,0 +1,131 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type OperationStatus string
+
+const (
+	OperationRunning   OperationStatus = "running"
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+)
+
+// OperationRetention is how long completed operations are retained for before being forgotten.
+const OperationRetention = 1 * time.Hour
+
+type Operation struct {
+	Identifier string
+	Device     string
+	Capability string
+	Action     string
+	Status     OperationStatus
+	Result     any    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+	Created    time.Time
+	Completed  *time.Time `json:",omitempty"`
+}
+
+// OperationTracker records the progress of device actions which are invoked asynchronously.
+type OperationTracker struct {
+	lock           *sync.Mutex
+	operations     map[string]*Operation
+	eventPublisher EventPublisher
+	now            func() time.Time
+}
+
+func NewOperationTracker(e EventPublisher) *OperationTracker {
+	return &OperationTracker{
+		lock:           &sync.Mutex{},
+		operations:     map[string]*Operation{},
+		eventPublisher: e,
+		now:            time.Now,
+	}
+}
+
+// Start records a new running operation, forgetting any completed operations older than OperationRetention.
+func (t *OperationTracker) Start(device string, capability string, action string) (Operation, error) {
+	id, err := randomOperationIdentifier()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+
+	for oid, op := range t.operations {
+		if op.Completed != nil && now.Sub(*op.Completed) > OperationRetention {
+			delete(t.operations, oid)
+		}
+	}
+
+	op := &Operation{
+		Identifier: id,
+		Device:     device,
+		Capability: capability,
+		Action:     action,
+		Status:     OperationRunning,
+		Created:    now,
+	}
+
+	t.operations[id] = op
+	return *op, nil
+}
+
+// Complete records the result of an operation, and announces its completion on the event bus.
+func (t *OperationTracker) Complete(id string, result any, err error) {
+	t.lock.Lock()
+
+	op, found := t.operations[id]
+	if !found {
+		t.lock.Unlock()
+		return
+	}
+
+	completed := t.now()
+	op.Completed = &completed
+
+	if err != nil {
+		op.Status = OperationFailed
+		op.Error = err.Error()
+	} else {
+		op.Status = OperationSucceeded
+		op.Result = result
+	}
+
+	copied := *op
+	t.lock.Unlock()
+
+	t.eventPublisher.Publish(OperationComplete{Operation: copied})
+}
+
+func (t *OperationTracker) Operation(id string) (Operation, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	op, found := t.operations[id]
+	if !found {
+		return Operation{}, false
+	}
+
+	return *op, true
+}
+
+func randomOperationIdentifier() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+type OperationComplete struct {
+	Operation Operation
+}
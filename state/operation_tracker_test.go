@@ -0,0 +1,77 @@
+package state
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestOperationTracker(t *testing.T) {
+	t.Run("Start records a running operation", func(t *testing.T) {
+		ot := NewOperationTracker(NullEventPublisher)
+
+		op, err := ot.Start("device", "OnOff", "On")
+		assert.NoError(t, err)
+
+		assert.NotEmpty(t, op.Identifier)
+		assert.Equal(t, OperationRunning, op.Status)
+
+		found, ok := ot.Operation(op.Identifier)
+		assert.True(t, ok)
+		assert.Equal(t, op, found)
+	})
+
+	t.Run("Complete records the result and publishes an event", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		mep.On("Publish", mock.AnythingOfType("state.OperationComplete"))
+
+		ot := NewOperationTracker(mep)
+
+		op, _ := ot.Start("device", "OnOff", "On")
+		ot.Complete(op.Identifier, struct{}{}, nil)
+
+		found, _ := ot.Operation(op.Identifier)
+		assert.Equal(t, OperationSucceeded, found.Status)
+		assert.Equal(t, struct{}{}, found.Result)
+		assert.NotNil(t, found.Completed)
+
+		published := mep.Calls[0].Arguments.Get(0).(OperationComplete)
+		assert.Equal(t, found, published.Operation)
+	})
+
+	t.Run("Complete records errors", func(t *testing.T) {
+		ot := NewOperationTracker(NullEventPublisher)
+
+		op, _ := ot.Start("device", "OnOff", "On")
+		ot.Complete(op.Identifier, nil, errors.New("failure"))
+
+		found, _ := ot.Operation(op.Identifier)
+		assert.Equal(t, OperationFailed, found.Status)
+		assert.Equal(t, "failure", found.Error)
+	})
+
+	t.Run("completed operations are forgotten after the retention period", func(t *testing.T) {
+		now := time.Now()
+
+		ot := NewOperationTracker(NullEventPublisher)
+		ot.now = func() time.Time { return now }
+
+		completed, _ := ot.Start("device", "OnOff", "On")
+		ot.Complete(completed.Identifier, nil, nil)
+
+		running, _ := ot.Start("device", "OnOff", "Off")
+
+		now = now.Add(OperationRetention + time.Second)
+		ot.Start("device", "OnOff", "On")
+
+		_, found := ot.Operation(completed.Identifier)
+		assert.False(t, found)
+
+		_, found = ot.Operation(running.Identifier)
+		assert.True(t, found)
+	})
+}
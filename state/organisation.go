@@ -0,0 +1,145 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"sort"
+)
+
+// OrganisationDocumentVersion is the version of document produced by ExportOrganisation, documents of any other
+// version are rejected by ImportOrganisation.
+const OrganisationDocumentVersion = 1
+
+// OrganisationDocument describes the zones and device metadata held by a DeviceOrganiser, such that the layout of a
+// house can be backed up or moved to another controller. Zones are nested beneath their parent, in order.
+type OrganisationDocument struct {
+	Version int                  `yaml:"Version"`
+	Zones   []OrganisationZone   `json:",omitempty" yaml:"Zones,omitempty"`
+	Devices []OrganisationDevice `json:",omitempty" yaml:"Devices,omitempty"`
+}
+
+type OrganisationZone struct {
+	Identifier  int                `yaml:"Identifier"`
+	Name        string             `yaml:"Name"`
+	Kind        ZoneKind           `json:",omitempty" yaml:"Kind,omitempty"`
+	Icon        string             `json:",omitempty" yaml:"Icon,omitempty"`
+	Attributes  map[string]any     `json:",omitempty" yaml:"Attributes,omitempty"`
+	Coordinates *ZoneCoordinates   `json:",omitempty" yaml:"Coordinates,omitempty"`
+	SubZones    []OrganisationZone `json:",omitempty" yaml:"SubZones,omitempty"`
+}
+
+// OrganisationDevice is the metadata of a device, the alias is only present if it was set explicitly rather than
+// derived from the devices name.
+type OrganisationDevice struct {
+	Identifier string         `yaml:"Identifier"`
+	Name       string         `json:",omitempty" yaml:"Name,omitempty"`
+	Alias      string         `json:",omitempty" yaml:"Alias,omitempty"`
+	Sleepy     bool           `json:",omitempty" yaml:"Sleepy,omitempty"`
+	Zones      []int          `json:",omitempty" yaml:"Zones,omitempty"`
+	Tags       []string       `json:",omitempty" yaml:"Tags,omitempty"`
+	Attributes map[string]any `json:",omitempty" yaml:"Attributes,omitempty"`
+}
+
+type OrganisationFormat string
+
+const (
+	OrganisationFormatJSON OrganisationFormat = "json"
+	OrganisationFormatYAML OrganisationFormat = "yaml"
+)
+
+// MarshalOrganisation encodes a document in the format requested.
+func MarshalOrganisation(doc OrganisationDocument, format OrganisationFormat) ([]byte, error) {
+	switch format {
+	case OrganisationFormatJSON:
+		return json.MarshalIndent(doc, "", "  ")
+	case OrganisationFormatYAML:
+		return yaml.Marshal(doc)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// UnmarshalOrganisation decodes a document in the format provided.
+func UnmarshalOrganisation(data []byte, format OrganisationFormat) (OrganisationDocument, error) {
+	var doc OrganisationDocument
+	var err error
+
+	switch format {
+	case OrganisationFormatJSON:
+		err = json.Unmarshal(data, &doc)
+	case OrganisationFormatYAML:
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return doc, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	if err != nil {
+		return doc, fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+	}
+
+	return doc, nil
+}
+
+// ExportOrganisation returns a document describing every zone and the metadata of every device.
+func (d *DeviceOrganiser) ExportOrganisation() OrganisationDocument {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	doc := OrganisationDocument{
+		Version: OrganisationDocumentVersion,
+		Zones:   d.exportZonesLocked(d.hiddenRoot.SubZones),
+	}
+
+	var ids []string
+
+	for id := range d.devices {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		dm := d.devices[id].copy()
+
+		device := OrganisationDevice{
+			Identifier: id,
+			Name:       dm.Name,
+			Sleepy:     dm.Sleepy,
+			Zones:      dm.Zones,
+			Tags:       dm.Tags,
+			Attributes: dm.Attributes,
+		}
+
+		if dm.customAlias {
+			device.Alias = dm.Alias
+		}
+
+		doc.Devices = append(doc.Devices, device)
+	}
+
+	return doc
+}
+
+func (d *DeviceOrganiser) exportZonesLocked(ids []int) []OrganisationZone {
+	var zones []OrganisationZone
+
+	for _, id := range ids {
+		zone := d.zones[id].copy()
+
+		zones = append(zones, OrganisationZone{
+			Identifier:  zone.Identifier,
+			Name:        zone.Name,
+			Kind:        zone.Kind,
+			Icon:        zone.Icon,
+			Attributes:  zone.Attributes,
+			Coordinates: zone.Coordinates,
+			SubZones:    d.exportZonesLocked(zone.SubZones),
+		})
+	}
+
+	return zones
+}
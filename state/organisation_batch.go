@@ -0,0 +1,323 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+type BatchAction string
+
+const (
+	BatchCreateZone     BatchAction = "create-zone"
+	BatchMoveZone       BatchAction = "move-zone"
+	BatchReorderZone    BatchAction = "reorder-zone"
+	BatchNameZone       BatchAction = "name-zone"
+	BatchNameDevice     BatchAction = "name-device"
+	BatchAssignDevice   BatchAction = "assign-device"
+	BatchUnassignDevice BatchAction = "unassign-device"
+)
+
+// ZoneReference refers to a zone by its identifier, or by the reference given to a zone created earlier in the same
+// batch. An empty reference is the root.
+type ZoneReference string
+
+func (z *ZoneReference) UnmarshalJSON(data []byte) error {
+	var number json.Number
+
+	if err := json.Unmarshal(data, &number); err == nil {
+		*z = ZoneReference(number)
+		return nil
+	}
+
+	return json.Unmarshal(data, (*string)(z))
+}
+
+// BatchOperation is a single change to the organisation within a batch. Zones being created may be given a Reference,
+// by which later operations in the batch can refer to them before they have an identifier. Reorders must provide
+// exactly one of Before or After.
+type BatchOperation struct {
+	Action    BatchAction
+	Reference string        `json:",omitempty"`
+	Zone      ZoneReference `json:",omitempty"`
+	Parent    ZoneReference `json:",omitempty"`
+	Before    ZoneReference `json:",omitempty"`
+	After     ZoneReference `json:",omitempty"`
+	Device    string        `json:",omitempty"`
+	Name      string        `json:",omitempty"`
+	Kind      ZoneKind      `json:",omitempty"`
+	Icon      string        `json:",omitempty"`
+}
+
+// BatchResult holds the identifiers allocated to the zones created by a batch, by their reference, and the changes
+// made.
+type BatchResult struct {
+	Zones   map[string]int
+	Changes []OrganisationChange
+}
+
+// ApplyBatch applies a list of operations to the organisation, in order, as a single change. Every operation is
+// validated before any change is made, and the changes are made to a copy of the organisation which replaces it only
+// once they have been made in full. Events are only published once the copy has replaced the organisation.
+func (d *DeviceOrganiser) ApplyBatch(operations []BatchOperation) (BatchResult, error) {
+	defer d.record("ApplyBatch")()
+
+	var result BatchResult
+
+	err := d.transact(true, func(tx *DeviceOrganiser) error {
+		current, err := planOrganisation(tx.ExportOrganisation())
+		if err != nil {
+			return err
+		}
+
+		b := batch{
+			d:      tx,
+			target: current.copy(),
+			nextId: int(atomic.LoadInt64(tx.nextZoneId)),
+			result: BatchResult{Zones: map[string]int{}},
+		}
+
+		for i, operation := range operations {
+			if err := b.apply(operation); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+
+		if err := b.target.validate(); err != nil {
+			return err
+		}
+
+		result = b.result
+		result.Changes = diffOrganisationPlans(current, b.target)
+
+		return tx.applyOrganisationPlan(current, b.target)
+	})
+
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	return result, nil
+}
+
+type batch struct {
+	d      *DeviceOrganiser
+	target organisationPlan
+	nextId int
+	result BatchResult
+}
+
+func (b *batch) apply(operation BatchOperation) error {
+	switch operation.Action {
+	case BatchCreateZone:
+		return b.createZone(operation)
+	case BatchMoveZone:
+		return b.moveZone(operation)
+	case BatchReorderZone:
+		return b.reorderZone(operation)
+	case BatchNameZone:
+		id, err := b.zone(operation.Zone)
+		if err != nil {
+			return err
+		}
+
+		zone := b.target.zones[id]
+		zone.Name = operation.Name
+		b.target.zones[id] = zone
+
+		return nil
+	case BatchNameDevice:
+		id, err := b.device(operation.Device)
+		if err != nil {
+			return err
+		}
+
+		device := b.target.devices[id]
+		device.Name = operation.Name
+		b.target.devices[id] = device
+
+		return nil
+	case BatchAssignDevice, BatchUnassignDevice:
+		return b.assignDevice(operation)
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidBatchOperation, operation.Action)
+	}
+}
+
+func (b *batch) createZone(operation BatchOperation) error {
+	if _, err := strconv.Atoi(operation.Reference); err == nil {
+		return fmt.Errorf("%w: reference %q can not be a number", ErrInvalidBatchOperation, operation.Reference)
+	}
+
+	if _, found := b.result.Zones[operation.Reference]; found && operation.Reference != "" {
+		return fmt.Errorf("%w: reference %q is already in use", ErrInvalidBatchOperation, operation.Reference)
+	}
+
+	if !operation.Kind.Valid() {
+		return ErrInvalidZoneKind
+	}
+
+	parent, err := b.parent(operation.Parent)
+	if err != nil {
+		return err
+	}
+
+	b.nextId++
+	id := b.nextId
+
+	b.target.zones[id] = OrganisationZone{Identifier: id, Name: operation.Name, Kind: operation.Kind, Icon: operation.Icon}
+	b.target.parents[id] = parent
+	b.target.children[parent] = append(b.target.children[parent], id)
+
+	if operation.Reference != "" {
+		b.result.Zones[operation.Reference] = id
+	}
+
+	return nil
+}
+
+func (b *batch) moveZone(operation BatchOperation) error {
+	id, err := b.zone(operation.Zone)
+	if err != nil {
+		return err
+	}
+
+	parent, err := b.parent(operation.Parent)
+	if err != nil {
+		return err
+	}
+
+	if id == parent {
+		return ErrSameZone
+	}
+
+	if b.target.isAncestor(id, parent) {
+		return ErrCircularReference
+	}
+
+	existing := b.target.parents[id]
+
+	b.target.children[existing] = filterInt(b.target.children[existing], id)
+	b.target.children[parent] = append(b.target.children[parent], id)
+	b.target.parents[id] = parent
+
+	return nil
+}
+
+func (b *batch) reorderZone(operation BatchOperation) error {
+	if (operation.Before == "") == (operation.After == "") {
+		return fmt.Errorf("%w: exactly one of Before and After must be provided", ErrInvalidBatchOperation)
+	}
+
+	id, err := b.zone(operation.Zone)
+	if err != nil {
+		return err
+	}
+
+	relative, err := b.zone(operation.Before + operation.After)
+	if err != nil {
+		return err
+	}
+
+	if id == relative {
+		return ErrSameZone
+	}
+
+	parent := b.target.parents[id]
+
+	if b.target.parents[relative] != parent {
+		return ErrMustHaveSameParent
+	}
+
+	var children []int
+
+	for _, sibling := range b.target.children[parent] {
+		if sibling == relative && operation.Before != "" {
+			children = append(children, id)
+		}
+
+		if sibling != id {
+			children = append(children, sibling)
+		}
+
+		if sibling == relative && operation.After != "" {
+			children = append(children, id)
+		}
+	}
+
+	b.target.children[parent] = children
+
+	return nil
+}
+
+func (b *batch) assignDevice(operation BatchOperation) error {
+	id, err := b.device(operation.Device)
+	if err != nil {
+		return err
+	}
+
+	zoneId, err := b.zone(operation.Zone)
+	if err != nil {
+		return err
+	}
+
+	device := b.target.devices[id]
+
+	if operation.Action == BatchAssignDevice {
+		if !containsInt(device.Zones, zoneId) {
+			device.Zones = append(append([]int{}, device.Zones...), zoneId)
+		}
+	} else {
+		device.Zones = filterInt(device.Zones, zoneId)
+	}
+
+	b.target.devices[id] = device
+
+	return nil
+}
+
+// zone resolves a reference to a zone which must exist.
+func (b *batch) zone(ref ZoneReference) (int, error) {
+	if ref == "" {
+		return 0, fmt.Errorf("%w: zone must be provided", ErrInvalidBatchOperation)
+	}
+
+	id, found := b.result.Zones[string(ref)]
+
+	if !found {
+		var err error
+
+		if id, err = strconv.Atoi(string(ref)); err != nil {
+			return 0, fmt.Errorf("zone %q: %w", ref, ErrNotFound)
+		}
+	}
+
+	if _, found := b.target.zones[id]; !found {
+		return 0, fmt.Errorf("zone %q: %w", ref, ErrNotFound)
+	}
+
+	return id, nil
+}
+
+// parent resolves a reference to a zone which may be the root.
+func (b *batch) parent(ref ZoneReference) (int, error) {
+	if ref == "" || ref == ZoneReference(strconv.Itoa(RootZoneId)) {
+		return RootZoneId, nil
+	}
+
+	return b.zone(ref)
+}
+
+func (b *batch) device(ref string) (string, error) {
+	id, err := b.d.ResolveDevice(ref)
+	if err != nil {
+		return "", fmt.Errorf("device %q: %w", ref, err)
+	}
+
+	if _, found := b.target.devices[id]; !found {
+		return "", fmt.Errorf("device %q: %w", ref, ErrNotFound)
+	}
+
+	return id, nil
+}
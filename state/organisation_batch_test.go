@@ -0,0 +1,105 @@
+package state
+
+import (
+	"encoding/json"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func TestDeviceOrganiser_ApplyBatch(t *testing.T) {
+	t.Run("creates zones referred to by reference, and assigns devices to them", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		var operations []BatchOperation
+
+		err := json.Unmarshal([]byte(`[
+			{"Action": "create-zone", "Reference": "upstairs", "Name": "Upstairs", "Kind": "floor"},
+			{"Action": "create-zone", "Reference": "bedroom", "Name": "Bedroom", "Parent": "upstairs"},
+			{"Action": "create-zone", "Reference": "bathroom", "Name": "Bathroom", "Parent": "upstairs"},
+			{"Action": "reorder-zone", "Zone": "bathroom", "Before": "bedroom"},
+			{"Action": "move-zone", "Zone": 3, "Parent": "upstairs"},
+			{"Action": "name-zone", "Zone": 1, "Name": "Downstairs"},
+			{"Action": "name-device", "Device": "kettle-plug", "Name": "Bedside Lamp"},
+			{"Action": "unassign-device", "Device": "one", "Zone": 2},
+			{"Action": "assign-device", "Device": "one", "Zone": "bedroom"}
+		]`), &operations)
+		assert.NoError(t, err)
+
+		result, err := do.ApplyBatch(operations)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"upstairs": 4, "bedroom": 5, "bathroom": 6}, result.Zones)
+		assert.Contains(t, result.Changes, OrganisationChange{Action: ChangeCreate, Zone: 4})
+
+		upstairs, _ := do.Zone(4)
+		assert.Equal(t, ZoneKindFloor, upstairs.Kind)
+		assert.Equal(t, []int{6, 5, 3}, upstairs.SubZones)
+
+		house, _ := do.Zone(1)
+		assert.Equal(t, "Downstairs", house.Name)
+
+		dm, _ := do.Device("one")
+		assert.Equal(t, "Bedside Lamp", dm.Name)
+		assert.Equal(t, []int{5}, dm.Zones)
+
+		history := do.History()
+		assert.Equal(t, "ApplyBatch", history[len(history)-1].Operation)
+
+		assert.Equal(t, 7, do.NewZone("Garage").Identifier)
+	})
+
+	t.Run("makes no changes and publishes no events if an operation is invalid", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		mep.On("Publish", mock.Anything)
+
+		do := NewDeviceOrganiser(memory.New(), mep)
+		do.AddDevice("one")
+		do.NewZone("House")
+
+		before := do.ExportOrganisation()
+		mep.Calls = nil
+
+		invalid := [][]BatchOperation{
+			{{Action: BatchCreateZone, Reference: "a", Name: "A"}, {Action: "delete-everything"}},
+			{{Action: BatchCreateZone, Reference: "a"}, {Action: BatchCreateZone, Reference: "a"}},
+			{{Action: BatchCreateZone, Reference: "5"}},
+			{{Action: BatchCreateZone, Kind: "cupboard"}},
+			{{Action: BatchCreateZone, Reference: "a"}, {Action: BatchMoveZone, Zone: "1", Parent: "a"}, {Action: BatchMoveZone, Zone: "a", Parent: "1"}},
+			{{Action: BatchMoveZone, Zone: "1", Parent: "1"}},
+			{{Action: BatchReorderZone, Zone: "1"}},
+			{{Action: BatchCreateZone, Reference: "a", Parent: "1"}, {Action: BatchReorderZone, Zone: "a", After: "1"}},
+			{{Action: BatchNameZone, Zone: "b"}},
+			{{Action: BatchNameDevice, Device: "missing"}},
+			{{Action: BatchAssignDevice, Device: "one", Zone: "9"}},
+		}
+
+		for _, operations := range invalid {
+			_, err := do.ApplyBatch(operations)
+			assert.Error(t, err, "%v", operations)
+		}
+
+		assert.Equal(t, before, do.ExportOrganisation())
+		assert.Empty(t, mep.Calls)
+		assert.Equal(t, 2, do.NewZone("Garage").Identifier)
+	})
+
+	t.Run("publishes events once the batch has been applied", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		mep.On("Publish", ZoneCreate{Identifier: 1, Name: "House"}).Once()
+		mep.On("Publish", DeviceMetadataUpdate{Identifier: "one", Name: "Lamp", Alias: "lamp"}).Once()
+		mep.On("Publish", DeviceAddedToZone{ZoneIdentifier: 1, DeviceIdentifier: "one"}).Once()
+
+		do := NewDeviceOrganiser(memory.New(), mep)
+		do.AddDevice("one")
+
+		_, err := do.ApplyBatch([]BatchOperation{
+			{Action: BatchCreateZone, Reference: "house", Name: "House"},
+			{Action: BatchNameDevice, Device: "one", Name: "Lamp"},
+			{Action: BatchAssignDevice, Device: "one", Zone: "house"},
+		})
+		assert.NoError(t, err)
+	})
+}
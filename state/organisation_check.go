@@ -0,0 +1,303 @@
+package state
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/persistence/converter"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type ProblemKind string
+
+const (
+	ProblemInvalidZone         ProblemKind = "invalid-zone"
+	ProblemOrphanZone          ProblemKind = "orphan-zone"
+	ProblemZoneCycle           ProblemKind = "zone-cycle"
+	ProblemOrderingGap         ProblemKind = "ordering-gap"
+	ProblemZoneCounter         ProblemKind = "zone-counter"
+	ProblemDanglingReference   ProblemKind = "dangling-reference"
+	ProblemDuplicateMembership ProblemKind = "duplicate-membership"
+	ProblemUnknownDevice       ProblemKind = "unknown-device"
+)
+
+// ConsistencyProblem is an inconsistency found in the organisation, either in the persisted data or between zones and
+// devices.
+type ConsistencyProblem struct {
+	Kind     ProblemKind
+	Zone     int    `json:",omitempty"`
+	Device   string `json:",omitempty"`
+	Detail   string
+	Repaired bool
+}
+
+func (p ConsistencyProblem) String() string {
+	var subject string
+
+	if p.Device != "" {
+		subject = fmt.Sprintf("device %s", p.Device)
+	} else {
+		subject = fmt.Sprintf("zone %d", p.Zone)
+	}
+
+	result := fmt.Sprintf("%s: %s: %s", p.Kind, subject, p.Detail)
+
+	if p.Repaired {
+		result += " (repaired)"
+	}
+
+	return result
+}
+
+// CheckConsistency looks for problems in the organisation, such as zones which could not be placed in the hierarchy
+// when loaded, broken ordering, and devices in zones which do not exist. If knownDevice is provided, devices it does
+// not know of are reported. If repair is set each problem is repaired, for persisted zones by storing the hierarchy as
+// loaded, and devices unknown to any gateway are marked as removed so that they are later purged.
+func (d *DeviceOrganiser) CheckConsistency(knownDevice func(string) bool, repair bool) []ConsistencyProblem {
+	if repair {
+		defer d.record("CheckConsistency")()
+	}
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	c := consistencyCheck{d: d, repair: repair}
+
+	c.checkZones()
+	c.checkOrdering()
+	c.checkDeviceZones()
+	c.checkMembership()
+
+	if knownDevice != nil {
+		c.checkKnownDevices(knownDevice)
+	}
+
+	return c.problems
+}
+
+type consistencyCheck struct {
+	d        *DeviceOrganiser
+	repair   bool
+	problems []ConsistencyProblem
+}
+
+func (c *consistencyCheck) add(problem ConsistencyProblem) {
+	problem.Repaired = c.repair
+	c.problems = append(c.problems, problem)
+}
+
+// checkZones compares the persisted hierarchy with that loaded, zones are left at the root if their parent was missing
+// or would have made them their own ancestor.
+func (c *consistencyCheck) checkZones() {
+	d := c.d
+
+	parents := map[int]int{}
+	maxId := 0
+
+	for _, key := range d.zoneConfig.SectionKeys() {
+		id, err := strconv.Atoi(key)
+		if err != nil || id <= RootZoneId {
+			c.add(ConsistencyProblem{Kind: ProblemInvalidZone, Detail: fmt.Sprintf("persisted zone has invalid identifier %q", key)})
+
+			if c.repair {
+				d.zoneConfig.SectionDelete(key)
+			}
+
+			continue
+		}
+
+		parent, _ := d.zoneConfig.Section(key).Int("ParentZone", int64(RootZoneId))
+		parents[id] = int(parent)
+
+		if id > maxId {
+			maxId = id
+		}
+	}
+
+	for _, id := range sortedKeys(parents) {
+		zone, found := d.zones[id]
+		if !found || zone.ParentZone == parents[id] {
+			continue
+		}
+
+		problem := ConsistencyProblem{Kind: ProblemZoneCycle, Zone: id, Detail: fmt.Sprintf("parent %d would make zone its own ancestor", parents[id])}
+
+		if _, found := parents[parents[id]]; !found {
+			problem = ConsistencyProblem{Kind: ProblemOrphanZone, Zone: id, Detail: fmt.Sprintf("parent %d does not exist", parents[id])}
+		}
+
+		c.add(problem)
+
+		if c.repair {
+			d.zoneConfig.Section(strconv.Itoa(id)).Set("ParentZone", zone.ParentZone)
+		}
+	}
+
+	if next := atomic.LoadInt64(d.nextZoneId); int64(maxId) > next {
+		c.add(ConsistencyProblem{Kind: ProblemZoneCounter, Zone: maxId, Detail: fmt.Sprintf("next zone identifier %d is already in use", next+1)})
+
+		if c.repair {
+			d.reserveZoneId(maxId)
+		}
+	}
+}
+
+// checkOrdering finds zones ordered after a zone which is not a sibling, or after the same zone as another sibling.
+// Repairs store the order of all siblings as loaded.
+func (c *consistencyCheck) checkOrdering() {
+	d := c.d
+
+	for _, parentId := range sortedKeys(d.zones) {
+		siblings := d.zones[parentId].SubZones
+		seen := map[int]int{}
+		broken := false
+
+		for _, id := range siblings {
+			afterId, _ := d.zoneConfig.Section(strconv.Itoa(id)).Int("OrderAfter")
+			after := int(afterId)
+
+			if after == RootZoneId {
+				continue
+			}
+
+			switch {
+			case after == id || !containsInt(siblings, after):
+				c.add(ConsistencyProblem{Kind: ProblemOrderingGap, Zone: id, Detail: fmt.Sprintf("ordered after zone %d which is not a sibling", after)})
+				broken = true
+			case seen[after] != 0:
+				c.add(ConsistencyProblem{Kind: ProblemOrderingGap, Zone: id, Detail: fmt.Sprintf("ordered after zone %d along with zone %d", after, seen[after])})
+				broken = true
+			default:
+				seen[after] = id
+			}
+		}
+
+		if broken && c.repair {
+			lastId := RootZoneId
+
+			for _, id := range siblings {
+				d.zoneConfig.Section(strconv.Itoa(id)).Set("OrderAfter", lastId)
+				lastId = id
+			}
+		}
+	}
+}
+
+// checkDeviceZones finds persisted zone membership of devices which refers to zones that do not exist.
+func (c *consistencyCheck) checkDeviceZones() {
+	d := c.d
+
+	for _, id := range sortedKeys(d.devices) {
+		s := d.deviceConfig.Section(id, "Zones")
+
+		for _, key := range s.SectionKeys() {
+			if zoneId, err := strconv.Atoi(key); err == nil && zoneId != RootZoneId {
+				if _, found := d.zones[zoneId]; found {
+					continue
+				}
+			}
+
+			c.add(ConsistencyProblem{Kind: ProblemDanglingReference, Device: id, Detail: fmt.Sprintf("member of zone %s which does not exist", key)})
+
+			if c.repair {
+				s.SectionDelete(key)
+			}
+		}
+	}
+}
+
+// checkMembership finds devices and zones whose membership of each other disagrees, or is duplicated. Device
+// membership is authoritative, and zones are rebuilt to match it.
+func (c *consistencyCheck) checkMembership() {
+	d := c.d
+
+	for _, id := range sortedKeys(d.devices) {
+		device := d.devices[id]
+
+		var zones []int
+
+		for _, zoneId := range device.Zones {
+			if _, found := d.zones[zoneId]; !found || zoneId == RootZoneId {
+				c.add(ConsistencyProblem{Kind: ProblemDanglingReference, Device: id, Detail: fmt.Sprintf("member of zone %d which does not exist", zoneId)})
+			} else if containsInt(zones, zoneId) {
+				c.add(ConsistencyProblem{Kind: ProblemDuplicateMembership, Device: id, Zone: zoneId, Detail: "member of zone more than once"})
+			} else {
+				zones = append(zones, zoneId)
+			}
+		}
+
+		if c.repair {
+			device.Zones = zones
+		}
+	}
+
+	for _, zoneId := range sortedKeys(d.zones) {
+		zone := d.zones[zoneId]
+
+		var devices []string
+
+		for _, id := range zone.Devices {
+			device, found := d.devices[id]
+
+			switch {
+			case !found:
+				c.add(ConsistencyProblem{Kind: ProblemDanglingReference, Zone: zoneId, Detail: fmt.Sprintf("contains device %s which does not exist", id)})
+			case !containsInt(device.Zones, zoneId):
+				c.add(ConsistencyProblem{Kind: ProblemDanglingReference, Zone: zoneId, Detail: fmt.Sprintf("contains device %s which is not a member", id)})
+			case containsString(devices, id):
+				c.add(ConsistencyProblem{Kind: ProblemDuplicateMembership, Zone: zoneId, Device: id, Detail: "contains device more than once"})
+			default:
+				devices = append(devices, id)
+			}
+		}
+
+		for _, id := range sortedKeys(d.devices) {
+			if containsInt(d.devices[id].Zones, zoneId) && !containsString(zone.Devices, id) {
+				c.add(ConsistencyProblem{Kind: ProblemDanglingReference, Zone: zoneId, Device: id, Detail: "device is a member but not contained by zone"})
+				devices = append(devices, id)
+			}
+		}
+
+		if c.repair {
+			zone.Devices = devices
+		}
+	}
+}
+
+// checkKnownDevices finds devices which are not known to any gateway, and have not already been marked as removed.
+func (c *consistencyCheck) checkKnownDevices(knownDevice func(string) bool) {
+	d := c.d
+
+	for _, id := range sortedKeys(d.devices) {
+		device := d.devices[id]
+
+		if !device.removed.IsZero() || knownDevice(id) {
+			continue
+		}
+
+		c.add(ConsistencyProblem{Kind: ProblemUnknownDevice, Device: id, Detail: "not known to any gateway"})
+
+		if c.repair {
+			device.removed = time.Now()
+			converter.Store(d.deviceConfig.Section(id), "Removed", device.removed, converter.TimeEncoder)
+		}
+	}
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	var keys []K
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
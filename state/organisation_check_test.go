@@ -0,0 +1,119 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDeviceOrganiser_CheckConsistency(t *testing.T) {
+	t.Run("finds no problems in a consistent organisation", func(t *testing.T) {
+		do := populatedOrganiser()
+		_ = do.ReorderZoneBefore(3, 2)
+
+		assert.Empty(t, do.CheckConsistency(nil, false))
+	})
+
+	t.Run("finds and repairs problems in the persisted organisation", func(t *testing.T) {
+		s := memory.New()
+
+		zones := s.Section("Zones")
+		zones.Set("NextZoneId", int64(2))
+		zones.Section("0").Set("Name", "Root")
+		zones.Section("kitchen").Set("Name", "Kitchen")
+
+		zones.Section("1").Set("Name", "House")
+		zones.Section("2").Set("Name", "Lounge")
+		zones.Section("2").Set("ParentZone", int64(1))
+		zones.Section("3").Set("Name", "Garden")
+		zones.Section("3").Set("ParentZone", int64(9))
+		zones.Section("4").Set("Name", "Upstairs")
+		zones.Section("4").Set("ParentZone", int64(5))
+		zones.Section("5").Set("Name", "Downstairs")
+		zones.Section("5").Set("ParentZone", int64(4))
+		zones.Section("6").Set("Name", "Shed")
+		zones.Section("6").Set("OrderAfter", int64(2))
+
+		s.Section("Devices", "one", "Zones", "2")
+		s.Section("Devices", "one", "Zones", "7")
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+
+		problems := do.CheckConsistency(nil, false)
+
+		kinds := map[ProblemKind]int{}
+		for _, problem := range problems {
+			assert.False(t, problem.Repaired)
+			kinds[problem.Kind]++
+		}
+
+		assert.Equal(t, map[ProblemKind]int{
+			ProblemInvalidZone:       2,
+			ProblemOrphanZone:        1,
+			ProblemZoneCycle:         1,
+			ProblemZoneCounter:       1,
+			ProblemOrderingGap:       1,
+			ProblemDanglingReference: 1,
+		}, kinds)
+
+		assert.Contains(t, problems, ConsistencyProblem{Kind: ProblemOrphanZone, Zone: 3, Detail: "parent 9 does not exist"})
+		assert.Contains(t, problems, ConsistencyProblem{Kind: ProblemDanglingReference, Device: "one", Detail: "member of zone 7 which does not exist"})
+
+		repaired := do.CheckConsistency(nil, true)
+		assert.Len(t, repaired, len(problems))
+		assert.True(t, repaired[0].Repaired)
+
+		assert.Empty(t, do.CheckConsistency(nil, false))
+
+		before := do.ExportOrganisation()
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		assert.Empty(t, reloaded.CheckConsistency(nil, false))
+		assert.Equal(t, before, reloaded.ExportOrganisation())
+		assert.Equal(t, 7, reloaded.NewZone("New").Identifier)
+	})
+
+	t.Run("finds and repairs duplicate and mismatched membership", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		do.devices["one"].Zones = append(do.devices["one"].Zones, 2)
+		do.zones[3].Devices = append(do.zones[3].Devices, "one", "missing")
+		do.zones[2].Devices = nil
+
+		problems := do.CheckConsistency(nil, true)
+		assert.Equal(t, []ConsistencyProblem{
+			{Kind: ProblemDuplicateMembership, Device: "one", Zone: 2, Detail: "member of zone more than once", Repaired: true},
+			{Kind: ProblemDanglingReference, Zone: 2, Device: "one", Detail: "device is a member but not contained by zone", Repaired: true},
+			{Kind: ProblemDanglingReference, Zone: 3, Detail: "contains device one which is not a member", Repaired: true},
+			{Kind: ProblemDanglingReference, Zone: 3, Detail: "contains device missing which does not exist", Repaired: true},
+		}, problems)
+
+		assert.Empty(t, do.CheckConsistency(nil, false))
+
+		zone, _ := do.Zone(2)
+		assert.Equal(t, []string{"one"}, zone.Devices)
+
+		zone, _ = do.Zone(3)
+		assert.Equal(t, []string{"two"}, zone.Devices)
+	})
+
+	t.Run("marks devices unknown to any gateway as removed", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		known := func(id string) bool {
+			return id == "one"
+		}
+
+		problems := do.CheckConsistency(known, true)
+		assert.Equal(t, []ConsistencyProblem{
+			{Kind: ProblemUnknownDevice, Device: "two", Detail: "not known to any gateway", Repaired: true},
+		}, problems)
+
+		assert.Empty(t, do.CheckConsistency(known, false))
+
+		do.PurgeRemovedDevices(0)
+
+		_, found := do.Device("two")
+		assert.False(t, found)
+	})
+}
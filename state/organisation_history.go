@@ -0,0 +1,686 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shimmeringbee/persistence"
+	"github.com/shimmeringbee/persistence/converter"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHistoryLength is the number of changes to the organisation retained in its history.
+const DefaultHistoryLength = 100
+
+// ActorSystem is recorded as the actor of changes made by the controller itself, rather than on behalf of a user.
+const ActorSystem = "system"
+
+// HistoryEntry is a versioned change to the organisation. Reverts is the version reverted to or undone, if the entry
+// is a revert or undo.
+type HistoryEntry struct {
+	Version   int64
+	Time      time.Time
+	Actor     string
+	Operation string
+	Reverts   int64 `json:",omitempty"`
+	Changes   []OrganisationChange
+
+	delta historyDelta
+}
+
+type organisationHistory struct {
+	lock        *sync.Mutex
+	entriesLock *sync.Mutex
+	config      persistence.Section
+	length      int
+	nextVersion int64
+	entries     []HistoryEntry
+	current     organisationPlan
+}
+
+func newOrganisationHistory(config persistence.Section, length int) *organisationHistory {
+	return &organisationHistory{
+		lock:        &sync.Mutex{},
+		entriesLock: &sync.Mutex{},
+		config:      config,
+		length:      length,
+		nextVersion: 1,
+		current:     newOrganisationPlan(),
+	}
+}
+
+// WithActor returns the organiser, recording any changes made through it against an actor such as a user.
+func (d *DeviceOrganiser) WithActor(actor string) *DeviceOrganiser {
+	c := *d
+	c.actor = actor
+	return &c
+}
+
+// Record makes several changes to the organisation as a single change, recording them as one entry in the history. The
+// changes are made to a copy of the organisation provided to fn, which replaces the organisation only if fn succeeds.
+// Events are published once it has, and fn must not use the organisation other than through the copy.
+func (d *DeviceOrganiser) Record(operation string, fn func(*DeviceOrganiser) error) error {
+	defer d.record(operation)()
+	return d.transact(true, fn)
+}
+
+// History returns the recorded changes to the organisation, oldest first.
+func (d *DeviceOrganiser) History() []HistoryEntry {
+	d.history.entriesLock.Lock()
+	defer d.history.entriesLock.Unlock()
+
+	return append([]HistoryEntry{}, d.history.entries...)
+}
+
+// HistoryVersionAt returns the version of the organisation at a point in time.
+func (d *DeviceOrganiser) HistoryVersionAt(t time.Time) (int64, error) {
+	d.history.entriesLock.Lock()
+	defer d.history.entriesLock.Unlock()
+
+	entries := d.history.entries
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Time.After(t) {
+			return entries[i].Version, nil
+		}
+	}
+
+	if len(entries) > 0 && entries[0].Version == 1 {
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("no history at %s: %w", t.Format(time.RFC3339), ErrNotFound)
+}
+
+// RevertOrganisation returns the organisation to how it was after a version in the history, version zero being before
+// the first change. The revert is itself recorded as a change, and so can be undone.
+func (d *DeviceOrganiser) RevertOrganisation(version int64) ([]OrganisationChange, error) {
+	defer d.beginChange("RevertOrganisation", version)()
+
+	target, found := d.history.planAfter(version)
+	if !found {
+		return nil, fmt.Errorf("history version %d: %w", version, ErrNotFound)
+	}
+
+	return d.nested().ImportOrganisation(target.document(), ImportReplace, false)
+}
+
+// UndoChange reverses a single change in the history, leaving any later changes to other zones and devices in place.
+func (d *DeviceOrganiser) UndoChange(version int64) ([]OrganisationChange, error) {
+	defer d.beginChange("UndoChange", version)()
+
+	entry, found := d.history.entry(version)
+	if !found {
+		return nil, fmt.Errorf("history version %d: %w", version, ErrNotFound)
+	}
+
+	after, _ := d.history.planAfter(version)
+
+	before := after.copy()
+	entry.delta.reverse(before)
+
+	current, err := planOrganisation(d.ExportOrganisation())
+	if err != nil {
+		return nil, err
+	}
+
+	target := undoOrganisationPlan(current, before, after)
+
+	if err := target.validate(); err != nil {
+		return nil, err
+	}
+
+	return d.nested().ImportOrganisation(target.document(), ImportReplace, false)
+}
+
+// record begins a change to the organisation, the returned function must be called once the change has been made to
+// record it in the history.
+func (d *DeviceOrganiser) record(operation string) func() {
+	return d.beginChange(operation, 0)
+}
+
+// beginChange locks the history until the returned function is called, which compares the organisation with how it
+// was after the last change and records any difference.
+func (d *DeviceOrganiser) beginChange(operation string, reverts int64) func() {
+	if d.loading || d.recording || d.history == nil {
+		return func() {}
+	}
+
+	d.history.lock.Lock()
+
+	return func() {
+		defer d.history.lock.Unlock()
+
+		actor := d.actor
+		if actor == "" {
+			actor = ActorSystem
+		}
+
+		after, err := planOrganisation(d.ExportOrganisation())
+		if err != nil {
+			return
+		}
+
+		d.history.add(actor, operation, reverts, after)
+	}
+}
+
+// nested returns the organiser for use within a change that is already being recorded.
+func (d *DeviceOrganiser) nested() *DeviceOrganiser {
+	c := *d
+	c.recording = true
+	return &c
+}
+
+// add records the difference between the organisation after the last change and after this one, the history lock
+// must be held.
+func (h *organisationHistory) add(actor string, operation string, reverts int64, after organisationPlan) {
+	before := h.current
+	h.current = after
+
+	delta := diffHistoryPlans(before, after)
+	if delta.empty() {
+		return
+	}
+
+	h.entriesLock.Lock()
+	defer h.entriesLock.Unlock()
+
+	entry := HistoryEntry{
+		Version:   h.nextVersion,
+		Time:      time.Now(),
+		Actor:     actor,
+		Operation: operation,
+		Reverts:   reverts,
+		Changes:   diffPlanChanges(before, after),
+		delta:     delta,
+	}
+
+	h.nextVersion++
+	h.entries = append(h.entries, entry)
+
+	h.config.Set("NextVersion", h.nextVersion)
+	h.persist(entry)
+
+	for len(h.entries) > h.length {
+		h.config.SectionDelete(strconv.FormatInt(h.entries[0].Version, 10))
+		h.entries = h.entries[1:]
+	}
+}
+
+func (h *organisationHistory) persist(entry HistoryEntry) {
+	s := h.config.Section(strconv.FormatInt(entry.Version, 10))
+
+	converter.Store(s, "Time", entry.Time, converter.TimeEncoder)
+	s.Set("Actor", entry.Actor)
+	s.Set("Operation", entry.Operation)
+	s.Set("Reverts", entry.Reverts)
+
+	if data, err := json.Marshal(entry.Changes); err == nil {
+		s.Set("Changes", string(data))
+	}
+
+	if data, err := json.Marshal(entry.delta); err == nil {
+		s.Set("Delta", string(data))
+	}
+}
+
+// load restores the persisted history, the current organisation must be set once the organiser has been loaded.
+func (h *organisationHistory) load() {
+	h.nextVersion, _ = h.config.Int("NextVersion", 1)
+
+	for _, key := range h.config.SectionKeys() {
+		version, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s := h.config.Section(key)
+
+		entry := HistoryEntry{Version: version}
+		entry.Time, _ = converter.Retrieve(s, "Time", converter.TimeDecoder)
+		entry.Actor, _ = s.String("Actor")
+		entry.Operation, _ = s.String("Operation")
+		entry.Reverts, _ = s.Int("Reverts")
+
+		changes, _ := s.String("Changes")
+		delta, _ := s.String("Delta")
+
+		if json.Unmarshal([]byte(changes), &entry.Changes) != nil || json.Unmarshal([]byte(delta), &entry.delta) != nil {
+			continue
+		}
+
+		h.entries = append(h.entries, entry)
+
+		if version >= h.nextVersion {
+			h.nextVersion = version + 1
+		}
+	}
+
+	sort.Slice(h.entries, func(i, j int) bool {
+		return h.entries[i].Version < h.entries[j].Version
+	})
+}
+
+func (h *organisationHistory) entry(version int64) (HistoryEntry, bool) {
+	h.entriesLock.Lock()
+	defer h.entriesLock.Unlock()
+
+	for _, entry := range h.entries {
+		if entry.Version == version {
+			return entry, true
+		}
+	}
+
+	return HistoryEntry{}, false
+}
+
+// planAfter returns the organisation as it was after a version, version zero being before the first change, by
+// reversing each later change from the organisation as it is now. The history lock must be held.
+func (h *organisationHistory) planAfter(version int64) (organisationPlan, bool) {
+	h.entriesLock.Lock()
+	defer h.entriesLock.Unlock()
+
+	plan := h.current.copy()
+	found := false
+
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[i]
+
+		if entry.Version == version || entry.Version == version+1 {
+			found = true
+		}
+
+		if entry.Version > version {
+			entry.delta.reverse(plan)
+		}
+	}
+
+	return plan, found
+}
+
+// diffPlanChanges describes the changes between two plans, including the removal of devices.
+func diffPlanChanges(before organisationPlan, after organisationPlan) []OrganisationChange {
+	changes := diffOrganisationPlans(before, after)
+
+	for _, id := range before.deviceIds() {
+		if _, found := after.devices[id]; !found {
+			changes = append(changes, OrganisationChange{Action: ChangeDelete, Device: id})
+		}
+	}
+
+	return changes
+}
+
+// historyDelta records the zones, ordering of zones and devices changed by an entry in the history, as they were
+// before and after the change. A nil state is one which did not exist.
+type historyDelta struct {
+	Zones    []zoneDelta     `json:",omitempty"`
+	SubZones []subZonesDelta `json:",omitempty"`
+	Devices  []deviceDelta   `json:",omitempty"`
+}
+
+type zoneDelta struct {
+	Identifier int
+	Before     *plannedZone `json:",omitempty"`
+	After      *plannedZone `json:",omitempty"`
+}
+
+type plannedZone struct {
+	Zone   OrganisationZone
+	Parent int
+}
+
+type subZonesDelta struct {
+	Parent int
+	Before []int `json:",omitempty"`
+	After  []int `json:",omitempty"`
+}
+
+type deviceDelta struct {
+	Identifier string
+	Before     *OrganisationDevice `json:",omitempty"`
+	After      *OrganisationDevice `json:",omitempty"`
+}
+
+func diffHistoryPlans(before organisationPlan, after organisationPlan) historyDelta {
+	var delta historyDelta
+
+	zoneIds := uniqueInts(append(before.zoneIds(), after.zoneIds()...))
+	sort.Ints(zoneIds)
+
+	for _, id := range zoneIds {
+		change := zoneDelta{Identifier: id}
+
+		if zone, found := before.zones[id]; found {
+			change.Before = &plannedZone{Zone: zone, Parent: before.parents[id]}
+		}
+
+		if zone, found := after.zones[id]; found {
+			change.After = &plannedZone{Zone: zone, Parent: after.parents[id]}
+		}
+
+		if !reflect.DeepEqual(change.Before, change.After) {
+			delta.Zones = append(delta.Zones, change)
+		}
+	}
+
+	var parents []int
+
+	for _, p := range []organisationPlan{before, after} {
+		for parent := range p.children {
+			parents = append(parents, parent)
+		}
+	}
+
+	parents = uniqueInts(parents)
+	sort.Ints(parents)
+
+	for _, parent := range parents {
+		if !sameOrder(before.children[parent], after.children[parent]) {
+			delta.SubZones = append(delta.SubZones, subZonesDelta{Parent: parent, Before: before.children[parent], After: after.children[parent]})
+		}
+	}
+
+	for _, id := range uniqueStrings(append(before.deviceIds(), after.deviceIds()...)) {
+		change := deviceDelta{Identifier: id}
+
+		if device, found := before.devices[id]; found {
+			change.Before = &device
+		}
+
+		if device, found := after.devices[id]; found {
+			change.After = &device
+		}
+
+		if !reflect.DeepEqual(change.Before, change.After) {
+			delta.Devices = append(delta.Devices, change)
+		}
+	}
+
+	return delta
+}
+
+func (h historyDelta) empty() bool {
+	return len(h.Zones) == 0 && len(h.SubZones) == 0 && len(h.Devices) == 0
+}
+
+// reverse returns the zones and devices in a plan to how they were before the change.
+func (h historyDelta) reverse(p organisationPlan) {
+	for _, change := range h.Zones {
+		if change.Before == nil {
+			delete(p.zones, change.Identifier)
+			delete(p.parents, change.Identifier)
+		} else {
+			p.zones[change.Identifier] = change.Before.Zone
+			p.parents[change.Identifier] = change.Before.Parent
+		}
+	}
+
+	for _, change := range h.SubZones {
+		if len(change.Before) == 0 {
+			delete(p.children, change.Parent)
+		} else {
+			p.children[change.Parent] = append([]int{}, change.Before...)
+		}
+	}
+
+	for _, change := range h.Devices {
+		if change.Before == nil {
+			delete(p.devices, change.Identifier)
+		} else {
+			p.devices[change.Identifier] = *change.Before
+		}
+	}
+}
+
+func sameOrder(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// undoOrganisationPlan returns the current plan with every zone and device changed between before and after returned
+// to how it was before. Zones created by the change are removed, and devices are removed from zones which no longer
+// exist.
+func undoOrganisationPlan(current organisationPlan, before organisationPlan, after organisationPlan) organisationPlan {
+	target := current.copy()
+
+	kept := func(id int) bool {
+		_, inBefore := before.zones[id]
+		_, inAfter := after.zones[id]
+
+		return inBefore && inAfter && before.parents[id] == after.parents[id]
+	}
+
+	changed := func(id int) bool {
+		bz, inBefore := before.zones[id]
+		az, inAfter := after.zones[id]
+
+		if inBefore != inAfter {
+			return true
+		}
+
+		bz.SubZones, az.SubZones = nil, nil
+
+		return !reflect.DeepEqual(bz, az) || before.parents[id] != after.parents[id] || before.previousSibling(id, kept) != after.previousSibling(id, kept)
+	}
+
+	for _, id := range after.zoneIds() {
+		if _, inBefore := before.zones[id]; !inBefore {
+			target.removeZone(id)
+		}
+	}
+
+	for _, id := range before.zoneOrder(RootZoneId) {
+		if changed(id) {
+			target.restoreZone(id, before)
+		}
+	}
+
+	for _, id := range uniqueStrings(append(before.deviceIds(), after.deviceIds()...)) {
+		bd, inBefore := before.devices[id]
+		ad, inAfter := after.devices[id]
+
+		if inBefore && inAfter && reflect.DeepEqual(bd, ad) {
+			continue
+		}
+
+		if inBefore {
+			target.devices[id] = bd
+		} else if _, found := target.devices[id]; found {
+			target.devices[id] = OrganisationDevice{Identifier: id}
+		}
+	}
+
+	for id, device := range target.devices {
+		var zones []int
+
+		for _, zoneId := range device.Zones {
+			if _, found := target.zones[zoneId]; found {
+				zones = append(zones, zoneId)
+			}
+		}
+
+		device.Zones = zones
+		target.devices[id] = device
+	}
+
+	return target
+}
+
+func (p organisationPlan) copy() organisationPlan {
+	c := newOrganisationPlan()
+
+	for id, zone := range p.zones {
+		c.zones[id] = zone
+	}
+
+	for id, parent := range p.parents {
+		c.parents[id] = parent
+	}
+
+	for id, children := range p.children {
+		c.children[id] = append([]int{}, children...)
+	}
+
+	for id, device := range p.devices {
+		c.devices[id] = device
+	}
+
+	return c
+}
+
+// zoneOrder returns the zones beneath a zone, each zone listed before those beneath it.
+func (p organisationPlan) zoneOrder(parent int) []int {
+	var ids []int
+
+	for _, id := range p.children[parent] {
+		ids = append(ids, id)
+		ids = append(ids, p.zoneOrder(id)...)
+	}
+
+	return ids
+}
+
+// removeZone removes a zone from the plan, the zones beneath it taking its place.
+func (p organisationPlan) removeZone(id int) {
+	if _, found := p.zones[id]; !found {
+		return
+	}
+
+	parent := p.parents[id]
+
+	var siblings []int
+
+	for _, sibling := range p.children[parent] {
+		if sibling == id {
+			for _, child := range p.children[id] {
+				siblings = append(siblings, child)
+				p.parents[child] = parent
+			}
+		} else {
+			siblings = append(siblings, sibling)
+		}
+	}
+
+	p.children[parent] = siblings
+
+	delete(p.children, id)
+	delete(p.parents, id)
+	delete(p.zones, id)
+}
+
+// restoreZone places a zone as it was in another plan, beneath its old parent if that still exists and would not make
+// the zone its own ancestor, after the nearest of its old siblings that is still in place.
+func (p organisationPlan) restoreZone(id int, from organisationPlan) {
+	parent := from.parents[id]
+
+	if _, found := p.zones[parent]; parent != RootZoneId && !found {
+		parent = RootZoneId
+	}
+
+	if existing, found := p.parents[id]; found {
+		if p.isAncestor(id, parent) {
+			parent = existing
+		}
+
+		p.children[existing] = filterInt(p.children[existing], id)
+	}
+
+	after := from.previousSibling(id, func(sibling int) bool {
+		return containsInt(p.children[parent], sibling)
+	})
+
+	var children []int
+
+	if after == RootZoneId {
+		children = append(children, id)
+	}
+
+	for _, sibling := range p.children[parent] {
+		children = append(children, sibling)
+
+		if sibling == after {
+			children = append(children, id)
+		}
+	}
+
+	zone := from.zones[id]
+	zone.SubZones = nil
+
+	p.zones[id] = zone
+	p.parents[id] = parent
+	p.children[parent] = children
+}
+
+func (p organisationPlan) isAncestor(ancestor int, id int) bool {
+	for id != RootZoneId {
+		if id == ancestor {
+			return true
+		}
+
+		id = p.parents[id]
+	}
+
+	return false
+}
+
+// document returns the organisation document described by the plan.
+func (p organisationPlan) document() OrganisationDocument {
+	doc := OrganisationDocument{
+		Version: OrganisationDocumentVersion,
+		Zones:   p.documentZones(RootZoneId),
+	}
+
+	for _, id := range p.deviceIds() {
+		doc.Devices = append(doc.Devices, p.devices[id])
+	}
+
+	return doc
+}
+
+func (p organisationPlan) documentZones(parent int) []OrganisationZone {
+	var zones []OrganisationZone
+
+	for _, id := range p.children[parent] {
+		zone := p.zones[id]
+		zone.SubZones = p.documentZones(id)
+		zones = append(zones, zone)
+	}
+
+	return zones
+}
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+
+	for _, value := range values {
+		if !containsString(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, check := range haystack {
+		if check == needle {
+			return true
+		}
+	}
+
+	return false
+}
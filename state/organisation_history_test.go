@@ -0,0 +1,274 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeviceOrganiser_History(t *testing.T) {
+	t.Run("records each change with its actor", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+
+		zone := do.WithActor("alice").NewZone("Kitchen")
+		_ = do.WithActor("bob").AddDeviceToZone("one", zone.Identifier)
+		_ = do.NameZone(99, "Missing")
+
+		history := do.History()
+		assert.Len(t, history, 3)
+
+		assert.Equal(t, int64(1), history[0].Version)
+		assert.Equal(t, ActorSystem, history[0].Actor)
+		assert.Equal(t, "AddDevice", history[0].Operation)
+
+		assert.Equal(t, int64(2), history[1].Version)
+		assert.Equal(t, "alice", history[1].Actor)
+		assert.Equal(t, "NewZone", history[1].Operation)
+		assert.Equal(t, []OrganisationChange{{Action: ChangeCreate, Zone: zone.Identifier}}, history[1].Changes)
+
+		assert.Equal(t, "bob", history[2].Actor)
+		assert.Equal(t, []OrganisationChange{{Action: ChangeUpdate, Device: "one", Fields: []string{"Zones"}}}, history[2].Changes)
+	})
+
+	t.Run("records several changes as a single change, making none if any fail", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		err := do.WithActor("alice").Record("Rooms", func(tx *DeviceOrganiser) error {
+			tx.NewZone("Kitchen")
+			tx.NewZone("Lounge")
+			return nil
+		})
+		assert.NoError(t, err)
+
+		err = do.Record("Failing", func(tx *DeviceOrganiser) error {
+			tx.NewZone("Garage")
+			return tx.NameZone(99, "Missing")
+		})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.Len(t, do.RootZones(), 2)
+
+		history := do.History()
+		assert.Len(t, history, 1)
+		assert.Equal(t, "alice", history[0].Actor)
+		assert.Equal(t, "Rooms", history[0].Operation)
+		assert.Len(t, history[0].Changes, 2)
+	})
+
+	t.Run("records an import as a single change", func(t *testing.T) {
+		do := populatedOrganiser()
+		count := len(do.History())
+
+		_, err := do.ImportOrganisation(OrganisationDocument{Version: OrganisationDocumentVersion}, ImportReplace, false)
+		assert.NoError(t, err)
+
+		history := do.History()
+		assert.Len(t, history, count+1)
+		assert.Equal(t, "ImportOrganisation", history[count].Operation)
+	})
+
+	t.Run("is persisted and limited in length", func(t *testing.T) {
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+
+		for i := 0; i < DefaultHistoryLength+5; i++ {
+			do.NewZone("Zone")
+		}
+
+		history := do.History()
+		assert.Len(t, history, DefaultHistoryLength)
+		assert.Equal(t, int64(6), history[0].Version)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		reloadedHistory := reloaded.History()
+		assert.Len(t, reloadedHistory, DefaultHistoryLength)
+		assert.Equal(t, history[0].Changes, reloadedHistory[0].Changes)
+
+		reloaded.NewZone("Zone")
+		assert.Equal(t, int64(DefaultHistoryLength+6), reloaded.History()[DefaultHistoryLength-1].Version)
+	})
+
+	t.Run("records only the zones and devices changed", func(t *testing.T) {
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		do.NewZone("Kitchen")
+
+		_ = do.NameDevice("two", "Lamp")
+
+		history := do.History()
+		last := history[len(history)-1]
+
+		assert.Empty(t, last.delta.Zones)
+		assert.Empty(t, last.delta.SubZones)
+		assert.Equal(t, []deviceDelta{{
+			Identifier: "two",
+			Before:     &OrganisationDevice{Identifier: "two"},
+			After:      &OrganisationDevice{Identifier: "two", Name: "Lamp"},
+		}}, last.delta.Devices)
+
+		persisted := s.Section("History", strconv.FormatInt(last.Version, 10))
+		assert.True(t, persisted.Exists("Delta"))
+		assert.False(t, persisted.Exists("Before"))
+		assert.False(t, persisted.Exists("After"))
+	})
+
+	t.Run("does not record adding a device which is already known", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("one")
+
+		assert.Len(t, do.History(), 1)
+	})
+}
+
+func TestDeviceOrganiser_RevertOrganisation(t *testing.T) {
+	t.Run("reverts to a version, recording the revert", func(t *testing.T) {
+		do := populatedOrganiser()
+		history := do.History()
+		version := history[len(history)-1].Version
+		before := do.ExportOrganisation()
+
+		_ = do.DeleteZoneRecursive(1, RootZoneId)
+		_ = do.NameDevice("two", "Lamp Two")
+
+		_, err := do.RevertOrganisation(version)
+		assert.NoError(t, err)
+		assert.Equal(t, before, do.ExportOrganisation())
+
+		history = do.History()
+		last := history[len(history)-1]
+		assert.Equal(t, "RevertOrganisation", last.Operation)
+		assert.Equal(t, version, last.Reverts)
+	})
+
+	t.Run("reverts to before the first change", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.NewZone("Kitchen")
+
+		version, err := do.HistoryVersionAt(time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), version)
+
+		_, err = do.RevertOrganisation(version)
+		assert.NoError(t, err)
+		assert.Empty(t, do.RootZones())
+
+		version, err = do.HistoryVersionAt(time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), version)
+	})
+
+	t.Run("reverts to a version recorded before the organiser was reloaded", func(t *testing.T) {
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		house := do.NewZone("House")
+		kitchen := do.NewZone("Kitchen")
+		_ = do.MoveZone(kitchen.Identifier, house.Identifier)
+		_ = do.AddDeviceToZone("one", kitchen.Identifier)
+
+		history := do.History()
+		version := history[len(history)-1].Version
+		before := do.ExportOrganisation()
+
+		lounge := do.NewZone("Lounge")
+		_ = do.ReorderZoneBefore(lounge.Identifier, house.Identifier)
+		_ = do.MoveZone(kitchen.Identifier, lounge.Identifier)
+		_ = do.NameDevice("one", "Kettle")
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+
+		_, err := reloaded.RevertOrganisation(version)
+		assert.NoError(t, err)
+		assert.Equal(t, before, reloaded.ExportOrganisation())
+	})
+
+	t.Run("fails for unknown versions", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		_, err := do.RevertOrganisation(1000)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestDeviceOrganiser_UndoChange(t *testing.T) {
+	t.Run("undoes a change, leaving later changes in place", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		_ = do.RemoveDeviceFromZone("one", 2)
+		removal := do.History()[len(do.History())-1].Version
+
+		_ = do.NameZone(3, "Living Room")
+
+		_, err := do.UndoChange(removal)
+		assert.NoError(t, err)
+
+		dm, _ := do.Device("one")
+		assert.Equal(t, []int{2}, dm.Zones)
+
+		zone, _ := do.Zone(3)
+		assert.Equal(t, "Living Room", zone.Name)
+
+		history := do.History()
+		last := history[len(history)-1]
+		assert.Equal(t, "UndoChange", last.Operation)
+		assert.Equal(t, removal, last.Reverts)
+	})
+
+	t.Run("undoes marking a device as sleepy", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		_ = do.SetDeviceSleepy("one", true)
+		change := do.History()[len(do.History())-1]
+		assert.Equal(t, "SetDeviceSleepy", change.Operation)
+		assert.Equal(t, []OrganisationChange{{Action: ChangeUpdate, Device: "one", Fields: []string{"Sleepy"}}}, change.Changes)
+
+		_, err := do.UndoChange(change.Version)
+		assert.NoError(t, err)
+
+		dm, _ := do.Device("one")
+		assert.False(t, dm.Sleepy)
+	})
+
+	t.Run("undoes a deletion, restoring the zone in place", func(t *testing.T) {
+		do := populatedOrganiser()
+		before := do.ExportOrganisation()
+
+		_ = do.DeleteZoneRecursive(2, RootZoneId)
+		deletion := do.History()[len(do.History())-1].Version
+
+		_, err := do.UndoChange(deletion)
+		assert.NoError(t, err)
+		assert.Equal(t, before, do.ExportOrganisation())
+	})
+
+	t.Run("undoes a creation, keeping later zones beneath it", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		garage := do.NewZone("Garage")
+		creation := do.History()[len(do.History())-1].Version
+
+		_ = do.MoveZone(3, garage.Identifier)
+
+		_, err := do.UndoChange(creation)
+		assert.NoError(t, err)
+
+		_, found := do.Zone(garage.Identifier)
+		assert.False(t, found)
+
+		zone, _ := do.Zone(3)
+		assert.Equal(t, RootZoneId, zone.ParentZone)
+	})
+
+	t.Run("fails for unknown versions", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		_, err := do.UndoChange(1000)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
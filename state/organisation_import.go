@@ -0,0 +1,701 @@
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+)
+
+type ImportMode string
+
+const (
+	ImportMerge   ImportMode = "merge"
+	ImportReplace ImportMode = "replace"
+)
+
+type ChangeAction string
+
+const (
+	ChangeCreate ChangeAction = "create"
+	ChangeUpdate ChangeAction = "update"
+	ChangeDelete ChangeAction = "delete"
+)
+
+// OrganisationChange describes a change made, or that would be made, to a zone or device by an import.
+type OrganisationChange struct {
+	Action ChangeAction
+	Zone   int      `json:",omitempty"`
+	Device string   `json:",omitempty"`
+	Fields []string `json:",omitempty"`
+}
+
+// ImportOrganisation applies a document to the organiser. In merge mode zones and devices in the document are created
+// or updated and everything else is left untouched, in replace mode zones missing from the document are deleted and
+// the metadata of devices missing from the document is cleared. The document is validated in full, and then applied to
+// a copy of the organisation which replaces it only if every change succeeds, so that aliases are checked against
+// those of every device including those derived from names. The changes are returned, if dryRun is set they are
+// calculated and checked but not made.
+func (d *DeviceOrganiser) ImportOrganisation(doc OrganisationDocument, mode ImportMode, dryRun bool) ([]OrganisationChange, error) {
+	defer d.record("ImportOrganisation")()
+
+	incoming, err := planOrganisation(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImportMode, mode)
+	}
+
+	var changes []OrganisationChange
+
+	err = d.transact(!dryRun, func(tx *DeviceOrganiser) error {
+		current, err := planOrganisation(tx.ExportOrganisation())
+		if err != nil {
+			return err
+		}
+
+		var target organisationPlan
+
+		if mode == ImportMerge {
+			target = mergeOrganisationPlans(current, incoming)
+		} else {
+			target = replaceOrganisationPlan(current, incoming)
+		}
+
+		if err := target.validate(); err != nil {
+			return err
+		}
+
+		if changes = diffOrganisationPlans(current, target); len(changes) == 0 {
+			return nil
+		}
+
+		return tx.applyOrganisationPlan(current, target)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// organisationPlan is a flattened organisation document, with zones recorded against their parent in order.
+type organisationPlan struct {
+	zones    map[int]OrganisationZone
+	parents  map[int]int
+	children map[int][]int
+	devices  map[string]OrganisationDevice
+}
+
+func newOrganisationPlan() organisationPlan {
+	return organisationPlan{
+		zones:    map[int]OrganisationZone{},
+		parents:  map[int]int{},
+		children: map[int][]int{},
+		devices:  map[string]OrganisationDevice{},
+	}
+}
+
+func planOrganisation(doc OrganisationDocument) (organisationPlan, error) {
+	p := newOrganisationPlan()
+
+	if doc.Version != OrganisationDocumentVersion {
+		return p, fmt.Errorf("%w: %d", ErrUnsupportedVersion, doc.Version)
+	}
+
+	if err := p.addZones(RootZoneId, doc.Zones); err != nil {
+		return p, err
+	}
+
+	if err := p.addDevices(doc.Devices); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (p organisationPlan) addZones(parent int, zones []OrganisationZone) error {
+	for _, zone := range zones {
+		id := zone.Identifier
+
+		if id <= RootZoneId {
+			return fmt.Errorf("%w: invalid zone identifier %d", ErrInvalidDocument, id)
+		}
+
+		if _, found := p.zones[id]; found {
+			return fmt.Errorf("%w: duplicate zone %d", ErrInvalidDocument, id)
+		}
+
+		if !zone.Kind.Valid() {
+			return fmt.Errorf("%w: zone %d: %w", ErrInvalidDocument, id, ErrInvalidZoneKind)
+		}
+
+		attributes, err := normaliseDocumentAttributes(zone.Attributes)
+		if err != nil {
+			return fmt.Errorf("%w: zone %d: %w", ErrInvalidDocument, id, err)
+		}
+
+		subZones := zone.SubZones
+
+		zone.Attributes = attributes
+		zone.SubZones = nil
+
+		if zone.Coordinates != nil {
+			c := *zone.Coordinates
+			zone.Coordinates = &c
+		}
+
+		p.zones[id] = zone
+		p.parents[id] = parent
+		p.children[parent] = append(p.children[parent], id)
+
+		if err := p.addZones(id, subZones); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p organisationPlan) addDevices(devices []OrganisationDevice) error {
+	for _, device := range devices {
+		id := device.Identifier
+
+		if id == "" {
+			return fmt.Errorf("%w: device without identifier", ErrInvalidDocument)
+		}
+
+		if _, found := p.devices[id]; found {
+			return fmt.Errorf("%w: duplicate device %s", ErrInvalidDocument, id)
+		}
+
+		if device.Alias != "" && !aliasPattern.MatchString(device.Alias) {
+			return fmt.Errorf("%w: device %s: %w", ErrInvalidDocument, id, ErrInvalidAlias)
+		}
+
+		attributes, err := normaliseDocumentAttributes(device.Attributes)
+		if err != nil {
+			return fmt.Errorf("%w: device %s: %w", ErrInvalidDocument, id, err)
+		}
+
+		device.Attributes = attributes
+		device.Tags = normaliseTags(device.Tags)
+		device.Zones = uniqueInts(device.Zones)
+
+		p.devices[id] = device
+	}
+
+	return nil
+}
+
+// validate checks that a plan refers only to zones within it, and that device aliases are unique and not the
+// identifier of another device.
+func (p organisationPlan) validate() error {
+	aliases := map[string]string{}
+
+	for _, id := range p.deviceIds() {
+		device := p.devices[id]
+
+		for _, zoneId := range device.Zones {
+			if _, found := p.zones[zoneId]; !found {
+				return fmt.Errorf("%w: device %s is in unknown zone %d", ErrInvalidDocument, id, zoneId)
+			}
+		}
+
+		if device.Alias == "" {
+			continue
+		}
+
+		if owner, found := aliases[device.Alias]; found {
+			return fmt.Errorf("%w: alias %s of device %s is used by %s: %w", ErrInvalidDocument, device.Alias, id, owner, ErrAliasInUse)
+		}
+
+		if _, found := p.devices[device.Alias]; found && device.Alias != id {
+			return fmt.Errorf("%w: alias %s of device %s is the identifier of another device: %w", ErrInvalidDocument, device.Alias, id, ErrAliasInUse)
+		}
+
+		aliases[device.Alias] = id
+	}
+
+	return nil
+}
+
+func (p organisationPlan) zoneIds() []int {
+	var ids []int
+
+	for id := range p.zones {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func (p organisationPlan) deviceIds() []string {
+	var ids []string
+
+	for id := range p.devices {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// previousSibling returns the zone ordered before a zone, ignoring any siblings that keep does not accept.
+func (p organisationPlan) previousSibling(id int, keep func(int) bool) int {
+	previous := RootZoneId
+
+	for _, sibling := range p.children[p.parents[id]] {
+		if sibling == id {
+			break
+		}
+
+		if keep(sibling) {
+			previous = sibling
+		}
+	}
+
+	return previous
+}
+
+// mergeOrganisationPlans overlays the incoming plan on the current. Zones from the incoming plan are ordered ahead of
+// any existing zones which share their parent.
+func mergeOrganisationPlans(current organisationPlan, incoming organisationPlan) organisationPlan {
+	target := newOrganisationPlan()
+
+	for _, p := range []organisationPlan{current, incoming} {
+		for id, zone := range p.zones {
+			target.zones[id] = zone
+			target.parents[id] = p.parents[id]
+		}
+
+		for id, device := range p.devices {
+			target.devices[id] = device
+		}
+	}
+
+	for parent := range target.zones {
+		target.mergeChildren(parent, current, incoming)
+	}
+
+	target.mergeChildren(RootZoneId, current, incoming)
+
+	return target
+}
+
+func (p organisationPlan) mergeChildren(parent int, current organisationPlan, incoming organisationPlan) {
+	children := append([]int{}, incoming.children[parent]...)
+
+	for _, id := range current.children[parent] {
+		if _, found := incoming.zones[id]; !found {
+			children = append(children, id)
+		}
+	}
+
+	if len(children) > 0 {
+		p.children[parent] = children
+	}
+}
+
+// replaceOrganisationPlan returns the incoming plan, clearing the metadata of any current devices missing from it.
+func replaceOrganisationPlan(current organisationPlan, incoming organisationPlan) organisationPlan {
+	for id := range current.devices {
+		if _, found := incoming.devices[id]; !found {
+			incoming.devices[id] = OrganisationDevice{Identifier: id}
+		}
+	}
+
+	return incoming
+}
+
+func diffOrganisationPlans(current organisationPlan, target organisationPlan) []OrganisationChange {
+	var changes []OrganisationChange
+
+	ids := uniqueInts(append(current.zoneIds(), target.zoneIds()...))
+	sort.Ints(ids)
+
+	kept := func(id int) bool {
+		_, inCurrent := current.zones[id]
+		_, inTarget := target.zones[id]
+
+		return inCurrent && inTarget && current.parents[id] == target.parents[id]
+	}
+
+	for _, id := range ids {
+		cz, inCurrent := current.zones[id]
+		tz, inTarget := target.zones[id]
+
+		switch {
+		case !inCurrent:
+			changes = append(changes, OrganisationChange{Action: ChangeCreate, Zone: id})
+		case !inTarget:
+			changes = append(changes, OrganisationChange{Action: ChangeDelete, Zone: id})
+		default:
+			var fields []string
+
+			if cz.Name != tz.Name {
+				fields = append(fields, "Name")
+			}
+
+			if cz.Kind != tz.Kind {
+				fields = append(fields, "Kind")
+			}
+
+			if cz.Icon != tz.Icon {
+				fields = append(fields, "Icon")
+			}
+
+			if !reflect.DeepEqual(cz.Attributes, tz.Attributes) {
+				fields = append(fields, "Attributes")
+			}
+
+			if !reflect.DeepEqual(cz.Coordinates, tz.Coordinates) {
+				fields = append(fields, "Coordinates")
+			}
+
+			if current.parents[id] != target.parents[id] {
+				fields = append(fields, "ParentZone")
+			} else if current.previousSibling(id, kept) != target.previousSibling(id, kept) {
+				fields = append(fields, "Order")
+			}
+
+			if len(fields) > 0 {
+				changes = append(changes, OrganisationChange{Action: ChangeUpdate, Zone: id, Fields: fields})
+			}
+		}
+	}
+
+	for _, id := range target.deviceIds() {
+		cd, inCurrent := current.devices[id]
+		td := target.devices[id]
+
+		if !inCurrent {
+			changes = append(changes, OrganisationChange{Action: ChangeCreate, Device: id})
+			continue
+		}
+
+		var fields []string
+
+		if cd.Name != td.Name {
+			fields = append(fields, "Name")
+		}
+
+		if cd.Alias != td.Alias {
+			fields = append(fields, "Alias")
+		}
+
+		if cd.Sleepy != td.Sleepy {
+			fields = append(fields, "Sleepy")
+		}
+
+		if !reflect.DeepEqual(cd.Tags, td.Tags) {
+			fields = append(fields, "Tags")
+		}
+
+		if !reflect.DeepEqual(cd.Attributes, td.Attributes) {
+			fields = append(fields, "Attributes")
+		}
+
+		if !sameInts(cd.Zones, td.Zones) {
+			fields = append(fields, "Zones")
+		}
+
+		if len(fields) > 0 {
+			changes = append(changes, OrganisationChange{Action: ChangeUpdate, Device: id, Fields: fields})
+		}
+	}
+
+	return changes
+}
+
+// applyOrganisationPlan changes the organiser from the current plan to the target, using the same operations as any
+// other change so that the usual events are published. Changes are made one at a time, and so should only be applied
+// within a transaction.
+func (d *DeviceOrganiser) applyOrganisationPlan(current organisationPlan, target organisationPlan) error {
+	for _, id := range target.zoneIds() {
+		if _, found := current.zones[id]; !found {
+			d.reserveZoneId(id)
+			d.newZoneWithId(target.zones[id].Name, id)
+		}
+	}
+
+	for id, parent := range target.parents {
+		if currentParent, found := current.parents[id]; found && currentParent != parent && currentParent != RootZoneId {
+			if err := d.MoveZone(id, RootZoneId); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := d.placeZones(target, RootZoneId); err != nil {
+		return err
+	}
+
+	for _, id := range current.zoneIds() {
+		if _, found := target.zones[id]; found {
+			continue
+		}
+
+		if _, found := d.Zone(id); found {
+			if err := d.DeleteZoneRecursive(id, RootZoneId); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range target.zoneIds() {
+		if err := d.applyOrganisationZone(target.zones[id]); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range target.deviceIds() {
+		if err := d.applyOrganisationDevice(current.devices[id], target.devices[id]); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range target.deviceIds() {
+		if alias := target.devices[id].Alias; alias != "" && alias != current.devices[id].Alias {
+			if err := d.SetDeviceAlias(id, alias); err != nil {
+				return fmt.Errorf("device %s: %w", id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// placeZones moves the children of a zone under it in order, working down the hierarchy.
+func (d *DeviceOrganiser) placeZones(target organisationPlan, parent int) error {
+	children := target.children[parent]
+
+	for _, id := range children {
+		if zone, _ := d.Zone(id); zone.ParentZone != parent {
+			if err := d.MoveZone(id, parent); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, id := range children {
+		parentZone, _ := d.Zone(parent)
+
+		var placed []int
+
+		for _, subId := range parentZone.SubZones {
+			if parentId, found := target.parents[subId]; found && parentId == parent {
+				placed = append(placed, subId)
+			}
+		}
+
+		switch {
+		case i == 0 && placed[0] != id:
+			if err := d.ReorderZoneBefore(id, placed[0]); err != nil {
+				return err
+			}
+		case i > 0 && placed[i] != id:
+			if err := d.ReorderZoneAfter(id, children[i-1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range children {
+		if err := d.placeZones(target, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DeviceOrganiser) applyOrganisationZone(tz OrganisationZone) error {
+	zone, found := d.Zone(tz.Identifier)
+	if !found {
+		return fmt.Errorf("zone %d: %w", tz.Identifier, ErrNotFound)
+	}
+
+	if zone.Name != tz.Name {
+		if err := d.NameZone(tz.Identifier, tz.Name); err != nil {
+			return err
+		}
+	}
+
+	if zone.Kind != tz.Kind {
+		if err := d.SetZoneKind(tz.Identifier, tz.Kind); err != nil {
+			return err
+		}
+	}
+
+	if zone.Icon != tz.Icon {
+		if err := d.SetZoneIcon(tz.Identifier, tz.Icon); err != nil {
+			return err
+		}
+	}
+
+	if updates := attributeUpdates(zone.Attributes, tz.Attributes); len(updates) > 0 {
+		if err := d.UpdateZoneAttributes(tz.Identifier, updates); err != nil {
+			return err
+		}
+	}
+
+	if !reflect.DeepEqual(zone.Coordinates, tz.Coordinates) {
+		if err := d.SetZoneCoordinates(tz.Identifier, tz.Coordinates); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyOrganisationDevice updates the metadata of a device, other than setting an explicit alias which is done once
+// all devices have released theirs.
+func (d *DeviceOrganiser) applyOrganisationDevice(cd OrganisationDevice, td OrganisationDevice) error {
+	id := td.Identifier
+
+	device, found := d.Device(id)
+	if !found {
+		d.AddDevice(id)
+	}
+
+	if device.Name != td.Name {
+		if err := d.NameDevice(id, td.Name); err != nil {
+			return err
+		}
+	}
+
+	if cd.Alias != "" && cd.Alias != td.Alias {
+		if err := d.SetDeviceAlias(id, ""); err != nil {
+			return err
+		}
+	}
+
+	if device.Sleepy != td.Sleepy {
+		if err := d.SetDeviceSleepy(id, td.Sleepy); err != nil {
+			return err
+		}
+	}
+
+	if !reflect.DeepEqual(device.Tags, td.Tags) {
+		if err := d.SetDeviceTags(id, td.Tags); err != nil {
+			return err
+		}
+	}
+
+	if updates := attributeUpdates(device.Attributes, td.Attributes); len(updates) > 0 {
+		if err := d.UpdateDeviceAttributes(id, updates); err != nil {
+			return err
+		}
+	}
+
+	device, _ = d.Device(id)
+
+	for _, zoneId := range device.Zones {
+		if !containsInt(td.Zones, zoneId) {
+			if err := d.RemoveDeviceFromZone(id, zoneId); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, zoneId := range td.Zones {
+		if !containsInt(device.Zones, zoneId) {
+			if err := d.AddDeviceToZone(id, zoneId); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reserveZoneId ensures that new zones are not allocated an identifier which has been used by an import.
+func (d *DeviceOrganiser) reserveZoneId(id int) {
+	for {
+		next := atomic.LoadInt64(d.nextZoneId)
+
+		if int64(id) <= next {
+			return
+		}
+
+		if atomic.CompareAndSwapInt64(d.nextZoneId, next, int64(id)) {
+			break
+		}
+	}
+
+	if !d.loading {
+		d.zoneConfig.Set("NextZoneId", int64(id))
+	}
+}
+
+// attributeUpdates returns the updates required to change one set of attributes into another.
+func attributeUpdates(current map[string]any, target map[string]any) map[string]any {
+	updates := map[string]any{}
+
+	for key := range current {
+		if _, found := target[key]; !found {
+			updates[key] = nil
+		}
+	}
+
+	for key, value := range target {
+		if existing, found := current[key]; !found || existing != value {
+			updates[key] = value
+		}
+	}
+
+	return updates
+}
+
+// normaliseDocumentAttributes normalises attributes from a document, dropping any without a value.
+func normaliseDocumentAttributes(attributes map[string]any) (map[string]any, error) {
+	normalised, err := normaliseAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range normalised {
+		if value == nil {
+			delete(normalised, key)
+		}
+	}
+
+	if len(normalised) == 0 {
+		return nil, nil
+	}
+
+	return normalised, nil
+}
+
+func uniqueInts(values []int) []int {
+	var unique []int
+
+	for _, value := range values {
+		if !containsInt(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+func sameInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, value := range a {
+		if !containsInt(b, value) {
+			return false
+		}
+	}
+
+	return true
+}
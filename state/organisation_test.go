@@ -0,0 +1,273 @@
+package state
+
+import (
+	"errors"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func populatedOrganiser() DeviceOrganiser {
+	do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+	do.AddDevice("one")
+	do.AddDevice("two")
+
+	house := do.NewZone("House")
+	kitchen := do.NewZone("Kitchen")
+	lounge := do.NewZone("Lounge")
+	_ = do.MoveZone(kitchen.Identifier, house.Identifier)
+	_ = do.MoveZone(lounge.Identifier, house.Identifier)
+	_ = do.SetZoneKind(kitchen.Identifier, ZoneKindRoom)
+	_ = do.UpdateZoneAttributes(kitchen.Identifier, map[string]any{"area": 12})
+
+	_ = do.NameDevice("one", "Kettle")
+	_ = do.SetDeviceAlias("one", "kettle-plug")
+	_ = do.NameDevice("two", "Lamp")
+	_ = do.SetDeviceTags("two", []string{"light"})
+	_ = do.SetDeviceSleepy("two", true)
+	_ = do.AddDeviceToZone("one", kitchen.Identifier)
+	_ = do.AddDeviceToZone("two", lounge.Identifier)
+
+	return do
+}
+
+func TestDeviceOrganiser_ExportOrganisation(t *testing.T) {
+	t.Run("exports zones in order with device metadata", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		expected := OrganisationDocument{
+			Version: OrganisationDocumentVersion,
+			Zones: []OrganisationZone{
+				{
+					Identifier: 1,
+					Name:       "House",
+					SubZones: []OrganisationZone{
+						{Identifier: 2, Name: "Kitchen", Kind: ZoneKindRoom, Attributes: map[string]any{"area": float64(12)}},
+						{Identifier: 3, Name: "Lounge"},
+					},
+				},
+			},
+			Devices: []OrganisationDevice{
+				{Identifier: "one", Name: "Kettle", Alias: "kettle-plug", Zones: []int{2}},
+				{Identifier: "two", Name: "Lamp", Sleepy: true, Zones: []int{3}, Tags: []string{"light"}},
+			},
+		}
+
+		assert.Equal(t, expected, do.ExportOrganisation())
+	})
+
+	t.Run("round trips through json and yaml", func(t *testing.T) {
+		do := populatedOrganiser()
+		doc := do.ExportOrganisation()
+
+		for _, format := range []OrganisationFormat{OrganisationFormatJSON, OrganisationFormatYAML} {
+			data, err := MarshalOrganisation(doc, format)
+			assert.NoError(t, err)
+
+			decoded, err := UnmarshalOrganisation(data, format)
+			assert.NoError(t, err)
+
+			changes, err := do.ImportOrganisation(decoded, ImportReplace, true)
+			assert.NoError(t, err)
+			assert.Empty(t, changes, "format %s", format)
+		}
+
+		_, err := MarshalOrganisation(doc, "xml")
+		assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+		_, err = UnmarshalOrganisation([]byte("{"), OrganisationFormatJSON)
+		assert.ErrorIs(t, err, ErrInvalidDocument)
+	})
+}
+
+func TestDeviceOrganiser_ImportOrganisation(t *testing.T) {
+	t.Run("replaces the organisation of another controller", func(t *testing.T) {
+		source := populatedOrganiser()
+		doc := source.ExportOrganisation()
+
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("two")
+		do.AddDevice("three")
+		_ = do.NameDevice("three", "Fan")
+		old := do.NewZone("Old")
+		_ = do.AddDeviceToZone("three", old.Identifier)
+
+		changes, err := do.ImportOrganisation(doc, ImportReplace, false)
+		assert.NoError(t, err)
+		assert.Contains(t, changes, OrganisationChange{Action: ChangeCreate, Device: "one"})
+		assert.Contains(t, changes, OrganisationChange{Action: ChangeUpdate, Device: "three", Fields: []string{"Name", "Zones"}})
+		assert.Contains(t, changes, OrganisationChange{Action: ChangeUpdate, Zone: 1, Fields: []string{"Name"}})
+
+		assert.Equal(t, doc.Zones, do.ExportOrganisation().Zones)
+
+		dm, _ := do.Device("three")
+		assert.Empty(t, dm.Name)
+		assert.Empty(t, dm.Zones)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		reloadedDoc := reloaded.ExportOrganisation()
+		assert.Contains(t, reloadedDoc.Devices, doc.Devices[0])
+		assert.Contains(t, reloadedDoc.Devices, doc.Devices[1])
+
+		newZone := reloaded.NewZone("New")
+		assert.Equal(t, 4, newZone.Identifier)
+	})
+
+	t.Run("merges zones and devices, leaving others untouched", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		doc := OrganisationDocument{
+			Version: OrganisationDocumentVersion,
+			Zones: []OrganisationZone{
+				{
+					Identifier: 1,
+					Name:       "Home",
+					SubZones: []OrganisationZone{
+						{Identifier: 3, Name: "Lounge"},
+						{Identifier: 10, Name: "Garage", Kind: ZoneKindRoom},
+					},
+				},
+			},
+			Devices: []OrganisationDevice{
+				{Identifier: "two", Name: "Lamp", Sleepy: true, Zones: []int{10}},
+			},
+		}
+
+		changes, err := do.ImportOrganisation(doc, ImportMerge, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []OrganisationChange{
+			{Action: ChangeUpdate, Zone: 1, Fields: []string{"Name"}},
+			{Action: ChangeUpdate, Zone: 2, Fields: []string{"Order"}},
+			{Action: ChangeUpdate, Zone: 3, Fields: []string{"Order"}},
+			{Action: ChangeCreate, Zone: 10},
+			{Action: ChangeUpdate, Device: "two", Fields: []string{"Tags", "Zones"}},
+		}, changes)
+
+		house, _ := do.Zone(1)
+		assert.Equal(t, "Home", house.Name)
+		assert.Equal(t, []int{3, 10, 2}, house.SubZones)
+
+		dm, _ := do.Device("one")
+		assert.Equal(t, "kettle-plug", dm.Alias)
+		assert.Equal(t, []int{2}, dm.Zones)
+
+		dm, _ = do.Device("two")
+		assert.Equal(t, []int{10}, dm.Zones)
+		assert.Empty(t, dm.Tags)
+	})
+
+	t.Run("moves zones across the hierarchy", func(t *testing.T) {
+		do := populatedOrganiser()
+
+		doc := OrganisationDocument{
+			Version: OrganisationDocumentVersion,
+			Zones: []OrganisationZone{
+				{
+					Identifier: 3,
+					Name:       "Lounge",
+					SubZones: []OrganisationZone{
+						{
+							Identifier: 1,
+							Name:       "House",
+						},
+					},
+				},
+			},
+		}
+
+		_, err := do.ImportOrganisation(doc, ImportReplace, false)
+		assert.NoError(t, err)
+
+		exported := do.ExportOrganisation()
+		assert.Equal(t, doc.Zones, exported.Zones)
+	})
+
+	t.Run("does not change anything on a dry run", func(t *testing.T) {
+		do := populatedOrganiser()
+		before := do.ExportOrganisation()
+
+		changes, err := do.ImportOrganisation(OrganisationDocument{Version: OrganisationDocumentVersion}, ImportReplace, true)
+		assert.NoError(t, err)
+		assert.Contains(t, changes, OrganisationChange{Action: ChangeDelete, Zone: 1})
+
+		assert.Equal(t, before, do.ExportOrganisation())
+	})
+
+	t.Run("rejects invalid documents without changes", func(t *testing.T) {
+		do := populatedOrganiser()
+		before := do.ExportOrganisation()
+
+		_, err := do.ImportOrganisation(OrganisationDocument{Version: 2}, ImportReplace, false)
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+		_, err = do.ImportOrganisation(OrganisationDocument{Version: OrganisationDocumentVersion}, "append", false)
+		assert.ErrorIs(t, err, ErrInvalidImportMode)
+
+		invalid := []OrganisationDocument{
+			{Zones: []OrganisationZone{{Identifier: 1}, {Identifier: 1}}},
+			{Zones: []OrganisationZone{{Identifier: 0}}},
+			{Zones: []OrganisationZone{{Identifier: 1, Kind: "cupboard"}}},
+			{Zones: []OrganisationZone{{Identifier: 1, Attributes: map[string]any{"walls": []int{4}}}}},
+			{Devices: []OrganisationDevice{{Identifier: "one", Zones: []int{99}}}},
+			{Devices: []OrganisationDevice{{Identifier: "one", Alias: "Not Valid"}}},
+			{Devices: []OrganisationDevice{{Identifier: "one", Alias: "same"}, {Identifier: "two", Alias: "same"}}},
+			{Devices: []OrganisationDevice{{Identifier: "one", Alias: "two"}, {Identifier: "two"}}},
+		}
+
+		for _, doc := range invalid {
+			doc.Version = OrganisationDocumentVersion
+
+			_, err = do.ImportOrganisation(doc, ImportReplace, false)
+			assert.ErrorIs(t, err, ErrInvalidDocument)
+		}
+
+		assert.Equal(t, before, do.ExportOrganisation())
+	})
+
+	t.Run("document and batch errors are organisation errors rather than zone errors", func(t *testing.T) {
+		var organisationError OrganisationError
+		var zoneError ZoneError
+
+		for _, err := range []error{ErrUnsupportedVersion, ErrUnsupportedFormat, ErrInvalidDocument, ErrInvalidImportMode, ErrInvalidBatchOperation} {
+			assert.ErrorAs(t, err, &organisationError)
+			assert.False(t, errors.As(err, &zoneError))
+		}
+	})
+
+	t.Run("rejects aliases derived by other devices, without changes or events", func(t *testing.T) {
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("a")
+		do.AddDevice("b")
+		_ = do.NameDevice("a", "Kitchen Light")
+
+		mep := new(MockEventPublisher)
+		do.eventPublisher = mep
+
+		before := do.ExportOrganisation()
+
+		doc := OrganisationDocument{
+			Version: OrganisationDocumentVersion,
+			Zones:   []OrganisationZone{{Identifier: 5, Name: "Kitchen"}},
+			Devices: []OrganisationDevice{{Identifier: "b", Name: "Lamp", Alias: "kitchen-light", Zones: []int{5}}},
+		}
+
+		_, err := do.ImportOrganisation(doc, ImportMerge, true)
+		assert.ErrorIs(t, err, ErrAliasInUse)
+
+		_, err = do.ImportOrganisation(doc, ImportMerge, false)
+		assert.ErrorIs(t, err, ErrAliasInUse)
+
+		assert.Equal(t, before, do.ExportOrganisation())
+		assert.NotEqual(t, "ImportOrganisation", do.History()[len(do.History())-1].Operation)
+		mep.AssertNotCalled(t, "Publish", mock.Anything)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		assert.Equal(t, before, reloaded.ExportOrganisation())
+
+		dm, _ := reloaded.Device("a")
+		assert.Equal(t, "kitchen-light", dm.Alias)
+	})
+}
@@ -0,0 +1,205 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence"
+	"sync"
+	"sync/atomic"
+)
+
+// transact makes a change to a copy of the organisation, which replaces the organisation if fn succeeds and commit is
+// set. The organisation is locked throughout so that the change is never seen partially made, and neither persistence
+// nor events are written until the copy has replaced the organisation. If fn fails the organisation is left untouched.
+func (d *DeviceOrganiser) transact(commit bool, fn func(*DeviceOrganiser) error) error {
+	events, err := d.transactLocked(commit, fn)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		d.eventPublisher.Publish(event)
+	}
+
+	return nil
+}
+
+func (d *DeviceOrganiser) transactLocked(commit bool, fn func(*DeviceOrganiser) error) ([]any, error) {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	buffer := &eventBuffer{}
+	var writes []func()
+
+	tx := d.copyLocked(buffer, &writes)
+
+	if err := fn(tx); err != nil || !commit {
+		return nil, err
+	}
+
+	*d.hiddenRoot = *tx.hiddenRoot
+
+	clear(d.zones)
+
+	for id, zone := range tx.zones {
+		d.zones[id] = zone
+	}
+
+	d.zones[RootZoneId] = d.hiddenRoot
+
+	clear(d.devices)
+
+	for id, dm := range tx.devices {
+		d.devices[id] = dm
+	}
+
+	atomic.StoreInt64(d.nextZoneId, atomic.LoadInt64(tx.nextZoneId))
+
+	for _, write := range writes {
+		write()
+	}
+
+	return buffer.events, nil
+}
+
+// copyLocked returns a copy of the organisation which shares nothing with it, publishing events to the publisher and
+// recording writes to persistence rather than making them. Both the device and zone locks must be held.
+func (d *DeviceOrganiser) copyLocked(e EventPublisher, writes *[]func()) *DeviceOrganiser {
+	nextZoneId := atomic.LoadInt64(d.nextZoneId)
+
+	c := &DeviceOrganiser{
+		nextZoneId:     &nextZoneId,
+		zoneLock:       &sync.Mutex{},
+		zones:          make(map[int]*Zone, len(d.zones)),
+		deviceLock:     &sync.Mutex{},
+		devices:        make(map[string]*DeviceMetadata, len(d.devices)),
+		zoneConfig:     journalSection{base: d.zoneConfig, writes: writes},
+		deviceConfig:   journalSection{base: d.deviceConfig, writes: writes},
+		actor:          d.actor,
+		recording:      true,
+		loading:        d.loading,
+		eventPublisher: e,
+	}
+
+	for id, zone := range d.zones {
+		z := zone.copy()
+		z.SubZones = append([]int(nil), zone.SubZones...)
+		z.Devices = append([]string(nil), zone.Devices...)
+
+		c.zones[id] = &z
+	}
+
+	c.hiddenRoot = c.zones[RootZoneId]
+
+	for id, dm := range d.devices {
+		m := dm.copy()
+		c.devices[id] = &m
+	}
+
+	return c
+}
+
+// eventBuffer holds the events published during a transaction, until it has been committed.
+type eventBuffer struct {
+	events []any
+}
+
+func (e *eventBuffer) Publish(event any) {
+	e.events = append(e.events, event)
+}
+
+// journalSection records writes to a section, so that they can be made once a transaction is committed. Reads are made
+// from the underlying section, and so do not reflect any recorded writes.
+type journalSection struct {
+	base   persistence.Section
+	path   []string
+	writes *[]func()
+}
+
+func (j journalSection) section() persistence.Section {
+	if len(j.path) == 0 {
+		return j.base
+	}
+
+	return j.base.Section(j.path...)
+}
+
+func (j journalSection) record(fn func(persistence.Section)) {
+	*j.writes = append(*j.writes, func() {
+		fn(j.section())
+	})
+}
+
+func (j journalSection) Section(key ...string) persistence.Section {
+	c := journalSection{base: j.base, path: append(append([]string{}, j.path...), key...), writes: j.writes}
+	c.record(func(persistence.Section) {})
+
+	return c
+}
+
+func (j journalSection) SectionKeys() []string {
+	return j.section().SectionKeys()
+}
+
+func (j journalSection) SectionExists(key string) bool {
+	return j.section().SectionExists(key)
+}
+
+func (j journalSection) SectionDelete(key string) bool {
+	j.record(func(s persistence.Section) {
+		s.SectionDelete(key)
+	})
+
+	return true
+}
+
+func (j journalSection) Keys() []string {
+	return j.section().Keys()
+}
+
+func (j journalSection) Exists(key string) bool {
+	return j.section().Exists(key)
+}
+
+func (j journalSection) Type(key string) persistence.ValueType {
+	return j.section().Type(key)
+}
+
+func (j journalSection) Int(key string, defValue ...int64) (int64, bool) {
+	return j.section().Int(key, defValue...)
+}
+
+func (j journalSection) UInt(key string, defValue ...uint64) (uint64, bool) {
+	return j.section().UInt(key, defValue...)
+}
+
+func (j journalSection) String(key string, defValue ...string) (string, bool) {
+	return j.section().String(key, defValue...)
+}
+
+func (j journalSection) Bool(key string, defValue ...bool) (bool, bool) {
+	return j.section().Bool(key, defValue...)
+}
+
+func (j journalSection) Float(key string, defValue ...float64) (float64, bool) {
+	return j.section().Float(key, defValue...)
+}
+
+func (j journalSection) Bytes(key string, defValue ...[]byte) ([]byte, bool) {
+	return j.section().Bytes(key, defValue...)
+}
+
+func (j journalSection) Set(key string, value interface{}) {
+	j.record(func(s persistence.Section) {
+		s.Set(key, value)
+	})
+}
+
+func (j journalSection) Delete(key string) bool {
+	j.record(func(s persistence.Section) {
+		s.Delete(key)
+	})
+
+	return true
+}
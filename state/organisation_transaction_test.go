@@ -0,0 +1,107 @@
+package state
+
+import (
+	"errors"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func TestDeviceOrganiser_transact(t *testing.T) {
+	change := func(tx *DeviceOrganiser) {
+		zone := tx.NewZone("Garage")
+		_ = tx.MoveZone(zone.Identifier, 1)
+		_ = tx.NameDevice("one", "Heater")
+		_ = tx.AddDeviceToZone("one", zone.Identifier)
+		_ = tx.DeleteZoneRecursive(2, 1)
+	}
+
+	t.Run("replaces the organisation, persisting and publishing changes once the change succeeds", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		house := do.NewZone("House")
+		lounge := do.NewZone("Lounge")
+		_ = do.MoveZone(lounge.Identifier, house.Identifier)
+		_ = do.AddDeviceToZone("two", lounge.Identifier)
+
+		expected := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		expected.AddDevice("one")
+		expected.AddDevice("two")
+		house = expected.NewZone("House")
+		lounge = expected.NewZone("Lounge")
+		_ = expected.MoveZone(lounge.Identifier, house.Identifier)
+		_ = expected.AddDeviceToZone("two", lounge.Identifier)
+		change(&expected)
+
+		mep := new(MockEventPublisher)
+		mep.On("Publish", mock.Anything)
+		do.eventPublisher = mep
+
+		err := do.transact(true, func(tx *DeviceOrganiser) error {
+			change(tx)
+			mep.AssertNotCalled(t, "Publish", mock.Anything)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, expected.ExportOrganisation(), do.ExportOrganisation())
+		mep.AssertCalled(t, "Publish", ZoneCreate{Identifier: 3, Name: "Garage", AfterZone: 1})
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		assert.Equal(t, expected.ExportOrganisation(), reloaded.ExportOrganisation())
+
+		assert.Equal(t, int64(3), *do.nextZoneId)
+	})
+
+	t.Run("leaves the organisation, persistence and events untouched if the change fails part way", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+		house := do.NewZone("House")
+		lounge := do.NewZone("Lounge")
+		_ = do.MoveZone(lounge.Identifier, house.Identifier)
+		_ = do.AddDeviceToZone("two", lounge.Identifier)
+
+		mep := new(MockEventPublisher)
+		do.eventPublisher = mep
+
+		before := do.ExportOrganisation()
+		failure := errors.New("failure")
+
+		err := do.transact(true, func(tx *DeviceOrganiser) error {
+			change(tx)
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+
+		assert.Equal(t, before, do.ExportOrganisation())
+		mep.AssertNotCalled(t, "Publish", mock.Anything)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		assert.Equal(t, before, reloaded.ExportOrganisation())
+
+		assert.Equal(t, int64(2), *do.nextZoneId)
+	})
+
+	t.Run("discards a successful change if it is not committed", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.NewZone("House")
+
+		before := do.ExportOrganisation()
+
+		err := do.transact(false, func(tx *DeviceOrganiser) error {
+			change(tx)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, before, do.ExportOrganisation())
+	})
+}
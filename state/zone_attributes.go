@@ -0,0 +1,189 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence"
+	"strconv"
+)
+
+type ZoneKind string
+
+const (
+	ZoneKindNone    ZoneKind = ""
+	ZoneKindSite    ZoneKind = "site"
+	ZoneKindFloor   ZoneKind = "floor"
+	ZoneKindRoom    ZoneKind = "room"
+	ZoneKindOutdoor ZoneKind = "outdoor"
+)
+
+// Valid reports if the kind is one of the known zone kinds, or none.
+func (k ZoneKind) Valid() bool {
+	switch k {
+	case ZoneKindNone, ZoneKindSite, ZoneKindFloor, ZoneKindRoom, ZoneKindOutdoor:
+		return true
+	default:
+		return false
+	}
+}
+
+// ZoneCoordinates position a zone on the floor plan of its parent.
+type ZoneCoordinates struct {
+	X      float64 `yaml:"X"`
+	Y      float64 `yaml:"Y"`
+	Width  float64 `json:",omitempty" yaml:"Width,omitempty"`
+	Height float64 `json:",omitempty" yaml:"Height,omitempty"`
+}
+
+func (d *DeviceOrganiser) SetZoneKind(id int, kind ZoneKind) error {
+	defer d.record("SetZoneKind")()
+
+	if !kind.Valid() {
+		return ErrInvalidZoneKind
+	}
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	zone, found := d.zones[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	zone.Kind = kind
+
+	if !d.loading {
+		d.zoneConfig.Section(strconv.Itoa(id)).Set("Kind", string(kind))
+	}
+
+	d.publishZoneUpdate(zone)
+
+	return nil
+}
+
+func (d *DeviceOrganiser) SetZoneIcon(id int, icon string) error {
+	defer d.record("SetZoneIcon")()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	zone, found := d.zones[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	zone.Icon = icon
+
+	if !d.loading {
+		d.zoneConfig.Section(strconv.Itoa(id)).Set("Icon", icon)
+	}
+
+	d.publishZoneUpdate(zone)
+
+	return nil
+}
+
+// UpdateZoneAttributes merges attributes into those of a zone, following the same rules as UpdateDeviceAttributes.
+func (d *DeviceOrganiser) UpdateZoneAttributes(id int, attributes map[string]any) error {
+	defer d.record("UpdateZoneAttributes")()
+
+	normalised, err := normaliseAttributes(attributes)
+	if err != nil {
+		return err
+	}
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	zone, found := d.zones[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	zone.Attributes = mergeAttributes(zone.Attributes, normalised, d.zoneConfig.Section(strconv.Itoa(id), "Attributes"), !d.loading)
+
+	d.publishZoneUpdate(zone)
+
+	return nil
+}
+
+// SetZoneCoordinates positions a zone on its parents floor plan, nil coordinates remove it from the floor plan.
+func (d *DeviceOrganiser) SetZoneCoordinates(id int, coordinates *ZoneCoordinates) error {
+	defer d.record("SetZoneCoordinates")()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	zone, found := d.zones[id]
+	if !found {
+		return ErrNotFound
+	}
+
+	if coordinates != nil {
+		c := *coordinates
+		coordinates = &c
+	}
+
+	zone.Coordinates = coordinates
+
+	if !d.loading {
+		persistZoneCoordinates(d.zoneConfig.Section(strconv.Itoa(id)), coordinates)
+	}
+
+	d.publishZoneUpdate(zone)
+
+	return nil
+}
+
+func persistZoneCoordinates(s persistence.Section, coordinates *ZoneCoordinates) {
+	if coordinates == nil {
+		s.SectionDelete("Coordinates")
+		return
+	}
+
+	cs := s.Section("Coordinates")
+	cs.Set("X", coordinates.X)
+	cs.Set("Y", coordinates.Y)
+	cs.Set("Width", coordinates.Width)
+	cs.Set("Height", coordinates.Height)
+}
+
+// copy returns a copy of the zone which does not share attributes with the original.
+func (z *Zone) copy() Zone {
+	c := *z
+
+	if z.Attributes != nil {
+		c.Attributes = make(map[string]any, len(z.Attributes))
+
+		for k, v := range z.Attributes {
+			c.Attributes[k] = v
+		}
+	}
+
+	return c
+}
+
+func (d *DeviceOrganiser) loadZoneAttributes(id int) {
+	s := d.zoneConfig.Section(strconv.Itoa(id))
+
+	if kind, found := s.String("Kind"); found {
+		d.SetZoneKind(id, ZoneKind(kind))
+	}
+
+	if icon, found := s.String("Icon"); found {
+		d.SetZoneIcon(id, icon)
+	}
+
+	if attributes := loadAttributes(s.Section("Attributes")); len(attributes) > 0 {
+		d.UpdateZoneAttributes(id, attributes)
+	}
+
+	if s.SectionExists("Coordinates") {
+		cs := s.Section("Coordinates")
+
+		x, _ := cs.Float("X")
+		y, _ := cs.Float("Y")
+		width, _ := cs.Float("Width")
+		height, _ := cs.Float("Height")
+
+		d.SetZoneCoordinates(id, &ZoneCoordinates{X: x, Y: y, Width: width, Height: height})
+	}
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDeviceOrganiser_ZoneAttributes(t *testing.T) {
+	t.Run("SetZoneKind sets a known kind and publishes an update", func(t *testing.T) {
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("Kitchen")
+
+		do.eventPublisher = mep
+		mep.On("Publish", ZoneUpdate{Identifier: zone.Identifier, Name: "Kitchen", Kind: ZoneKindRoom})
+
+		assert.NoError(t, do.SetZoneKind(zone.Identifier, ZoneKindRoom))
+
+		z, _ := do.Zone(zone.Identifier)
+		assert.Equal(t, ZoneKindRoom, z.Kind)
+	})
+
+	t.Run("SetZoneKind rejects unknown kinds", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("Kitchen")
+
+		assert.ErrorIs(t, do.SetZoneKind(zone.Identifier, "cupboard"), ErrInvalidZoneKind)
+		assert.ErrorIs(t, do.SetZoneKind(99, ZoneKindRoom), ErrNotFound)
+	})
+
+	t.Run("NewZoneOfKind creates a zone with its kind and icon as a single change", func(t *testing.T) {
+		s := memory.New()
+
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+		mep.On("Publish", ZoneCreate{Identifier: 1, Name: "Kitchen", Kind: ZoneKindRoom, Icon: "mdi:stove"}).Once()
+
+		do := NewDeviceOrganiser(s, mep)
+
+		zone, err := do.NewZoneOfKind("Kitchen", ZoneKindRoom, "mdi:stove")
+		assert.NoError(t, err)
+		assert.Equal(t, ZoneKindRoom, zone.Kind)
+		assert.Equal(t, "mdi:stove", zone.Icon)
+
+		history := do.History()
+		assert.Len(t, history, 1)
+		assert.Equal(t, "NewZone", history[0].Operation)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+		z, _ := reloaded.Zone(zone.Identifier)
+		assert.Equal(t, ZoneKindRoom, z.Kind)
+		assert.Equal(t, "mdi:stove", z.Icon)
+	})
+
+	t.Run("NewZoneOfKind rejects unknown kinds without creating a zone", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		_, err := do.NewZoneOfKind("Cupboard", "cupboard", "")
+		assert.ErrorIs(t, err, ErrInvalidZoneKind)
+		assert.Empty(t, do.RootZones())
+		assert.Empty(t, do.History())
+	})
+
+	t.Run("UpdateZoneAttributes merges attributes, removing those set to nil", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("Kitchen")
+
+		assert.NoError(t, do.UpdateZoneAttributes(zone.Identifier, map[string]any{"area": 12, "heated": true}))
+		assert.NoError(t, do.UpdateZoneAttributes(zone.Identifier, map[string]any{"heated": nil}))
+		assert.ErrorIs(t, do.UpdateZoneAttributes(zone.Identifier, map[string]any{"walls": []int{4}}), ErrInvalidAttribute)
+
+		z, _ := do.Zone(zone.Identifier)
+		assert.Equal(t, map[string]any{"area": float64(12)}, z.Attributes)
+	})
+
+	t.Run("SetZoneCoordinates positions and removes a zone from the floor plan", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("Kitchen")
+
+		assert.NoError(t, do.SetZoneCoordinates(zone.Identifier, &ZoneCoordinates{X: 1, Y: 2, Width: 3, Height: 4}))
+
+		z, _ := do.Zone(zone.Identifier)
+		assert.Equal(t, &ZoneCoordinates{X: 1, Y: 2, Width: 3, Height: 4}, z.Coordinates)
+
+		assert.NoError(t, do.SetZoneCoordinates(zone.Identifier, nil))
+
+		z, _ = do.Zone(zone.Identifier)
+		assert.Nil(t, z.Coordinates)
+	})
+
+	t.Run("kind, icon, attributes and coordinates are persisted and reloaded", func(t *testing.T) {
+		s := memory.New()
+
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		zone := do.NewZone("Garden")
+
+		_ = do.SetZoneKind(zone.Identifier, ZoneKindOutdoor)
+		_ = do.SetZoneIcon(zone.Identifier, "tree")
+		_ = do.UpdateZoneAttributes(zone.Identifier, map[string]any{"area": 40})
+		_ = do.SetZoneCoordinates(zone.Identifier, &ZoneCoordinates{X: 5, Y: 6})
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+
+		z, found := reloaded.Zone(zone.Identifier)
+		assert.True(t, found)
+		assert.Equal(t, ZoneKindOutdoor, z.Kind)
+		assert.Equal(t, "tree", z.Icon)
+		assert.Equal(t, map[string]any{"area": float64(40)}, z.Attributes)
+		assert.Equal(t, &ZoneCoordinates{X: 5, Y: 6}, z.Coordinates)
+	})
+}
@@ -0,0 +1,232 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// DeleteZoneRecursive deletes a zone and all zones beneath it. Devices in the deleted zones are moved to another zone,
+// or if RootZoneId is provided, removed from the zones. The deletion is made as a single change, if any part of it
+// fails nothing is deleted.
+func (d *DeviceOrganiser) DeleteZoneRecursive(id int, moveDevicesTo int) error {
+	defer d.record("DeleteZoneRecursive")()
+
+	return d.transact(true, func(tx *DeviceOrganiser) error {
+		return tx.deleteZoneRecursive(id, moveDevicesTo)
+	})
+}
+
+func (d *DeviceOrganiser) deleteZoneRecursive(id int, moveDevicesTo int) error {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	if _, found := d.zones[id]; !found || id == RootZoneId {
+		return fmt.Errorf("zone not found: %w", ErrNotFound)
+	}
+
+	deleting := append([]int{id}, d.enumerateZoneDescendents(id)...)
+
+	var target *Zone
+
+	if moveDevicesTo != RootZoneId {
+		var found bool
+
+		if target, found = d.zones[moveDevicesTo]; !found {
+			return fmt.Errorf("zone to move devices to not found: %w", ErrNotFound)
+		}
+
+		for _, zoneId := range deleting {
+			if zoneId == moveDevicesTo {
+				return fmt.Errorf("zone to move devices to is being deleted: %w", ErrCircularReference)
+			}
+		}
+	}
+
+	for i := len(deleting) - 1; i >= 0; i-- {
+		zone := d.zones[deleting[i]]
+
+		d.moveZoneDevicesLocked(zone, target)
+
+		if err := d.deleteZoneLocked(zone.Identifier); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MoveZoneDevices moves every device in a zone to another zone.
+func (d *DeviceOrganiser) MoveZoneDevices(fromId int, toId int) error {
+	defer d.record("MoveZoneDevices")()
+
+	if fromId == toId {
+		return ErrSameZone
+	}
+
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	from, found := d.zones[fromId]
+	if !found {
+		return fmt.Errorf("zone not found: %w", ErrNotFound)
+	}
+
+	to, found := d.zones[toId]
+	if !found || toId == RootZoneId {
+		return fmt.Errorf("zone to move devices to not found: %w", ErrNotFound)
+	}
+
+	d.moveZoneDevicesLocked(from, to)
+
+	return nil
+}
+
+// moveZoneDevicesLocked removes every device from a zone, adding them to another zone if provided. Both the device and
+// zone locks must be held.
+func (d *DeviceOrganiser) moveZoneDevicesLocked(from *Zone, to *Zone) {
+	for _, deviceId := range append([]string{}, from.Devices...) {
+		device, found := d.devices[deviceId]
+		if !found {
+			from.Devices = filterString(from.Devices, deviceId)
+			continue
+		}
+
+		d.removeDeviceFromZoneLocked(deviceId, device, from)
+
+		if to != nil && !containsInt(device.Zones, to.Identifier) {
+			d.addDeviceToZoneLocked(deviceId, device, to)
+		}
+	}
+}
+
+type zoneTree struct {
+	zone     *Zone
+	subZones []zoneTree
+}
+
+// CloneZone copies a zone and all zones beneath it to a new parent, including their kind, icon, attributes and
+// coordinates. Device membership of the zones is copied if requested. The copy is made as a single change, and the
+// copy of the zone is returned.
+func (d *DeviceOrganiser) CloneZone(id int, parentId int, includeDevices bool) (Zone, error) {
+	defer d.record("CloneZone")()
+
+	var clone Zone
+
+	err := d.transact(true, func(tx *DeviceOrganiser) error {
+		var err error
+		clone, err = tx.cloneZone(id, parentId, includeDevices)
+		return err
+	})
+
+	if err != nil {
+		return Zone{}, err
+	}
+
+	return clone, nil
+}
+
+func (d *DeviceOrganiser) cloneZone(id int, parentId int, includeDevices bool) (Zone, error) {
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	d.zoneLock.Lock()
+	defer d.zoneLock.Unlock()
+
+	if _, found := d.zones[id]; !found || id == RootZoneId {
+		return Zone{}, fmt.Errorf("zone not found: %w", ErrNotFound)
+	}
+
+	if _, found := d.zones[parentId]; !found {
+		return Zone{}, fmt.Errorf("new parent not found: %w", ErrNotFound)
+	}
+
+	clone, err := d.cloneZoneLocked(d.zoneTreeLocked(id), parentId, includeDevices)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	return clone.copy(), nil
+}
+
+// zoneTreeLocked captures the structure beneath a zone, so that it can be copied while zones are being created.
+func (d *DeviceOrganiser) zoneTreeLocked(id int) zoneTree {
+	source := d.zones[id].copy()
+	source.SubZones = append([]int{}, source.SubZones...)
+	source.Devices = append([]string{}, source.Devices...)
+
+	tree := zoneTree{zone: &source}
+
+	for _, subId := range source.SubZones {
+		tree.subZones = append(tree.subZones, d.zoneTreeLocked(subId))
+	}
+
+	return tree
+}
+
+func (d *DeviceOrganiser) cloneZoneLocked(tree zoneTree, parentId int, includeDevices bool) (*Zone, error) {
+	newId := int(atomic.AddInt64(d.nextZoneId, 1))
+
+	if !d.loading {
+		d.zoneConfig.Set("NextZoneId", *d.nextZoneId)
+	}
+
+	clone := d.newZoneLocked(tree.zone.Name, ZoneKindNone, "", newId)
+
+	if parentId != RootZoneId {
+		if err := d.moveZoneLocked(newId, parentId); err != nil {
+			return nil, err
+		}
+	}
+
+	source := tree.zone
+
+	if source.Kind != ZoneKindNone || source.Icon != "" || source.Attributes != nil || source.Coordinates != nil {
+		clone.Kind = source.Kind
+		clone.Icon = source.Icon
+		clone.Attributes = source.copy().Attributes
+		clone.Coordinates = source.Coordinates
+
+		if !d.loading {
+			s := d.zoneConfig.Section(strconv.Itoa(newId))
+			s.Set("Kind", string(clone.Kind))
+			s.Set("Icon", clone.Icon)
+			mergeAttributes(nil, clone.Attributes, s.Section("Attributes"), true)
+			persistZoneCoordinates(s, clone.Coordinates)
+		}
+
+		d.publishZoneUpdate(clone)
+	}
+
+	if includeDevices {
+		for _, deviceId := range source.Devices {
+			if device, found := d.devices[deviceId]; found {
+				d.addDeviceToZoneLocked(deviceId, device, clone)
+			}
+		}
+	}
+
+	for _, subTree := range tree.subZones {
+		if _, err := d.cloneZoneLocked(subTree, newId, includeDevices); err != nil {
+			return nil, err
+		}
+	}
+
+	return clone, nil
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, check := range haystack {
+		if check == needle {
+			return true
+		}
+	}
+
+	return false
+}
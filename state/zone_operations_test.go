@@ -0,0 +1,247 @@
+package state
+
+import (
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+// observeZoneCounts returns a publisher which records how many zones the organiser has as each event is published, or
+// -1 if it is published while the organiser is locked.
+func observeZoneCounts(do *DeviceOrganiser, counts *[]int) *MockEventPublisher {
+	mep := new(MockEventPublisher)
+
+	mep.On("Publish", mock.Anything).Run(func(mock.Arguments) {
+		if !do.zoneLock.TryLock() {
+			*counts = append(*counts, -1)
+			return
+		}
+
+		*counts = append(*counts, len(do.zones))
+		do.zoneLock.Unlock()
+	})
+
+	return mep
+}
+
+func TestDeviceOrganiser_DeleteZoneRecursive(t *testing.T) {
+	t.Run("deletes a zone and its descendents, unassigning devices", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		house := do.NewZone("House")
+		floor := do.NewZone("Floor")
+		room := do.NewZone("Room")
+
+		_ = do.MoveZone(floor.Identifier, house.Identifier)
+		_ = do.MoveZone(room.Identifier, floor.Identifier)
+		_ = do.AddDeviceToZone("one", floor.Identifier)
+		_ = do.AddDeviceToZone("two", room.Identifier)
+
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+		do.eventPublisher = mep
+
+		mep.On("Publish", DeviceRemovedFromZone{ZoneIdentifier: room.Identifier, DeviceIdentifier: "two"}).Once()
+		mep.On("Publish", ZoneRemove{Identifier: room.Identifier}).Once()
+		mep.On("Publish", DeviceRemovedFromZone{ZoneIdentifier: floor.Identifier, DeviceIdentifier: "one"}).Once()
+		mep.On("Publish", ZoneRemove{Identifier: floor.Identifier}).Once()
+		mep.On("Publish", ZoneRemove{Identifier: house.Identifier}).Once()
+
+		assert.NoError(t, do.DeleteZoneRecursive(house.Identifier, RootZoneId))
+
+		assert.Empty(t, do.ZoneDescendents(RootZoneId))
+
+		dm, _ := do.Device("one")
+		assert.Empty(t, dm.Zones)
+
+		dm, _ = do.Device("two")
+		assert.Empty(t, dm.Zones)
+	})
+
+	t.Run("moves devices of deleted zones to another zone", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		house := do.NewZone("House")
+		room := do.NewZone("Room")
+		spare := do.NewZone("Spare")
+
+		_ = do.MoveZone(room.Identifier, house.Identifier)
+		_ = do.AddDeviceToZone("one", room.Identifier)
+		_ = do.AddDeviceToZone("two", room.Identifier)
+		_ = do.AddDeviceToZone("two", spare.Identifier)
+
+		assert.NoError(t, do.DeleteZoneRecursive(house.Identifier, spare.Identifier))
+
+		z, _ := do.Zone(spare.Identifier)
+		assert.ElementsMatch(t, []string{"one", "two"}, z.Devices)
+
+		dm, _ := do.Device("two")
+		assert.Equal(t, []int{spare.Identifier}, dm.Zones)
+	})
+
+	t.Run("publishes events only once the whole subtree has been deleted, as a single change", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+
+		house := do.NewZone("House")
+		room := do.NewZone("Room")
+		_ = do.MoveZone(room.Identifier, house.Identifier)
+		_ = do.AddDeviceToZone("one", room.Identifier)
+
+		history := len(do.History())
+
+		var counts []int
+		do.eventPublisher = observeZoneCounts(&do, &counts)
+
+		assert.NoError(t, do.DeleteZoneRecursive(house.Identifier, RootZoneId))
+
+		assert.Equal(t, []int{1, 1, 1}, counts)
+		assert.Len(t, do.History(), history+1)
+	})
+
+	t.Run("fails without change if the target zone is being deleted or does not exist", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		house := do.NewZone("House")
+		room := do.NewZone("Room")
+		_ = do.MoveZone(room.Identifier, house.Identifier)
+
+		assert.ErrorIs(t, do.DeleteZoneRecursive(house.Identifier, room.Identifier), ErrCircularReference)
+		assert.ErrorIs(t, do.DeleteZoneRecursive(house.Identifier, 99), ErrNotFound)
+		assert.ErrorIs(t, do.DeleteZoneRecursive(99, RootZoneId), ErrNotFound)
+
+		assert.Len(t, do.ZoneDescendents(RootZoneId), 2)
+	})
+}
+
+func TestDeviceOrganiser_MoveZoneDevices(t *testing.T) {
+	t.Run("moves all devices from one zone to another", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		do.AddDevice("one")
+		do.AddDevice("two")
+
+		from := do.NewZone("From")
+		to := do.NewZone("To")
+
+		_ = do.AddDeviceToZone("one", from.Identifier)
+		_ = do.AddDeviceToZone("two", from.Identifier)
+		_ = do.AddDeviceToZone("two", to.Identifier)
+
+		mep := new(MockEventPublisher)
+		defer mep.AssertExpectations(t)
+		do.eventPublisher = mep
+
+		mep.On("Publish", DeviceRemovedFromZone{ZoneIdentifier: from.Identifier, DeviceIdentifier: "one"}).Once()
+		mep.On("Publish", DeviceAddedToZone{ZoneIdentifier: to.Identifier, DeviceIdentifier: "one"}).Once()
+		mep.On("Publish", DeviceRemovedFromZone{ZoneIdentifier: from.Identifier, DeviceIdentifier: "two"}).Once()
+
+		assert.NoError(t, do.MoveZoneDevices(from.Identifier, to.Identifier))
+
+		z, _ := do.Zone(from.Identifier)
+		assert.Empty(t, z.Devices)
+
+		z, _ = do.Zone(to.Identifier)
+		assert.ElementsMatch(t, []string{"one", "two"}, z.Devices)
+	})
+
+	t.Run("fails if the zones are the same or do not exist", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("Zone")
+
+		assert.ErrorIs(t, do.MoveZoneDevices(zone.Identifier, zone.Identifier), ErrSameZone)
+		assert.ErrorIs(t, do.MoveZoneDevices(zone.Identifier, 99), ErrNotFound)
+		assert.ErrorIs(t, do.MoveZoneDevices(99, zone.Identifier), ErrNotFound)
+	})
+}
+
+func TestDeviceOrganiser_CloneZone(t *testing.T) {
+	t.Run("clones a zone subtree with its details, optionally including devices", func(t *testing.T) {
+		s := memory.New()
+		do := NewDeviceOrganiser(s, NullEventPublisher)
+		do.AddDevice("one")
+
+		floor := do.NewZone("Floor")
+		room := do.NewZone("Room")
+		_ = do.MoveZone(room.Identifier, floor.Identifier)
+		_ = do.SetZoneKind(room.Identifier, ZoneKindRoom)
+		_ = do.SetZoneIcon(room.Identifier, "sofa")
+		_ = do.UpdateZoneAttributes(room.Identifier, map[string]any{"area": 12})
+		_ = do.SetZoneCoordinates(room.Identifier, &ZoneCoordinates{X: 1, Y: 2})
+		_ = do.AddDeviceToZone("one", room.Identifier)
+
+		clone, err := do.CloneZone(floor.Identifier, RootZoneId, true)
+		assert.NoError(t, err)
+		assert.NotEqual(t, floor.Identifier, clone.Identifier)
+		assert.Equal(t, "Floor", clone.Name)
+		assert.Len(t, clone.SubZones, 1)
+
+		clonedRoom, _ := do.Zone(clone.SubZones[0])
+		assert.Equal(t, "Room", clonedRoom.Name)
+		assert.Equal(t, ZoneKindRoom, clonedRoom.Kind)
+		assert.Equal(t, "sofa", clonedRoom.Icon)
+		assert.Equal(t, map[string]any{"area": float64(12)}, clonedRoom.Attributes)
+		assert.Equal(t, &ZoneCoordinates{X: 1, Y: 2}, clonedRoom.Coordinates)
+		assert.Equal(t, []string{"one"}, clonedRoom.Devices)
+
+		reloaded := NewDeviceOrganiser(s, NullEventPublisher)
+
+		reloadedRoom, found := reloaded.Zone(clonedRoom.Identifier)
+		assert.True(t, found)
+		assert.Equal(t, clone.Identifier, reloadedRoom.ParentZone)
+		assert.Equal(t, "sofa", reloadedRoom.Icon)
+		assert.Equal(t, []string{"one"}, reloadedRoom.Devices)
+	})
+
+	t.Run("clones a zone into its own subtree without recursing into the copy", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		floor := do.NewZone("Floor")
+		room := do.NewZone("Room")
+		_ = do.MoveZone(room.Identifier, floor.Identifier)
+
+		clone, err := do.CloneZone(floor.Identifier, room.Identifier, false)
+		assert.NoError(t, err)
+		assert.Equal(t, room.Identifier, clone.ParentZone)
+		assert.Len(t, do.ZoneDescendents(RootZoneId), 4)
+	})
+
+	t.Run("publishes events only once the whole subtree has been copied, as a single change", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+
+		floor := do.NewZone("Floor")
+		room := do.NewZone("Room")
+		_ = do.MoveZone(room.Identifier, floor.Identifier)
+
+		history := len(do.History())
+
+		var counts []int
+		do.eventPublisher = observeZoneCounts(&do, &counts)
+
+		_, err := do.CloneZone(floor.Identifier, RootZoneId, false)
+		assert.NoError(t, err)
+
+		assert.NotEmpty(t, counts)
+
+		for _, count := range counts {
+			assert.Equal(t, 5, count)
+		}
+
+		assert.Len(t, do.History(), history+1)
+	})
+
+	t.Run("fails if the zone or parent does not exist", func(t *testing.T) {
+		do := NewDeviceOrganiser(memory.New(), NullEventPublisher)
+		zone := do.NewZone("Zone")
+
+		_, err := do.CloneZone(99, RootZoneId, false)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = do.CloneZone(zone.Identifier, 99, false)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
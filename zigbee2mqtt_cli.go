@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/shimmeringbee/controller/interface/converters/zigbee2mqtt"
+	"github.com/shimmeringbee/controller/state"
+	"io"
+	"strings"
+)
+
+func importZigbee2MQTTCommand(do *state.DeviceOrganiser, args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("zigbee2mqtt import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	dryRun := fs.Bool("dry-run", false, "report what the import would do without making any changes")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("the zigbee2mqtt configuration.yaml to import must be provided")
+	}
+
+	cfg, err := zigbee2mqtt.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report := zigbee2mqtt.Import(do, cfg, *dryRun)
+
+	fmt.Fprintf(stdout, "Matched devices (%d):\n", len(report.Matched))
+
+	for _, device := range report.Matched {
+		fmt.Fprintf(stdout, "  %s %q: %s\n", device.IEEEAddress, device.FriendlyName, strings.Join(device.Identifiers, ", "))
+	}
+
+	fmt.Fprintf(stdout, "Unmatched devices (%d):\n", len(report.Unmatched))
+
+	for _, device := range report.Unmatched {
+		fmt.Fprintf(stdout, "  %s %q\n", device.IEEEAddress, device.FriendlyName)
+	}
+
+	fmt.Fprintf(stdout, "Zones (%d):\n", len(report.Zones))
+
+	for _, zone := range report.Zones {
+		action := "existing"
+
+		if zone.Created {
+			action = "created"
+		}
+
+		fmt.Fprintf(stdout, "  %q (%s): %d devices\n", zone.Name, action, len(zone.Devices))
+	}
+
+	if len(report.UnknownGroupMembers) > 0 {
+		fmt.Fprintf(stdout, "Unknown group members (%d):\n", len(report.UnknownGroupMembers))
+
+		for _, member := range report.UnknownGroupMembers {
+			fmt.Fprintf(stdout, "  %q: %s\n", member.Group, member.Member)
+		}
+	}
+
+	if len(report.Failures) > 0 {
+		fmt.Fprintf(stdout, "Failures (%d):\n", len(report.Failures))
+
+		for _, failure := range report.Failures {
+			fmt.Fprintf(stdout, "  device %q zone %q: %s\n", failure.Device, failure.Zone, failure.Error)
+		}
+	}
+
+	if *dryRun {
+		fmt.Fprintln(stdout, "Dry run only, no changes made.")
+	}
+
+	if len(report.Failures) > 0 {
+		return fmt.Errorf("%d changes could not be made", len(report.Failures))
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"github.com/shimmeringbee/controller/state"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_importZigbee2MQTTCommand(t *testing.T) {
+	t.Run("imports a zigbee2mqtt configuration and prints a report", func(t *testing.T) {
+		section := memory.New()
+		do := state.NewDeviceOrganiser(section.Section("Organiser"), state.NullEventPublisher)
+		do.AddDevice("00158d0001d82999-00")
+
+		configuration := filepath.Join(t.TempDir(), "configuration.yaml")
+		content := "devices:\n  '0x00158d0001d82999':\n    friendly_name: lamp\n    description: Lounge\n  '0x00158d0001d8ffff':\n    friendly_name: sensor\n"
+
+		if err := os.WriteFile(configuration, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		code := runCommand([]string{"zigbee2mqtt", "import", configuration}, section, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+
+		assert.Equal(t, `Matched devices (1):
+  0x00158d0001d82999 "lamp": 00158d0001d82999-00
+Unmatched devices (1):
+  0x00158d0001d8ffff "sensor"
+Zones (1):
+  "Lounge" (created): 1 devices
+`, stdout.String())
+
+		imported := state.NewDeviceOrganiser(section.Section("Organiser"), state.NullEventPublisher)
+		dm, _ := imported.Device("00158d0001d82999-00")
+		assert.Equal(t, "lamp", dm.Name)
+		assert.Len(t, dm.Zones, 1)
+	})
+}